@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// isTextDocument reports whether d is a plain text file, by its MIME type or, if Telegram doesn't know it, by the
+// extension of its name.
+func isTextDocument(d Document) bool {
+	if d.MimeType != "" {
+		return strings.HasPrefix(d.MimeType, "text/plain")
+	}
+	return strings.EqualFold(path.Ext(d.FileName), ".txt")
+}
+
+// parseBatch parses the content of a batch file into its queries: one per line, the keywords of each separated by
+// commas like in a text message. the blank lines are skipped.
+func parseBatch(content string) []string {
+	var queries []string
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			queries = append(queries, line)
+		}
+	}
+	return queries
+}
+
+// answerDocument searches the queries of the text file of update, see parseBatch, and answers with the first
+// BATCH_RESULTS_PER_QUERY movies of every query. the file is at most MAX_BATCH_FILE_SIZE bytes and MAX_BATCH_QUERIES
+// lines, and the other documents are rejected.
+func (b *Bot) answerDocument(ctx context.Context, update *Update) (string, error) {
+	chatID, document := update.Message.Chat.ID, update.Message.Document
+	if b.Limiter != nil && !b.Limiter.Allow(chatID) {
+		b.logger(ctx).Info("chat is rate limited", "update_id", update.UpdateID, "chat_id", chatID)
+		return b.sendMessage(ctx, chatID, b.text(ctx, SLOW_DOWN_TEXT))
+	}
+
+	if !isTextDocument(document) {
+		return b.sendMessage(ctx, chatID, b.text(ctx, NOT_TEXT_DOCUMENT_TEXT))
+	}
+	if document.FileSize > MAX_BATCH_FILE_SIZE {
+		return b.sendMessage(ctx, chatID, b.text(ctx, BATCH_TOO_LARGE_TEXT, MAX_BATCH_FILE_SIZE>>10))
+	}
+
+	content, err := b.downloadFile(ctx, document.FileID, MAX_BATCH_FILE_SIZE)
+	switch {
+	case errors.Is(err, ErrFileTooLarge):
+		return b.sendMessage(ctx, chatID, b.text(ctx, BATCH_TOO_LARGE_TEXT, MAX_BATCH_FILE_SIZE>>10))
+	case err != nil:
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		b.logger(ctx).Error("error downloading the batch file", "chat_id", chatID, "file_id", document.FileID, "error", err)
+		return b.sendMessage(ctx, chatID, b.text(ctx, BATCH_FAILED_TEXT))
+	case !utf8.Valid(content):
+		return b.sendMessage(ctx, chatID, b.text(ctx, NOT_TEXT_DOCUMENT_TEXT))
+	}
+
+	queries := parseBatch(string(content))
+	switch {
+	case len(queries) == 0:
+		return b.sendMessage(ctx, chatID, b.text(ctx, NO_KEYWORDS_TEXT))
+	case len(queries) > MAX_BATCH_QUERIES:
+		return b.sendMessage(ctx, chatID, b.text(ctx, TOO_MANY_QUERIES_TEXT, MAX_BATCH_QUERIES))
+	}
+
+	if b.SendTyping {
+		if body, err := b.sendChatAction(ctx, chatID, CHAT_ACTION_TYPING); err != nil {
+			b.logger(ctx).Error("error sending the typing action", "chat_id", chatID, "error", err, "response_body", body)
+		}
+	}
+
+	sections := make([]string, len(queries))
+	for i, query := range queries {
+		sections[i] = b.text(ctx, BATCH_QUERY_TEXT, query) + "\n" + strings.TrimRight(b.batchResults(ctx, query), "\n")
+	}
+
+	return b.sendReply(ctx, chatID, reply{text: strings.Join(sections, "\n\n")})
+}
+
+// batchResults returns the first BATCH_RESULTS_PER_QUERY movies matching the keywords of query, or a message telling
+// the user why there are none.
+func (b *Bot) batchResults(ctx context.Context, query string) string {
+	keywords := getKeywords(query)
+	if text, ok := b.checkKeywords(ctx, keywords); !ok {
+		return text
+	}
+
+	keywords, notice := b.trimKeywords(ctx, keywords)
+	movies, err := b.getMovies(ctx, keywords, b.defaultFilter())
+	return notice + b.limitedMoviesText(ctx, movies, err, BATCH_RESULTS_PER_QUERY)
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// documentUpdate returns the JSON of an update with the document of a private chat, as Telegram posts it.
+func documentUpdate(updateID, chatID int, fileName, mimeType string, fileSize int) string {
+	return fmt.Sprintf(`{"update_id": %d, "message": {"message_id": %d, "chat": {"id": %d, "type": "private"}, `+
+		`"document": {"file_id": "d", "file_name": %q, "mime_type": %q, "file_size": %d}}}`, updateID, updateID, chatID, fileName, mimeType, fileSize)
+}
+
+// serveFile makes telegram serve content as the file with the ID "d".
+func serveFile(telegram *telegramServer, content string) {
+	telegram.Respond(func(call telegramCall) (int, string) {
+		switch call.Method {
+		case TELEGRAM_API_GET_FILE:
+			return http.StatusOK, fmt.Sprintf(`{"ok":true,"result":{"file_id":"d","file_size":%d,"file_path":"documents/file_1.txt"}}`, len(content))
+		case "/file/bot" + TEST_BOT_TOKEN + "/documents/file_1.txt":
+			return http.StatusOK, content
+		}
+		return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+	})
+}
+
+func TestIsTextDocument(t *testing.T) {
+	tests := []struct {
+		document Document
+		want     bool
+	}{
+		{Document{FileName: "movies.txt", MimeType: "text/plain"}, true},
+		{Document{FileName: "movies", MimeType: "text/plain; charset=utf-8"}, true},
+		{Document{FileName: "MOVIES.TXT"}, true},
+		{Document{FileName: "movies.txt", MimeType: "application/pdf"}, false},
+		{Document{FileName: "movies.csv"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isTextDocument(tt.document); got != tt.want {
+			t.Errorf("isTextDocument(%v) = %t, want %t", tt.document, got, tt.want)
+		}
+	}
+}
+
+func TestParseBatch(t *testing.T) {
+	got := parseBatch("time travel, dystopia\r\n\n   \n  heist \n")
+	if want := []string{"time travel, dystopia", "heist"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBatch() = %q, want %q", got, want)
+	}
+}
+
+func TestDocumentBatch(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	source := &fakeSource{movies: map[string][]Movie{
+		"time travel,dystopia": {{Title: "12 Monkeys", Year: 1995, EndYear: 1995, Rating: 8}},
+		"heist":                {{Title: "Heat", Year: 1995, EndYear: 1995, Rating: 8.3}},
+	}}
+	bot.Source = source
+	serveFile(telegram, "time travel, dystopia\n\nheist\nnothing\n")
+
+	postUpdate(bot, documentUpdate(1, 7, "movies.txt", "text/plain", 36))
+
+	ctx := context.Background()
+	want := bot.text(ctx, BATCH_QUERY_TEXT, "time travel, dystopia") + "\n1. 12 Monkeys (1995) (8.0)\n\n" +
+		bot.text(ctx, BATCH_QUERY_TEXT, "heist") + "\n1. Heat (1995) (8.3)\n\n" +
+		bot.text(ctx, BATCH_QUERY_TEXT, "nothing") + "\n" + bot.text(ctx, NO_RESULTS_TEXT)
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 || sent[0] != want {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	if searches := source.Searches(); len(searches) != 3 {
+		t.Errorf("searched %q, want every line", searches)
+	}
+}
+
+func TestDocumentBatchRejected(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		fileName string
+		fileSize int
+		content  string
+		want     func(b *Bot) string
+	}{
+		{
+			name:     "too large",
+			fileName: "movies.txt",
+			fileSize: MAX_BATCH_FILE_SIZE + 1,
+			want:     func(b *Bot) string { return b.text(ctx, BATCH_TOO_LARGE_TEXT, MAX_BATCH_FILE_SIZE>>10) },
+		},
+		{
+			name:     "too many lines",
+			fileName: "movies.txt",
+			content:  strings.Repeat("heist\n", MAX_BATCH_QUERIES+1),
+			want:     func(b *Bot) string { return b.text(ctx, TOO_MANY_QUERIES_TEXT, MAX_BATCH_QUERIES) },
+		},
+		{
+			name:     "blank",
+			fileName: "movies.txt",
+			content:  "\n  \n",
+			want:     func(b *Bot) string { return b.text(ctx, NO_KEYWORDS_TEXT) },
+		},
+		{
+			name:     "binary",
+			fileName: "movies.txt",
+			content:  "\xff\xfeh\x00e\x00",
+			want:     func(b *Bot) string { return b.text(ctx, NOT_TEXT_DOCUMENT_TEXT) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, telegram, _ := newTestBot(t, nil)
+			source := &fakeSource{}
+			bot.Source = source
+			serveFile(telegram, tt.content)
+
+			postUpdate(bot, documentUpdate(1, 7, tt.fileName, "", tt.fileSize))
+
+			if sent, want := sentTexts(telegram.Calls()), tt.want(bot); len(sent) != 1 || sent[0] != want {
+				t.Errorf("sent %q, want %q", sent, want)
+			}
+			if searches := source.Searches(); len(searches) != 0 {
+				t.Errorf("searched %q from a rejected file", searches)
+			}
+		})
+	}
+}
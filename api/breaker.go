@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of searching while a CircuitBreaker is open. it wraps ErrScrapeFailed.
+var ErrCircuitOpen = fmt.Errorf("%w: the movie source is temporarily unavailable", ErrScrapeFailed)
+
+// CircuitBreaker stops the searches of a failing movie source for a while, so a source which is down isn't hammered
+// and the users don't wait for it to time out. it opens after threshold consecutive failures, and the searches fail
+// with ErrCircuitOpen for cooldown. then it half-opens: one search is let through to test the source, closing the
+// breaker if it succeeds and opening it again if it fails. it is safe for concurrent use.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+// NewCircuitBreaker returns a closed CircuitBreaker which opens after threshold consecutive failures, for cooldown.
+// threshold must be positive.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Do calls search unless the breaker is open, in which case it returns ErrCircuitOpen. the searches failing with
+// ErrScrapeFailed or ErrRateLimited are failures of the source. the others, e.g. finding no movies, aren't, and the
+// searches stopped because ctx is done aren't counted at all.
+func (cb *CircuitBreaker) Do(ctx context.Context, search func() error) error {
+	probe, ok := cb.allow()
+	if !ok {
+		return ErrCircuitOpen
+	}
+
+	err := search()
+	cb.record(ctx, probe, err)
+	return err
+}
+
+// allow reports whether a search can be made, and whether it is the one testing the source of a half-open breaker.
+func (cb *CircuitBreaker) allow() (probe, ok bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch {
+	case !cb.open:
+		return false, true
+	case cb.probing || cb.now().Sub(cb.openedAt) < cb.cooldown:
+		return false, false
+	}
+
+	cb.probing = true
+	return true, true
+}
+
+// record records the outcome of a search allowed by allow.
+func (cb *CircuitBreaker) record(ctx context.Context, probe bool, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if probe {
+		cb.probing = false
+	}
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// the source can't be blamed, and another search tests it instead.
+
+	case errors.Is(err, ErrScrapeFailed) || errors.Is(err, ErrRateLimited):
+		cb.failures++
+		if probe || cb.failures >= cb.threshold {
+			cb.open = true
+			cb.openedAt = cb.now()
+		}
+
+	case probe || !cb.open:
+		cb.failures = 0
+		cb.open = false
+	}
+}
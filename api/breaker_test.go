@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestBreaker returns a CircuitBreaker whose clock is the time returned, which the tests move forward themselves.
+func newTestBreaker(threshold int, cooldown time.Duration) (*CircuitBreaker, *time.Time) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := NewCircuitBreaker(threshold, cooldown)
+	cb.now = func() time.Time { return now }
+	return cb, &now
+}
+
+// searchFailing returns a search failing with err, counting its calls in calls.
+func searchFailing(err error, calls *int) func() error {
+	return func() error {
+		*calls++
+		return err
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	cb, _ := newTestBreaker(3, time.Minute)
+	ctx := context.Background()
+	failure := fmt.Errorf("%w: status code 503", ErrScrapeFailed)
+
+	var calls int
+	for _, err := range []error{failure, failure, nil, failure, ErrNoResults, failure, fmt.Errorf("%w: status code 429", ErrRateLimited)} {
+		if got := cb.Do(ctx, searchFailing(err, &calls)); got != err {
+			t.Fatalf("Do() = %v, want the error of the search %v", got, err)
+		}
+	}
+	if calls != 7 {
+		t.Fatalf("searched %d times, want the breaker closed while the failures aren't consecutive", calls)
+	}
+
+	if err := cb.Do(ctx, searchFailing(failure, &calls)); err != failure {
+		t.Fatalf("Do() of the third consecutive failure = %v, want %v", err, failure)
+	}
+	for i := 0; i < 3; i++ {
+		if err := cb.Do(ctx, searchFailing(nil, &calls)); !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrScrapeFailed) {
+			t.Errorf("Do() of an open breaker = %v, want %v", err, ErrCircuitOpen)
+		}
+	}
+	if calls != 8 {
+		t.Errorf("searched %d more times, want no search while the breaker is open", calls-8)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	cb, now := newTestBreaker(1, time.Minute)
+	ctx := context.Background()
+	failure := fmt.Errorf("%w: status code 503", ErrScrapeFailed)
+
+	var calls int
+	cb.Do(ctx, searchFailing(failure, &calls))
+	*now = now.Add(59 * time.Second)
+	if err := cb.Do(ctx, searchFailing(nil, &calls)); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Do() during the cooldown = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// the probe fails: the breaker opens again for another cooldown.
+	*now = now.Add(time.Second)
+	var during error
+	probe := func() error {
+		calls++
+		during = cb.Do(ctx, searchFailing(nil, &calls))
+		return failure
+	}
+	if err := cb.Do(ctx, probe); err != failure {
+		t.Fatalf("Do() of the probe = %v, want %v", err, failure)
+	}
+	if !errors.Is(during, ErrCircuitOpen) {
+		t.Errorf("Do() while probing = %v, want %v, a single search tests the source", during, ErrCircuitOpen)
+	}
+	*now = now.Add(59 * time.Second)
+	if err := cb.Do(ctx, searchFailing(nil, &calls)); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Do() after a failed probe = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// the probe succeeds: the breaker closes.
+	*now = now.Add(time.Second)
+	for i := 0; i < 3; i++ {
+		if err := cb.Do(ctx, searchFailing(nil, &calls)); err != nil {
+			t.Errorf("Do() after a successful probe = %v, want the breaker closed", err)
+		}
+	}
+	if calls != 5 {
+		t.Errorf("searched %d times, want the failure, the probes and the searches after them", calls)
+	}
+}
+
+func TestCircuitBreakerCanceledSearch(t *testing.T) {
+	cb, _ := newTestBreaker(1, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var calls int
+	cb.Do(ctx, searchFailing(fmt.Errorf("%w: %v", ErrScrapeFailed, context.Canceled), &calls))
+	if err := cb.Do(context.Background(), searchFailing(nil, &calls)); err != nil {
+		t.Errorf("Do() after a canceled search = %v, want the breaker closed", err)
+	}
+}
+
+func TestCircuitBreakerBot(t *testing.T) {
+	bot, telegram, imdb := newTestBot(t, fixtures{})
+	bot.Breaker = NewCircuitBreaker(2, time.Minute)
+	bot.Cache = nil
+
+	for i := 1; i <= 4; i++ {
+		postUpdate(bot, messageUpdate(i, 7, "dream"))
+	}
+
+	ctx := context.Background()
+	failed, unavailable := bot.text(ctx, SCRAPE_FAILED_TEXT), bot.text(ctx, SOURCE_UNAVAILABLE_TEXT)
+	if sent, want := sentTexts(telegram.Calls()), []string{failed, failed, unavailable, unavailable}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	if requests := imdb.Requests(); len(requests) != 2 {
+		t.Errorf("requested %q, want IMDB left alone once the breaker opens", requests)
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache stores the movies found by a search, so the same search doesn't hit the MovieSource again. implementations
+// must be safe for concurrent use.
+type Cache interface {
+	// Get returns the movies stored under key. ok is false if there are none. the movies are shared, so they must not
+	// be modified.
+	Get(key string) (movies []Movie, ok bool)
+
+	// Set stores movies under key.
+	Set(key string, movies []Movie)
+}
+
+// MemoryCache is a Cache which keeps the movies in memory for a limited time.
+type MemoryCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]cacheEntry
+	lastSweep time.Time
+}
+
+// cacheEntry is the movies stored in a MemoryCache and when they expire.
+type cacheEntry struct {
+	movies  []Movie
+	expires time.Time
+}
+
+// NewMemoryCache returns a MemoryCache which keeps the movies for ttl.
+func NewMemoryCache(ttl time.Duration) *MemoryCache {
+	return &MemoryCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// Get implements the Cache interface.
+func (c *MemoryCache) Get(key string) ([]Movie, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.movies, true
+}
+
+// Set implements the Cache interface. the expired entries are dropped at most once per ttl, so the searches nobody
+// makes anymore don't leak memory.
+func (c *MemoryCache) Set(key string, movies []Movie) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) >= c.ttl {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	c.entries[key] = cacheEntry{movies: movies, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCachedSearchVisitsOnce(t *testing.T) {
+	bot, _, fixture := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+	postUpdate(bot, messageUpdate(1, 7, "dream, heist"))
+	postUpdate(bot, messageUpdate(2, 8, "Heist,dream"))
+
+	if requests := fixture.Requests(); len(requests) != 1 {
+		t.Errorf("visited %q, want the second search cached", requests)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	cache := NewMemoryCache(20 * time.Millisecond)
+	movies := []Movie{{Title: "Inception", Year: 2010, EndYear: 2010}}
+
+	if _, ok := cache.Get("keywords:dream"); ok {
+		t.Fatal("Get() of an empty cache ok = true")
+	}
+
+	cache.Set("keywords:dream", movies)
+	if got, ok := cache.Get("keywords:dream"); !ok || !reflect.DeepEqual(got, movies) {
+		t.Errorf("Get() = %v, %t, want %v", got, ok, movies)
+	}
+	if _, ok := cache.Get("keywords:heist"); ok {
+		t.Error("Get() of another key ok = true")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := cache.Get("keywords:dream"); ok {
+		t.Error("Get() after the ttl ok = true, want the movies expired")
+	}
+
+	cache.Set("keywords:heist", movies)
+	if _, ok := cache.entries["keywords:dream"]; ok {
+		t.Error("Set() kept the expired entry")
+	}
+}
@@ -0,0 +1,470 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of a Bot, see NewHandlerFromConfig. LoadConfig reads it from the environment.
+type Config struct {
+	// Token is the token of the bot. it is required.
+	Token string
+
+	// Username is the username of the bot, see Bot.Username. a leading "@" is dropped.
+	Username string
+
+	// SecretToken secures the webhook, see Bot.SecretToken.
+	SecretToken string
+
+	// AllowedChats restricts the bot to the chats in it, see Bot.AllowedChats.
+	AllowedChats map[int]bool
+
+	// Preview turns the preview mode on, see Bot.Preview.
+	Preview bool
+
+	// AdminChatID is the chat the feedback of the users is forwarded to, see Bot.AdminChatID.
+	AdminChatID int
+
+	// Proxy is the URL of the proxy the requests of the bot go through, see Bot.SetProxy. empty doesn't use a proxy.
+	Proxy string
+
+	// Source names the MovieSource of the bot, MOVIE_SOURCE_IMDB or MOVIE_SOURCE_TMDB. TMDBAPIKey is required by the
+	// latter.
+	Source     string
+	TMDBAPIKey string
+
+	// RequestTimeout, MaxPages and Locale are the timeout of a request to IMDB, the number of result pages scraped
+	// and the locale of the results, see Scraper. they are ignored by the other sources.
+	RequestTimeout time.Duration
+	MaxPages       int
+	Locale         string
+
+	// ScrapeDelay, ScrapeRandomDelay, ScrapeParallelism and UserAgent are the Delay, RandomDelay, Parallelism and
+	// UserAgent of the Scraper. zero delays don't pause between the requests, unlike the ones of DefaultConfig.
+	ScrapeDelay       time.Duration
+	ScrapeRandomDelay time.Duration
+	ScrapeParallelism int
+	UserAgent         string
+
+	// MaxScrapes is the number of searches the bot runs at once, see Bot.Scrapes. every bot gets a limiter of its own,
+	// which the bots can share by setting their Scrapes to it. zero means DEFAULT_MAX_SCRAPES.
+	MaxScrapes int
+
+	// SendRate is the number of messages the bot sends per second, see Bot.Sends. every bot gets a queue of its own,
+	// which the bots of the same token can share by setting their Sends to it. zero means DEFAULT_SEND_RATE.
+	SendRate int
+
+	// RateLimit and RateBurst are the number of messages a chat can send to the bot per second on average, and at
+	// once, see Bot.Limiter. either of them being zero turns the rate limiting off.
+	RateLimit float64
+	RateBurst int
+
+	// PageSize, MaxResults and MinRating tune the results of the searches, see Bot.
+	PageSize       int
+	MaxResults     int
+	MinRating      float64
+	KeepDuplicates bool
+	SearchFallback bool
+
+	// SendPosters, ShowGenres, ShowPlots, PlotLength and SendTyping tune how the results are shown, see Bot.
+	SendPosters bool
+	ShowGenres  bool
+	ShowPlots   bool
+	PlotLength  int
+	SendTyping  bool
+
+	// LinkPreviews, Silent and Overflow tune how the messages of the bot are sent, see Bot.
+	LinkPreviews bool
+	Silent       bool
+	Overflow     OverflowMode
+
+	// Debounce is the time a text message waits for the next one of its chat, see Bot.Debounce.
+	Debounce time.Duration
+
+	// MaxRetries and RetryBaseDelay tune the retries of the Telegram API calls, see Bot.MaxRetries.
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+
+	// ParseMode is the formatting of the replies, see Bot.ParseMode.
+	ParseMode ParseMode
+
+	// ListStyle is how the movies of the lists are numbered, see Bot.ListStyle.
+	ListStyle ListStyle
+
+	// Fields are the fields of the movies shown in the lists, see Bot.Fields.
+	Fields Fields
+
+	// UpdateTimeout bounds the time an update is answered in, see Bot.UpdateTimeout.
+	UpdateTimeout time.Duration
+
+	// Quotes is which chats the answers quote the messages they answer in, see Bot.Quotes.
+	Quotes QuoteMode
+
+	// DedupFile is the file the handled updates are remembered in across restarts, see FileDedupStore. empty keeps
+	// them in memory.
+	DedupFile string
+}
+
+// DefaultConfig returns the Config used for the settings missing from the environment. it has no Token.
+func DefaultConfig() Config {
+	return Config{
+		Source:            MOVIE_SOURCE_IMDB,
+		Locale:            DEFAULT_LOCALE,
+		RequestTimeout:    DEFAULT_SCRAPE_TIMEOUT,
+		MaxPages:          DEFAULT_MAX_PAGES,
+		ScrapeDelay:       DEFAULT_SCRAPE_DELAY,
+		ScrapeRandomDelay: DEFAULT_SCRAPE_RANDOM_DELAY,
+		ScrapeParallelism: DEFAULT_SCRAPE_PARALLELISM,
+		UserAgent:         DEFAULT_USER_AGENT,
+		PageSize:          DEFAULT_PAGE_SIZE,
+		UpdateTimeout:     DEFAULT_UPDATE_TIMEOUT,
+		RateLimit:         DEFAULT_RATE_LIMIT,
+		RateBurst:         DEFAULT_RATE_BURST,
+	}
+}
+
+// LoadConfig reads a Config from the environment variables, e.g. TELEGRAM_BOT_TOKEN for the Token and MOVIE_SOURCE for
+// the Source, see the _ENV constants. the variables which aren't set keep the values of DefaultConfig. an error is
+// returned if a variable is malformed or the Config isn't valid, see Config.Validate.
+func LoadConfig() (Config, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadConfig is like LoadConfig, without validating the Config, so the missing settings can still be filled in.
+func loadConfig() (Config, error) {
+	cfg := DefaultConfig()
+	cfg.Token = os.Getenv(BOT_TOKEN_ENV)
+	cfg.Username = os.Getenv(BOT_USERNAME_ENV)
+	cfg.SecretToken = os.Getenv(SECRET_TOKEN_ENV)
+	cfg.Proxy = os.Getenv(PROXY_ENV)
+	cfg.TMDBAPIKey = os.Getenv(TMDB_API_KEY_ENV)
+	cfg.DedupFile = os.Getenv(DEDUP_FILE_ENV)
+	if locale := os.Getenv(LOCALE_ENV); locale != "" {
+		cfg.Locale = locale
+	}
+	if agent := os.Getenv(USER_AGENT_ENV); agent != "" {
+		cfg.UserAgent = agent
+	}
+	if name := os.Getenv(MOVIE_SOURCE_ENV); name != "" {
+		cfg.Source = name
+	}
+
+	var err error
+	if cfg.AllowedChats, err = parseChatIDs(os.Getenv(ALLOWED_CHATS_ENV)); err != nil {
+		return Config{}, fmt.Errorf("invalid %s: %w", ALLOWED_CHATS_ENV, err)
+	}
+
+	// a malformed value would silently fall back to the default, so it's an error instead.
+	bools := []struct {
+		env   string
+		value *bool
+	}{
+		{PREVIEW_ENV, &cfg.Preview},
+		{KEEP_DUPLICATES_ENV, &cfg.KeepDuplicates},
+		{SEARCH_FALLBACK_ENV, &cfg.SearchFallback},
+		{SEND_POSTERS_ENV, &cfg.SendPosters},
+		{SHOW_GENRES_ENV, &cfg.ShowGenres},
+		{SHOW_PLOTS_ENV, &cfg.ShowPlots},
+		{SEND_TYPING_ENV, &cfg.SendTyping},
+		{LINK_PREVIEWS_ENV, &cfg.LinkPreviews},
+		{SILENT_ENV, &cfg.Silent},
+	}
+	for _, b := range bools {
+		if value := os.Getenv(b.env); value != "" {
+			if *b.value, err = strconv.ParseBool(value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s %q: %w", b.env, value, err)
+			}
+		}
+	}
+
+	if value := os.Getenv(PARSE_MODE_ENV); value != "" {
+		if cfg.ParseMode, err = parseParseMode(value); err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", PARSE_MODE_ENV, err)
+		}
+	}
+
+	if value := os.Getenv(LIST_STYLE_ENV); value != "" {
+		cfg.ListStyle = ListStyle(strings.ToLower(value))
+	}
+
+	if value := os.Getenv(QUOTES_ENV); value != "" {
+		cfg.Quotes = QuoteMode(strings.ToLower(value))
+	}
+
+	if value := os.Getenv(OVERFLOW_ENV); value != "" {
+		cfg.Overflow = OverflowMode(strings.ToLower(value))
+	}
+
+	if value := os.Getenv(FIELDS_ENV); value != "" {
+		if cfg.Fields, err = parseFields(value); err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %w", FIELDS_ENV, err)
+		}
+	}
+
+	ints := []struct {
+		env   string
+		value *int
+	}{
+		{MAX_PAGES_ENV, &cfg.MaxPages},
+		{MAX_SCRAPES_ENV, &cfg.MaxScrapes},
+		{SEND_RATE_ENV, &cfg.SendRate},
+		{RATE_BURST_ENV, &cfg.RateBurst},
+		{PAGE_SIZE_ENV, &cfg.PageSize},
+		{MAX_RESULTS_ENV, &cfg.MaxResults},
+		{ADMIN_CHAT_ID_ENV, &cfg.AdminChatID},
+		{PLOT_LENGTH_ENV, &cfg.PlotLength},
+		{MAX_RETRIES_ENV, &cfg.MaxRetries},
+		{SCRAPE_PARALLELISM_ENV, &cfg.ScrapeParallelism},
+	}
+	for _, i := range ints {
+		if value := os.Getenv(i.env); value != "" {
+			if *i.value, err = strconv.Atoi(value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s %q: %w", i.env, value, err)
+			}
+		}
+	}
+
+	durations := []struct {
+		env   string
+		value *time.Duration
+	}{
+		{REQUEST_TIMEOUT_ENV, &cfg.RequestTimeout},
+		{UPDATE_TIMEOUT_ENV, &cfg.UpdateTimeout},
+		{DEBOUNCE_ENV, &cfg.Debounce},
+		{RETRY_BASE_DELAY_ENV, &cfg.RetryBaseDelay},
+		{SCRAPE_DELAY_ENV, &cfg.ScrapeDelay},
+		{SCRAPE_RANDOM_DELAY_ENV, &cfg.ScrapeRandomDelay},
+	}
+	for _, d := range durations {
+		if value := os.Getenv(d.env); value != "" {
+			if *d.value, err = time.ParseDuration(value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s %q: %w", d.env, value, err)
+			}
+		}
+	}
+
+	floats := []struct {
+		env   string
+		value *float64
+	}{
+		{MIN_RATING_ENV, &cfg.MinRating},
+		{RATE_LIMIT_ENV, &cfg.RateLimit},
+	}
+	for _, f := range floats {
+		if value := os.Getenv(f.env); value != "" {
+			if *f.value, err = strconv.ParseFloat(value, 64); err != nil {
+				return Config{}, fmt.Errorf("invalid %s %q: %w", f.env, value, err)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// parseParseMode parses the name of a ParseMode, case insensitively: "MarkdownV2", "HTML", or "none" for plain text.
+func parseParseMode(name string) (ParseMode, error) {
+	for _, mode := range []ParseMode{PARSE_MODE_MARKDOWN_V2, PARSE_MODE_HTML} {
+		if strings.EqualFold(name, string(mode)) {
+			return mode, nil
+		}
+	}
+	if name == "" || strings.EqualFold(name, "none") {
+		return PARSE_MODE_NONE, nil
+	}
+	return "", fmt.Errorf("unknown parse mode %q. expected %q, %q or %q", name, PARSE_MODE_MARKDOWN_V2, PARSE_MODE_HTML, "none")
+}
+
+// Validate reports the first setting of the Config which isn't valid, e.g. a missing Token or a negative MaxPages.
+func (cfg Config) Validate() error {
+	if cfg.Token == "" {
+		return errors.New("empty bot token. pass a token or set the " + BOT_TOKEN_ENV + " environment variable")
+	}
+
+	switch cfg.Source {
+	case "", MOVIE_SOURCE_IMDB:
+	case MOVIE_SOURCE_TMDB:
+		if cfg.TMDBAPIKey == "" {
+			return errors.New("empty TMDB API key. set the " + TMDB_API_KEY_ENV + " environment variable")
+		}
+	default:
+		return fmt.Errorf("unknown movie source %q. set %s to %q or %q", cfg.Source, MOVIE_SOURCE_ENV, MOVIE_SOURCE_IMDB, MOVIE_SOURCE_TMDB)
+	}
+
+	if cfg.Locale != "" && !isLocale(cfg.Locale) {
+		return fmt.Errorf("unsupported locale %q. expected one of %s", cfg.Locale, strings.Join(locales, ", "))
+	}
+
+	if _, err := parseParseMode(string(cfg.ParseMode)); err != nil {
+		return err
+	}
+
+	switch cfg.ListStyle {
+	case LIST_STYLE_NUMBERED, LIST_STYLE_RANKED:
+	default:
+		return fmt.Errorf("unknown list style %q. expected %q or an empty one", cfg.ListStyle, LIST_STYLE_RANKED)
+	}
+
+	switch cfg.Quotes {
+	case QUOTE_GROUPS, QUOTE_ALWAYS, QUOTE_NEVER:
+	default:
+		return fmt.Errorf("unknown quote mode %q. expected %q, %q or an empty one", cfg.Quotes, QUOTE_ALWAYS, QUOTE_NEVER)
+	}
+
+	switch cfg.Overflow {
+	case OVERFLOW_SPLIT, OVERFLOW_TRUNCATE:
+	default:
+		return fmt.Errorf("unknown overflow mode %q. expected %q or an empty one", cfg.Overflow, OVERFLOW_TRUNCATE)
+	}
+
+	if cfg.Proxy != "" {
+		if _, err := parseProxyURL(cfg.Proxy); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case cfg.RequestTimeout < 0:
+		return fmt.Errorf("invalid request timeout %s. it can't be negative", cfg.RequestTimeout)
+	case cfg.UpdateTimeout < 0:
+		return fmt.Errorf("invalid update timeout %s. it can't be negative", cfg.UpdateTimeout)
+	case cfg.MaxPages < 0:
+		return fmt.Errorf("invalid max pages %d. it can't be negative", cfg.MaxPages)
+	case cfg.ScrapeDelay < 0:
+		return fmt.Errorf("invalid scrape delay %s. it can't be negative", cfg.ScrapeDelay)
+	case cfg.ScrapeRandomDelay < 0:
+		return fmt.Errorf("invalid scrape random delay %s. it can't be negative", cfg.ScrapeRandomDelay)
+	case cfg.ScrapeParallelism < 0:
+		return fmt.Errorf("invalid scrape parallelism %d. it can't be negative", cfg.ScrapeParallelism)
+	case cfg.MaxScrapes < 0:
+		return fmt.Errorf("invalid max scrapes %d. it can't be negative", cfg.MaxScrapes)
+	case cfg.SendRate < 0:
+		return fmt.Errorf("invalid send rate %d. it can't be negative", cfg.SendRate)
+	case cfg.RateLimit < 0:
+		return fmt.Errorf("invalid rate limit %v. it can't be negative", cfg.RateLimit)
+	case cfg.RateBurst < 0:
+		return fmt.Errorf("invalid rate burst %d. it can't be negative", cfg.RateBurst)
+	case cfg.PageSize < 0:
+		return fmt.Errorf("invalid page size %d. it can't be negative", cfg.PageSize)
+	case cfg.MaxResults < 0:
+		return fmt.Errorf("invalid max results %d. it can't be negative", cfg.MaxResults)
+	case cfg.MinRating < 0 || cfg.MinRating > 10:
+		return fmt.Errorf("invalid min rating %v. expected a rating from 0 to 10", cfg.MinRating)
+	case cfg.PlotLength < 0:
+		return fmt.Errorf("invalid plot length %d. it can't be negative", cfg.PlotLength)
+	case cfg.Debounce < 0:
+		return fmt.Errorf("invalid debounce %s. it can't be negative", cfg.Debounce)
+	case cfg.RetryBaseDelay < 0:
+		return fmt.Errorf("invalid retry base delay %s. it can't be negative", cfg.RetryBaseDelay)
+	}
+
+	return nil
+}
+
+// NewHandlerFromConfig returns a Bot with the settings of cfg, once it is validated. the stores, the cache and the
+// limiters of the bot are kept in memory, with the default sizes, except the handled updates if cfg has a DedupFile.
+func NewHandlerFromConfig(cfg Config) (*Bot, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var source MovieSource
+	switch cfg.Source {
+	case MOVIE_SOURCE_TMDB:
+		source = NewTMDBSource(cfg.TMDBAPIKey)
+	default:
+		scraper := NewScraper()
+		scraper.RequestTimeout = cfg.RequestTimeout
+		scraper.MaxPages = cfg.MaxPages
+		scraper.Locale = cfg.Locale
+		scraper.Delay = cfg.ScrapeDelay
+		scraper.RandomDelay = cfg.ScrapeRandomDelay
+		scraper.Parallelism = cfg.ScrapeParallelism
+		scraper.UserAgent = cfg.UserAgent
+		source = scraper
+	}
+
+	maxScrapes := cfg.MaxScrapes
+	if maxScrapes == 0 {
+		maxScrapes = DEFAULT_MAX_SCRAPES
+	}
+	sendRate := cfg.SendRate
+	if sendRate == 0 {
+		sendRate = DEFAULT_SEND_RATE
+	}
+
+	var limiter *RateLimiter
+	if cfg.RateLimit > 0 && cfg.RateBurst > 0 {
+		limiter = NewRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+
+	var dedup DedupStore = NewMemoryDedupStore(DEFAULT_DEDUP_SIZE, DEFAULT_DEDUP_TTL)
+	if cfg.DedupFile != "" {
+		store, err := OpenFileDedupStore(cfg.DedupFile, DEFAULT_DEDUP_SIZE, DEFAULT_DEDUP_TTL)
+		if err != nil {
+			return nil, err
+		}
+		dedup = store
+	}
+
+	bot := &Bot{
+		Source:         source,
+		Username:       strings.TrimPrefix(cfg.Username, "@"),
+		SecretToken:    cfg.SecretToken,
+		AllowedChats:   cfg.AllowedChats,
+		AdminChatID:    cfg.AdminChatID,
+		PageSize:       cfg.PageSize,
+		MaxResults:     cfg.MaxResults,
+		MinRating:      cfg.MinRating,
+		ParseMode:      cfg.ParseMode,
+		ListStyle:      cfg.ListStyle,
+		Quotes:         cfg.Quotes,
+		Fields:         cfg.Fields,
+		UpdateTimeout:  cfg.UpdateTimeout,
+		Cache:          NewMemoryCache(DEFAULT_CACHE_TTL),
+		Breaker:        NewCircuitBreaker(DEFAULT_BREAKER_THRESHOLD, DEFAULT_BREAKER_COOLDOWN),
+		Scrapes:        NewScrapeLimiter(maxScrapes, DEFAULT_SCRAPE_WAIT),
+		Sends:          NewSendQueue(sendRate),
+		Limiter:        limiter,
+		Dedup:          dedup,
+		History:        NewMemoryHistoryStore(DEFAULT_HISTORY_SIZE),
+		Favorites:      NewMemoryFavoritesStore(DEFAULT_MAX_FAVORITES),
+		Preferences:    NewMemoryPreferencesStore(),
+		Rand:           rand.New(rand.NewSource(time.Now().UnixNano())),
+		Preview:        cfg.Preview,
+		KeepDuplicates: cfg.KeepDuplicates,
+		SearchFallback: cfg.SearchFallback,
+		SendPosters:    cfg.SendPosters,
+		ShowGenres:     cfg.ShowGenres,
+		ShowPlots:      cfg.ShowPlots,
+		PlotLength:     cfg.PlotLength,
+		SendTyping:     cfg.SendTyping,
+		LinkPreviews:   cfg.LinkPreviews,
+		Silent:         cfg.Silent,
+		Overflow:       cfg.Overflow,
+		Debounce:       cfg.Debounce,
+		MaxRetries:     cfg.MaxRetries,
+		RetryBaseDelay: cfg.RetryBaseDelay,
+		token:          cfg.Token,
+	}
+
+	if cfg.Proxy != "" {
+		if err := bot.SetProxy(cfg.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	return bot, nil
+}
@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// configEnvs are the environment variables LoadConfig reads.
+var configEnvs = []string{
+	BOT_TOKEN_ENV, BOT_USERNAME_ENV, PREVIEW_ENV, ALLOWED_CHATS_ENV, SECRET_TOKEN_ENV, PROXY_ENV, MAX_SCRAPES_ENV,
+	SEND_RATE_ENV, RATE_LIMIT_ENV, RATE_BURST_ENV, REQUEST_TIMEOUT_ENV, MAX_PAGES_ENV, MAX_RESULTS_ENV, PAGE_SIZE_ENV,
+	MIN_RATING_ENV, PARSE_MODE_ENV, LIST_STYLE_ENV, ADMIN_CHAT_ID_ENV, FIELDS_ENV, LOCALE_ENV, DEDUP_FILE_ENV,
+	QUOTES_ENV, UPDATE_TIMEOUT_ENV, SEND_POSTERS_ENV, SHOW_GENRES_ENV, SHOW_PLOTS_ENV, PLOT_LENGTH_ENV, SEND_TYPING_ENV,
+	KEEP_DUPLICATES_ENV, SEARCH_FALLBACK_ENV, LINK_PREVIEWS_ENV, SILENT_ENV, OVERFLOW_ENV, DEBOUNCE_ENV, MAX_RETRIES_ENV,
+	RETRY_BASE_DELAY_ENV, SCRAPE_DELAY_ENV, SCRAPE_RANDOM_DELAY_ENV, SCRAPE_PARALLELISM_ENV, USER_AGENT_ENV,
+	TMDB_API_KEY_ENV, MOVIE_SOURCE_ENV,
+}
+
+// clearConfigEnv unsets the configEnvs for the test, so the environment it runs in doesn't change the Config loaded.
+func clearConfigEnv(t *testing.T) {
+	for _, env := range configEnvs {
+		t.Setenv(env, "")
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	clearConfigEnv(t)
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() without a token error = nil")
+	}
+
+	t.Setenv(BOT_TOKEN_ENV, TEST_BOT_TOKEN)
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	want := DefaultConfig()
+	want.Token = TEST_BOT_TOKEN
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("LoadConfig() = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	clearConfigEnv(t)
+	for env, value := range map[string]string{
+		BOT_TOKEN_ENV:          TEST_BOT_TOKEN,
+		BOT_USERNAME_ENV:       "@gmtm_bot",
+		ALLOWED_CHATS_ENV:      "7,-100",
+		REQUEST_TIMEOUT_ENV:    "3s",
+		MAX_PAGES_ENV:          "4",
+		MAX_RESULTS_ENV:        "15",
+		PAGE_SIZE_ENV:          "5",
+		MIN_RATING_ENV:         "6.5",
+		PARSE_MODE_ENV:         "html",
+		LIST_STYLE_ENV:         "Ranked",
+		FIELDS_ENV:             "year,rating",
+		LOCALE_ENV:             "de-DE",
+		QUOTES_ENV:             "always",
+		ADMIN_CHAT_ID_ENV:      "42",
+		SHOW_PLOTS_ENV:         "true",
+		PLOT_LENGTH_ENV:        "80",
+		SILENT_ENV:             "1",
+		OVERFLOW_ENV:           "Truncate",
+		DEBOUNCE_ENV:           "2s",
+		MAX_RETRIES_ENV:        "-1",
+		SCRAPE_DELAY_ENV:       "0",
+		SCRAPE_PARALLELISM_ENV: "4",
+		USER_AGENT_ENV:         "gmtm-test",
+	} {
+		t.Setenv(env, value)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	want := DefaultConfig()
+	want.Token, want.Username = TEST_BOT_TOKEN, "@gmtm_bot"
+	want.AllowedChats = map[int]bool{7: true, -100: true}
+	want.RequestTimeout, want.MaxPages, want.MaxResults, want.PageSize, want.MinRating = 3*time.Second, 4, 15, 5, 6.5
+	want.ParseMode, want.ListStyle, want.Quotes = PARSE_MODE_HTML, LIST_STYLE_RANKED, QUOTE_ALWAYS
+	want.Fields = FIELD_TITLE | FIELD_YEAR | FIELD_RATING
+	want.Locale, want.AdminChatID = "de-DE", 42
+	want.ShowPlots, want.PlotLength, want.Silent, want.Overflow = true, 80, true, OVERFLOW_TRUNCATE
+	want.Debounce, want.MaxRetries = 2*time.Second, -1
+	want.ScrapeDelay, want.ScrapeParallelism, want.UserAgent = 0, 4, "gmtm-test"
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("LoadConfig() = %+v, want %+v", cfg, want)
+	}
+
+	bot, err := NewHandlerFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewHandlerFromConfig() error = %v", err)
+	}
+	scraper, ok := bot.Source.(*Scraper)
+	if !ok || scraper.RequestTimeout != 3*time.Second || scraper.MaxPages != 4 || scraper.Locale != "de-DE" {
+		t.Errorf("NewHandlerFromConfig() source = %+v, want a scraper with the timeout, pages and locale of the config", bot.Source)
+	}
+	if ok && (scraper.Delay != 0 || scraper.RandomDelay != DEFAULT_SCRAPE_RANDOM_DELAY || scraper.Parallelism != 4 || scraper.UserAgent != "gmtm-test") {
+		t.Errorf("NewHandlerFromConfig() source = %+v, want a scraper with the delays, parallelism and user agent of the config", bot.Source)
+	}
+	if bot.Username != "gmtm_bot" || bot.MaxResults != 15 || bot.PageSize != 5 || bot.MinRating != 6.5 || bot.ParseMode != PARSE_MODE_HTML || bot.AdminChatID != 42 {
+		t.Errorf("NewHandlerFromConfig() = %+v, want the settings of the config", bot)
+	}
+	if !bot.ShowPlots || bot.PlotLength != 80 || !bot.Silent || bot.Overflow != OVERFLOW_TRUNCATE || bot.Debounce != 2*time.Second || bot.MaxRetries != -1 {
+		t.Errorf("NewHandlerFromConfig() = %+v, want the display, sending and retry settings of the config", bot)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct{ env, value string }{
+		{MAX_PAGES_ENV, "many"},
+		{MAX_PAGES_ENV, "-1"},
+		{MIN_RATING_ENV, "11"},
+		{MIN_RATING_ENV, "high"},
+		{REQUEST_TIMEOUT_ENV, "3"},
+		{PARSE_MODE_ENV, "markdown"},
+		{LIST_STYLE_ENV, "bullets"},
+		{QUOTES_ENV, "sometimes"},
+		{FIELDS_ENV, "title,budget"},
+		{LOCALE_ENV, "xx-XX"},
+		{PREVIEW_ENV, "maybe"},
+		{SEND_POSTERS_ENV, "sometimes"},
+		{OVERFLOW_ENV, "drop"},
+		{PLOT_LENGTH_ENV, "-5"},
+		{DEBOUNCE_ENV, "-1s"},
+		{RETRY_BASE_DELAY_ENV, "soon"},
+		{SCRAPE_DELAY_ENV, "-1s"},
+		{SCRAPE_PARALLELISM_ENV, "-2"},
+		{ALLOWED_CHATS_ENV, "7,me"},
+		{MOVIE_SOURCE_ENV, "netflix"},
+		{MOVIE_SOURCE_ENV, MOVIE_SOURCE_TMDB},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env+"="+tt.value, func(t *testing.T) {
+			clearConfigEnv(t)
+			t.Setenv(BOT_TOKEN_ENV, TEST_BOT_TOKEN)
+			t.Setenv(tt.env, tt.value)
+
+			if _, err := LoadConfig(); err == nil {
+				t.Error("LoadConfig() error = nil")
+			}
+		})
+	}
+}
+
+func TestNewHandlerFromConfigDedupFile(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Token = TEST_BOT_TOKEN
+	cfg.DedupFile = filepath.Join(t.TempDir(), "dedup")
+
+	bot, err := NewHandlerFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewHandlerFromConfig() error = %v", err)
+	}
+	store, ok := bot.Dedup.(*FileDedupStore)
+	if !ok {
+		t.Fatalf("Dedup = %T, want a *FileDedupStore", bot.Dedup)
+	}
+	store.Seen(9)
+	store.Close()
+
+	restarted, err := NewHandlerFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewHandlerFromConfig() after a restart error = %v", err)
+	}
+	defer restarted.Dedup.(*FileDedupStore).Close()
+	if seen, _ := restarted.Dedup.Seen(9); !seen {
+		t.Error("Seen(9) = false after a restart, want the update remembered")
+	}
+}
+
+func TestLoadConfigSendRate(t *testing.T) {
+	tests := []struct {
+		value        string
+		wantInterval time.Duration
+		wantErr      bool
+	}{
+		{"", time.Second / DEFAULT_SEND_RATE, false},
+		{"5", 200 * time.Millisecond, false},
+		{"-1", 0, true},
+		{"fast", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			clearConfigEnv(t)
+			t.Setenv(BOT_TOKEN_ENV, TEST_BOT_TOKEN)
+			t.Setenv(SEND_RATE_ENV, tt.value)
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("LoadConfig() of the send rate %q error = nil", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+
+			bot, err := NewHandlerFromConfig(cfg)
+			if err != nil {
+				t.Fatalf("NewHandlerFromConfig() error = %v", err)
+			}
+			if bot.Sends == nil || bot.Sends.interval != tt.wantInterval {
+				t.Errorf("Sends = %+v, want one sending every %v", bot.Sends, tt.wantInterval)
+			}
+		})
+	}
+}
+
+func TestLoadConfigUpdateTimeout(t *testing.T) {
+	t.Setenv(BOT_TOKEN_ENV, TEST_BOT_TOKEN)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.UpdateTimeout != DEFAULT_UPDATE_TIMEOUT {
+		t.Errorf("UpdateTimeout = %v, want the default %v", cfg.UpdateTimeout, DEFAULT_UPDATE_TIMEOUT)
+	}
+
+	t.Setenv(UPDATE_TIMEOUT_ENV, "10s")
+	if cfg, err = LoadConfig(); err != nil || cfg.UpdateTimeout != 10*time.Second {
+		t.Errorf("LoadConfig() = %v, %v, want an update timeout of 10s", cfg.UpdateTimeout, err)
+	}
+
+	t.Setenv(UPDATE_TIMEOUT_ENV, "-1s")
+	if _, err = LoadConfig(); err == nil {
+		t.Error("LoadConfig() of a negative update timeout error = nil")
+	}
+}
+
+func TestNewHandlerFromConfigOwnLimits(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Token = TEST_BOT_TOKEN
+
+	first, err := NewHandlerFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewHandlerFromConfig() error = %v", err)
+	}
+	second, err := NewHandlerFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewHandlerFromConfig() error = %v", err)
+	}
+
+	if first.Scrapes == nil || first.Scrapes == second.Scrapes {
+		t.Error("the bots share a scrape limiter, want one each")
+	}
+	if first.Sends == nil || first.Sends == second.Sends {
+		t.Error("the bots share a send queue, want one each")
+	}
+}
+
+func TestLoadConfigRateLimit(t *testing.T) {
+	t.Setenv(BOT_TOKEN_ENV, TEST_BOT_TOKEN)
+	t.Setenv(RATE_LIMIT_ENV, "2.5")
+	t.Setenv(RATE_BURST_ENV, "5")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.RateLimit != 2.5 || cfg.RateBurst != 5 {
+		t.Errorf("rate limit %v, burst %d, want 2.5 and 5", cfg.RateLimit, cfg.RateBurst)
+	}
+
+	bot, err := NewHandlerFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewHandlerFromConfig() error = %v", err)
+	}
+	if bot.Limiter == nil || bot.Limiter.rate != 2.5 || bot.Limiter.burst != 5 {
+		t.Errorf("Limiter = %+v, want a rate of 2.5 and a burst of 5", bot.Limiter)
+	}
+}
+
+func TestNewHandlerFromConfigRateLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		rate        float64
+		burst       int
+		wantLimiter bool
+		wantErr     bool
+	}{
+		{name: "default", rate: DEFAULT_RATE_LIMIT, burst: DEFAULT_RATE_BURST, wantLimiter: true},
+		{name: "zero rate", rate: 0, burst: DEFAULT_RATE_BURST},
+		{name: "zero burst", rate: DEFAULT_RATE_LIMIT, burst: 0},
+		{name: "negative rate", rate: -1, burst: DEFAULT_RATE_BURST, wantErr: true},
+		{name: "negative burst", rate: DEFAULT_RATE_LIMIT, burst: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Token = TEST_BOT_TOKEN
+			cfg.RateLimit, cfg.RateBurst = tt.rate, tt.burst
+
+			bot, err := NewHandlerFromConfig(cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewHandlerFromConfig() error = nil, want an invalid config")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewHandlerFromConfig() error = %v", err)
+			}
+			if got := bot.Limiter != nil; got != tt.wantLimiter {
+				t.Errorf("limited = %v, want %v", got, tt.wantLimiter)
+			}
+		})
+	}
+}
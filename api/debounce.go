@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// debouncer coalesces the messages a chat sends in quick succession, so only the latest of them is answered. its zero
+// value is ready to use, and it is safe for concurrent use, since webhooks arrive concurrently.
+type debouncer struct {
+	mu      sync.Mutex
+	pending map[int]*debounced
+}
+
+// debounced is the latest message of a chat, answered with ctx unless a later message supersedes it first.
+type debounced struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// debounce waits for window and reports whether the chat sent no later message meanwhile. the later messages cancel
+// the context returned, even once this message is being answered, so the answers of the superseded messages stop.
+// done must be called once the message is answered. it returns false as well if ctx is done before window passes.
+func (d *debouncer) debounce(ctx context.Context, chatID int, window time.Duration) (debouncedCtx context.Context, done func(), ok bool) {
+	entry := &debounced{}
+	entry.ctx, entry.cancel = context.WithCancel(ctx)
+
+	d.mu.Lock()
+	if d.pending == nil {
+		d.pending = make(map[int]*debounced)
+	}
+	if previous := d.pending[chatID]; previous != nil {
+		previous.cancel()
+	}
+	d.pending[chatID] = entry
+	d.mu.Unlock()
+
+	done = func() {
+		d.mu.Lock()
+		if d.pending[chatID] == entry {
+			delete(d.pending, chatID)
+		}
+		d.mu.Unlock()
+		entry.cancel()
+	}
+
+	wait(entry.ctx, window)
+	if entry.ctx.Err() != nil {
+		done()
+		return nil, nil, false
+	}
+	return entry.ctx, done, true
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// postRapidly posts the text messages to the chat one after the other, each one pause after the previous one without
+// waiting for it to be answered, and returns the status codes of the responses once all of them are answered.
+func postRapidly(bot *Bot, chatID int, pause time.Duration, texts ...string) []int {
+	codes := make([]int, len(texts))
+	var wg sync.WaitGroup
+	for i, text := range texts {
+		wg.Add(1)
+		go func(i int, text string) {
+			defer wg.Done()
+			codes[i] = postUpdate(bot, messageUpdate(i+1, chatID, text)).Code
+		}(i, text)
+		time.Sleep(pause)
+	}
+	wg.Wait()
+	return codes
+}
+
+func TestDebounce(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	source := &fakeSource{movies: map[string][]Movie{"dream,heist": {{Title: "Inception", Year: 2010, EndYear: 2010}}}}
+	bot.Source = source
+	bot.Debounce = 100 * time.Millisecond
+
+	codes := postRapidly(bot, 7, 10*time.Millisecond, "dream", "dream,hei", "dream,heist")
+
+	if want := []int{http.StatusOK, http.StatusOK, http.StatusOK}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("statuses = %v, want %v", codes, want)
+	}
+	if searches := source.Searches(); !reflect.DeepEqual(searches, [][]string{{"dream", "heist"}}) {
+		t.Errorf("searched %q, want the latest message only", searches)
+	}
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 || sent[0] != "1. Inception (2010)\n" {
+		t.Errorf("sent %q, want a single answer", sent)
+	}
+}
+
+func TestDebounceChats(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.Source = &fakeSource{movies: map[string][]Movie{"dream": {{Title: "Inception", Year: 2010, EndYear: 2010}}}}
+	bot.Debounce = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	for _, chatID := range []int{7, 8} {
+		wg.Add(1)
+		go func(chatID int) {
+			defer wg.Done()
+			postUpdate(bot, messageUpdate(chatID, chatID, "dream"))
+		}(chatID)
+	}
+	wg.Wait()
+
+	if sent := sentTexts(telegram.Calls()); len(sent) != 2 {
+		t.Errorf("sent %q, want both chats answered", sent)
+	}
+
+	// without a window, the messages of a chat are all answered.
+	bot.Debounce = 0
+	postRapidly(bot, 9, 0, "dream", "dream")
+	if sent := sentTexts(telegram.Calls()); len(sent) != 4 {
+		t.Errorf("sent %q, want every message answered without debouncing", sent)
+	}
+}
+
+// stallingSource is a MovieSource whose searches of "slow" take until the context is done, and which finds nothing
+// else searched. it closes started once a slow search is running.
+type stallingSource struct {
+	MovieSource
+	started chan struct{}
+
+	mu       sync.Mutex
+	searches []string
+}
+
+// Search implements the MovieSource interface.
+func (s *stallingSource) Search(ctx context.Context, keywords []string) ([]Movie, error) {
+	s.mu.Lock()
+	s.searches = append(s.searches, keywords[0])
+	s.mu.Unlock()
+
+	if keywords[0] != "slow" {
+		return []Movie{{Title: "Inception", Year: 2010, EndYear: 2010}}, nil
+	}
+	close(s.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestDebounceCancelsSupersededAnswer(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	source := &stallingSource{started: make(chan struct{})}
+	bot.Source = source
+	bot.Debounce = 10 * time.Millisecond
+
+	slow := make(chan int)
+	go func() {
+		slow <- postUpdate(bot, messageUpdate(1, 7, "slow")).Code
+	}()
+
+	select {
+	case <-source.started:
+	case <-time.After(time.Second):
+		t.Fatal("the first message wasn't searched")
+	}
+	if code := postUpdate(bot, messageUpdate(2, 7, "dream")).Code; code != http.StatusOK {
+		t.Errorf("status of the latest message = %d, want %d", code, http.StatusOK)
+	}
+
+	select {
+	case code := <-slow:
+		if code != http.StatusOK {
+			t.Errorf("status of the superseded message = %d, want %d", code, http.StatusOK)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the superseded message is still being answered")
+	}
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 || sent[0] != "1. Inception (2010)\n" {
+		t.Errorf("sent %q, want the latest message answered only", sent)
+	}
+}
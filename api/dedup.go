@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// DedupStore remembers the IDs of the updates a Bot has handled, so an update Telegram delivers again is ignored.
+// implementations must be safe for concurrent use, since webhooks arrive concurrently.
+type DedupStore interface {
+	// Seen records updateID and reports whether it was recorded before.
+	Seen(updateID int) (bool, error)
+
+	// Forget forgets updateID, recorded by Seen for an update which couldn't be answered, so the update is answered
+	// when Telegram delivers it again.
+	Forget(updateID int) error
+}
+
+// MemoryDedupStore is a DedupStore which keeps a bounded number of update IDs in memory, each for a limited time.
+type MemoryDedupStore struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	seen  map[int]time.Time
+	order []int
+}
+
+// NewMemoryDedupStore returns a MemoryDedupStore which remembers at most size update IDs for ttl each. the oldest IDs
+// are forgotten first once the store is full. a size of zero or less doesn't bound the store.
+func NewMemoryDedupStore(size int, ttl time.Duration) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		size: size,
+		ttl:  ttl,
+		seen: make(map[int]time.Time),
+	}
+}
+
+// Seen implements the DedupStore interface.
+func (s *MemoryDedupStore) Seen(updateID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.seenAt(updateID, time.Now()), nil
+}
+
+// seenAt records updateID as handled at now and reports whether it was recorded before. s.mu must be held.
+func (s *MemoryDedupStore) seenAt(updateID int, now time.Time) bool {
+	s.expire(now)
+
+	if _, ok := s.seen[updateID]; ok {
+		return true
+	}
+
+	if s.size > 0 && len(s.order) >= s.size {
+		delete(s.seen, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	s.seen[updateID] = now
+	s.order = append(s.order, updateID)
+
+	return false
+}
+
+// Forget implements the DedupStore interface.
+func (s *MemoryDedupStore) Forget(updateID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.forget(updateID)
+	return nil
+}
+
+// forget forgets updateID. s.mu must be held.
+func (s *MemoryDedupStore) forget(updateID int) {
+	if _, ok := s.seen[updateID]; !ok {
+		return
+	}
+	delete(s.seen, updateID)
+	for i, id := range s.order {
+		if id == updateID {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// expire forgets the update IDs recorded more than ttl before now. order is sorted by time, so it stops at the first
+// ID which is still fresh.
+func (s *MemoryDedupStore) expire(now time.Time) {
+	for len(s.order) > 0 && now.Sub(s.seen[s.order[0]]) > s.ttl {
+		delete(s.seen, s.order[0])
+		s.order = s.order[1:]
+	}
+}
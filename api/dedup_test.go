@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryDedupStore(t *testing.T) {
+	store := NewMemoryDedupStore(2, time.Hour)
+
+	if seen, _ := store.Seen(1); seen {
+		t.Fatal("Seen(1) = true for a new update")
+	}
+	if seen, _ := store.Seen(1); !seen {
+		t.Fatal("Seen(1) = false for a recorded update")
+	}
+
+	// the store is full, so recording 2 and 3 forgets 1, the oldest.
+	store.Seen(2)
+	store.Seen(3)
+	if seen, _ := store.Seen(1); seen {
+		t.Error("Seen(1) = true after the store is full, want the oldest update forgotten")
+	}
+}
+
+func TestMemoryDedupStoreExpires(t *testing.T) {
+	store := NewMemoryDedupStore(10, time.Millisecond)
+
+	store.Seen(1)
+	time.Sleep(5 * time.Millisecond)
+	if seen, _ := store.Seen(1); seen {
+		t.Error("Seen(1) = true after its ttl, want it forgotten")
+	}
+}
+
+func TestMemoryDedupStoreForget(t *testing.T) {
+	store := NewMemoryDedupStore(10, time.Hour)
+
+	if seen, _ := store.Seen(1); seen {
+		t.Fatal("Seen(1) = true for a new update")
+	}
+	if seen, _ := store.Seen(1); !seen {
+		t.Fatal("Seen(1) = false for a recorded update")
+	}
+
+	if err := store.Forget(1); err != nil {
+		t.Fatalf("Forget(1) error = %v", err)
+	}
+	if seen, _ := store.Seen(1); seen {
+		t.Error("Seen(1) = true for a forgotten update")
+	}
+	if len(store.order) != 1 {
+		t.Errorf("order = %v, want the update recorded once", store.order)
+	}
+
+	if err := store.Forget(2); err != nil {
+		t.Errorf("Forget(2) error = %v for an update never seen", err)
+	}
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileDedupStore is a DedupStore which remembers the update IDs like a MemoryDedupStore, and also writes them to a
+// file so they are still remembered after a restart, and the updates Telegram delivers again after a redeploy are
+// ignored too. the file is a log of the IDs with the time they were handled, or a "-" once they're forgotten, one per
+// line, which is compacted once most of its lines are forgotten. a file must be used by a single store at a time.
+type FileDedupStore struct {
+	mu     sync.Mutex
+	memory *MemoryDedupStore
+	path   string
+	file   *os.File
+	lines  int
+}
+
+// OpenFileDedupStore returns a FileDedupStore which remembers at most size update IDs for ttl each, like
+// NewMemoryDedupStore, in the file at path. the IDs already in the file are loaded, and the file is created if it
+// doesn't exist. the store must be closed once it isn't used anymore, see Close.
+func OpenFileDedupStore(path string, size int, ttl time.Duration) (*FileDedupStore, error) {
+	s := &FileDedupStore{
+		memory: NewMemoryDedupStore(size, ttl),
+		path:   path,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Seen implements the DedupStore interface. an ID which can't be written to the file is still remembered until the
+// store is closed, and the error is returned.
+func (s *FileDedupStore) Seen(updateID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.memory.seenAt(updateID, now) {
+		return true, nil
+	}
+
+	if _, err := fmt.Fprintf(s.file, "%d %d\n", updateID, now.UnixNano()); err != nil {
+		return false, fmt.Errorf("writing update %d to the dedup file: %w", updateID, err)
+	}
+	s.lines++
+
+	if s.lines > 2*len(s.memory.order)+MIN_DEDUP_COMPACTION {
+		if err := s.compact(); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// Forget implements the DedupStore interface. the ID stays forgotten after a restart, unless it can't be written to the
+// file, and the error is returned.
+func (s *FileDedupStore) Forget(updateID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.memory.seen[updateID]; !ok {
+		return nil
+	}
+	s.memory.forget(updateID)
+
+	if _, err := fmt.Fprintf(s.file, "%d -\n", updateID); err != nil {
+		return fmt.Errorf("forgetting update %d in the dedup file: %w", updateID, err)
+	}
+	s.lines++
+
+	return nil
+}
+
+// Close closes the file of the store. the store mustn't be used after.
+func (s *FileDedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// load records the update IDs of the file in memory, forgetting the expired ones. the lines which can't be parsed are
+// skipped, and so is the last one if it isn't terminated, like the one of a process which crashed midway writing it.
+func (s *FileDedupStore) load() error {
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading the dedup file: %w", err)
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		updateID, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		if fields[1] == "-" {
+			s.memory.forget(updateID)
+			continue
+		}
+		nanos, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		s.memory.seenAt(updateID, time.Unix(0, nanos))
+	}
+
+	s.memory.expire(time.Now())
+	return nil
+}
+
+// compact rewrites the file with only the update IDs remembered in memory, and reopens it to append the next ones. the
+// file is replaced by renaming, so a crash leaves either the old file or the new one. s.mu must be held, unless the
+// store isn't shared yet.
+func (s *FileDedupStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("compacting the dedup file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, updateID := range s.memory.order {
+		fmt.Fprintf(w, "%d %d\n", updateID, s.memory.seen[updateID].UnixNano())
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("compacting the dedup file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("compacting the dedup file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("compacting the dedup file: %w", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("opening the dedup file: %w", err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, s.lines = file, len(s.memory.order)
+
+	return nil
+}
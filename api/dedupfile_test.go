@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileDedupStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup")
+	store, err := OpenFileDedupStore(path, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore() error = %v", err)
+	}
+	for _, updateID := range []int{1, 2, 1} {
+		store.Seen(updateID)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened, err := OpenFileDedupStore(path, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("reopening: OpenFileDedupStore() error = %v", err)
+	}
+	defer reopened.Close()
+
+	for _, updateID := range []int{1, 2} {
+		if seen, err := reopened.Seen(updateID); !seen || err != nil {
+			t.Errorf("Seen(%d) = %t, %v after a reopen, want true", updateID, seen, err)
+		}
+	}
+	if seen, _ := reopened.Seen(3); seen {
+		t.Error("Seen(3) = true after a reopen for a new update")
+	}
+}
+
+func TestFileDedupStoreLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup")
+	now, expired := time.Now().UnixNano(), time.Now().Add(-2*time.Hour).UnixNano()
+	// the expired, the garbled and the unterminated lines are skipped.
+	content := fmt.Sprintf("1 %d\n2 %d\nthree %d\n4\n5 %d", expired, now, now, now)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing the dedup file: %v", err)
+	}
+
+	store, err := OpenFileDedupStore(path, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore() error = %v", err)
+	}
+	defer store.Close()
+
+	for updateID, want := range map[int]bool{1: false, 2: true, 4: false, 5: false} {
+		if seen, _ := store.Seen(updateID); seen != want {
+			t.Errorf("Seen(%d) = %t, want %t", updateID, seen, want)
+		}
+	}
+}
+
+func TestFileDedupStoreCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup")
+	store, err := OpenFileDedupStore(path, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore() error = %v", err)
+	}
+	defer store.Close()
+
+	for updateID := 1; updateID <= 2*MIN_DEDUP_COMPACTION; updateID++ {
+		if _, err := store.Seen(updateID); err != nil {
+			t.Fatalf("Seen(%d) error = %v", updateID, err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading the dedup file: %v", err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines > 20+MIN_DEDUP_COMPACTION {
+		t.Errorf("the dedup file has %d lines for 10 remembered updates, want it compacted", lines)
+	}
+	if seen, _ := store.Seen(2 * MIN_DEDUP_COMPACTION); !seen {
+		t.Error("Seen() = false for the last update after a compaction")
+	}
+}
+
+func TestFileDedupStoreForgetSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup")
+	store, err := OpenFileDedupStore(path, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore() error = %v", err)
+	}
+	store.Seen(1)
+	store.Seen(2)
+	if err := store.Forget(1); err != nil {
+		t.Fatalf("Forget(1) error = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened, err := OpenFileDedupStore(path, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("reopening: OpenFileDedupStore() error = %v", err)
+	}
+	defer reopened.Close()
+
+	if seen, _ := reopened.Seen(1); seen {
+		t.Error("Seen(1) = true after a reopen for a forgotten update")
+	}
+	if seen, _ := reopened.Seen(2); !seen {
+		t.Error("Seen(2) = false after a reopen for a recorded update")
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrTooManyFavorites is returned by FavoritesStore.Add when the chat has saved as many favorites as it can.
+var ErrTooManyFavorites = errors.New("too many favorites")
+
+// FavoritesStore remembers the movies every chat has saved. implementations must be safe for concurrent use.
+type FavoritesStore interface {
+	// Add saves the title for the chat. adding a title which is already saved does nothing.
+	Add(chatID int, title string) error
+
+	// Remove forgets the title for the chat. removing a title which isn't saved does nothing.
+	Remove(chatID int, title string) error
+
+	// List returns the titles the chat has saved, in the order they were saved.
+	List(chatID int) ([]string, error)
+}
+
+// MemoryFavoritesStore is a FavoritesStore which keeps a bounded number of titles per chat in memory. titles are
+// compared case insensitively.
+type MemoryFavoritesStore struct {
+	size int
+
+	mu     sync.Mutex
+	titles map[int][]string
+}
+
+// NewMemoryFavoritesStore returns a MemoryFavoritesStore which lets every chat save at most size titles.
+func NewMemoryFavoritesStore(size int) *MemoryFavoritesStore {
+	return &MemoryFavoritesStore{
+		size:   size,
+		titles: make(map[int][]string),
+	}
+}
+
+// Add implements the FavoritesStore interface. it returns ErrTooManyFavorites if the chat has saved size titles.
+func (s *MemoryFavoritesStore) Add(chatID int, title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	titles := s.titles[chatID]
+	if indexOfTitle(titles, title) >= 0 {
+		return nil
+	}
+	if len(titles) >= s.size {
+		return ErrTooManyFavorites
+	}
+
+	s.titles[chatID] = append(titles, title)
+	return nil
+}
+
+// Remove implements the FavoritesStore interface.
+func (s *MemoryFavoritesStore) Remove(chatID int, title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	titles := s.titles[chatID]
+	if i := indexOfTitle(titles, title); i >= 0 {
+		s.titles[chatID] = append(titles[:i:i], titles[i+1:]...)
+	}
+	return nil
+}
+
+// List implements the FavoritesStore interface.
+func (s *MemoryFavoritesStore) List(chatID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.titles[chatID]...), nil
+}
+
+// indexOfTitle returns the index of title in titles, ignoring the case, or -1 if it's missing.
+func indexOfTitle(titles []string, title string) int {
+	for i, t := range titles {
+		if strings.EqualFold(t, title) {
+			return i
+		}
+	}
+	return -1
+}
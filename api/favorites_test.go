@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryFavoritesStore(t *testing.T) {
+	store := NewMemoryFavoritesStore(2)
+
+	for _, title := range []string{"Inception", "inception", "Alien"} {
+		if err := store.Add(1, title); err != nil {
+			t.Fatalf("Add(%q) error = %v", title, err)
+		}
+	}
+	if err := store.Add(1, "Tenet"); !errors.Is(err, ErrTooManyFavorites) {
+		t.Errorf("Add() past the cap error = %v, want %v", err, ErrTooManyFavorites)
+	}
+	store.Add(2, "Heat")
+
+	if titles, _ := store.List(1); !reflect.DeepEqual(titles, []string{"Inception", "Alien"}) {
+		t.Errorf("List() = %q, want Inception saved once and Alien", titles)
+	}
+	if titles, _ := store.List(2); !reflect.DeepEqual(titles, []string{"Heat"}) {
+		t.Errorf("List() of another chat = %q, want Heat", titles)
+	}
+
+	store.Remove(1, "INCEPTION")
+	if titles, _ := store.List(1); !reflect.DeepEqual(titles, []string{"Alien"}) {
+		t.Errorf("List() after Remove() = %q, want Alien", titles)
+	}
+}
+
+func TestFavoritesCommands(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	bot.Favorites = NewMemoryFavoritesStore(2)
+
+	postUpdate(bot, messageUpdate(1, 7, "/favorites"))
+	postUpdate(bot, messageUpdate(2, 7, "/save Heat"))
+	postUpdate(bot, messageUpdate(3, 7, "/save heat"))
+	postUpdate(bot, messageUpdate(4, 7, "dream"))
+
+	buttons := callbackData(t, telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE)[3].Values)
+	if len(buttons) == 0 || buttons[0] != SAVE_CALLBACK_PREFIX+"Inception" {
+		t.Fatalf("buttons = %q, want a save button per movie", buttons)
+	}
+	postUpdate(bot, callbackQueryUpdate(5, 7, 4, buttons[0]))
+	postUpdate(bot, messageUpdate(6, 7, "/save Alien"))
+	postUpdate(bot, messageUpdate(7, 7, "/favorites"))
+
+	ctx := context.Background()
+	texts := sentTexts(telegram.Calls())
+	want := []string{
+		bot.text(ctx, NO_FAVORITES_TEXT),
+		bot.text(ctx, SAVED_TEXT, "Heat"),
+		bot.text(ctx, SAVED_TEXT, "heat"),
+		texts[3],
+		bot.text(ctx, SAVED_TEXT, "Inception"),
+		bot.text(ctx, TOO_MANY_FAVORITES_TEXT),
+		bot.localize(ctx, FAVORITES_TEXT) + "\n1. Heat\n2. Inception",
+	}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+}
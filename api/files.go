@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrFileTooLarge is returned when a file sent to the bot is larger than it downloads.
+var ErrFileTooLarge = errors.New("the file is too large")
+
+// File is a Telegram object describing a file ready to be downloaded, as returned by getFile.
+type File struct {
+	FileID   string `json:"file_id"`
+	FileSize int    `json:"file_size"`
+	FilePath string `json:"file_path"`
+}
+
+// getFile asks Telegram where the file with the ID can be downloaded from.
+func (b *Bot) getFile(ctx context.Context, fileID string) (File, error) {
+	body, err := b.callAPI(ctx, TELEGRAM_API_GET_FILE, url.Values{"file_id": {fileID}})
+	if err != nil {
+		return File{}, err
+	}
+
+	var response TelegramResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return File{}, fmt.Errorf("decoding getFile response: %w", err)
+	}
+
+	var file File
+	if err := json.Unmarshal(response.Result, &file); err != nil {
+		return File{}, fmt.Errorf("decoding file: %w", err)
+	}
+	if file.FilePath == "" {
+		return File{}, errors.New("telegram returned no path to download the file " + fileID + " from")
+	}
+
+	return file, nil
+}
+
+// downloadFile downloads the file with the ID, which must be at most maxSize bytes, and returns its content.
+// ErrFileTooLarge is returned for the larger files.
+func (b *Bot) downloadFile(ctx context.Context, fileID string, maxSize int) ([]byte, error) {
+	file, err := b.getFile(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.FileSize > maxSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrFileTooLarge, file.FileSize)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, b.fileURL(file.FilePath), nil)
+	if err != nil {
+		return nil, b.redact(err)
+	}
+
+	response, err := b.client().Do(request)
+	if err != nil {
+		return nil, b.redact(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading file %s failed with status code %d", fileID, response.StatusCode)
+	}
+
+	// the size reported by getFile is optional, so the download is capped too.
+	content, err := io.ReadAll(io.LimitReader(response.Body, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("downloading file %s: %w", fileID, err)
+	}
+	if len(content) > maxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	return content, nil
+}
+
+// fileURL returns the URL the file at path is downloaded from. the files of a bot calling its own APIBaseURL are
+// downloaded from the same server, under /file/bot<token>/ instead of /bot<token>/.
+func (b *Bot) fileURL(path string) string {
+	base := TELEGRAM_FILE_BASE_URL
+	if b.APIBaseURL != "" {
+		base = strings.TrimSuffix(b.APIBaseURL, "bot") + "file/bot"
+	}
+	return base + b.token + "/" + path
+}
@@ -0,0 +1,354 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TEST_BOT_TOKEN is the token of the bots of newTestBot.
+const TEST_BOT_TOKEN = "TOKEN"
+
+// TEST_FIELDS are the fields the bots of newTestBot show, more than DEFAULT_FIELDS, so the tests see the years, the
+// ratings and the links the movies are answered with.
+const TEST_FIELDS = FIELD_TITLE | FIELD_YEAR | FIELD_RATING | FIELD_LINK
+
+// fixtures maps the URLs requested from a fixture server, a path followed by its page parameter if it has one, e.g.
+// "/search/keyword/?page=2", to the file of testdata served for them.
+type fixtures map[string]string
+
+// fixtureServer is a test server standing in for IMDB, serving saved pages out of testdata.
+type fixtureServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	requests    []string
+	latency     time.Duration
+	inFlight    int
+	maxInFlight int
+}
+
+// newFixtureServer returns a fixtureServer serving fixtures, and 404 for the other URLs. it is closed once the test
+// ends.
+func newFixtureServer(t *testing.T, fixtures fixtures) *fixtureServer {
+	t.Helper()
+
+	pages := make(map[string][]byte, len(fixtures))
+	for url, file := range fixtures {
+		page, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatalf("reading fixture: %v", err)
+		}
+		pages[url] = page
+	}
+
+	s := &fixtureServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := r.URL.Path
+		if page := r.URL.Query().Get("page"); page != "" {
+			url += "?page=" + page
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL.String())
+		s.inFlight++
+		if s.inFlight > s.maxInFlight {
+			s.maxInFlight = s.inFlight
+		}
+		latency := s.latency
+		s.mu.Unlock()
+
+		defer func() {
+			s.mu.Lock()
+			s.inFlight--
+			s.mu.Unlock()
+		}()
+		time.Sleep(latency)
+
+		page, ok := pages[url]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Requests returns the URLs requested from the server so far, in order.
+func (s *fixtureServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// SetLatency delays the responses of the server by latency, so the requests made in parallel overlap.
+func (s *fixtureServer) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = latency
+}
+
+// MaxInFlight returns the most requests the server has been answering at the same time.
+func (s *fixtureServer) MaxInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.maxInFlight
+}
+
+// newFixtureScraper returns a Scraper of a fixtureServer serving fixtures, which neither pauses between the pages nor
+// retries them, and the server.
+func newFixtureScraper(t *testing.T, fixtures fixtures) (*Scraper, *fixtureServer) {
+	t.Helper()
+
+	server := newFixtureServer(t, fixtures)
+	scraper := NewScraper()
+	scraper.BaseURL = server.URL
+	scraper.Delay, scraper.RandomDelay = 0, 0
+	scraper.MaxAttempts = 1
+	scraper.IgnoreRobotsTxt = true
+
+	return scraper, server
+}
+
+// telegramCall is a call of the Telegram API made to a telegramServer.
+type telegramCall struct {
+	// Method is the path of the Telegram method, e.g. TELEGRAM_API_SEND_MESSAGE.
+	Method string
+	Values url.Values
+}
+
+// telegramServer is a test server standing in for the Telegram API. it records the calls, and answers them with its
+// respond function, successfully if it has none.
+type telegramServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	calls   []telegramCall
+	respond func(call telegramCall) (int, string)
+}
+
+// newTelegramServer returns a telegramServer which is closed once the test ends.
+func newTelegramServer(t *testing.T) *telegramServer {
+	t.Helper()
+
+	s := &telegramServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		call := telegramCall{Method: strings.TrimPrefix(r.URL.Path, "/bot"+TEST_BOT_TOKEN), Values: r.PostForm}
+
+		s.mu.Lock()
+		s.calls = append(s.calls, call)
+		respond := s.respond
+		s.mu.Unlock()
+
+		status, body := http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+		if respond != nil {
+			status, body = respond(call)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Respond makes the server answer the following calls with respond, which returns the status code and the body of
+// the response.
+func (s *telegramServer) Respond(respond func(call telegramCall) (int, string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.respond = respond
+}
+
+// Calls returns the calls made to the server so far, in order.
+func (s *telegramServer) Calls() []telegramCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]telegramCall(nil), s.calls...)
+}
+
+// CallsOf returns the calls of the Telegram method made to the server so far, in order.
+func (s *telegramServer) CallsOf(method string) []telegramCall {
+	var calls []telegramCall
+	for _, call := range s.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// testLogger is a Logger writing to the log of a test, so the entries are only shown when it fails. the entries of
+// the goroutines outliving the test are dropped, since testing panics when they are logged.
+type testLogger struct {
+	t    *testing.T
+	done *int32
+}
+
+// newTestLogger returns the testLogger of t.
+func newTestLogger(t *testing.T) testLogger {
+	l := testLogger{t: t, done: new(int32)}
+	t.Cleanup(func() { atomic.StoreInt32(l.done, 1) })
+	return l
+}
+
+// Info implements the Logger interface.
+func (l testLogger) Info(msg string, args ...interface{}) {
+	if atomic.LoadInt32(l.done) == 0 {
+		l.t.Log(formatLogLine("INFO", msg, args))
+	}
+}
+
+// Error implements the Logger interface.
+func (l testLogger) Error(msg string, args ...interface{}) {
+	if atomic.LoadInt32(l.done) == 0 {
+		l.t.Log(formatLogLine("ERROR", msg, args))
+	}
+}
+
+// newTestBot returns a Bot of the default Config calling the Telegram API of a telegramServer and searching a
+// fixtureServer serving fixtures, and both servers. it isn't rate limited, and retries its calls without waiting
+// long, so the tests stay fast.
+func newTestBot(t *testing.T, fixtures fixtures) (*Bot, *telegramServer, *fixtureServer) {
+	t.Helper()
+
+	cfg := DefaultConfig()
+	cfg.Token = TEST_BOT_TOKEN
+	cfg.Fields = TEST_FIELDS
+	bot, err := NewHandlerFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewHandlerFromConfig() error = %v", err)
+	}
+
+	telegram := newTelegramServer(t)
+	scraper, imdb := newFixtureScraper(t, fixtures)
+	bot.Source = scraper
+	bot.APIBaseURL = telegram.URL + "/bot"
+	bot.Logger = newTestLogger(t)
+	bot.Limiter = nil
+	bot.Sends = nil
+	bot.RetryBaseDelay = time.Millisecond
+
+	return bot, telegram, imdb
+}
+
+// postUpdate posts the update body to the webhook handler like Telegram does, and returns the response.
+func postUpdate(handler http.Handler, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// waitFor waits for condition to hold, failing the test if it still doesn't after a second.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// fakeSource is a MovieSource answering the keyword searches with the movies of their keywords, joined with ",", and
+// recording them. it embeds the MovieSource the other searches are made with, which is nil if they aren't expected.
+type fakeSource struct {
+	MovieSource
+	movies map[string][]Movie
+
+	mu       sync.Mutex
+	searches [][]string
+}
+
+// Search implements the MovieSource interface.
+func (s *fakeSource) Search(ctx context.Context, keywords []string) ([]Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.searches = append(s.searches, append([]string(nil), keywords...))
+	return s.movies[strings.Join(keywords, ",")], nil
+}
+
+// Searches returns the keywords searched so far, in order.
+func (s *fakeSource) Searches() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([][]string(nil), s.searches...)
+}
+
+// messageUpdate returns the JSON of an update with the text message of a private chat, as Telegram posts it.
+func messageUpdate(updateID, chatID int, text string) string {
+	update := Update{UpdateID: updateID, Message: Message{MessageID: updateID, Text: text, Chat: Chat{ID: chatID, Type: CHAT_TYPE_PRIVATE}}}
+	body, _ := json.Marshal(update)
+	return string(body)
+}
+
+// sentTexts returns the texts of the messages sent by calls, in order.
+func sentTexts(calls []telegramCall) []string {
+	var texts []string
+	for _, call := range calls {
+		if call.Method == TELEGRAM_API_SEND_MESSAGE {
+			texts = append(texts, call.Values.Get("text"))
+		}
+	}
+	return texts
+}
+
+// callbackQueryUpdate returns the JSON of an update with the tap on a button of the message of a private chat, as
+// Telegram posts it.
+func callbackQueryUpdate(updateID, chatID, messageID int, data string) string {
+	message := &Message{MessageID: messageID, Chat: Chat{ID: chatID, Type: CHAT_TYPE_PRIVATE}}
+	update := Update{UpdateID: updateID, CallbackQuery: &CallbackQuery{ID: "query" + strconv.Itoa(updateID), Data: data, Message: message}}
+	body, _ := json.Marshal(update)
+	return string(body)
+}
+
+// callbackData returns the callback data of the buttons of the inline keyboard sent with values, in order.
+func callbackData(t *testing.T, values url.Values) []string {
+	t.Helper()
+
+	if values.Get("reply_markup") == "" {
+		return nil
+	}
+	var markup InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(values.Get("reply_markup")), &markup); err != nil {
+		t.Fatalf("decoding the reply markup: %v", err)
+	}
+
+	var data []string
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			data = append(data, button.CallbackData)
+		}
+	}
+	return data
+}
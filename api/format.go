@@ -0,0 +1,348 @@
+package handler
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseMode is the formatting Telegram applies to the text of a message.
+type ParseMode string
+
+// the supported ParseModes.
+const (
+	PARSE_MODE_NONE        ParseMode = ""
+	PARSE_MODE_MARKDOWN_V2 ParseMode = "MarkdownV2"
+	PARSE_MODE_HTML        ParseMode = "HTML"
+)
+
+// escape escapes the characters of plain text which are reserved in the parse mode.
+func (m ParseMode) escape(text string) string {
+	switch m {
+	case PARSE_MODE_MARKDOWN_V2:
+		return escapeMarkdownV2(text)
+	case PARSE_MODE_HTML:
+		return escapeHTML(text)
+	}
+	return text
+}
+
+// markdownV2Replacer escapes every character reserved by Telegram's MarkdownV2 with a preceding backslash.
+var markdownV2Replacer = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "~", `\~`, "`", "\\`", ">", `\>`,
+	"#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// escapeMarkdownV2 escapes s so it is shown as is in a MarkdownV2 message.
+func escapeMarkdownV2(s string) string {
+	return markdownV2Replacer.Replace(s)
+}
+
+// markdownV2LinkReplacer escapes the characters which are reserved inside the URL part of a MarkdownV2 inline link.
+var markdownV2LinkReplacer = strings.NewReplacer(`\`, `\\`, ")", `\)`)
+
+// escapeMarkdownV2Link escapes link so it can be used as the URL of a MarkdownV2 inline link.
+func escapeMarkdownV2Link(link string) string {
+	return markdownV2LinkReplacer.Replace(link)
+}
+
+// htmlReplacer escapes the characters Telegram requires to be escaped in the text of an HTML message.
+var htmlReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// escapeHTML escapes s so it is shown as is in an HTML message.
+func escapeHTML(s string) string {
+	return htmlReplacer.Replace(s)
+}
+
+// htmlAttributeReplacer escapes the characters which are reserved inside a quoted attribute of an HTML tag.
+var htmlAttributeReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// escapeHTMLAttribute escapes value so it can be used as a double quoted attribute, e.g. the href of a link.
+func escapeHTMLAttribute(value string) string {
+	return htmlAttributeReplacer.Replace(value)
+}
+
+// plainText returns the text formatted in mode as plain text: the formatting is dropped, the links follow their text
+// and the escaped characters are unescaped.
+func plainText(mode ParseMode, text string) string {
+	switch mode {
+	case PARSE_MODE_MARKDOWN_V2:
+		return plainMarkdownV2(text)
+	case PARSE_MODE_HTML:
+		return plainHTML(text)
+	}
+	return text
+}
+
+// plainMarkdownV2 returns the MarkdownV2 text as plain text, see plainText.
+func plainMarkdownV2(text string) string {
+	var plain strings.Builder
+	runes := []rune(text)
+	inLink := false
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			plain.WriteRune(runes[i])
+		case inLink && r == ')':
+			inLink = false
+		case inLink:
+			plain.WriteRune(r)
+		case r == ']' && i+1 < len(runes) && runes[i+1] == '(':
+			inLink = true
+			i++
+			plain.WriteRune(' ')
+		case !strings.ContainsRune("*_~`|[]", r):
+			plain.WriteRune(r)
+		}
+	}
+	return plain.String()
+}
+
+var (
+	// htmlLinkRegexp matches the links formatMovie makes, capturing their URL and their text.
+	htmlLinkRegexp = regexp.MustCompile(`(?s)<a href="([^"]*)">(.*?)</a>`)
+
+	// htmlTagRegexp matches the HTML tags.
+	htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+)
+
+// plainHTML returns the HTML text as plain text, see plainText.
+func plainHTML(text string) string {
+	text = htmlLinkRegexp.ReplaceAllString(text, "$2 $1")
+	return html.UnescapeString(htmlTagRegexp.ReplaceAllString(text, ""))
+}
+
+// Fields is a set of the fields of a Movie shown in the lists, e.g. FIELD_TITLE | FIELD_YEAR.
+type Fields int
+
+// the Fields which can be shown. the title is always shown, but FIELD_TITLE alone shows nothing else.
+const (
+	FIELD_TITLE Fields = 1 << iota
+	FIELD_YEAR
+	FIELD_RATING
+	FIELD_LINK
+	FIELD_GENRES
+	FIELD_PLOT
+
+	DEFAULT_FIELDS = FIELD_TITLE
+)
+
+// fieldNames name the Fields for parseFields.
+var fieldNames = map[string]Fields{
+	"title":  FIELD_TITLE,
+	"year":   FIELD_YEAR,
+	"rating": FIELD_RATING,
+	"link":   FIELD_LINK,
+	"genres": FIELD_GENRES,
+	"plot":   FIELD_PLOT,
+}
+
+// parseFields parses a comma separated list of the names of Fields, e.g. "title,year,rating". the names are title,
+// year, rating, link, genres and plot.
+func parseFields(list string) (Fields, error) {
+	fields := FIELD_TITLE
+	for _, name := range strings.Split(list, ",") {
+		field, ok := fieldNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return 0, fmt.Errorf("unknown field %q. expected title, year, rating, link, genres or plot", name)
+		}
+		fields |= field
+	}
+	return fields, nil
+}
+
+// formatOptions control how formatMovies renders a list of movies.
+type formatOptions struct {
+	// mode is the parse mode the list is formatted in.
+	mode ParseMode
+
+	// maxLen caps the length of the list in bytes. the movies which don't fit are left out. zero doesn't cap it.
+	maxLen int
+
+	// fields are the fields of the movies shown. zero means DEFAULT_FIELDS. the plots are cut to plotLen characters.
+	fields  Fields
+	plotLen int
+
+	// offset numbers the movies from offset+1 on, for the pages after the first one.
+	offset int
+
+	// style is how the movies are numbered.
+	style ListStyle
+}
+
+// ListStyle is how the movies of a list are numbered.
+type ListStyle string
+
+// the supported ListStyles.
+const (
+	// LIST_STYLE_NUMBERED numbers the movies 1., 2., 3. and so on.
+	LIST_STYLE_NUMBERED ListStyle = ""
+
+	// LIST_STYLE_RANKED numbers the movies too, with their numbers padded to the same width, and puts a medal before
+	// the first three.
+	LIST_STYLE_RANKED ListStyle = "ranked"
+)
+
+// medals are put before the first movies of a ranked list, the best first.
+var medals = []string{"🥇", "🥈", "🥉"}
+
+// FIGURE_SPACE is a space as wide as a digit, which pads the numbers of a ranked list.
+const FIGURE_SPACE = "\u2007"
+
+// show reports whether the field of the movies is shown.
+func (opts formatOptions) show(field Fields) bool {
+	fields := opts.fields
+	if fields == 0 {
+		fields = DEFAULT_FIELDS
+	}
+	return fields&field != 0
+}
+
+// FormatMovies formats movies the way the bot sends them, as a numbered list in mode, one movie per line, with the
+// DEFAULT_FIELDS.
+func FormatMovies(movies []Movie, mode ParseMode) string {
+	return FormatMovieFields(movies, mode, DEFAULT_FIELDS)
+}
+
+// FormatMovieFields is FormatMovies, showing the given fields of the movies. zero fields means DEFAULT_FIELDS.
+func FormatMovieFields(movies []Movie, mode ParseMode, fields Fields) string {
+	return formatMovies(movies, formatOptions{mode: mode, fields: fields, plotLen: DEFAULT_PLOT_LENGTH})
+}
+
+// formatMovies formats movies as a numbered list, one movie per line, and one more for its plot if opts show it.
+func formatMovies(movies []Movie, opts formatOptions) string {
+	text, _ := formatMovieList(movies, opts)
+	return text
+}
+
+// formatMovieList is formatMovies, also returning the number of movies which fit in the maxLen of opts.
+func formatMovieList(movies []Movie, opts formatOptions) (text string, shown int) {
+	last := opts.offset + len(movies)
+	if len(movies) > 0 && movies[len(movies)-1].Rank > 0 {
+		last = movies[len(movies)-1].Rank
+	}
+
+	for i, movie := range movies {
+		rank := opts.offset + i + 1
+		if movie.Rank > 0 {
+			rank = movie.Rank
+		}
+		entry := formatMovie(opts, listIndex(opts, rank, last), movie) + "\n"
+		if opts.maxLen > 0 && len(text)+len(entry) > opts.maxLen {
+			break
+		}
+		text += entry
+		shown++
+	}
+	return text, shown
+}
+
+// listIndex returns the index of the movie ranked rank in a list with opts ending at the rank last, e.g. "3.", or
+// "🥉 3." in a ranked list, with a FIGURE_SPACE before the 3 if the list goes past 9. the movies are ranked by their
+// position in the list, or by their Rank if they're listed from a chart.
+func listIndex(opts formatOptions, rank, last int) string {
+	index := strconv.Itoa(rank) + "."
+	if opts.style != LIST_STYLE_RANKED {
+		return index
+	}
+
+	// the numbers are padded to the width of the last one, so the titles line up.
+	width := len(strconv.Itoa(last))
+	if pad := width - len(strconv.Itoa(rank)); pad > 0 {
+		index = strings.Repeat(FIGURE_SPACE, pad) + index
+	}
+	if rank <= len(medals) {
+		index = medals[rank-1] + " " + index
+	}
+	return index
+}
+
+// formatMovie formats movie as a line of a reply in the mode of opts, with the fields opts show. in MarkdownV2 and
+// HTML the title is bold and links to the movie, and the years are italic. in plain text the link follows the movie.
+// the years, the rating, the genres and the link are left out if they are unknown. the plot follows on a line of its
+// own.
+func formatMovie(opts formatOptions, index string, movie Movie) string {
+	mode := opts.mode
+	title, link, years := movie.Title, "", ""
+	if opts.show(FIELD_LINK) {
+		link = movie.URL
+	}
+	if movie.Year != 0 && opts.show(FIELD_YEAR) {
+		years = formatYears(movie.Year, movie.EndYear)
+	}
+
+	switch mode {
+	case PARSE_MODE_MARKDOWN_V2:
+		title = escapeMarkdownV2(title)
+		if link != "" {
+			title = "[" + title + "](" + escapeMarkdownV2Link(link) + ")"
+			link = ""
+		}
+		title = "*" + title + "*"
+		if years != "" {
+			years = "_" + escapeMarkdownV2(years) + "_"
+		}
+
+	case PARSE_MODE_HTML:
+		title = escapeHTML(title)
+		if link != "" {
+			title = `<a href="` + escapeHTMLAttribute(link) + `">` + title + "</a>"
+			link = ""
+		}
+		title = "<b>" + title + "</b>"
+		if years != "" {
+			years = "<i>" + escapeHTML(years) + "</i>"
+		}
+	}
+
+	line := title
+	if index != "" {
+		line = mode.escape(index) + " " + title
+	}
+	if years != "" {
+		line += " " + years
+	}
+	if movie.Rating > 0 && opts.show(FIELD_RATING) {
+		line += " " + mode.escape(fmt.Sprintf("(%.1f)", movie.Rating))
+	}
+	if opts.show(FIELD_GENRES) && len(movie.Genres) > 0 {
+		line += " " + mode.escape("["+strings.Join(movie.Genres, ", ")+"]")
+	}
+	if link != "" {
+		line += " " + link
+	}
+	if opts.show(FIELD_PLOT) && movie.Plot != "" {
+		line += "\n" + mode.escape(truncatePlot(movie.Plot, opts.plotLen))
+	}
+
+	return line
+}
+
+// truncatePlot cuts plot to at most n characters, on a word boundary if it can, and ends it with an ellipsis if it
+// was cut.
+func truncatePlot(plot string, n int) string {
+	runes := []rune(plot)
+	if len(runes) <= n {
+		return plot
+	}
+
+	cut := string(runes[:n-1])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// formatYears formats the years of a title the way IMDB shows them.
+func formatYears(from, to int) string {
+	switch to {
+	case from:
+		return fmt.Sprintf("(%d)", from)
+	case 0:
+		return fmt.Sprintf("(%d–)", from)
+	}
+	return fmt.Sprintf("(%d–%d)", from, to)
+}
@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`_`, `\_`}, {`*`, `\*`}, {`[`, `\[`}, {`]`, `\]`}, {`(`, `\(`}, {`)`, `\)`}, {`~`, `\~`}, {"`", "\\`"},
+		{`>`, `\>`}, {`#`, `\#`}, {`+`, `\+`}, {`-`, `\-`}, {`=`, `\=`}, {`|`, `\|`}, {`{`, `\{`}, {`}`, `\}`},
+		{`.`, `\.`}, {`!`, `\!`}, {`\`, `\\`},
+		{"Plain Title", "Plain Title"},
+		{"Mr. & Mrs. Smith (2005)", `Mr\. & Mrs\. Smith \(2005\)`},
+		{"Spider-Man: No Way Home!", `Spider\-Man: No Way Home\!`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeMarkdownV2(tt.in); got != tt.want {
+			t.Errorf("escapeMarkdownV2(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatMovies(t *testing.T) {
+	movies := []Movie{
+		{Title: "Mr. Smith (Goes)", Year: 2010, EndYear: 2010, Rating: 8.8, URL: "https://www.imdb.com/title/tt1/"},
+		{Title: "No <Link>", Year: 2000, EndYear: 2000},
+	}
+
+	tests := []struct {
+		mode ParseMode
+		want string
+	}{
+		{
+			mode: PARSE_MODE_NONE,
+			want: "1. Mr. Smith (Goes) (2010) (8.8) https://www.imdb.com/title/tt1/\n2. No <Link> (2000)\n",
+		},
+		{
+			mode: PARSE_MODE_MARKDOWN_V2,
+			want: "1\\. *[Mr\\. Smith \\(Goes\\)](https://www.imdb.com/title/tt1/)* _\\(2010\\)_ \\(8\\.8\\)\n2\\. *No <Link\\>* _\\(2000\\)_\n",
+		},
+		{
+			mode: PARSE_MODE_HTML,
+			want: "1. <b><a href=\"https://www.imdb.com/title/tt1/\">Mr. Smith (Goes)</a></b> <i>(2010)</i> (8.8)\n2. <b>No &lt;Link&gt;</b> <i>(2000)</i>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := FormatMovieFields(movies, tt.mode, TEST_FIELDS); got != tt.want {
+			t.Errorf("FormatMovieFields(%q) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+
+	if got, want := FormatMovies(movies, PARSE_MODE_NONE), "1. Mr. Smith (Goes)\n2. No <Link>\n"; got != want {
+		t.Errorf("FormatMovies() = %q, want the titles only, %q", got, want)
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		list string
+		want Fields
+	}{
+		{"title", FIELD_TITLE},
+		{"year, Rating", FIELD_TITLE | FIELD_YEAR | FIELD_RATING},
+		{"title,year,rating,link,genres,plot", FIELD_TITLE | FIELD_YEAR | FIELD_RATING | FIELD_LINK | FIELD_GENRES | FIELD_PLOT},
+	}
+
+	for _, tt := range tests {
+		if got, err := parseFields(tt.list); err != nil || got != tt.want {
+			t.Errorf("parseFields(%q) = %b, %v, want %b", tt.list, got, err, tt.want)
+		}
+	}
+
+	for _, list := range []string{"budget", "title,", ""} {
+		if got, err := parseFields(list); err == nil {
+			t.Errorf("parseFields(%q) = %b, want an error", list, got)
+		}
+	}
+}
+
+func TestFormatMoviesFields(t *testing.T) {
+	movies := []Movie{
+		{Title: "Inception", Year: 2010, EndYear: 2010, Rating: 8.8, URL: "https://www.imdb.com/title/tt1/", Genres: []string{"Action", "Sci-Fi"}, Plot: "A thief."},
+	}
+
+	tests := []struct {
+		fields Fields
+		want   string
+	}{
+		{0, "1. Inception\n"},
+		{FIELD_TITLE, "1. Inception\n"},
+		{FIELD_TITLE | FIELD_RATING, "1. Inception (8.8)\n"},
+		{FIELD_YEAR | FIELD_GENRES | FIELD_PLOT, "1. Inception (2010) [Action, Sci-Fi]\nA thief.\n"},
+	}
+
+	for _, tt := range tests {
+		if got := formatMovies(movies, formatOptions{fields: tt.fields, plotLen: DEFAULT_PLOT_LENGTH}); got != tt.want {
+			t.Errorf("formatMovies() with the fields %b = %q, want %q", tt.fields, got, tt.want)
+		}
+	}
+
+	// the title links to the movie in MarkdownV2 only if the link is shown.
+	if got, want := formatMovies(movies, formatOptions{mode: PARSE_MODE_MARKDOWN_V2, fields: FIELD_TITLE}), "1\\. *Inception*\n"; got != want {
+		t.Errorf("formatMovies() in MarkdownV2 without the link = %q, want %q", got, want)
+	}
+}
+
+func TestFormatMovieList(t *testing.T) {
+	movies := []Movie{
+		{Title: "Inception", Year: 2010, EndYear: 2010},
+		{Title: "Unrated"},
+		{Title: "Bad Movie", Year: 2015, EndYear: 2018, Rating: 4.1},
+	}
+
+	text, shown := formatMovieList(movies, formatOptions{fields: TEST_FIELDS})
+	if want := "1. Inception (2010)\n2. Unrated\n3. Bad Movie (2015–2018) (4.1)\n"; text != want || shown != 3 {
+		t.Errorf("formatMovieList() = %q, %d, want %q, 3", text, shown, want)
+	}
+
+	text, shown = formatMovieList(movies, formatOptions{fields: TEST_FIELDS, offset: 10, maxLen: len("11. Inception (2010)\n12. Unrated\n")})
+	if want := "11. Inception (2010)\n12. Unrated\n"; text != want || shown != 2 {
+		t.Errorf("formatMovieList() of the second page = %q, %d, want %q, 2", text, shown, want)
+	}
+
+	if text, shown := formatMovieList(nil, formatOptions{}); text != "" || shown != 0 {
+		t.Errorf("formatMovieList(nil) = %q, %d, want nothing", text, shown)
+	}
+}
+
+func TestFormatYears(t *testing.T) {
+	tests := []struct {
+		from, to int
+		want     string
+	}{
+		{2010, 2010, "(2010)"},
+		{2016, 0, "(2016–)"},
+		{2011, 2016, "(2011–2016)"},
+	}
+
+	for _, tt := range tests {
+		if got := formatYears(tt.from, tt.to); got != tt.want {
+			t.Errorf("formatYears(%d, %d) = %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeHTML(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Plain Title", "Plain Title"},
+		{"Tom & Jerry", "Tom &amp; Jerry"},
+		{"<b>Bold</b>", "&lt;b&gt;Bold&lt;/b&gt;"},
+		{"&amp;", "&amp;amp;"},
+		{`"Quoted" 'Title'`, `"Quoted" 'Title'`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeHTML(tt.in); got != tt.want {
+			t.Errorf("escapeHTML(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if got, want := escapeHTMLAttribute(`https://example.com/?a=1&b="2"`), "https://example.com/?a=1&amp;b=&quot;2&quot;"; got != want {
+		t.Errorf("escapeHTMLAttribute() = %q, want %q", got, want)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		mode     ParseMode
+		in, want string
+	}{
+		{PARSE_MODE_MARKDOWN_V2, `1\. [Tom & Jerry](https://www.imdb.com/title/tt1/?a=\(b\)) \(2021\) *8\.5*`, "1. Tom & Jerry https://www.imdb.com/title/tt1/?a=(b) (2021) 8.5"},
+		{PARSE_MODE_MARKDOWN_V2, `_under_ ~strike~ \_kept\_ \[not a link\]`, "under strike _kept_ [not a link]"},
+		{PARSE_MODE_HTML, `1. <a href="https://www.imdb.com/title/tt1/?a=1&amp;b=2">Tom &amp; Jerry</a> (2021) <b>8.5</b>`, "1. Tom & Jerry https://www.imdb.com/title/tt1/?a=1&b=2 (2021) 8.5"},
+		{PARSE_MODE_HTML, "&lt;b&gt; is <i>kept</i>", "<b> is kept"},
+		{"", `*as is*`, `*as is*`},
+	}
+
+	for _, tt := range tests {
+		if got := plainText(tt.mode, tt.in); got != tt.want {
+			t.Errorf("plainText(%q, %q) = %q, want %q", tt.mode, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatMoviesValidHTML(t *testing.T) {
+	movies := []Movie{
+		{Title: `<Tom & "Jerry">`, Year: 2021, EndYear: 2021, Rating: 5.3, URL: `https://www.imdb.com/title/tt1/?ref="x"&y=<z>`},
+		{Title: "Fast & Furious", Year: 2009},
+	}
+
+	text := FormatMovieFields(movies, PARSE_MODE_HTML, TEST_FIELDS)
+
+	// the tags Telegram supports are well formed XML, so the text must decode as XML once wrapped in an element.
+	decoder := xml.NewDecoder(strings.NewReader("<message>" + text + "</message>"))
+	var content strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("FormatMovieFields() = %q, which isn't valid HTML: %v", text, err)
+		}
+		if data, ok := token.(xml.CharData); ok {
+			content.Write(data)
+		}
+	}
+
+	if want := "1. <Tom & \"Jerry\"> (2021) (5.3)\n2. Fast & Furious (2009–)\n"; content.String() != want {
+		t.Errorf("text of FormatMovieFields() = %q, want %q", content.String(), want)
+	}
+}
+
+func TestTruncatePlot(t *testing.T) {
+	tests := []struct {
+		plot string
+		n    int
+		want string
+	}{
+		{"A short plot.", 20, "A short plot."},
+		{"A thief who steals corporate secrets.", 20, "A thief who steals…"},
+		{"A thief, who steals corporate secrets.", 10, "A thief…"},
+		{"Supercalifragilistic", 10, "Supercali…"},
+		{"Ein Dieb, der Geheimnisse stiehlt, öffnet Träume.", 45, "Ein Dieb, der Geheimnisse stiehlt, öffnet…"},
+	}
+
+	for _, tt := range tests {
+		got := truncatePlot(tt.plot, tt.n)
+		if got != tt.want {
+			t.Errorf("truncatePlot(%q, %d) = %q, want %q", tt.plot, tt.n, got, tt.want)
+		}
+		if n := utf8.RuneCountInString(got); n > tt.n {
+			t.Errorf("truncatePlot(%q, %d) is %d characters long", tt.plot, tt.n, n)
+		}
+	}
+}
+
+func TestFormatRankedList(t *testing.T) {
+	movies := []Movie{
+		{Title: "The Godfather", Year: 1972, EndYear: 1972},
+		{Title: "Inception", Year: 2010, EndYear: 2010},
+		{Title: "Memento", Year: 2000, EndYear: 2000},
+		{Title: "Alien", Year: 1979, EndYear: 1979},
+		{Title: "Heat", Year: 1995, EndYear: 1995},
+	}
+
+	text, _ := formatMovieList(movies, formatOptions{fields: TEST_FIELDS, style: LIST_STYLE_RANKED})
+	want := "🥇 1. The Godfather (1972)\n🥈 2. Inception (2010)\n🥉 3. Memento (2000)\n4. Alien (1979)\n5. Heat (1995)\n"
+	if text != want {
+		t.Errorf("formatMovieList() of a ranked list = %q, want %q", text, want)
+	}
+
+	text, _ = formatMovieList(movies, formatOptions{fields: TEST_FIELDS, style: LIST_STYLE_RANKED, mode: PARSE_MODE_MARKDOWN_V2})
+	if !strings.HasPrefix(text, "🥇 1\\. *The Godfather*") || !strings.Contains(text, "\n4\\. *Alien*") {
+		t.Errorf("formatMovieList() of a ranked MarkdownV2 list = %q, want the indexes escaped", text)
+	}
+
+	// the list goes past 9, so the numbers of one digit are padded to line the titles up.
+	text, _ = formatMovieList(movies, formatOptions{fields: TEST_FIELDS, style: LIST_STYLE_RANKED, offset: 7})
+	want = FIGURE_SPACE + "8. The Godfather (1972)\n" + FIGURE_SPACE + "9. Inception (2010)\n10. Memento (2000)\n11. Alien (1979)\n12. Heat (1995)\n"
+	if text != want {
+		t.Errorf("formatMovieList() of the second page of a ranked list = %q, want %q", text, want)
+	}
+
+	ranked := append([]Movie(nil), movies...)
+	for i := range ranked {
+		ranked[i].Rank = 5 - i
+	}
+	text, _ = formatMovieList(ranked, formatOptions{fields: TEST_FIELDS, style: LIST_STYLE_RANKED})
+	if !strings.HasPrefix(text, "5. The Godfather (1972)\n") || !strings.HasSuffix(text, "🥇 1. Heat (1995)\n") {
+		t.Errorf("formatMovieList() of a chart = %q, want the movies numbered by their Rank", text)
+	}
+}
+
+func TestFormatMovie(t *testing.T) {
+	smith := Movie{Title: "Mr. Smith (Goes)", Year: 2010, EndYear: 2010, Rating: 8.8, URL: "https://www.imdb.com/title/tt1/"}
+
+	tests := []struct {
+		mode  ParseMode
+		index string
+		movie Movie
+		want  string
+	}{
+		{mode: PARSE_MODE_NONE, index: "1.", movie: smith, want: "1. Mr. Smith (Goes) (2010) (8.8) https://www.imdb.com/title/tt1/"},
+		{
+			mode: PARSE_MODE_MARKDOWN_V2, index: "1.", movie: smith,
+			want: `1\. *[Mr\. Smith \(Goes\)](https://www.imdb.com/title/tt1/)* _\(2010\)_ \(8\.8\)`,
+		},
+		{mode: PARSE_MODE_NONE, index: "2.", movie: Movie{Title: "Untitled"}, want: "2. Untitled"},
+		{mode: PARSE_MODE_MARKDOWN_V2, index: "2.", movie: Movie{Title: "Untitled"}, want: `2\. *Untitled*`},
+	}
+
+	for _, tt := range tests {
+		if got := formatMovie(formatOptions{mode: tt.mode, fields: TEST_FIELDS}, tt.index, tt.movie); got != tt.want {
+			t.Errorf("formatMovie(%q, %q) = %q, want %q", tt.mode, tt.movie.Title, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeMarkdownV2Link(t *testing.T) {
+	if got := escapeMarkdownV2Link(`https://example.com/a_(b)\c`); got != `https://example.com/a_(b\)\\c` {
+		t.Errorf("escapeMarkdownV2Link() = %q, want only ) and \\ escaped", got)
+	}
+}
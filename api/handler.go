@@ -1,52 +1,228 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"math/rand"
+	"mime"
 	"net/http"
-	"net/url"
-	"os"
+	"sort"
 	"strconv"
 	"strings"
-
-	"github.com/gocolly/colly"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
-	TELEGRAM_API_BASE_URL     = "https://api.telegram.org/bot"
-	TELEGRAM_API_SEND_MESSAGE = "/sendMessage"
-	BOT_TOKEN_ENV             = "TELEGRAM_BOT_TOKEN"
-	IMDB_URL                  = "https://www.imdb.com/search/keyword/?keywords="
+	TELEGRAM_API_BASE_URL                = "https://api.telegram.org/bot"
+	TELEGRAM_FILE_BASE_URL               = "https://api.telegram.org/file/bot"
+	TELEGRAM_API_SEND_MESSAGE            = "/sendMessage"
+	TELEGRAM_API_EDIT_MESSAGE_TEXT       = "/editMessageText"
+	TELEGRAM_API_ANSWER_CALLBACK_QUERY   = "/answerCallbackQuery"
+	TELEGRAM_API_ANSWER_INLINE_QUERY     = "/answerInlineQuery"
+	TELEGRAM_API_SEND_PHOTO              = "/sendPhoto"
+	TELEGRAM_API_SEND_CHAT_ACTION        = "/sendChatAction"
+	TELEGRAM_API_SET_WEBHOOK             = "/setWebhook"
+	TELEGRAM_API_DELETE_WEBHOOK          = "/deleteWebhook"
+	TELEGRAM_API_GET_UPDATES             = "/getUpdates"
+	TELEGRAM_API_GET_FILE                = "/getFile"
+	CHAT_ACTION_TYPING                   = "typing"
+	SECRET_TOKEN_HEADER                  = "X-Telegram-Bot-Api-Secret-Token"
+	TELEGRAM_BLOCKED_DESCRIPTION         = "bot was blocked by the user"
+	TELEGRAM_UNPARSABLE_DESCRIPTION      = "can't parse entities"
+	TELEGRAM_REPLY_NOT_FOUND_DESCRIPTION = "message to be replied not found"
+	BOT_TOKEN_ENV                        = "TELEGRAM_BOT_TOKEN"
+	BOT_USERNAME_ENV                     = "TELEGRAM_BOT_USERNAME"
+	PREVIEW_ENV                          = "GMTM_PREVIEW"
+	ALLOWED_CHATS_ENV                    = "GMTM_ALLOWED_CHATS"
+	SECRET_TOKEN_ENV                     = "GMTM_SECRET_TOKEN"
+	PROXY_ENV                            = "GMTM_PROXY"
+	MAX_SCRAPES_ENV                      = "GMTM_MAX_SCRAPES"
+	SEND_RATE_ENV                        = "GMTM_SEND_RATE"
+	RATE_LIMIT_ENV                       = "GMTM_RATE_LIMIT"
+	RATE_BURST_ENV                       = "GMTM_RATE_BURST"
+	REQUEST_TIMEOUT_ENV                  = "GMTM_REQUEST_TIMEOUT"
+	MAX_PAGES_ENV                        = "GMTM_MAX_PAGES"
+	MAX_RESULTS_ENV                      = "GMTM_MAX_RESULTS"
+	PAGE_SIZE_ENV                        = "GMTM_PAGE_SIZE"
+	MIN_RATING_ENV                       = "GMTM_MIN_RATING"
+	PARSE_MODE_ENV                       = "GMTM_PARSE_MODE"
+	LIST_STYLE_ENV                       = "GMTM_LIST_STYLE"
+	ADMIN_CHAT_ID_ENV                    = "GMTM_ADMIN_CHAT_ID"
+	FIELDS_ENV                           = "GMTM_FIELDS"
+	LOCALE_ENV                           = "GMTM_LOCALE"
+	DEDUP_FILE_ENV                       = "GMTM_DEDUP_FILE"
+	QUOTES_ENV                           = "GMTM_QUOTES"
+	UPDATE_TIMEOUT_ENV                   = "GMTM_UPDATE_TIMEOUT"
+	SEND_POSTERS_ENV                     = "GMTM_SEND_POSTERS"
+	SHOW_GENRES_ENV                      = "GMTM_SHOW_GENRES"
+	SHOW_PLOTS_ENV                       = "GMTM_SHOW_PLOTS"
+	PLOT_LENGTH_ENV                      = "GMTM_PLOT_LENGTH"
+	SEND_TYPING_ENV                      = "GMTM_SEND_TYPING"
+	KEEP_DUPLICATES_ENV                  = "GMTM_KEEP_DUPLICATES"
+	SEARCH_FALLBACK_ENV                  = "GMTM_SEARCH_FALLBACK"
+	LINK_PREVIEWS_ENV                    = "GMTM_LINK_PREVIEWS"
+	SILENT_ENV                           = "GMTM_SILENT"
+	OVERFLOW_ENV                         = "GMTM_OVERFLOW"
+	DEBOUNCE_ENV                         = "GMTM_DEBOUNCE"
+	MAX_RETRIES_ENV                      = "GMTM_MAX_RETRIES"
+	RETRY_BASE_DELAY_ENV                 = "GMTM_RETRY_BASE_DELAY"
+	SCRAPE_DELAY_ENV                     = "GMTM_SCRAPE_DELAY"
+	SCRAPE_RANDOM_DELAY_ENV              = "GMTM_SCRAPE_RANDOM_DELAY"
+	SCRAPE_PARALLELISM_ENV               = "GMTM_SCRAPE_PARALLELISM"
+	USER_AGENT_ENV                       = "GMTM_USER_AGENT"
+	DEFAULT_LANGUAGE                     = "en"
+	IMDB_BASE_URL                        = "https://www.imdb.com"
+	SOURCE_URL                           = "https://github.com/MehdiEidi/gmtm"
+	IMDB_KEYWORD_SEARCH_PATH             = "/search/keyword/?keywords="
+	IMDB_GENRE_SEARCH_PATH               = "/search/title/?genres="
+	IMDB_TITLE_SEARCH_PATH               = "/search/title/?"
+	IMDB_CHART_PATH                      = "/chart/"
+	TMDB_API_BASE_URL                    = "https://api.themoviedb.org/3"
+	TMDB_MOVIE_BASE_URL                  = "https://www.themoviedb.org/movie/"
+	TMDB_IMAGE_BASE_URL                  = "https://image.tmdb.org/t/p/w500"
+	TMDB_API_KEY_ENV                     = "TMDB_API_KEY"
+	MOVIE_SOURCE_ENV                     = "MOVIE_SOURCE"
+	MOVIE_SOURCE_IMDB                    = "imdb"
+	MOVIE_SOURCE_TMDB                    = "tmdb"
+	HTTP_CLIENT_TIMEOUT                  = 10 * time.Second
+	DEFAULT_MAX_PAGES                    = 1
+	DEFAULT_SCRAPE_TIMEOUT               = 10 * time.Second
+	DEFAULT_SCRAPE_DELAY                 = 500 * time.Millisecond
+	DEFAULT_SCRAPE_RANDOM_DELAY          = time.Second
+	DEFAULT_SCRAPE_PARALLELISM           = 2
+	DEFAULT_SCRAPE_ATTEMPTS              = 3
+	DEFAULT_SCRAPE_RETRY_DELAY           = time.Second
+	DEFAULT_USER_AGENT                   = "gmtm/1.0 (+https://github.com/MehdiEidi/gmtm)"
+	DEFAULT_LOCALE                       = "en-US"
+	TELEGRAM_MAX_MESSAGE_LEN             = 4096
+	MAX_MESSAGES_PER_REPLY               = 3
+	TELEGRAM_MAX_CALLBACK_DATA_LEN       = 64
+	MAX_SEARCH_URL_LEN                   = 2000
+	DEFAULT_PAGE_SIZE                    = 10
+	DEFAULT_PLOT_LENGTH                  = 160
+	MAX_KEYWORDS                         = 10
+	MAX_UPDATE_SIZE                      = 1 << 20
+	MAX_VOICE_SIZE                       = 5 << 20
+	MAX_BATCH_FILE_SIZE                  = 16 << 10
+	DEFAULT_CHART_RESULTS                = 10
+	MAX_CHART_RESULTS                    = 50
+	MAX_BATCH_QUERIES                    = 5
+	BATCH_RESULTS_PER_QUERY              = 5
+	MAX_TOP_RESULTS                      = 50
+	INLINE_QUERY_MAX_RESULTS             = 50
+	INLINE_QUERY_CACHE_TIME              = 5 * time.Minute
+	MORE_CALLBACK_PREFIX                 = "more:"
+	SEARCH_CALLBACK_PREFIX               = "search:"
+	SAVE_CALLBACK_PREFIX                 = "save:"
+	DEFAULT_MAX_RETRIES                  = 3
+	DEFAULT_RATE_LIMIT                   = 0.5
+	DEFAULT_RATE_BURST                   = 3
+	DEFAULT_DEDUP_SIZE                   = 10000
+	DEFAULT_DEDUP_TTL                    = time.Hour
+	MIN_DEDUP_COMPACTION                 = 1000
+	DEFAULT_CACHE_TTL                    = time.Hour
+	DEFAULT_BREAKER_THRESHOLD            = 5
+	DEFAULT_BREAKER_COOLDOWN             = 30 * time.Second
+	DEFAULT_MAX_SCRAPES                  = 8
+	MAX_ANY_SEARCHES                     = 2
+	DEFAULT_SEND_RATE                    = 30
+	DEFAULT_SCRAPE_WAIT                  = 2 * time.Second
+	DEFAULT_HISTORY_SIZE                 = 10
+	DEFAULT_MAX_FAVORITES                = 50
+	DEFAULT_RETRY_BASE_DELAY             = 500 * time.Millisecond
+	POLL_TIMEOUT                         = 8 * time.Second
+	POLL_CONFIRM_TIMEOUT                 = 5 * time.Second
+	DEFAULT_UPDATE_TIMEOUT               = 25 * time.Second
+	TIMEOUT_APOLOGY_BUDGET               = 3 * time.Second
+	PREVIEW_RESPONSE_BODY                = `{"ok":true}`
 )
 
-var telegramAPI = TELEGRAM_API_BASE_URL + os.Getenv(BOT_TOKEN_ENV) + TELEGRAM_API_SEND_MESSAGE
+// Version is the version of the bot reported by /about. releases stamp it at build time, e.g.
+//
+//	go build -ldflags "-X github.com/MehdiEidi/gmtm/api.Version=v1.2.0"
+var Version = "dev"
+
+// httpClient is the client used for every call to the Telegram API, unless the bot has its own Client. Unlike http.DefaultClient it has a timeout, so a
+// hanging Telegram API can't block the webhook forever, and its transport keeps idle connections around for reuse.
+var httpClient = &http.Client{
+	Timeout: HTTP_CLIENT_TIMEOUT,
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
 
 // Update is a Telegram object that we receive every time a user interacts with the bot.
 type Update struct {
-	UpdateID int     `json:"update_id"`
-	Message  Message `json:"message"`
+	UpdateID      int            `json:"update_id"`
+	Message       Message        `json:"message"`
+	CallbackQuery *CallbackQuery `json:"callback_query"`
+	InlineQuery   *InlineQuery   `json:"inline_query"`
 }
 
 // String implements the fmt.String interface to get the representation of an Update as a string.
 func (u Update) String() string {
-	return fmt.Sprintf("(update id: %d, message: %s)", u.UpdateID, u.Message)
+	return fmt.Sprintf("(update id: %d, message: %s, callback query: %v, inline query: %v)", u.UpdateID, u.Message, u.CallbackQuery, u.InlineQuery)
+}
+
+// CallbackQuery is a Telegram object that we receive when a user taps a button of an inline keyboard.
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	Data    string   `json:"data"`
+	From    User     `json:"from"`
+	Message *Message `json:"message"`
+}
+
+// String implements the fmt.String interface to get the representation of a CallbackQuery as a string.
+func (q CallbackQuery) String() string {
+	return fmt.Sprintf("(id: %s, data: %s, from: %s, message: %v)", q.ID, q.Data, q.From, q.Message)
+}
+
+// User is a Telegram user or bot.
+type User struct {
+	ID           int    `json:"id"`
+	FirstName    string `json:"first_name"`
+	Username     string `json:"username"`
+	LanguageCode string `json:"language_code"`
+	IsBot        bool   `json:"is_bot"`
+}
+
+// String implements the fmt.String interface to get the representation of a User as a string.
+func (u User) String() string {
+	return fmt.Sprintf("(id: %d, username: %s, bot: %t)", u.ID, u.Username, u.IsBot)
 }
 
 // Message is a Telegram object that can be found in an update.
 type Message struct {
-	Text     string   `json:"text"`
-	Chat     Chat     `json:"chat"`
-	Audio    Audio    `json:"audio"`
-	Voice    Voice    `json:"voice"`
-	Document Document `json:"document"`
+	MessageID int      `json:"message_id"`
+	From      *User    `json:"from"`
+	Text      string   `json:"text"`
+	Chat      Chat     `json:"chat"`
+	Audio     Audio    `json:"audio"`
+	Voice     Voice    `json:"voice"`
+	Document  Document `json:"document"`
+
+	// MessageThreadID is the forum topic the message was sent in, if IsTopicMessage. the other messages may carry
+	// the thread of the replies they belong to, which the answers don't have to be sent in.
+	MessageThreadID int  `json:"message_thread_id"`
+	IsTopicMessage  bool `json:"is_topic_message"`
+
+	// ReplyToMessage is the message this one replies to, nil if it isn't a reply.
+	ReplyToMessage *Message `json:"reply_to_message"`
 }
 
 // String implements the fmt.String interface to get the representation of a Message as a string.
 func (m Message) String() string {
-	return fmt.Sprintf("(text: %s, chat: %s, audio %s)", m.Text, m.Chat, m.Audio)
+	return fmt.Sprintf("(text: %s, from: %v, chat: %s, audio %s)", m.Text, m.From, m.Chat, m.Audio)
 }
 
 // Audio refer to a audio file sent.
@@ -67,6 +243,8 @@ type Voice Audio
 type Document struct {
 	FileID   string `json:"file_id"`
 	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	FileSize int    `json:"file_size"`
 }
 
 // String implements the fmt.String interface to get the representation of an Document as a string.
@@ -74,105 +252,2018 @@ func (d Document) String() string {
 	return fmt.Sprintf("(file id: %s, file name: %s)", d.FileID, d.FileName)
 }
 
+// the kinds of Message, as returned by messageKind.
+const (
+	TEXT_MESSAGE     = "text"
+	AUDIO_MESSAGE    = "audio"
+	VOICE_MESSAGE    = "voice"
+	DOCUMENT_MESSAGE = "document"
+	UNKNOWN_MESSAGE  = "unknown"
+)
+
+// messageKind classifies m by its content. a message with text is a text message even if it has a file attached.
+func messageKind(m Message) string {
+	switch {
+	case m.Text != "":
+		return TEXT_MESSAGE
+	case m.Audio.FileID != "":
+		return AUDIO_MESSAGE
+	case m.Voice.FileID != "":
+		return VOICE_MESSAGE
+	case m.Document.FileID != "":
+		return DOCUMENT_MESSAGE
+	}
+	return UNKNOWN_MESSAGE
+}
+
 // Chat indicates the conversation to which the Message belongs.
 type Chat struct {
-	ID int `json:"id"`
+	ID   int      `json:"id"`
+	Type ChatType `json:"type"`
+}
+
+// ChatType is the kind of a Chat.
+type ChatType string
+
+// the types of the chats.
+const (
+	CHAT_TYPE_PRIVATE    ChatType = "private"
+	CHAT_TYPE_GROUP      ChatType = "group"
+	CHAT_TYPE_SUPERGROUP ChatType = "supergroup"
+	CHAT_TYPE_CHANNEL    ChatType = "channel"
+)
+
+// isGroup reports whether the chat is a group, in which the bot only answers the messages addressed to it.
+func (c Chat) isGroup() bool {
+	return c.Type == CHAT_TYPE_GROUP || c.Type == CHAT_TYPE_SUPERGROUP
 }
 
 // String implements the fmt.String interface to get the representation of a Chat as a string.
 func (c Chat) String() string {
-	return fmt.Sprintf("(id: %d)", c.ID)
+	return fmt.Sprintf("(id: %d, type: %s)", c.ID, c.Type)
+}
+
+// Bot is a http.Handler which answers the Telegram updates posted to its webhook.
+type Bot struct {
+	// Source finds the movies, e.g. a Scraper of IMDB or a TMDBSource.
+	Source MovieSource
+
+	// PageSize is the number of movies sent for a keyword search. the rest are sent when the user taps "Show more".
+	// zero means DEFAULT_PAGE_SIZE.
+	PageSize int
+
+	// SendPosters sends the poster of the first movie of a keyword search, captioned with its title, before the list.
+	SendPosters bool
+
+	// Fields are the fields of the movies shown in the lists, whatever the Source finds, e.g. FIELD_YEAR | FIELD_RATING
+	// for more detailed lists. zero means DEFAULT_FIELDS, which shows the titles alone.
+	Fields Fields
+
+	// ShowGenres shows the genres of the movies next to their titles, if the Source knows them.
+	ShowGenres bool
+
+	// ShowPlots shows the plot summary of every movie under its title, if the Source knows it, cut to PlotLength
+	// characters. zero PlotLength means DEFAULT_PLOT_LENGTH.
+	ShowPlots  bool
+	PlotLength int
+
+	// SendTyping shows the user the bot is typing while a keyword search is scraped. Telegram stops showing it once the
+	// reply is sent, or after a few seconds.
+	SendTyping bool
+
+	// MaxResults caps the number of movies sent for a search, after they are sorted. /top overrides it. zero doesn't
+	// cap them.
+	MaxResults int
+
+	// KeepDuplicates keeps the movies a search lists more than once. by default they are merged into one, with the
+	// highest rating of them.
+	KeepDuplicates bool
+
+	// SearchFallback shows the movies of a looser keyword search, labeled as related results, when nothing matches all
+	// the keywords. see SearchOptions.Fallback.
+	SearchFallback bool
+
+	// MinRating drops the movies rated below it from the results. zero keeps every movie, rated or not.
+	MinRating float64
+
+	// MaxRetries is the number of times a Telegram API call is retried after a 429 or 5xx response. zero means
+	// DEFAULT_MAX_RETRIES and a negative value disables retries.
+	MaxRetries int
+
+	// RetryBaseDelay is the delay before the first retry, doubled on every following one. zero means
+	// DEFAULT_RETRY_BASE_DELAY.
+	RetryBaseDelay time.Duration
+
+	// ParseMode is the formatting of the replies. the zero value sends plain text.
+	ParseMode ParseMode
+
+	// ListStyle is how the movies of the lists are numbered. the zero value numbers them plainly.
+	ListStyle ListStyle
+
+	// LinkPreviews lets Telegram preview the first link of a message, e.g. the page of the first movie of a list. by
+	// default the previews are disabled, since they bury the lists under the page of a single movie.
+	LinkPreviews bool
+
+	// Silent delivers the messages of the bot without a notification.
+	Silent bool
+
+	// Quotes is which chats the answers to a message quote it in, so it's clear which query they answer. the zero
+	// value quotes it in the groups only, where the answers to several users are mixed.
+	Quotes QuoteMode
+
+	// Overflow is how the replies longer than a Telegram message are sent. the zero value splits them into several
+	// messages.
+	Overflow OverflowMode
+
+	// Catalog holds the texts the bot sends, in the language of every user. nil uses DefaultCatalog.
+	Catalog Catalog
+
+	// Username is the username of the bot, without the "@". in groups, it tells the commands and the replies addressed
+	// to the bot from the ones addressed to other bots. empty answers the commands and the replies to any bot.
+	Username string
+
+	// SecretToken is the secret Telegram sends in the SECRET_TOKEN_HEADER of every update posted to the webhook, once
+	// SetWebhook registered it. the updates without it are refused, so only Telegram can post them. empty doesn't check
+	// the header.
+	SecretToken string
+
+	// AllowedChats restricts the bot to the chats in it, by ID. the updates of the other chats aren't answered, save for
+	// a short "not authorized" message. the inline queries are checked against the ID of the user. nil or empty doesn't
+	// restrict the bot.
+	AllowedChats map[int]bool
+
+	// Limiter limits the number of messages each chat can send to the bot. nil disables rate limiting.
+	Limiter *RateLimiter
+
+	// Logger logs what the bot does. nil logs with the log package.
+	Logger Logger
+
+	// Metrics receives the measurements of the bot. nil drops them.
+	Metrics Metrics
+
+	// Cache stores the movies found by a search for later identical searches. nil disables caching.
+	Cache Cache
+
+	// Breaker stops searching the Source for a while once it keeps failing. nil disables it.
+	Breaker *CircuitBreaker
+
+	// Scrapes limits the searches of the Source running at once. the bots can share one to limit the whole process.
+	// nil doesn't limit them.
+	Scrapes *ScrapeLimiter
+
+	// Sends queues the messages sent by the bot, to keep within the rate Telegram allows a bot. the bots of the same
+	// token can share one. nil sends them right away.
+	Sends *SendQueue
+
+	// History remembers the searches of every chat for /history. nil disables the history.
+	History HistoryStore
+
+	// Favorites remembers the movies every chat has saved. nil disables the favorites.
+	Favorites FavoritesStore
+
+	// Preferences remembers the defaults every chat has set for its keyword searches. nil disables /setdefault.
+	Preferences PreferencesStore
+
+	// Rand picks the movie of /random. nil uses the math/rand package.
+	Rand   *rand.Rand
+	randMu sync.Mutex
+
+	// Preview answers the updates without calling Telegram, writing the calls it would make to the HTTP response
+	// instead, so the bot can be tried with curl, posting the update with a "Content-Type: application/json" header.
+	// it is off by default.
+	Preview bool
+
+	// UpdateTimeout bounds the time an update is answered in, searches and Telegram calls included, so the webhook
+	// returns before a serverless platform kills it. zero means DEFAULT_UPDATE_TIMEOUT.
+	UpdateTimeout time.Duration
+
+	// Dedup remembers the handled updates so the ones Telegram redelivers are ignored. nil disables deduplication.
+	Dedup DedupStore
+
+	// Debounce is the time a text message waits for the next one of its chat. a message followed by another one that
+	// soon isn't answered, and its answer is canceled if it has started, so a user typing several searches quickly
+	// gets the answer of the last one only. zero answers every message.
+	Debounce  time.Duration
+	debouncer debouncer
+
+	// Client makes the calls to the Telegram API. nil uses a client shared by the bots, which times out after
+	// HTTP_CLIENT_TIMEOUT.
+	Client *http.Client
+
+	// SpeechToText transcribes the voice messages and the audio files, which are then searched like text messages. nil
+	// answers them as unsupported, see FileTranscriber to plug in a speech to text provider.
+	SpeechToText SpeechToText
+
+	// AdminChatID is the chat /feedback forwards the feedback of the users to, e.g. the private chat of the operator
+	// with the bot. zero turns /feedback off.
+	AdminChatID int
+
+	// OnBlocked is called with the chat of a Telegram call which failed since the user has blocked the bot, e.g. to
+	// forget the History, Favorites and Preferences of the chat. nil does nothing but log it.
+	OnBlocked func(ctx context.Context, chatID int)
+
+	// APIBaseURL is the URL the Telegram API methods of the bot are called on, followed by the token, e.g.
+	// "http://localhost:8081/bot" for a local Bot API server. empty means TELEGRAM_API_BASE_URL.
+	APIBaseURL string
+
+	token string
+}
+
+// NewHandler returns a Bot which talks to Telegram using the given bot token. if token is empty, it falls back to the
+// TELEGRAM_BOT_TOKEN environment variable. the other settings of the bot are read from the environment by LoadConfig,
+// e.g. the movie source from MOVIE_SOURCE, the chats the bot is restricted to from GMTM_ALLOWED_CHATS and the proxy
+// of its requests from GMTM_PROXY. an error is returned if one of the variables is malformed, instead of ignoring it.
+func NewHandler(token string) (*Bot, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		cfg.Token = token
+	}
+	return NewHandlerFromConfig(cfg)
+}
+
+// parseChatIDs parses a comma separated list of chat IDs into a set. an empty list is parsed to nil.
+func parseChatIDs(list string) (map[int]bool, error) {
+	var ids map[int]bool
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chat id %q", field)
+		}
+
+		if ids == nil {
+			ids = make(map[int]bool)
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+var (
+	defaultBotMu sync.Mutex
+	defaultBot   *Bot
+)
+
+// getDefaultBot returns the Bot used by Handler, creating it on the first call. it is shared by all the requests so
+// its state, e.g. the handled updates, outlives a single update.
+func getDefaultBot() (*Bot, error) {
+	defaultBotMu.Lock()
+	defer defaultBotMu.Unlock()
+
+	if defaultBot == nil {
+		bot, err := NewHandler("")
+		if err != nil {
+			return nil, err
+		}
+		defaultBot = bot
+	}
+
+	return defaultBot, nil
 }
 
-// Handler sends a message back to the chat.
+// Handler sends a message back to the chat. the bot token is read from the TELEGRAM_BOT_TOKEN environment variable.
+// panics are recovered with RecoverMiddleware, and logged with the Logger of the bot.
 func Handler(w http.ResponseWriter, r *http.Request) {
-	update, err := parseIncomingRequest(r)
+	bot, err := getDefaultBot()
+	if err != nil {
+		stdLogger{}.Error("error creating the bot", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	RecoverMiddleware(bot.Logger)(bot).ServeHTTP(w, r)
+}
+
+// ServeHTTP implements the http.Handler interface. it parses the update posted to the webhook, answers it with
+// processUpdate and reports the outcome with the status code: 405 if the request isn't a POST, 403 if it doesn't carry
+// the SecretToken of the bot, 415 if its body isn't JSON, as Telegram always posts, 413 if the update is larger than
+// MAX_UPDATE_SIZE, 400 if it can't be parsed otherwise, 500 if answering it fails and 200 on success. the secret token
+// is checked first, so the requests not coming from Telegram learn nothing about the ones the bot accepts. in preview
+// mode nothing is sent and the Telegram API calls are written to the response as a JSON array of PreviewCalls.
+func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		b.logger(r.Context()).Info("refusing request which isn't a POST", "method", r.Method, "remote_addr", r.RemoteAddr)
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !b.authorized(r) {
+		b.logger(r.Context()).Info("refusing update without the secret token", "remote_addr", r.RemoteAddr)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if !isJSON(r) {
+		b.logger(r.Context()).Info("refusing request which isn't JSON", "content_type", r.Header.Get("Content-Type"), "remote_addr", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	update, err := parseIncomingRequest(w, r)
 	if err != nil {
-		log.Printf("error parsing incoming update, %s", err.Error())
+		b.logger(r.Context()).Error("error parsing incoming update", "error", err)
+		if errors.Is(err, errUpdateTooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		return
+	}
+
+	ctx := r.Context()
+	var p *preview
+	if b.Preview {
+		p = &preview{}
+		ctx = withPreview(ctx, p)
+	}
+
+	if err := b.processUpdate(ctx, update); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if p != nil {
+		if err := p.write(w); err != nil {
+			b.logger(ctx).Error("error writing the preview", "update_id", update.UpdateID, "error", err)
+		}
 		return
 	}
 
-	telegramResponseBody, err := sendToClient(update.Message.Chat.ID, update.Message.Text)
+	w.WriteHeader(http.StatusOK)
+}
+
+// processUpdate answers update, however it was received: it is shared by ServeHTTP and Poll. the updates which were
+// already handled are ignored, unless ctx previews the answer so an update can be previewed as many times as it's
+// posted. the updates which couldn't be answered are forgotten, so they're answered when Telegram delivers them
+// again. the update is answered within the UpdateTimeout of the bot, and if it isn't, the user is sent an apology
+// instead. the outcome is logged, and every entry logged for the update carries a request ID of its own, or the one
+// ctx already carries, e.g. from RecoverMiddleware.
+func (b *Bot) processUpdate(ctx context.Context, update *Update) error {
+	b.metrics().UpdateReceived()
+	if requestIDFrom(ctx) == "" {
+		ctx = withRequestID(ctx, newRequestID())
+	}
+
+	if b.Dedup != nil && previewFrom(ctx) == nil {
+		seen, err := b.Dedup.Seen(update.UpdateID)
+		if err != nil {
+			b.logger(ctx).Error("error checking if the update was already handled", "update_id", update.UpdateID, "error", err)
+		}
+		if seen {
+			b.logger(ctx).Info("ignoring update, it is already handled", "update_id", update.UpdateID)
+			return nil
+		}
+	}
+
+	updateCtx, cancel := context.WithTimeout(ctx, b.updateTimeout())
+	defer cancel()
+
+	telegramResponseBody, err := b.answerUpdate(updateCtx, update)
+	if errors.Is(err, ErrBotBlocked) {
+		// the user won't see the answer, so the update is done with: Telegram delivering it again wouldn't help.
+		b.logger(ctx).Info("not answering update, the bot was blocked by the user", "update_id", update.UpdateID)
+		return nil
+	}
 	if err != nil {
-		log.Printf("got error %s from telegram, response body is %s", err.Error(), telegramResponseBody)
+		b.logger(ctx).Error("error answering update", "update_id", update.UpdateID, "error", err, "response_body", telegramResponseBody)
+		if updateCtx.Err() == context.DeadlineExceeded {
+			b.apologize(ctx, update)
+		}
+		b.forget(ctx, update)
+		return err
+	}
+
+	b.logger(ctx).Info("successfully answered update", "update_id", update.UpdateID)
+	return nil
+}
+
+// forget forgets the update in the Dedup store of the bot, since it couldn't be answered: Telegram delivers it again
+// for the error returned, and it is answered then.
+func (b *Bot) forget(ctx context.Context, update *Update) {
+	if b.Dedup == nil || previewFrom(ctx) != nil {
+		return
+	}
+	if err := b.Dedup.Forget(update.UpdateID); err != nil {
+		b.logger(ctx).Error("error forgetting the update", "update_id", update.UpdateID, "error", err)
+	}
+}
+
+// updateTimeout returns the time an update is answered in, falling back to DEFAULT_UPDATE_TIMEOUT.
+func (b *Bot) updateTimeout() time.Duration {
+	if b.UpdateTimeout <= 0 {
+		return DEFAULT_UPDATE_TIMEOUT
+	}
+	return b.UpdateTimeout
+}
+
+// apologize tells the user who sent update that it took too long to answer. it has TIMEOUT_APOLOGY_BUDGET to do so,
+// even though ctx may be done already. the inline queries get no apology: the bot may not be allowed to message their
+// users.
+func (b *Bot) apologize(ctx context.Context, update *Update) {
+	if update.InlineQuery != nil || update.CallbackQuery == nil && messageKind(update.Message) == UNKNOWN_MESSAGE {
 		return
 	}
 
-	log.Printf("successfully distributed to chat id %d", update.Message.Chat.ID)
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, TIMEOUT_APOLOGY_BUDGET)
+	defer cancel()
+	ctx = updateContext(ctx, update)
+
+	chatID := updateChat(update)
+	if _, err := b.sendMessage(ctx, chatID, b.text(ctx, TIMEOUT_TEXT)); err != nil {
+		b.logger(ctx).Error("error apologizing for the timeout", "update_id", update.UpdateID, "chat_id", chatID, "error", err)
+	}
+}
+
+// detachedContext carries the values of its parent but is never done, even once the parent is. it lets the bot finish
+// talking to the user after the context of the update expired.
+type detachedContext struct {
+	parent context.Context
+}
+
+// Deadline implements the context.Context interface.
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done implements the context.Context interface.
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err implements the context.Context interface.
+func (detachedContext) Err() error {
+	return nil
+}
+
+// Value implements the context.Context interface.
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// updateContext returns a context in which the texts are sent to the user who sent update, in their language if the
+// update has one, and in the forum topic of the update if it was sent in one.
+func updateContext(ctx context.Context, update *Update) context.Context {
+	if sender := updateSender(update); sender != nil {
+		ctx = withLanguage(withSender(ctx, sender), sender.LanguageCode)
+	}
+	if threadID := updateThread(update); threadID != 0 {
+		ctx = withThread(ctx, updateChat(update), threadID)
+	}
+	if update.CallbackQuery == nil && update.InlineQuery == nil && update.Message.MessageID != 0 {
+		ctx = withQuoted(ctx, update.Message)
+	}
+	return ctx
+}
+
+// answerUpdate answers update according to its kind and returns the body of the last telegram response. the texts are
+// sent in the language of the user, if the update has one.
+func (b *Bot) answerUpdate(ctx context.Context, update *Update) (string, error) {
+	ctx = updateContext(ctx, update)
+
+	if chatID := updateChat(update); len(b.AllowedChats) > 0 && !b.AllowedChats[chatID] {
+		return b.rejectUpdate(ctx, update, chatID)
+	}
+
+	switch {
+	case update.CallbackQuery != nil:
+		return b.handleCallbackQuery(ctx, update.CallbackQuery)
+
+	case update.InlineQuery != nil:
+		return b.handleInlineQuery(ctx, update.InlineQuery)
+
+	case !b.addressed(&update.Message):
+		b.logger(ctx).Info("ignoring group message not addressed to the bot", "update_id", update.UpdateID, "chat_id", update.Message.Chat.ID)
+		return "", nil
+
+	case messageKind(update.Message) == TEXT_MESSAGE && b.Debounce > 0:
+		return b.answerDebouncedText(ctx, update)
+
+	case messageKind(update.Message) == TEXT_MESSAGE:
+		return b.answerText(ctx, update)
+
+	case messageKind(update.Message) == VOICE_MESSAGE, messageKind(update.Message) == AUDIO_MESSAGE:
+		return b.answerVoice(ctx, update)
+
+	case messageKind(update.Message) == DOCUMENT_MESSAGE:
+		return b.answerDocument(ctx, update)
+
+	case messageKind(update.Message) != UNKNOWN_MESSAGE:
+		return b.sendMessage(ctx, update.Message.Chat.ID, b.text(ctx, MEDIA_NOT_SUPPORTED_TEXT))
+	}
+
+	b.logger(ctx).Info("ignoring update, it has no message we can answer", "update_id", update.UpdateID)
+	return "", nil
+}
+
+// answerText answers the text message of update, unless its chat is rate limited by the Limiter of the bot.
+func (b *Bot) answerText(ctx context.Context, update *Update) (string, error) {
+	if b.Limiter != nil && !b.Limiter.Allow(update.Message.Chat.ID) {
+		b.logger(ctx).Info("chat is rate limited", "update_id", update.UpdateID, "chat_id", update.Message.Chat.ID)
+		return b.sendMessage(ctx, update.Message.Chat.ID, b.text(ctx, SLOW_DOWN_TEXT))
+	}
+	return b.sendToClient(ctx, update.Message.Chat.ID, update.Message.Text)
+}
+
+// answerDebouncedText is answerText, debounced by the Debounce of the bot. the messages superseded by a later one of
+// their chat aren't answered, and they aren't errors: Telegram shouldn't deliver them again.
+func (b *Bot) answerDebouncedText(ctx context.Context, update *Update) (string, error) {
+	chatID := update.Message.Chat.ID
+
+	debouncedCtx, done, ok := b.debouncer.debounce(ctx, chatID, b.Debounce)
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		b.logger(ctx).Info("ignoring message, a later one of the chat supersedes it", "update_id", update.UpdateID, "chat_id", chatID)
+		return "", nil
+	}
+	defer done()
+
+	body, err := b.answerText(debouncedCtx, update)
+	if err != nil && debouncedCtx.Err() != nil && ctx.Err() == nil {
+		b.logger(ctx).Info("stopped answering message, a later one of the chat supersedes it", "update_id", update.UpdateID, "chat_id", chatID)
+		return body, nil
+	}
+	return body, err
+}
+
+// updateSender returns the user who sent update, or nil if it doesn't say, e.g. for messages sent on behalf of a
+// channel.
+func updateSender(update *Update) *User {
+	switch {
+	case update.CallbackQuery != nil:
+		return &update.CallbackQuery.From
+	case update.InlineQuery != nil:
+		return &update.InlineQuery.From
+	}
+	return update.Message.From
+}
+
+// updateChat returns the ID of the chat update was sent in. the inline queries, and the callback queries of the
+// messages sent inline, aren't sent in a chat: the ID of their sender is returned instead, which is the ID of their
+// private chat with the bot.
+func updateChat(update *Update) int {
+	switch {
+	case update.CallbackQuery != nil:
+		if update.CallbackQuery.Message != nil {
+			return update.CallbackQuery.Message.Chat.ID
+		}
+		return update.CallbackQuery.From.ID
+	case update.InlineQuery != nil:
+		return update.InlineQuery.From.ID
+	}
+	return update.Message.Chat.ID
+}
+
+// updateThread returns the ID of the forum topic update was sent in, or 0 if it wasn't sent in one.
+func updateThread(update *Update) int {
+	message := &update.Message
+	switch {
+	case update.CallbackQuery != nil:
+		message = update.CallbackQuery.Message
+	case update.InlineQuery != nil:
+		return 0
+	}
+
+	if message == nil || !message.IsTopicMessage {
+		return 0
+	}
+	return message.MessageThreadID
+}
+
+// rejectUpdate tells the user of a chat which isn't allowed that they aren't authorized, without doing anything else
+// update asks for.
+func (b *Bot) rejectUpdate(ctx context.Context, update *Update, chatID int) (string, error) {
+	b.logger(ctx).Info("chat is not allowed", "update_id", update.UpdateID, "chat_id", chatID)
+
+	switch {
+	case update.CallbackQuery != nil:
+		return b.answerCallbackQuery(ctx, update.CallbackQuery.ID, b.localize(ctx, NOT_AUTHORIZED_TEXT))
+	case update.InlineQuery != nil:
+		return b.answerInlineQuery(ctx, update.InlineQuery.ID, []InlineQueryResultArticle{})
+	case messageKind(update.Message) != UNKNOWN_MESSAGE:
+		return b.sendMessage(ctx, chatID, b.text(ctx, NOT_AUTHORIZED_TEXT))
+	}
+	return "", nil
+}
+
+// senderKey is the context key of the user an update is answered to.
+type senderKey struct{}
+
+// withSender returns a context carrying the user an update is answered to.
+func withSender(ctx context.Context, sender *User) context.Context {
+	return context.WithValue(ctx, senderKey{}, sender)
+}
+
+// senderFrom returns the user of ctx, or nil if it's unknown.
+func senderFrom(ctx context.Context) *User {
+	sender, _ := ctx.Value(senderKey{}).(*User)
+	return sender
+}
+
+// threadKey is the context key of the forum topic an update is answered in.
+type threadKey struct{}
+
+// topic is a forum topic of a chat.
+type topic struct {
+	chatID   int
+	threadID int
+}
+
+// withThread returns a context in which the messages sent to the chat are sent in the forum topic with threadID.
+func withThread(ctx context.Context, chatID, threadID int) context.Context {
+	return context.WithValue(ctx, threadKey{}, topic{chatID: chatID, threadID: threadID})
+}
+
+// quotedKey is the context key of the message an update is answered to.
+type quotedKey struct{}
+
+// withQuoted returns a context in which the messages sent to the chat of message may quote it, see Bot.Quotes.
+func withQuoted(ctx context.Context, message Message) context.Context {
+	return context.WithValue(ctx, quotedKey{}, message)
+}
+
+// quotedFrom returns the message of ctx the messages sent to the chat may quote, and whether there is one.
+func quotedFrom(ctx context.Context, chatID int) (Message, bool) {
+	message, ok := ctx.Value(quotedKey{}).(Message)
+	return message, ok && message.Chat.ID == chatID
+}
+
+// threadFrom returns the forum topic of ctx the messages to the chat are sent in, or 0 if they aren't sent in one.
+// the messages sent to the other chats, e.g. the feedback forwarded to the admin, aren't sent in the topic.
+func threadFrom(ctx context.Context, chatID int) int {
+	if t, ok := ctx.Value(threadKey{}).(topic); ok && t.chatID == chatID {
+		return t.threadID
+	}
+	return 0
+}
+
+// logger returns the Logger of the bot, falling back to one writing with the log package. the entries logged while an
+// update is answered carry the request ID of ctx.
+func (b *Bot) logger(ctx context.Context) Logger {
+	var logger Logger = stdLogger{}
+	if b.Logger != nil {
+		logger = b.Logger
+	}
+
+	if id := requestIDFrom(ctx); id != "" {
+		return requestLogger{logger: logger, requestID: id}
+	}
+	return logger
+}
+
+// apiURL returns the URL of the given Telegram Bot API method for this bot.
+func (b *Bot) apiURL(method string) string {
+	base := b.APIBaseURL
+	if base == "" {
+		base = TELEGRAM_API_BASE_URL
+	}
+	return base + b.token + method
+}
+
+// client returns the Client of the bot, falling back to the shared httpClient.
+func (b *Bot) client() *http.Client {
+	if b.Client == nil {
+		return httpClient
+	}
+	return b.Client
+}
+
+// isJSON reports whether the body of r is JSON by its Content-Type, e.g. "application/json; charset=utf-8".
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
 }
 
-// parseIncomingRequest parses incoming update to Update.
-func parseIncomingRequest(r *http.Request) (*Update, error) {
+// authorized reports whether r carries the SecretToken of the bot, or the bot has none, see hasSecretToken.
+func (b *Bot) authorized(r *http.Request) bool {
+	return hasSecretToken(r, b.SecretToken)
+}
+
+// errUpdateTooLarge is returned by parseIncomingRequest when the body of the request is larger than MAX_UPDATE_SIZE.
+var errUpdateTooLarge = fmt.Errorf("incoming update is larger than %d bytes", MAX_UPDATE_SIZE)
+
+// parseIncomingRequest parses incoming update to Update. bodies larger than MAX_UPDATE_SIZE aren't read to their end,
+// so a client can't exhaust the memory, and errUpdateTooLarge is returned for them.
+func parseIncomingRequest(w http.ResponseWriter, r *http.Request) (*Update, error) {
 	var update Update
 
-	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
-		log.Printf("could not decode incoming update %s", err.Error())
-		return nil, err
+	// one byte past the limit is read, so a body of exactly MAX_UPDATE_SIZE bytes is told apart from a larger one
+	// whatever error the read ends with.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MAX_UPDATE_SIZE+1))
+	if len(body) > MAX_UPDATE_SIZE {
+		return nil, errUpdateTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read incoming update: %w", err)
+	}
+
+	if err := json.Unmarshal(body, &update); err != nil {
+		return nil, fmt.Errorf("could not decode incoming update: %w", err)
 	}
 
 	if update.UpdateID == 0 {
-		log.Printf("invalid update id, got update id = 0")
 		return nil, errors.New("invalid update id. 0 indicates failure to parse incoming update")
 	}
 
 	return &update, nil
 }
 
-// sendToClient sends a text message to the Telegram chat identified by the chat ID.
-func sendToClient(chatID int, incomingText string) (string, error) {
-	sendValues := url.Values{"chat_id": {strconv.Itoa(chatID)}}
+// sendToClient sends a text message to the Telegram chat identified by the chat ID. texts longer than the Telegram
+// limit are sent as several messages. nothing is posted once ctx is done. the reply is formatted in the ParseMode of
+// the bot, so commands escape the plain text they return.
+func (b *Bot) sendToClient(ctx context.Context, chatID int, incomingText string) (string, error) {
+	var rep reply
 
-	switch incomingText {
-	case "/start":
-		text := "Hey dude!\nGive me some keywords (comma delimited) to recommend you movies :D"
-		sendValues.Add("text", text)
+	name, args := parseCommand(incomingText)
+	if cmd, ok := commands[name]; ok {
+		rep = cmd(b, ctx, chatID, args)
+	} else {
+		if b.SendTyping {
+			if body, err := b.sendChatAction(ctx, chatID, CHAT_ACTION_TYPING); err != nil {
+				b.logger(ctx).Error("error sending the typing action", "chat_id", chatID, "error", err, "response_body", body)
+			}
+		}
+		rep = b.searchPage(ctx, chatID, incomingText, 0)
+	}
 
-	default:
-		keywords := getKeywords(incomingText)
-		movies := getMovies(keywords)
-		sendValues.Add("text", movies)
+	return b.sendReply(ctx, chatID, rep)
+}
+
+// reply is the answer of the bot to an update.
+type reply struct {
+	text   string
+	markup *InlineKeyboardMarkup
+
+	// photo is the URL of an image sent with caption before the text, if it's not empty.
+	photo   string
+	caption string
+}
+
+// sendReply sends rep to the chat, splitting its text into several messages if it's longer than the Telegram limit, or
+// truncating it if the bot overflows with OVERFLOW_TRUNCATE. the inline keyboard is attached to the last message. if
+// the photo can't be sent, only the text is.
+func (b *Bot) sendReply(ctx context.Context, chatID int, rep reply) (string, error) {
+	if rep.photo != "" {
+		if _, err := b.sendPhoto(ctx, chatID, rep.photo, rep.caption); err != nil {
+			b.logger(ctx).Error("error sending the photo", "chat_id", chatID, "photo", rep.photo, "error", err)
+		}
 	}
 
-	response, err := http.PostForm(telegramAPI, sendValues)
-	if err != nil {
-		log.Printf("error when posting text to the chat: %s", err.Error())
-		return "", err
+	var chunks []string
+	if b.Overflow == OVERFLOW_TRUNCATE {
+		chunks = []string{truncateMessage(rep.text, TELEGRAM_MAX_MESSAGE_LEN, func(omitted int) string {
+			return b.text(ctx, TRUNCATED_TEXT, omitted)
+		})}
+	} else {
+		chunks = splitMessage(rep.text, TELEGRAM_MAX_MESSAGE_LEN)
 	}
-	defer response.Body.Close()
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		log.Printf("error in parsing telegram response %s", err.Error())
-		return "", err
+	var body string
+	for i, chunk := range chunks {
+		var markup *InlineKeyboardMarkup
+		if i == len(chunks)-1 {
+			markup = rep.markup
+		}
+
+		var err error
+		body, err = b.sendMessageWithMarkup(ctx, chatID, chunk, markup)
+		if err != nil {
+			return body, err
+		}
 	}
 
-	log.Printf("body of the telegram response: %s", string(body))
+	return body, nil
+}
+
+// callbackHandler answers a CallbackQuery. args is the callback data following the "<name>:" prefix.
+type callbackHandler func(b *Bot, ctx context.Context, query *CallbackQuery, args string) (string, error)
 
-	return string(body), nil
+// callbackHandlers maps the prefix of the callback data of the buttons the bot makes to the handler of their taps.
+var callbackHandlers = map[string]callbackHandler{
+	"more":   (*Bot).moreCallback,
+	"search": (*Bot).searchCallback,
+	"save":   (*Bot).saveCallback,
 }
 
-// getMovies constructs an IMDB URL which will be used to scrape movies out of it. it returns list of scraped movies.
-func getMovies(keywords []string) string {
-	URL := IMDB_URL + keywords[0]
-	for i := 1; i < len(keywords); i++ {
-		URL += "%2C" + keywords[i]
+// handleCallbackQuery answers the tap on a button of an inline keyboard. the query is answered first, so the client
+// stops showing its spinner, then it is routed by the prefix of its data.
+func (b *Bot) handleCallbackQuery(ctx context.Context, query *CallbackQuery) (string, error) {
+	if body, err := b.answerCallbackQuery(ctx, query.ID, ""); err != nil {
+		b.logger(ctx).Error("error answering callback query", "callback_query_id", query.ID, "error", err, "response_body", body)
 	}
 
-	c := colly.NewCollector()
+	if query.Message == nil {
+		b.logger(ctx).Info("ignoring callback query, it has no message", "callback_query_id", query.ID)
+		return "", nil
+	}
 
-	var movies string
+	name, args := query.Data, ""
+	if i := strings.Index(query.Data, ":"); i >= 0 {
+		name, args = query.Data[:i], query.Data[i+1:]
+	}
 
-	c.OnHTML(`h3[class="lister-item-header"]`, func(element *colly.HTMLElement) {
-		movies += strings.TrimSpace(element.DOM.Children().Text()) + "\n"
-	})
+	handler, ok := callbackHandlers[name]
+	if !ok {
+		b.logger(ctx).Info("ignoring callback query, unknown data", "callback_query_id", query.ID, "data", query.Data)
+		return "", nil
+	}
 
-	c.Visit(URL)
+	return handler(b, ctx, query, args)
+}
+
+// moreCallback shows the next page of a keyword search when "Show more" is tapped. the page replaces the one the
+// button is under, so the chat isn't cluttered with a message per page. it is sent as a new message if the message
+// can't be edited, e.g. if the page doesn't fit in a single message or the message is too old.
+func (b *Bot) moreCallback(ctx context.Context, query *CallbackQuery, args string) (string, error) {
+	keywords, offset, err := parseMoreCallbackData(args)
+	if err != nil {
+		b.logger(ctx).Info("ignoring callback query", "callback_query_id", query.ID, "error", err)
+		return "", nil
+	}
 
-	return movies
+	chatID := query.Message.Chat.ID
+	rep := b.searchPage(ctx, chatID, keywords, offset)
+	if rep.photo == "" && len(rep.text) <= TELEGRAM_MAX_MESSAGE_LEN {
+		body, err := b.editMessage(ctx, chatID, query.Message.MessageID, rep.text, rep.markup)
+		if err == nil {
+			return body, nil
+		}
+		b.logger(ctx).Error("error editing the message, sending a new one", "chat_id", chatID, "message_id", query.Message.MessageID, "error", err, "response_body", body)
+	}
+
+	return b.sendReply(ctx, chatID, rep)
 }
 
-// getKeywords parses incoming text and returns keywords
-func getKeywords(incomingText string) []string {
-	incomingText = strings.ReplaceAll(incomingText, " ", "")
-	return strings.Split(incomingText, ",")
+// saveCallback saves a movie to the favorites of the chat when its "❤" button is tapped.
+func (b *Bot) saveCallback(ctx context.Context, query *CallbackQuery, args string) (string, error) {
+	return b.sendReply(ctx, query.Message.Chat.ID, b.saveFavorite(ctx, query.Message.Chat.ID, args))
+}
+
+// searchCallback runs a search again when one of the buttons of /history is tapped.
+func (b *Bot) searchCallback(ctx context.Context, query *CallbackQuery, args string) (string, error) {
+	return b.sendReply(ctx, query.Message.Chat.ID, b.searchPage(ctx, query.Message.Chat.ID, args, 0))
+}
+
+// searchPage returns a page of the movies matching the keywords in incomingText, starting at offset. if there are more
+// movies, the reply has a "Show more" button whose callback data carries the keywords and the next offset, so no
+// state has to be kept between the pages. the first page records the search in the History of the bot. the movies are
+// searched with the Preferences of the chat, and labeled as related results if the search falls back to a looser one.
+// the user is told about the keywords dropped by trimKeywords.
+func (b *Bot) searchPage(ctx context.Context, chatID int, incomingText string, offset int) reply {
+	keywords := getKeywords(incomingText)
+	if text, ok := b.checkKeywords(ctx, keywords); !ok {
+		return reply{text: text}
+	}
+	keywords, notice := b.trimKeywords(ctx, keywords)
+
+	if offset == 0 && b.History != nil {
+		if err := b.History.Record(chatID, keywords); err != nil {
+			b.logger(ctx).Error("error recording the search", "chat_id", chatID, "error", err)
+		}
+	}
+
+	// the movies are capped by SearchMovies already, to the MaxResults of the preferences if they set one.
+	movies, searched, err := searchMovies(ctx, keywords, b.searchOptions(ctx, chatID))
+	if err != nil || len(movies) == 0 {
+		return reply{text: notice + b.limitedMoviesText(ctx, movies, err, 0)}
+	}
+
+	pageMovies, more := paginate(movies, offset, b.pageSize())
+	if len(pageMovies) == 0 {
+		return reply{text: b.text(ctx, NO_MORE_RESULTS_TEXT)}
+	}
+
+	// the movies which don't fit in the reply are left for the next page.
+	opts := b.formatOptions()
+	opts.offset, opts.maxLen = offset, TELEGRAM_MAX_MESSAGE_LEN*MAX_MESSAGES_PER_REPLY
+	page, shown := formatMovieList(pageMovies, opts)
+	if shown < len(pageMovies) {
+		pageMovies, more = pageMovies[:shown], true
+	}
+
+	rep := reply{text: page}
+	if len(searched) < len(keywords) {
+		rep.text = b.text(ctx, RELATED_RESULTS_TEXT, strings.Join(searched, ", ")) + "\n" + page
+	}
+	rep.text = notice + rep.text
+	if b.SendPosters && offset == 0 && movies[0].PosterURL != "" {
+		rep.photo = movies[0].PosterURL
+		rep.caption = b.ParseMode.escape(movies[0].Title)
+	}
+
+	var keyboard [][]InlineKeyboardButton
+	if b.Favorites != nil {
+		keyboard = saveButtons(pageMovies)
+	}
+	if data := moreCallbackData(keywords, offset+len(pageMovies)); more && len(data) <= TELEGRAM_MAX_CALLBACK_DATA_LEN {
+		keyboard = append(keyboard, []InlineKeyboardButton{{Text: b.localize(ctx, SHOW_MORE_TEXT), CallbackData: data}})
+	}
+	if len(keyboard) > 0 {
+		rep.markup = &InlineKeyboardMarkup{InlineKeyboard: keyboard}
+	}
+
+	return rep
+}
+
+// saveButtons returns a "❤" button for each of the movies, which saves it to the favorites of the chat when tapped.
+// the movies whose title doesn't fit in the callback data have no button.
+func saveButtons(movies []Movie) [][]InlineKeyboardButton {
+	var keyboard [][]InlineKeyboardButton
+	for _, movie := range movies {
+		data := SAVE_CALLBACK_PREFIX + movie.Title
+		if len(data) > TELEGRAM_MAX_CALLBACK_DATA_LEN {
+			continue
+		}
+		keyboard = append(keyboard, []InlineKeyboardButton{{Text: "❤ " + movie.Title, CallbackData: data}})
+	}
+	return keyboard
+}
+
+// paginate returns the movies from offset on, at most size of them, and whether there are more movies after them.
+func paginate(movies []Movie, offset, size int) (page []Movie, more bool) {
+	if offset >= len(movies) {
+		return nil, false
+	}
+
+	end := offset + size
+	if end >= len(movies) {
+		return movies[offset:], false
+	}
+
+	return movies[offset:end], true
+}
+
+// moreCallbackData returns the callback data of the "Show more" button, "more:<keywords>:<offset>".
+func moreCallbackData(keywords []string, offset int) string {
+	return MORE_CALLBACK_PREFIX + strings.Join(keywords, ",") + ":" + strconv.Itoa(offset)
+}
+
+// parseMoreCallbackData parses the callback data of the "Show more" button made by moreCallbackData, without its
+// prefix.
+func parseMoreCallbackData(data string) (keywords string, offset int, err error) {
+	i := strings.LastIndex(data, ":")
+	if i < 0 {
+		return "", 0, errors.New("invalid show more callback data " + data)
+	}
+
+	offset, err = strconv.Atoi(data[i+1:])
+	if err != nil || offset < 0 {
+		return "", 0, errors.New("invalid show more offset " + data[i+1:])
+	}
+
+	return data[:i], offset, nil
+}
+
+// defaultFilter returns the filter applied to the searches which don't set their own.
+func (b *Bot) defaultFilter() filter {
+	return filter{minRating: b.MinRating, keepDuplicates: b.KeepDuplicates}
+}
+
+// searchOptions returns the SearchOptions of the keyword searches of the chat: the defaults of the bot, overridden by
+// the Preferences of the chat. the defaults of the bot are used alone if the preferences can't be read.
+func (b *Bot) searchOptions(ctx context.Context, chatID int) SearchOptions {
+	opts := SearchOptions{
+		Source:         cachedSource{b},
+		MinRating:      b.MinRating,
+		MaxResults:     b.MaxResults,
+		KeepDuplicates: b.KeepDuplicates,
+		Fallback:       b.SearchFallback,
+	}
+	if b.Preferences == nil {
+		return opts
+	}
+
+	prefs, err := b.Preferences.Get(chatID)
+	if err != nil {
+		b.logger(ctx).Error("error getting the preferences", "chat_id", chatID, "error", err)
+		return opts
+	}
+
+	if prefs.MinRating > 0 {
+		opts.MinRating = prefs.MinRating
+	}
+	opts.SortBy = prefs.SortBy
+	if prefs.MaxResults > 0 {
+		opts.MaxResults = prefs.MaxResults
+	}
+	return opts
+}
+
+// pageSize returns the number of movies of a page, falling back to DEFAULT_PAGE_SIZE.
+func (b *Bot) pageSize() int {
+	if b.PageSize <= 0 {
+		return DEFAULT_PAGE_SIZE
+	}
+	return b.PageSize
+}
+
+// search returns the movies matching the keywords in incomingText and f, or a message telling the user why there are
+// none.
+func (b *Bot) search(ctx context.Context, incomingText string, f filter) string {
+	keywords := getKeywords(incomingText)
+	if text, ok := b.checkKeywords(ctx, keywords); !ok {
+		return text
+	}
+
+	keywords, notice := b.trimKeywords(ctx, keywords)
+	movies, err := b.getMovies(ctx, keywords, f)
+	return notice + b.moviesText(ctx, movies, err)
+}
+
+// trimKeywords drops the trailing keywords which don't fit in the QueryBudget of the MovieSource, see fitKeywords. the
+// keywords are in the order the user typed them, see getKeywords, so the ones typed last are dropped. none are dropped
+// if the source isn't a QueryBudgeter. the notice returned tells the user which keywords were dropped, on a line of its
+// own, and is empty if none were.
+func (b *Bot) trimKeywords(ctx context.Context, keywords []string) ([]string, string) {
+	budgeter, ok := b.Source.(QueryBudgeter)
+	if !ok {
+		return keywords, ""
+	}
+
+	kept := fitKeywords(budgeter.QueryBudget(), keywords)
+	if len(kept) == len(keywords) {
+		return keywords, ""
+	}
+
+	b.logger(ctx).Info("dropping the keywords over the query budget of the source", "keywords", keywords, "kept", len(kept))
+	return kept, b.text(ctx, KEYWORDS_DROPPED_TEXT, strings.Join(keywords[len(kept):], ", ")) + "\n"
+}
+
+// checkKeywords reports whether keywords can be searched. if they can't, it returns the message telling the user why.
+func (b *Bot) checkKeywords(ctx context.Context, keywords []string) (string, bool) {
+	switch {
+	case len(keywords) == 0:
+		return b.text(ctx, NO_KEYWORDS_TEXT), false
+	case len(keywords) > MAX_KEYWORDS:
+		return b.text(ctx, TOO_MANY_KEYWORDS_TEXT, MAX_KEYWORDS), false
+	}
+	return "", true
+}
+
+// moviesText returns the list of movies formatted in the parse mode of the bot, or a message telling the user why
+// there are none. the list is capped to the MaxResults of the bot, and to MAX_MESSAGES_PER_REPLY Telegram messages.
+func (b *Bot) moviesText(ctx context.Context, movies []Movie, err error) string {
+	return b.limitedMoviesText(ctx, movies, err, b.MaxResults)
+}
+
+// limitedMoviesText is like moviesText, with the list capped to maxResults movies instead. zero doesn't cap it.
+func (b *Bot) limitedMoviesText(ctx context.Context, movies []Movie, err error, maxResults int) string {
+	if maxResults > 0 && len(movies) > maxResults {
+		movies = movies[:maxResults]
+	}
+
+	switch {
+	case errors.Is(err, ErrNoResults), err == nil && len(movies) == 0:
+		return b.text(ctx, NO_RESULTS_TEXT)
+	case errors.Is(err, ErrInvalidKeywords):
+		return b.text(ctx, NO_KEYWORDS_TEXT)
+	case errors.Is(err, ErrRateLimited):
+		b.logger(ctx).Error("rate limited getting movies", "error", err)
+		return b.text(ctx, SOURCE_BUSY_TEXT)
+	case errors.Is(err, ErrCircuitOpen):
+		b.logger(ctx).Info("not getting movies, the movie source keeps failing", "error", err)
+		return b.text(ctx, SOURCE_UNAVAILABLE_TEXT)
+	case errors.Is(err, ErrBusy):
+		b.logger(ctx).Info("not getting movies, too many searches are running", "error", err)
+		return b.text(ctx, BUSY_TEXT)
+	case err != nil:
+		b.logger(ctx).Error("error getting movies", "error", err)
+		return b.text(ctx, SCRAPE_FAILED_TEXT)
+	}
+
+	opts := b.formatOptions()
+	opts.maxLen = TELEGRAM_MAX_MESSAGE_LEN * MAX_MESSAGES_PER_REPLY
+	return formatMovies(movies, opts)
+}
+
+// formatOptions returns the options the movies sent by the bot are formatted with.
+func (b *Bot) formatOptions() formatOptions {
+	plotLen := b.PlotLength
+	if plotLen <= 0 {
+		plotLen = DEFAULT_PLOT_LENGTH
+	}
+	fields := b.Fields
+	if fields == 0 {
+		fields = DEFAULT_FIELDS
+	}
+	if b.ShowGenres {
+		fields |= FIELD_GENRES
+	}
+	if b.ShowPlots {
+		fields |= FIELD_PLOT
+	}
+	return formatOptions{mode: b.ParseMode, fields: fields, plotLen: plotLen, style: b.ListStyle}
+}
+
+// getMovies searches the keywords with SearchMovies and returns the movies satisfying f. the movies of the search are
+// cached, and the actual searches are reported to the Metrics of the bot.
+func (b *Bot) getMovies(ctx context.Context, keywords []string, f filter) ([]Movie, error) {
+	return SearchMovies(ctx, keywords, SearchOptions{
+		Source:         cachedSource{b},
+		MinRating:      f.minRating,
+		MinYear:        f.minYear,
+		MaxYear:        f.maxYear,
+		Kinds:          f.kinds,
+		KeepDuplicates: f.keepDuplicates,
+	})
+}
+
+// getMoviesByGenre searches the genre with the MovieSource of the bot, the same way getMovies does.
+func (b *Bot) getMoviesByGenre(ctx context.Context, genre string, f filter) ([]Movie, error) {
+	movies, err := cachedSource{b}.SearchGenre(ctx, genre)
+	return f.apply(movies), err
+}
+
+// getTrending returns the movies trending on the MovieSource of the bot which satisfy f. they are cached like the
+// movies of getMovies.
+func (b *Bot) getTrending(ctx context.Context, f filter) ([]Movie, error) {
+	movies, err := cachedSource{b}.Trending(ctx)
+	return f.apply(movies), err
+}
+
+// getChart returns the titles of the chart on the MovieSource of the bot which satisfy f, cached like the movies of
+// getMovies. they keep the Rank they have on the chart.
+func (b *Bot) getChart(ctx context.Context, chart Chart, f filter) ([]Movie, error) {
+	movies, err := cachedSource{b}.Chart(ctx, chart)
+	return f.apply(movies), err
+}
+
+// getMoviesByTitle runs the advanced title search with the MovieSource of the bot, the same way getMovies does.
+func (b *Bot) getMoviesByTitle(ctx context.Context, params TitleSearchParams, f filter) ([]Movie, error) {
+	movies, err := cachedSource{b}.SearchByTitle(ctx, params)
+	return f.apply(movies), err
+}
+
+// cachedSource is a MovieSource searching the MovieSource of the bot through cachedSearch.
+type cachedSource struct {
+	b *Bot
+}
+
+// Search implements the MovieSource interface.
+func (s cachedSource) Search(ctx context.Context, keywords []string) ([]Movie, error) {
+	return s.b.cachedSearch(ctx, cacheKey("keywords", keywords), func() ([]Movie, error) {
+		return s.b.Source.Search(ctx, keywords)
+	})
+}
+
+// SearchGenre implements the MovieSource interface.
+func (s cachedSource) SearchGenre(ctx context.Context, genre string) ([]Movie, error) {
+	return s.b.cachedSearch(ctx, cacheKey("genre", []string{genre}), func() ([]Movie, error) {
+		return s.b.Source.SearchGenre(ctx, genre)
+	})
+}
+
+// SearchByTitle implements the MovieSource interface.
+func (s cachedSource) SearchByTitle(ctx context.Context, params TitleSearchParams) ([]Movie, error) {
+	return s.b.cachedSearch(ctx, cacheKey("title", []string{params.String()}), func() ([]Movie, error) {
+		return s.b.Source.SearchByTitle(ctx, params)
+	})
+}
+
+// Chart implements the MovieSource interface.
+func (s cachedSource) Chart(ctx context.Context, chart Chart) ([]Movie, error) {
+	return s.b.cachedSearch(ctx, cacheKey("chart", []string{string(chart)}), func() ([]Movie, error) {
+		return s.b.Source.Chart(ctx, chart)
+	})
+}
+
+// Trending implements the MovieSource interface.
+func (s cachedSource) Trending(ctx context.Context) ([]Movie, error) {
+	return s.b.cachedSearch(ctx, cacheKey("trending", nil), func() ([]Movie, error) {
+		return s.b.Source.Trending(ctx)
+	})
+}
+
+// cachedSearch returns the movies cached under key, or calls search and caches its movies if it succeeds. search isn't
+// called while the Breaker of the bot is open, and waits for a slot of its Scrapes limiter.
+func (b *Bot) cachedSearch(ctx context.Context, key string, search func() ([]Movie, error)) ([]Movie, error) {
+	if b.Cache != nil {
+		if movies, ok := b.Cache.Get(key); ok {
+			return movies, nil
+		}
+	}
+
+	var movies []Movie
+	measured := func() error {
+		start := time.Now()
+		var err error
+		movies, err = search()
+		b.metrics().ScrapeDone(time.Since(start), err)
+		return err
+	}
+
+	// the breaker is inside the limiter, so the searches refused for being too many aren't failures of the source.
+	guarded := measured
+	if b.Breaker != nil {
+		guarded = func() error { return b.Breaker.Do(ctx, measured) }
+	}
+
+	var err error
+	if b.Scrapes != nil {
+		err = b.Scrapes.Do(ctx, guarded)
+	} else {
+		err = guarded()
+	}
+
+	if err == nil && b.Cache != nil {
+		b.Cache.Set(key, movies)
+	}
+
+	return movies, err
+}
+
+// cacheKey returns the key the movies of a search are cached under. the terms are expected to be normalized by
+// getKeywords, and are sorted, so the same search typed differently shares the key.
+func cacheKey(kind string, terms []string) string {
+	sorted := append([]string(nil), terms...)
+	sort.Strings(sorted)
+	return kind + ":" + strings.Join(sorted, ",")
+}
+
+// command answers a bot command. args is the text following the command name.
+type command func(b *Bot, ctx context.Context, chatID int, args string) reply
+
+// commands maps the supported command names to their implementation. any other text is treated as keywords.
+var commands = map[string]command{
+	"/start":         (*Bot).startCommand,
+	"/help":          (*Bot).helpCommand,
+	"/about":         (*Bot).aboutCommand,
+	"/year":          (*Bot).yearCommand,
+	"/genre":         (*Bot).genreCommand,
+	"/trending":      (*Bot).trendingCommand,
+	"/top250":        (*Bot).top250Command,
+	"/chart":         (*Bot).chartCommand,
+	"/advanced":      (*Bot).advancedCommand,
+	"/sort":          (*Bot).sortCommand,
+	"/type":          (*Bot).typeCommand,
+	"/random":        (*Bot).randomCommand,
+	"/any":           (*Bot).anyCommand,
+	"/top":           (*Bot).topCommand,
+	"/history":       (*Bot).historyCommand,
+	"/save":          (*Bot).saveCommand,
+	"/favorites":     (*Bot).favoritesCommand,
+	"/setdefault":    (*Bot).setDefaultCommand,
+	"/defaults":      (*Bot).defaultsCommand,
+	"/cleardefaults": (*Bot).clearDefaultsCommand,
+	"/feedback":      (*Bot).feedbackCommand,
+}
+
+// addressed reports whether the bot should answer message. in groups only the commands and the replies addressed to the
+// bot are answered, so the bot doesn't answer every message of the group. in the other chats every message is.
+func (b *Bot) addressed(message *Message) bool {
+	if !message.Chat.isGroup() {
+		return true
+	}
+
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.IsBot &&
+		(b.Username == "" || strings.EqualFold(reply.From.Username, b.Username)) {
+		return true
+	}
+
+	username, ok := commandUsername(message.Text)
+	return ok && (username == "" || b.Username == "" || strings.EqualFold(username, b.Username))
+}
+
+// commandUsername returns the bot username following the command name of text, e.g. "MyBot" for "/help@MyBot", or ""
+// if the command isn't addressed to a bot. ok is false if text is not a command.
+func commandUsername(text string) (username string, ok bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", false
+	}
+
+	name := text
+	if i := strings.IndexAny(text, " \t\n"); i >= 0 {
+		name = text[:i]
+	}
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		return name[i+1:], true
+	}
+	return "", true
+}
+
+// parseCommand splits text into a command name and its arguments. the bot username that Telegram appends to commands
+// in groups ("/help@MyBot") is dropped. name is empty if text is not a command.
+func parseCommand(text string) (name, args string) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", text
+	}
+
+	name = text
+	if i := strings.IndexAny(text, " \t\n"); i >= 0 {
+		name, args = text[:i], strings.TrimSpace(text[i+1:])
+	}
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+
+	return name, args
+}
+
+// startCommand greets the user, by their first name if we know it. the payload of a deep link, e.g.
+// https://t.me/<bot>?start=horror, follows /start: it is searched like the keywords of a plain message instead.
+func (b *Bot) startCommand(ctx context.Context, chatID int, args string) reply {
+	if len(getKeywords(args)) > 0 {
+		return b.searchPage(ctx, chatID, args, 0)
+	}
+
+	name := b.localize(ctx, STRANGER_NAME_TEXT)
+	if sender := senderFrom(ctx); sender != nil && sender.FirstName != "" {
+		name = sender.FirstName
+	}
+	return reply{text: b.text(ctx, START_TEXT, name)}
+}
+
+// helpCommand lists the supported commands.
+func (b *Bot) helpCommand(ctx context.Context, chatID int, args string) reply {
+	return reply{text: b.text(ctx, HELP_TEXT)}
+}
+
+// aboutCommand tells the Version of the bot and where its source is.
+func (b *Bot) aboutCommand(ctx context.Context, chatID int, args string) reply {
+	return reply{text: b.text(ctx, ABOUT_TEXT, Version, SOURCE_URL)}
+}
+
+// feedbackCommand forwards the feedback of the user to the AdminChatID of the bot, along with who sent it.
+func (b *Bot) feedbackCommand(ctx context.Context, chatID int, args string) reply {
+	feedback := strings.TrimSpace(args)
+	switch {
+	case b.AdminChatID == 0:
+		return reply{text: b.text(ctx, FEEDBACK_DISABLED_TEXT)}
+	case feedback == "":
+		return reply{text: b.text(ctx, FEEDBACK_USAGE_TEXT)}
+	}
+
+	// the admin reads the feedback in the default language, whichever the user speaks.
+	adminCtx := withLanguage(ctx, "")
+	from := b.localize(adminCtx, STRANGER_NAME_TEXT)
+	if sender := senderFrom(ctx); sender != nil {
+		switch {
+		case sender.Username != "":
+			from = "@" + sender.Username
+		case sender.FirstName != "":
+			from = sender.FirstName
+		}
+	}
+
+	if body, err := b.sendMessage(ctx, b.AdminChatID, b.text(adminCtx, FEEDBACK_FORWARD_TEXT, from, chatID, feedback)); err != nil {
+		b.logger(ctx).Error("error forwarding the feedback", "chat_id", chatID, "error", err, "response_body", body)
+		return reply{text: b.text(ctx, FEEDBACK_FAILED_TEXT)}
+	}
+
+	return reply{text: b.text(ctx, FEEDBACK_THANKS_TEXT)}
+}
+
+// yearCommand searches the keywords following a year range. the range is inclusive and either end may be left out,
+// e.g. "1990-2000", "2010-", "-1980" or just "1999".
+func (b *Bot) yearCommand(ctx context.Context, chatID int, args string) reply {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return reply{text: b.text(ctx, YEAR_USAGE_TEXT)}
+	}
+
+	minYear, maxYear, err := parseYearRange(fields[0])
+	if err != nil {
+		return reply{text: b.text(ctx, INVALID_YEAR_RANGE_TEXT, fields[0])}
+	}
+
+	f := b.defaultFilter()
+	f.minYear, f.maxYear = minYear, maxYear
+	return reply{text: b.search(ctx, strings.Join(fields[1:], " "), f)}
+}
+
+// genreCommand recommends movies of the genre given as args.
+func (b *Bot) genreCommand(ctx context.Context, chatID int, args string) reply {
+	genre := strings.ToLower(strings.TrimSpace(args))
+	if !isGenre(genre) {
+		return reply{text: b.text(ctx, UNKNOWN_GENRE_TEXT, args, strings.Join(genres, ", "))}
+	}
+
+	movies, err := b.getMoviesByGenre(ctx, genre, b.defaultFilter())
+	return reply{text: b.moviesText(ctx, movies, err)}
+}
+
+// trendingCommand sends the movies which are popular right now.
+func (b *Bot) trendingCommand(ctx context.Context, chatID int, args string) reply {
+	movies, err := b.getTrending(ctx, b.defaultFilter())
+	return reply{text: b.moviesText(ctx, movies, err)}
+}
+
+// top250Command sends the best rated movies of the IMDB Top 250, the first DEFAULT_CHART_RESULTS of them unless args
+// is a number or a range of them, see chartRange.
+func (b *Bot) top250Command(ctx context.Context, chatID int, args string) reply {
+	return b.chartReply(ctx, CHART_TOP_250, strings.TrimSpace(args))
+}
+
+// chartCommand sends the titles of the chart named by the first of args, e.g. "/chart toptv 11-20". the titles sent
+// are chosen like the ones of top250Command.
+func (b *Bot) chartCommand(ctx context.Context, chatID int, args string) reply {
+	fields := strings.Fields(args)
+	if len(fields) == 0 || len(fields) > 2 {
+		return reply{text: b.text(ctx, CHART_USAGE_TEXT, chartNames())}
+	}
+
+	chart := Chart(strings.ToLower(fields[0]))
+	if !isChart(chart) {
+		return reply{text: b.text(ctx, UNKNOWN_CHART_TEXT, fields[0], chartNames())}
+	}
+
+	return b.chartReply(ctx, chart, strings.Join(fields[1:], " "))
+}
+
+// chartReply returns the reply listing the titles ranked in the range of the chart, see chartRange.
+func (b *Bot) chartReply(ctx context.Context, chart Chart, rangeText string) reply {
+	from, to, ok := chartRange(rangeText)
+	if !ok {
+		return reply{text: b.text(ctx, INVALID_CHART_RANGE_TEXT, rangeText, MAX_CHART_RESULTS)}
+	}
+
+	movies, err := b.getChart(ctx, chart, b.defaultFilter())
+	var ranked []Movie
+	for _, movie := range movies {
+		if movie.Rank >= from && movie.Rank <= to {
+			ranked = append(ranked, movie)
+		}
+	}
+
+	return reply{text: b.limitedMoviesText(ctx, ranked, err, 0)}
+}
+
+// chartRange parses the ranks of the titles of a chart to send: a number N for the first N titles, or a range like
+// "11-20". empty means the first DEFAULT_CHART_RESULTS. ok is false if text is neither, or if it spans more than
+// MAX_CHART_RESULTS titles.
+func chartRange(text string) (from, to int, ok bool) {
+	if text == "" {
+		return 1, DEFAULT_CHART_RESULTS, true
+	}
+
+	fromText, toText := "1", text
+	if i := strings.Index(text, "-"); i >= 0 {
+		fromText, toText = text[:i], text[i+1:]
+	}
+
+	from, err := strconv.Atoi(fromText)
+	if err != nil {
+		return 0, 0, false
+	}
+	to, err = strconv.Atoi(toText)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	if from < 1 || to < from || to-from+1 > MAX_CHART_RESULTS {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+// chartNames returns the supported Charts separated by commas.
+func chartNames() string {
+	names := make([]string, len(charts))
+	for i, chart := range charts {
+		names[i] = string(chart)
+	}
+	return strings.Join(names, ", ")
+}
+
+// advancedCommand runs the advanced title search of the "key=value" criteria given as args, e.g. "genre=horror
+// year=2000-2010 rating=7". see parseTitleSearchPair.
+func (b *Bot) advancedCommand(ctx context.Context, chatID int, args string) reply {
+	pairs := strings.Fields(args)
+	if len(pairs) == 0 {
+		return reply{text: b.text(ctx, ADVANCED_USAGE_TEXT)}
+	}
+
+	var params TitleSearchParams
+	for _, pair := range pairs {
+		if err := parseTitleSearchPair(pair, &params); err != nil {
+			return reply{text: b.text(ctx, INVALID_ADVANCED_TEXT, pair)}
+		}
+	}
+
+	movies, err := b.getMoviesByTitle(ctx, params, b.defaultFilter())
+	return reply{text: b.moviesText(ctx, movies, err)}
+}
+
+// parseTitleSearchPair parses a "key=value" criterion of /advanced into params. the keys are genre, one or more comma
+// separated genres, year, a range parsed by parseYearRange, rating, the minimum rating from 0 to 10, and sort, one of
+// sortBys.
+func parseTitleSearchPair(pair string, params *TitleSearchParams) error {
+	i := strings.Index(pair, "=")
+	if i < 0 {
+		return errors.New("invalid criterion " + pair + ". expected key=value")
+	}
+	key, value := strings.ToLower(pair[:i]), strings.ToLower(pair[i+1:])
+
+	switch key {
+	case "genre":
+		params.Genres = nil
+		for _, genre := range strings.Split(value, ",") {
+			if genre = strings.TrimSpace(genre); genre != "" {
+				params.Genres = append(params.Genres, genre)
+			}
+		}
+
+	case "year":
+		from, to, err := parseYearRange(value)
+		if err != nil {
+			return err
+		}
+		params.MinYear, params.MaxYear = from, to
+
+	case "rating":
+		rating, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		params.MinRating = rating
+
+	case "sort":
+		params.SortBy = SortBy(value)
+
+	default:
+		return errors.New("unknown criterion " + key)
+	}
+
+	return params.validate()
+}
+
+// sortCommand searches the keywords following a SortBy and sends the movies in that order. the other options are the
+// ones of a plain search, so the preferences of the chat apply but for their SortBy.
+func (b *Bot) sortCommand(ctx context.Context, chatID int, args string) reply {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return reply{text: b.text(ctx, SORT_USAGE_TEXT)}
+	}
+
+	by := SortBy(strings.ToLower(fields[0]))
+	if !isSortBy(by) {
+		return reply{text: b.text(ctx, UNKNOWN_SORT_TEXT, fields[0])}
+	}
+
+	keywords := getKeywords(strings.Join(fields[1:], " "))
+	if text, ok := b.checkKeywords(ctx, keywords); !ok {
+		return reply{text: text}
+	}
+
+	// the movies are capped by SearchMovies already, to the MaxResults of the preferences if they set one.
+	opts := b.searchOptions(ctx, chatID)
+	opts.SortBy = by
+	movies, err := SearchMovies(ctx, keywords, opts)
+	return reply{text: b.limitedMoviesText(ctx, movies, err, 0)}
+}
+
+// typeCommand searches the keywords following a Kind, e.g. "movie", and sends the titles of that kind only.
+func (b *Bot) typeCommand(ctx context.Context, chatID int, args string) reply {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return reply{text: b.text(ctx, TYPE_USAGE_TEXT)}
+	}
+
+	kind := Kind(strings.ToLower(fields[0]))
+	if !isKind(kind) {
+		return reply{text: b.text(ctx, UNKNOWN_TYPE_TEXT, fields[0], kindNames())}
+	}
+
+	f := b.defaultFilter()
+	f.kinds = []Kind{kind}
+	return reply{text: b.search(ctx, strings.Join(fields[1:], " "), f)}
+}
+
+// kindNames returns the supported Kinds separated by commas.
+func kindNames() string {
+	names := make([]string, len(kinds))
+	for i, kind := range kinds {
+		names[i] = string(kind)
+	}
+	return strings.Join(names, ", ")
+}
+
+// topCommand searches the keywords following a number N and sends only the first N movies, whatever the
+// MaxResults of the bot is. N is at most MAX_TOP_RESULTS.
+func (b *Bot) topCommand(ctx context.Context, chatID int, args string) reply {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return reply{text: b.text(ctx, TOP_USAGE_TEXT)}
+	}
+
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 1 || n > MAX_TOP_RESULTS {
+		return reply{text: b.text(ctx, INVALID_TOP_TEXT, fields[0], MAX_TOP_RESULTS)}
+	}
+
+	keywords := getKeywords(strings.Join(fields[1:], " "))
+	if text, ok := b.checkKeywords(ctx, keywords); !ok {
+		return reply{text: text}
+	}
+
+	movies, err := b.getMovies(ctx, keywords, b.defaultFilter())
+	return reply{text: b.limitedMoviesText(ctx, movies, err, n)}
+}
+
+// randomCommand searches the keywords given as args and sends one of the movies, picked at random.
+func (b *Bot) randomCommand(ctx context.Context, chatID int, args string) reply {
+	keywords := getKeywords(args)
+	if text, ok := b.checkKeywords(ctx, keywords); !ok {
+		return reply{text: text}
+	}
+
+	movies, err := b.getMovies(ctx, keywords, b.defaultFilter())
+	if err != nil || len(movies) == 0 {
+		return reply{text: b.moviesText(ctx, movies, err)}
+	}
+
+	movie := movies[b.intn(len(movies))]
+	return reply{text: formatMovie(b.formatOptions(), "", movie)}
+}
+
+// anyCommand searches each of the keywords given as args on its own and sends the movies matching any of them, rather
+// than all of them like a plain search.
+func (b *Bot) anyCommand(ctx context.Context, chatID int, args string) reply {
+	keywords := getKeywords(args)
+	if text, ok := b.checkKeywords(ctx, keywords); !ok {
+		return reply{text: text}
+	}
+
+	movies, err := b.getAnyMovies(ctx, keywords, b.defaultFilter())
+	if err != nil || len(movies) == 0 {
+		return reply{text: b.moviesText(ctx, movies, err)}
+	}
+
+	return reply{text: b.text(ctx, ANY_RESULTS_TEXT, strings.Join(keywords, ", ")) + "\n" + b.moviesText(ctx, movies, nil)}
+}
+
+// getAnyMovies searches every keyword on its own with getMovies, MAX_ANY_SEARCHES at the same time so a single /any
+// leaves the Scrapes of the bot to the searches of the other chats, and merges the results with mergeMovies. it fails
+// if any of the searches does, other than with ErrNoResults.
+func (b *Bot) getAnyMovies(ctx context.Context, keywords []string, f filter) ([]Movie, error) {
+	results := make([][]Movie, len(keywords))
+	errs := make([]error, len(keywords))
+
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for i := range keywords {
+			indexes <- i
+		}
+	}()
+
+	workers := MAX_ANY_SEARCHES
+	if len(keywords) < workers {
+		workers = len(keywords)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i], errs[i] = b.getMovies(ctx, []string{keywords[i]}, f)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, ErrNoResults) {
+			return nil, err
+		}
+	}
+	return mergeMovies(results), nil
+}
+
+// mergeMovies interleaves the lists of movies, so the most relevant movies of every list come first, and drops the
+// movies already merged from an earlier list, the same movie being told by its movieKey.
+func mergeMovies(lists [][]Movie) []Movie {
+	seen := make(map[movieKey]bool)
+
+	var merged []Movie
+	for i := 0; ; i++ {
+		done := true
+		for _, list := range lists {
+			if i >= len(list) {
+				continue
+			}
+			done = false
+
+			k := keyOf(list[i])
+			if !seen[k] {
+				seen[k] = true
+				merged = append(merged, list[i])
+			}
+		}
+		if done {
+			return merged
+		}
+	}
+}
+
+// intn returns a random number in [0, n) with the Rand of the bot.
+func (b *Bot) intn(n int) int {
+	if b.Rand == nil {
+		return rand.Intn(n)
+	}
+
+	b.randMu.Lock()
+	defer b.randMu.Unlock()
+	return b.Rand.Intn(n)
+}
+
+// historyCommand lists the last searches of the chat as buttons which run them again.
+func (b *Bot) historyCommand(ctx context.Context, chatID int, args string) reply {
+	if b.History == nil {
+		return reply{text: b.text(ctx, NO_HISTORY_TEXT)}
+	}
+
+	searches, err := b.History.Recent(chatID, DEFAULT_HISTORY_SIZE)
+	if err != nil {
+		b.logger(ctx).Error("error getting the history", "chat_id", chatID, "error", err)
+		return reply{text: b.text(ctx, NO_HISTORY_TEXT)}
+	}
+
+	var keyboard [][]InlineKeyboardButton
+	for _, keywords := range searches {
+		data := SEARCH_CALLBACK_PREFIX + strings.Join(keywords, ",")
+		if len(data) > TELEGRAM_MAX_CALLBACK_DATA_LEN {
+			continue
+		}
+		keyboard = append(keyboard, []InlineKeyboardButton{{Text: strings.Join(keywords, ", "), CallbackData: data}})
+	}
+
+	if len(keyboard) == 0 {
+		return reply{text: b.text(ctx, NO_HISTORY_TEXT)}
+	}
+
+	return reply{
+		text:   b.text(ctx, HISTORY_TEXT),
+		markup: &InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	}
+}
+
+// saveCommand saves the title given as args to the favorites of the chat.
+func (b *Bot) saveCommand(ctx context.Context, chatID int, args string) reply {
+	title := strings.TrimSpace(args)
+	if title == "" {
+		return reply{text: b.text(ctx, SAVE_USAGE_TEXT)}
+	}
+	return b.saveFavorite(ctx, chatID, title)
+}
+
+// saveFavorite saves title to the favorites of the chat and returns the reply telling the user how it went.
+func (b *Bot) saveFavorite(ctx context.Context, chatID int, title string) reply {
+	if b.Favorites == nil {
+		return reply{text: b.text(ctx, FAVORITES_DISABLED_TEXT)}
+	}
+
+	switch err := b.Favorites.Add(chatID, title); {
+	case errors.Is(err, ErrTooManyFavorites):
+		return reply{text: b.text(ctx, TOO_MANY_FAVORITES_TEXT)}
+	case err != nil:
+		b.logger(ctx).Error("error saving the favorite", "chat_id", chatID, "title", title, "error", err)
+		return reply{text: b.text(ctx, FAVORITES_FAILED_TEXT)}
+	}
+
+	return reply{text: b.text(ctx, SAVED_TEXT, title)}
+}
+
+// favoritesCommand lists the favorites of the chat.
+func (b *Bot) favoritesCommand(ctx context.Context, chatID int, args string) reply {
+	if b.Favorites == nil {
+		return reply{text: b.text(ctx, FAVORITES_DISABLED_TEXT)}
+	}
+
+	titles, err := b.Favorites.List(chatID)
+	if err != nil {
+		b.logger(ctx).Error("error listing the favorites", "chat_id", chatID, "error", err)
+		return reply{text: b.text(ctx, FAVORITES_FAILED_TEXT)}
+	}
+
+	if len(titles) == 0 {
+		return reply{text: b.text(ctx, NO_FAVORITES_TEXT)}
+	}
+
+	text := b.localize(ctx, FAVORITES_TEXT)
+	for i, title := range titles {
+		text += "\n" + strconv.Itoa(i+1) + ". " + title
+	}
+	return reply{text: b.ParseMode.escape(text)}
+}
+
+// setDefaultCommand sets the "key=value" Preferences given as args for the keyword searches of the chat. the
+// preferences which aren't given are kept.
+func (b *Bot) setDefaultCommand(ctx context.Context, chatID int, args string) reply {
+	if b.Preferences == nil {
+		return reply{text: b.text(ctx, PREFERENCES_DISABLED_TEXT)}
+	}
+
+	pairs := strings.Fields(args)
+	if len(pairs) == 0 {
+		return reply{text: b.text(ctx, SET_DEFAULT_USAGE_TEXT)}
+	}
+
+	prefs, err := b.Preferences.Get(chatID)
+	if err != nil {
+		b.logger(ctx).Error("error getting the preferences", "chat_id", chatID, "error", err)
+		return reply{text: b.text(ctx, PREFERENCES_FAILED_TEXT)}
+	}
+
+	for _, pair := range pairs {
+		if err := prefs.set(pair); err != nil {
+			return reply{text: b.text(ctx, INVALID_DEFAULT_TEXT, pair, MAX_TOP_RESULTS)}
+		}
+	}
+
+	if err := b.Preferences.Set(chatID, prefs); err != nil {
+		b.logger(ctx).Error("error setting the preferences", "chat_id", chatID, "error", err)
+		return reply{text: b.text(ctx, PREFERENCES_FAILED_TEXT)}
+	}
+	return reply{text: b.text(ctx, DEFAULTS_TEXT, prefs)}
+}
+
+// defaultsCommand sends the Preferences of the chat.
+func (b *Bot) defaultsCommand(ctx context.Context, chatID int, args string) reply {
+	if b.Preferences == nil {
+		return reply{text: b.text(ctx, PREFERENCES_DISABLED_TEXT)}
+	}
+
+	prefs, err := b.Preferences.Get(chatID)
+	if err != nil {
+		b.logger(ctx).Error("error getting the preferences", "chat_id", chatID, "error", err)
+		return reply{text: b.text(ctx, PREFERENCES_FAILED_TEXT)}
+	}
+
+	if prefs == (Preferences{}) {
+		return reply{text: b.text(ctx, NO_DEFAULTS_TEXT)}
+	}
+	return reply{text: b.text(ctx, DEFAULTS_TEXT, prefs)}
+}
+
+// clearDefaultsCommand forgets the Preferences of the chat.
+func (b *Bot) clearDefaultsCommand(ctx context.Context, chatID int, args string) reply {
+	if b.Preferences == nil {
+		return reply{text: b.text(ctx, PREFERENCES_DISABLED_TEXT)}
+	}
+
+	if err := b.Preferences.Clear(chatID); err != nil {
+		b.logger(ctx).Error("error clearing the preferences", "chat_id", chatID, "error", err)
+		return reply{text: b.text(ctx, PREFERENCES_FAILED_TEXT)}
+	}
+	return reply{text: b.text(ctx, DEFAULTS_CLEARED_TEXT)}
+}
+
+// parseYearRange parses an inclusive range of years such as "1990-2000". a missing end is returned as 0.
+func parseYearRange(text string) (from, to int, err error) {
+	fromText, toText := text, text
+	if i := strings.Index(text, "-"); i >= 0 {
+		fromText, toText = text[:i], text[i+1:]
+	}
+
+	if fromText != "" {
+		if from, err = strconv.Atoi(fromText); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if toText != "" {
+		if to, err = strconv.Atoi(toText); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if from == 0 && to == 0 || to != 0 && from > to {
+		return 0, 0, errors.New("invalid year range " + text)
+	}
+
+	return from, to, nil
+}
+
+// splitMessage breaks text into chunks of at most limit bytes. chunks are cut on newlines so a movie title is never
+// split, unless a single line is longer than limit by itself. empty chunks are dropped.
+func splitMessage(text string, limit int) []string {
+	var chunks []string
+	var chunk string
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		for len(line) > limit {
+			if chunk != "" {
+				chunks = append(chunks, chunk)
+				chunk = ""
+			}
+			cut := limit
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			chunks = append(chunks, line[:cut])
+			line = line[cut:]
+		}
+
+		if len(chunk)+len(line) > limit {
+			chunks = append(chunks, chunk)
+			chunk = ""
+		}
+		chunk += line
+	}
+
+	if strings.TrimSpace(chunk) != "" {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// QuoteMode is which chats a Bot quotes the messages it answers in.
+type QuoteMode string
+
+// the supported QuoteModes.
+const (
+	QUOTE_GROUPS QuoteMode = ""
+	QUOTE_ALWAYS QuoteMode = "always"
+	QUOTE_NEVER  QuoteMode = "never"
+)
+
+// quotes reports whether the answers to the messages of the chat quote them in the mode.
+func (m QuoteMode) quotes(chat Chat) bool {
+	switch m {
+	case QUOTE_ALWAYS:
+		return true
+	case QUOTE_NEVER:
+		return false
+	}
+	return chat.isGroup()
+}
+
+// OverflowMode is how a Bot sends a reply longer than a Telegram message.
+type OverflowMode string
+
+// the supported OverflowModes.
+const (
+	OVERFLOW_SPLIT    OverflowMode = ""
+	OVERFLOW_TRUNCATE OverflowMode = "truncate"
+)
+
+// truncateMessage cuts text on a newline so that it fits in limit bytes together with the notice of the number of
+// lines left out, which is appended to it. text is returned as is if it fits already. every line is left out if the
+// first one doesn't fit by itself.
+func truncateMessage(text string, limit int, notice func(omitted int) string) string {
+	if len(text) <= limit {
+		return text
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n")
+	kept, length := 0, 0
+	for kept < len(lines) && length+len(lines[kept]) <= limit {
+		length += len(lines[kept])
+		kept++
+	}
+	if kept == len(lines) {
+		return strings.Join(lines, "")
+	}
+
+	for {
+		tail := notice(len(lines) - kept)
+		if length+len(tail) <= limit || kept == 0 {
+			return strings.Join(lines[:kept], "") + tail
+		}
+		kept--
+		length -= len(lines[kept])
+	}
+}
+
+// getKeywords parses incoming text and returns keywords. the keywords are sanitized, see sanitizeKeyword, and
+// lowercased, and the empty or rejected ones are dropped. they keep the order they were typed in, since the keywords
+// typed last are the ones a search drops, see searchMovies and trimKeywords. "Action,Drama" and "drama, action" still
+// share their cached results, see cacheKey.
+func getKeywords(incomingText string) []string {
+	var keywords []string
+	for _, keyword := range strings.Split(incomingText, ",") {
+		if keyword := sanitizeKeyword(keyword); keyword != "" {
+			keywords = append(keywords, strings.ToLower(keyword))
+		}
+	}
+	return keywords
+}
+
+// sanitizeKeyword keeps only the letters, digits, spaces and hyphens of keyword, so it can't add query parameters or
+// path segments to the URLs it is searched with, e.g. "sci-fi/horror?page=2" becomes "sci-fi horror page 2". the other
+// characters are replaced with spaces, and the spaces are trimmed and collapsed. the letters and digits of any script
+// are kept, and the control characters, e.g. a newline, are replaced with spaces as well.
+func sanitizeKeyword(keyword string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			return r
+		}
+		return ' '
+	}, keyword)
+	return strings.Join(strings.Fields(sanitized), " ")
 }
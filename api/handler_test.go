@@ -0,0 +1,1728 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+	"unicode/utf8"
+)
+
+func TestParseIncomingRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantErr      bool
+		wantTooBig   bool
+		wantChatID   int
+		wantText     string
+		wantUpdateID int
+	}{
+		{name: "empty body", body: "", wantErr: true},
+		{name: "invalid json", body: `{"update_id": 1, "message": {`, wantErr: true},
+		{name: "too large", body: `{"update_id": 1, "message": {"text": "` + strings.Repeat("a", MAX_UPDATE_SIZE) + `"}}`, wantErr: true, wantTooBig: true},
+		{name: "update id 0", body: `{"update_id": 0, "message": {"text": "hi", "chat": {"id": 7}}}`, wantErr: true},
+		{name: "missing update id", body: `{"message": {"text": "hi", "chat": {"id": 7}}}`, wantErr: true},
+		{
+			name:         "unknown fields",
+			body:         `{"update_id": 3, "edited_channel_post": {}, "message": {"text": "hi", "chat": {"id": 7, "title": "x"}, "sticker": {}}}`,
+			wantChatID:   7,
+			wantText:     "hi",
+			wantUpdateID: 3,
+		},
+		{
+			name:         "valid message",
+			body:         `{"update_id": 42, "message": {"message_id": 5, "text": "the godfather", "chat": {"id": -100123, "type": "supergroup"}}}`,
+			wantChatID:   -100123,
+			wantText:     "the godfather",
+			wantUpdateID: 42,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			update, err := parseIncomingRequest(httptest.NewRecorder(), r)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseIncomingRequest() = %v, want an error", update)
+				}
+				if got := errors.Is(err, errUpdateTooLarge); got != tt.wantTooBig {
+					t.Errorf("parseIncomingRequest() error = %v, too large %v, want %v", err, got, tt.wantTooBig)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseIncomingRequest() error = %v", err)
+			}
+			if update.UpdateID != tt.wantUpdateID || update.Message.Chat.ID != tt.wantChatID || update.Message.Text != tt.wantText {
+				t.Errorf("parseIncomingRequest() = update %d, chat %d, text %q, want update %d, chat %d, text %q",
+					update.UpdateID, update.Message.Chat.ID, update.Message.Text, tt.wantUpdateID, tt.wantChatID, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestServeHTTPStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{name: "get", method: http.MethodGet, contentType: "application/json", want: http.StatusMethodNotAllowed},
+		{name: "form", method: http.MethodPost, contentType: "application/x-www-form-urlencoded", body: "a=b", want: http.StatusUnsupportedMediaType},
+		{name: "no content type", method: http.MethodPost, body: `{"update_id": 1}`, want: http.StatusUnsupportedMediaType},
+		{name: "invalid content type", method: http.MethodPost, contentType: "application/json; charset", body: `{"update_id": 1}`, want: http.StatusUnsupportedMediaType},
+		{name: "empty body", method: http.MethodPost, contentType: "application/json", want: http.StatusBadRequest},
+		{name: "invalid json", method: http.MethodPost, contentType: "application/json", body: "{", want: http.StatusBadRequest},
+		{name: "update id 0", method: http.MethodPost, contentType: "application/json", body: `{"update_id": 0}`, want: http.StatusBadRequest},
+		{
+			name:        "too large",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body:        `{"update_id": 1, "message": {"text": "` + strings.Repeat("a", MAX_UPDATE_SIZE) + `"}}`,
+			want:        http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "valid update",
+			method:      http.MethodPost,
+			contentType: "application/json; charset=utf-8",
+			body:        `{"update_id": 1, "message": {"message_id": 1, "text": "/help", "chat": {"id": 7, "type": "private"}}}`,
+			want:        http.StatusOK,
+		},
+		{
+			name:        "media type case",
+			method:      http.MethodPost,
+			contentType: "Application/JSON",
+			body:        `{"update_id": 1, "message": {"message_id": 1, "text": "/help", "chat": {"id": 7, "type": "private"}}}`,
+			want:        http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, _, _ := newTestBot(t, fixtures{})
+
+			r := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			bot.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("ServeHTTP() status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusMethodNotAllowed && w.Header().Get("Allow") != http.MethodPost {
+				t.Errorf("Allow = %q, want %q", w.Header().Get("Allow"), http.MethodPost)
+			}
+		})
+	}
+}
+
+func TestServeHTTPChecksSecretTokenBeforeContentType(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+	bot.SecretToken = "s3cr3t"
+
+	tests := []struct {
+		method, contentType string
+		want                int
+	}{
+		{http.MethodPut, "application/json", http.StatusMethodNotAllowed},
+		{http.MethodPost, "text/plain", http.StatusForbidden},
+		{http.MethodPost, "application/json", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", strings.NewReader(messageUpdate(1, 7, "/help")))
+		r.Header.Set("Content-Type", tt.contentType)
+		w := httptest.NewRecorder()
+		bot.ServeHTTP(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("ServeHTTP() of a %s of %s without the secret token status = %d, want %d", tt.method, tt.contentType, w.Code, tt.want)
+		}
+	}
+	if calls := telegram.Calls(); len(calls) != 0 {
+		t.Errorf("answered the refused requests with %v", calls)
+	}
+}
+
+func TestServeHTTPAnswersMessage(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+
+	if w := postUpdate(bot, `{"update_id": 1, "message": {"message_id": 1, "text": "/help", "chat": {"id": 7, "type": "private"}}}`); w.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	sent := telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE)
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1: %v", len(sent), telegram.Calls())
+	}
+	if chatID := sent[0].Values.Get("chat_id"); chatID != "7" {
+		t.Errorf("chat_id = %q, want 7", chatID)
+	}
+	if sent[0].Values.Get("text") == "" {
+		t.Error("sent an empty help text")
+	}
+}
+
+func TestServeHTTPRedeliveredUpdate(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+	update := `{"update_id": 9, "message": {"message_id": 1, "text": "/help", "chat": {"id": 7, "type": "private"}}}`
+
+	telegram.Respond(func(telegramCall) (int, string) {
+		return http.StatusInternalServerError, `{"ok":false,"error_code":500,"description":"Internal Server Error"}`
+	})
+	if w := postUpdate(bot, update); w.Code != http.StatusInternalServerError {
+		t.Fatalf("failed update: ServeHTTP() status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	telegram.Respond(nil)
+	failed := len(telegram.Calls())
+	if w := postUpdate(bot, update); w.Code != http.StatusOK {
+		t.Fatalf("redelivered update: ServeHTTP() status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if sent := len(telegram.Calls()) - failed; sent != 1 {
+		t.Fatalf("redelivered update: made %d calls, want 1", sent)
+	}
+
+	if w := postUpdate(bot, update); w.Code != http.StatusOK {
+		t.Fatalf("duplicate update: ServeHTTP() status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if sent := len(telegram.Calls()) - failed; sent != 1 {
+		t.Errorf("duplicate update: made %d calls, want it ignored", sent-1)
+	}
+}
+
+func TestTrimKeywordsDropsLastTyped(t *testing.T) {
+	bot, _, _ := newTestBot(t, fixtures{})
+	long := strings.Repeat("z", MAX_SEARCH_URL_LEN/2)
+
+	// "apple" sorts first, but it's typed last, so it's the one left out.
+	keywords := getKeywords(long + ", " + long + ", apple")
+	kept, notice := bot.trimKeywords(context.Background(), keywords)
+
+	if len(kept) != 1 || kept[0] != long {
+		t.Errorf("trimKeywords() kept %.10q, want the first keyword typed", kept)
+	}
+	if !strings.Contains(notice, "apple") || !strings.HasSuffix(notice, "\n") {
+		t.Errorf("notice = %.80q, want it to name the dropped keywords on a line of its own", notice)
+	}
+}
+
+func TestTrimKeywordsQueryBudget(t *testing.T) {
+	long := strings.Repeat("z", MAX_SEARCH_URL_LEN/2)
+	keywords := []string{long, long, "apple"}
+
+	tests := []struct {
+		name   string
+		source MovieSource
+		want   int
+	}{
+		{name: "scraper", source: NewScraper(), want: 1},
+		{name: "tmdb", source: NewTMDBSource(TMDB_TEST_API_KEY), want: 3},
+		{name: "no budget", source: &fakeSource{}, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, _, _ := newTestBot(t, nil)
+			bot.Source = tt.source
+
+			kept, notice := bot.trimKeywords(context.Background(), keywords)
+			if len(kept) != tt.want {
+				t.Errorf("trimKeywords() kept %d keywords, want %d", len(kept), tt.want)
+			}
+			if (notice == "") != (tt.want == len(keywords)) {
+				t.Errorf("notice = %.80q, want one only if keywords were dropped", notice)
+			}
+		})
+	}
+}
+
+func TestSearchDropsLongKeywords(t *testing.T) {
+	bot, telegram, imdb := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	long := strings.Repeat("z", MAX_SEARCH_URL_LEN/2)
+
+	postUpdate(bot, messageUpdate(1, 7, long+", "+long+", apple"))
+
+	notice := bot.text(context.Background(), KEYWORDS_DROPPED_TEXT, long+", apple") + "\n"
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 || !strings.HasPrefix(sent[0], notice+"1. Inception") {
+		t.Errorf("sent %.80q, want the dropped keywords followed by the movies", sent)
+	}
+	requests := imdb.Requests()
+	if len(requests) != 1 || len(imdb.URL)+len(requests[0]) > MAX_SEARCH_URL_LEN {
+		t.Errorf("requested %d URLs %.40q, want one of at most %d characters", len(requests), requests, MAX_SEARCH_URL_LEN)
+	}
+}
+
+func TestSendToClientCanceledContext(t *testing.T) {
+	bot, telegram, imdb := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bot.sendToClient(ctx, 7, "dream"); err == nil {
+		t.Error("sendToClient() error = nil with a canceled context")
+	}
+
+	if calls := telegram.Calls(); len(calls) != 0 {
+		t.Errorf("made %d Telegram calls with a canceled context, want none: %v", len(calls), calls)
+	}
+	if requests := imdb.Requests(); len(requests) != 0 {
+		t.Errorf("made %d IMDB requests with a canceled context, want none: %v", len(requests), requests)
+	}
+}
+
+func TestServeHTTPSendFailure(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+	telegram.Respond(func(telegramCall) (int, string) {
+		return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+	})
+
+	if w := postUpdate(bot, messageUpdate(1, 7, "/help")); w.Code != http.StatusInternalServerError {
+		t.Errorf("ServeHTTP() status = %d, want %d when the answer can't be sent", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	var lines []string
+	var text strings.Builder
+	for i := 0; text.Len() < 10000; i++ {
+		line := fmt.Sprintf("%d. A Movie Title Long Enough To Matter (%d) ⭐ 7.%d\n", i+1, 1950+i%70, i%10)
+		lines = append(lines, line)
+		text.WriteString(line)
+	}
+
+	chunks := splitMessage(text.String(), TELEGRAM_MAX_MESSAGE_LEN)
+	if len(chunks) < 3 {
+		t.Fatalf("split %d characters into %d chunks, want at least 3", text.Len(), len(chunks))
+	}
+	if joined := strings.Join(chunks, ""); joined != text.String() {
+		t.Error("the chunks don't add up to the text, in order")
+	}
+
+	lineChunks := make(map[string]bool)
+	for i, chunk := range chunks {
+		if len(chunk) > TELEGRAM_MAX_MESSAGE_LEN {
+			t.Errorf("chunk %d is %d bytes long, over the limit of %d", i, len(chunk), TELEGRAM_MAX_MESSAGE_LEN)
+		}
+		if strings.TrimSpace(chunk) == "" {
+			t.Errorf("chunk %d is empty", i)
+		}
+		for _, line := range strings.SplitAfter(chunk, "\n") {
+			lineChunks[line] = true
+		}
+	}
+	for _, line := range lines {
+		if !lineChunks[line] {
+			t.Fatalf("the line %q is split across chunks", line)
+		}
+	}
+}
+
+func TestSplitMessageLongLine(t *testing.T) {
+	line := strings.Repeat("é", 3000)
+	chunks := splitMessage(line+"\nend\n", TELEGRAM_MAX_MESSAGE_LEN)
+
+	if strings.Join(chunks, "") != line+"\nend\n" {
+		t.Fatal("the chunks don't add up to the text")
+	}
+	for i, chunk := range chunks {
+		if len(chunk) > TELEGRAM_MAX_MESSAGE_LEN || !utf8.ValidString(chunk) {
+			t.Errorf("chunk %d is %d bytes long or cuts a character", i, len(chunk))
+		}
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	for i, text := range []string{"/help", "/help@SomeBot", "  /help  "} {
+		t.Run(text, func(t *testing.T) {
+			bot, telegram, _ := newTestBot(t, fixtures{})
+
+			if w := postUpdate(bot, messageUpdate(i+1, 7, text)); w.Code != http.StatusOK {
+				t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			want := bot.text(context.Background(), HELP_TEXT)
+			if sent := sentTexts(telegram.Calls()); len(sent) != 1 || sent[0] != want {
+				t.Errorf("sent %q, want the help text", sent)
+			}
+		})
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text, name, args string
+	}{
+		{"/help", "/help", ""},
+		{"/help@MyBot", "/help", ""},
+		{"/year@MyBot 1990-2000 heist", "/year", "1990-2000 heist"},
+		{"/genre\thorror", "/genre", "horror"},
+		{"time travel", "", "time travel"},
+	}
+
+	for _, tt := range tests {
+		if name, args := parseCommand(tt.text); name != tt.name || args != tt.args {
+			t.Errorf("parseCommand(%q) = %q, %q, want %q, %q", tt.text, name, args, tt.name, tt.args)
+		}
+	}
+}
+
+func TestSearchWithoutResults(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "empty.html"})
+
+	if w := postUpdate(bot, messageUpdate(1, 7, "nothing matches this")); w.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	want := bot.text(context.Background(), NO_RESULTS_TEXT)
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 || sent[0] != want {
+		t.Errorf("sent %q, want the no results text", sent)
+	}
+}
+
+func TestMoviesTextErrors(t *testing.T) {
+	bot, _, _ := newTestBot(t, fixtures{})
+
+	tests := []struct {
+		name string
+		err  error
+		want MessageKey
+	}{
+		{name: "no movies", err: nil, want: NO_RESULTS_TEXT},
+		{name: "no results", err: fmt.Errorf("%w for x", ErrNoResults), want: NO_RESULTS_TEXT},
+		{name: "scrape failed", err: fmt.Errorf("%w: status code 500", ErrScrapeFailed), want: SCRAPE_FAILED_TEXT},
+		{name: "rate limited", err: fmt.Errorf("%w: status code 429", ErrRateLimited), want: SOURCE_BUSY_TEXT},
+		{name: "circuit open", err: ErrCircuitOpen, want: SOURCE_UNAVAILABLE_TEXT},
+		{name: "busy", err: ErrBusy, want: BUSY_TEXT},
+		{name: "invalid keywords", err: ErrInvalidKeywords, want: NO_KEYWORDS_TEXT},
+		{name: "other", err: errors.New("connection reset"), want: SCRAPE_FAILED_TEXT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if got, want := bot.moviesText(ctx, nil, tt.err), bot.text(ctx, tt.want); got != want {
+				t.Errorf("moviesText() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestSearchScrapeFailed(t *testing.T) {
+	// the fixture server answers 404 to the search, which fails the scrape.
+	bot, telegram, _ := newTestBot(t, fixtures{})
+
+	if w := postUpdate(bot, messageUpdate(1, 7, "dream")); w.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	want := bot.text(context.Background(), SCRAPE_FAILED_TEXT)
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 || sent[0] != want {
+		t.Errorf("sent %q, want the scrape failed text", sent)
+	}
+}
+
+func TestSearchShowsRatings(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	bot.MinRating = 5
+
+	postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+	sent := sentTexts(telegram.Calls())
+	if len(sent) != 1 || !strings.Contains(sent[0], "Inception (2010) (8.8)") || strings.Contains(sent[0], "Bad Movie") {
+		t.Errorf("sent %q, want Inception with its rating only", sent)
+	}
+}
+
+func TestParseYearRange(t *testing.T) {
+	tests := []struct {
+		text     string
+		from, to int
+		wantErr  bool
+	}{
+		{text: "1990-2000", from: 1990, to: 2000},
+		{text: "1999", from: 1999, to: 1999},
+		{text: "2010-", from: 2010},
+		{text: "-1980", to: 1980},
+		{text: "2000-1990", wantErr: true},
+		{text: "-", wantErr: true},
+		{text: "nineties", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		from, to, err := parseYearRange(tt.text)
+		if (err != nil) != tt.wantErr || from != tt.from || to != tt.to {
+			t.Errorf("parseYearRange(%q) = %d, %d, %v, want %d, %d, error %v", tt.text, from, to, err, tt.from, tt.to, tt.wantErr)
+		}
+	}
+}
+
+// TITLE_SEARCH_FIXTURE is the URL of the genre and advanced title searches of a fixture server, without their query.
+const TITLE_SEARCH_FIXTURE = "/search/title/"
+
+func TestGenreCommand(t *testing.T) {
+	bot, telegram, imdb := newTestBot(t, fixtures{TITLE_SEARCH_FIXTURE: "genre.html"})
+
+	postUpdate(bot, messageUpdate(1, 7, "/genre Horror"))
+
+	sent := sentTexts(telegram.Calls())
+	if len(sent) != 1 || !strings.Contains(sent[0], "The Shining") || !strings.Contains(sent[0], "Hereditary") {
+		t.Errorf("sent %q, want the horror movies", sent)
+	}
+	if requests := imdb.Requests(); len(requests) != 1 || requests[0] != TITLE_SEARCH_FIXTURE+"?genres=horror" {
+		t.Errorf("requested %q, want the genre search of horror", requests)
+	}
+}
+
+func TestGenreCommandUnknownGenre(t *testing.T) {
+	bot, telegram, imdb := newTestBot(t, fixtures{TITLE_SEARCH_FIXTURE: "genre.html"})
+
+	postUpdate(bot, messageUpdate(1, 7, "/genre spaghetti"))
+
+	want := bot.text(context.Background(), UNKNOWN_GENRE_TEXT, "spaghetti", strings.Join(genres, ", "))
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 || sent[0] != want {
+		t.Errorf("sent %q, want the unknown genre text", sent)
+	}
+	if requests := imdb.Requests(); len(requests) != 0 {
+		t.Errorf("requested %q for an unknown genre", requests)
+	}
+}
+
+func TestTypeCommand(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.Source = &fakeSource{movies: map[string][]Movie{"dream": {
+		{Title: "Inception", Year: 2010, EndYear: 2010, Rating: 8.8, Kind: KIND_MOVIE},
+		{Title: "Dreamland", Year: 2015, EndYear: 2017, Rating: 7, Kind: KIND_SERIES},
+	}}}
+
+	postUpdate(bot, messageUpdate(1, 7, "/type Series dream"))
+	postUpdate(bot, messageUpdate(2, 7, "/type podcast dream"))
+	postUpdate(bot, messageUpdate(3, 7, "/type movie"))
+
+	texts := sentTexts(telegram.Calls())
+	want := []string{
+		"1. Dreamland (2015–2017) (7.0)\n",
+		bot.text(context.Background(), UNKNOWN_TYPE_TEXT, "podcast", kindNames()),
+		bot.text(context.Background(), TYPE_USAGE_TEXT),
+	}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+}
+
+func TestMessageKind(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+		want    string
+	}{
+		{name: "text", message: Message{Text: "heist"}, want: TEXT_MESSAGE},
+		{name: "text with a document", message: Message{Text: "heist", Document: Document{FileID: "d"}}, want: TEXT_MESSAGE},
+		{name: "audio", message: Message{Audio: Audio{FileID: "a"}}, want: AUDIO_MESSAGE},
+		{name: "voice", message: Message{Voice: Voice{FileID: "v"}}, want: VOICE_MESSAGE},
+		{name: "document", message: Message{Document: Document{FileID: "d"}}, want: DOCUMENT_MESSAGE},
+		{name: "empty", message: Message{}, want: UNKNOWN_MESSAGE},
+	}
+
+	for _, tt := range tests {
+		if got := messageKind(tt.message); got != tt.want {
+			t.Errorf("%s: messageKind() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMediaOnlyMessages(t *testing.T) {
+	tests := []struct {
+		name  string
+		media string
+		want  MessageKey
+	}{
+		{name: "audio", media: `"audio": {"file_id": "a", "duration": 120}`, want: MEDIA_NOT_SUPPORTED_TEXT},
+		{name: "voice", media: `"voice": {"file_id": "v", "duration": 3}`, want: MEDIA_NOT_SUPPORTED_TEXT},
+		{name: "document", media: `"document": {"file_id": "d", "file_name": "poster.pdf", "mime_type": "application/pdf"}`, want: NOT_TEXT_DOCUMENT_TEXT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, telegram, imdb := newTestBot(t, fixtures{})
+
+			update := `{"update_id": 1, "message": {"message_id": 1, "chat": {"id": 7, "type": "private"}, ` + tt.media + `}}`
+			if w := postUpdate(bot, update); w.Code != http.StatusOK {
+				t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			want := bot.text(context.Background(), tt.want)
+			if sent := sentTexts(telegram.Calls()); len(sent) != 1 || sent[0] != want {
+				t.Errorf("sent %q, want %q", sent, want)
+			}
+			if requests := imdb.Requests(); len(requests) != 0 {
+				t.Errorf("searched %q for a message without text", requests)
+			}
+		})
+	}
+}
+
+func TestShowMore(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	bot.PageSize = 2
+	bot.Favorites = nil
+
+	postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+	sent := telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE)
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want the first page", len(sent))
+	}
+	if text := sent[0].Values.Get("text"); !strings.Contains(text, "Inception") || !strings.Contains(text, "Bad Movie") || strings.Contains(text, "Unrated") {
+		t.Errorf("first page = %q, want the first two movies", text)
+	}
+	data := callbackData(t, sent[0].Values)
+	if want := []string{moreCallbackData([]string{"dream"}, 2)}; !reflect.DeepEqual(data, want) {
+		t.Fatalf("buttons = %q, want %q", data, want)
+	}
+
+	postUpdate(bot, callbackQueryUpdate(2, 7, 10, data[0]))
+
+	if answered := telegram.CallsOf(TELEGRAM_API_ANSWER_CALLBACK_QUERY); len(answered) != 1 || answered[0].Values.Get("callback_query_id") != "query2" {
+		t.Errorf("answered the callback queries %v, want query2", answered)
+	}
+	edited := telegram.CallsOf(TELEGRAM_API_EDIT_MESSAGE_TEXT)
+	if len(edited) != 1 {
+		t.Fatalf("edited %d messages, want the page replaced", len(edited))
+	}
+	if edited[0].Values.Get("message_id") != "10" || !strings.Contains(edited[0].Values.Get("text"), "3. Unrated") {
+		t.Errorf("edited message %s to %q, want message 10 showing the third movie", edited[0].Values.Get("message_id"), edited[0].Values.Get("text"))
+	}
+	if data := callbackData(t, edited[0].Values); len(data) != 0 {
+		t.Errorf("last page buttons = %q, want none", data)
+	}
+}
+
+func TestParseMoreCallbackData(t *testing.T) {
+	keywords, offset, err := parseMoreCallbackData(strings.TrimPrefix(moreCallbackData([]string{"time travel", "dystopia"}, 20), MORE_CALLBACK_PREFIX))
+	if err != nil || keywords != "time travel,dystopia" || offset != 20 {
+		t.Errorf("parseMoreCallbackData() = %q, %d, %v, want the keywords and offset 20", keywords, offset, err)
+	}
+
+	for _, data := range []string{"dream", "dream:x", "dream:-1"} {
+		if _, _, err := parseMoreCallbackData(data); err == nil {
+			t.Errorf("parseMoreCallbackData(%q) error = nil", data)
+		}
+	}
+}
+
+func TestCallbackQuery(t *testing.T) {
+	const payload = `{
+		"update_id": 10000,
+		"callback_query": {
+			"id": "4382bfdwdsb323b2d9",
+			"from": {"id": 1111111, "is_bot": false, "first_name": "Test", "username": "Test", "language_code": "en"},
+			"message": {
+				"message_id": 1365,
+				"from": {"id": 2222222, "is_bot": true, "first_name": "gmtm", "username": "gmtm_bot"},
+				"chat": {"id": 1111111, "first_name": "Test", "username": "Test", "type": "private"},
+				"date": 1441645532,
+				"text": "1. Inception (2010) (8.8)"
+			},
+			"chat_instance": "-8217267987612367766",
+			"data": "more:dream:2"
+		}
+	}`
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload))
+	update, err := parseIncomingRequest(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatalf("parseIncomingRequest() error = %v", err)
+	}
+	if update.CallbackQuery == nil {
+		t.Fatal("parseIncomingRequest() dropped the callback query")
+	}
+	query := update.CallbackQuery
+	if query.ID != "4382bfdwdsb323b2d9" || query.Data != "more:dream:2" || query.From.ID != 1111111 || query.Message == nil || query.Message.MessageID != 1365 || query.Message.Chat.ID != 1111111 {
+		t.Errorf("parseIncomingRequest() callback query = %+v", query)
+	}
+
+	for _, data := range []string{"more:dream:2", "unknown:data"} {
+		t.Run(data, func(t *testing.T) {
+			bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+			bot.PageSize = 2
+
+			if rec := postUpdate(bot, strings.Replace(payload, "more:dream:2", data, 1)); rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			answered := telegram.CallsOf(TELEGRAM_API_ANSWER_CALLBACK_QUERY)
+			if len(answered) != 1 || answered[0].Values.Get("callback_query_id") != "4382bfdwdsb323b2d9" {
+				t.Errorf("answered the callback queries %v, want the query once", answered)
+			}
+		})
+	}
+}
+
+func TestGetKeywords(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"mixed case", "Action,DRAMA", []string{"action", "drama"}},
+		{"spaces", "  drama ,  action  ", []string{"drama", "action"}},
+		{"inner spaces", "time   travel", []string{"time travel"}},
+		{"extra commas", ",,drama,,,action,", []string{"drama", "action"}},
+		{"only commas", ",,,", nil},
+		{"special characters", "Sci-Fi/Horror?page=2", []string{"sci-fi horror page 2"}},
+		{"control characters", "drama\tfilm\n,action", []string{"drama film", "action"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getKeywords(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getKeywords(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidKeywords(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want MessageKey
+		args []interface{}
+	}{
+		{"empty", " ", NO_KEYWORDS_TEXT, nil},
+		{"single comma", ",", NO_KEYWORDS_TEXT, nil},
+		{"rejected", "?!/", NO_KEYWORDS_TEXT, nil},
+		{"over the limit", strings.Repeat("drama,", MAX_KEYWORDS) + "action", TOO_MANY_KEYWORDS_TEXT, []interface{}{MAX_KEYWORDS}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, telegram, fixture := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+			if rec := postUpdate(bot, messageUpdate(1, 7, tt.text)); rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			want := bot.text(context.Background(), tt.want, tt.args...)
+			if texts := sentTexts(telegram.Calls()); len(texts) != 1 || texts[0] != want {
+				t.Errorf("sent %q, want %q", texts, want)
+			}
+			if requests := fixture.Requests(); len(requests) != 0 {
+				t.Errorf("scraped %q, want no search", requests)
+			}
+		})
+	}
+}
+
+func TestSendPosters(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	bot.SendPosters = true
+
+	postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+	calls := telegram.Calls()
+	var methods []string
+	for _, call := range calls {
+		if call.Method != TELEGRAM_API_SEND_CHAT_ACTION {
+			methods = append(methods, call.Method)
+		}
+	}
+	if want := []string{TELEGRAM_API_SEND_PHOTO, TELEGRAM_API_SEND_MESSAGE}; !reflect.DeepEqual(methods, want) {
+		t.Fatalf("called %q, want %q", methods, want)
+	}
+	photo := telegram.CallsOf(TELEGRAM_API_SEND_PHOTO)[0]
+	if photo.Values.Get("photo") != "https://m.media-amazon.com/images/inception.jpg" || photo.Values.Get("caption") != "Inception" || photo.Values.Get("chat_id") != "7" {
+		t.Errorf("sent the photo %v, want the poster of Inception captioned with its title", photo.Values)
+	}
+}
+
+func TestSendPostersFallsBackToText(t *testing.T) {
+	tests := []struct {
+		name   string
+		movies []Movie
+		status int
+		photos int
+	}{
+		{"no poster", []Movie{{Title: "Unrated"}}, http.StatusOK, 0},
+		{"photo refused", []Movie{{Title: "Inception", PosterURL: "https://m.media-amazon.com/images/inception.jpg"}}, http.StatusBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, telegram, _ := newTestBot(t, nil)
+			bot.Source = &fakeSource{movies: map[string][]Movie{"dream": tt.movies}}
+			bot.SendPosters = true
+			telegram.Respond(func(call telegramCall) (int, string) {
+				if call.Method == TELEGRAM_API_SEND_PHOTO && tt.status != http.StatusOK {
+					return tt.status, `{"ok":false,"error_code":400,"description":"Bad Request: wrong file identifier/HTTP URL specified"}`
+				}
+				return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+			})
+
+			postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+			if photos := telegram.CallsOf(TELEGRAM_API_SEND_PHOTO); len(photos) != tt.photos {
+				t.Errorf("sent %d photos, want %d", len(photos), tt.photos)
+			}
+			if texts := sentTexts(telegram.Calls()); len(texts) != 1 || !strings.Contains(texts[0], tt.movies[0].Title) {
+				t.Errorf("sent %q, want the list of movies", texts)
+			}
+		})
+	}
+}
+
+func TestRandomCommand(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	movies := []string{
+		"Inception (2010) (8.8)",
+		"Bad Movie (2015–2018) (4.1)",
+		"Unrated",
+	}
+
+	const SEED = 42
+	bot.Rand = rand.New(rand.NewSource(SEED))
+	picks := rand.New(rand.NewSource(SEED))
+
+	for i := 1; i <= 3; i++ {
+		postUpdate(bot, messageUpdate(i, 7, "/random dream"))
+	}
+
+	texts := sentTexts(telegram.Calls())
+	if len(texts) != 3 {
+		t.Fatalf("sent %q, want a movie per command", texts)
+	}
+	for _, text := range texts {
+		if want := movies[picks.Intn(len(movies))]; !strings.HasPrefix(text, want) {
+			t.Errorf("picked %q, want %q", text, want)
+		}
+	}
+}
+
+func TestRandomCommandWithoutResults(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "empty.html"})
+
+	postUpdate(bot, messageUpdate(1, 7, "/random dream"))
+
+	if texts, want := sentTexts(telegram.Calls()), bot.text(context.Background(), NO_RESULTS_TEXT); len(texts) != 1 || texts[0] != want {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+}
+
+func TestProcessUpdate(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	ctx := context.Background()
+
+	update := &Update{UpdateID: 1, Message: Message{MessageID: 3, Text: "dream", Chat: Chat{ID: 7, Type: CHAT_TYPE_PRIVATE}}}
+	if err := bot.processUpdate(ctx, update); err != nil {
+		t.Fatalf("processUpdate() error = %v", err)
+	}
+	if texts := sentTexts(telegram.Calls()); len(texts) != 1 || !strings.HasPrefix(texts[0], "1. Inception (2010)") {
+		t.Fatalf("sent %q, want the movies", texts)
+	}
+
+	if err := bot.processUpdate(ctx, update); err != nil {
+		t.Errorf("processUpdate() of a redelivered update error = %v", err)
+	}
+	if err := bot.processUpdate(ctx, &Update{UpdateID: 2}); err != nil {
+		t.Errorf("processUpdate() of an empty update error = %v", err)
+	}
+	if texts := sentTexts(telegram.Calls()); len(texts) != 1 {
+		t.Errorf("sent %q, want the redelivered and the empty updates ignored", texts)
+	}
+
+	telegram.Respond(func(telegramCall) (int, string) {
+		return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+	})
+	if err := bot.processUpdate(ctx, &Update{UpdateID: 3, Message: update.Message}); err == nil {
+		t.Error("processUpdate() of an update which can't be answered error = nil")
+	}
+}
+
+func TestStartGreeting(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+
+	postUpdate(bot, `{"update_id":1,"message":{"message_id":1,"text":"/start",
+		"from":{"id":7,"is_bot":false,"first_name":"Ada","username":"ada","language_code":"en"},
+		"chat":{"id":7,"first_name":"Ada","type":"private"}}}`)
+	postUpdate(bot, messageUpdate(2, 8, "/start"))
+
+	ctx := context.Background()
+	want := []string{bot.text(ctx, START_TEXT, "Ada"), bot.text(ctx, START_TEXT, bot.localize(ctx, STRANGER_NAME_TEXT))}
+	if texts := sentTexts(telegram.Calls()); !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	notice := func(omitted int) string { return fmt.Sprintf("(…%d more)", omitted) }
+	line := strings.Repeat("x", 49) + "\n"
+
+	text := strings.Repeat(line, 100)
+	got := truncateMessage(text, TELEGRAM_MAX_MESSAGE_LEN, notice)
+	if len(got) > TELEGRAM_MAX_MESSAGE_LEN {
+		t.Errorf("truncateMessage() is %d bytes long, want at most %d", len(got), TELEGRAM_MAX_MESSAGE_LEN)
+	}
+	if want := strings.Repeat(line, 81) + notice(19); got != want {
+		t.Errorf("truncateMessage() = %d lines and %q, want 81 lines and %q", strings.Count(got, line), got[strings.LastIndex(got, "\n")+1:], notice(19))
+	}
+
+	// 81 lines fit in 4055 bytes, but the notice only fits with 80 of them.
+	if got, want := truncateMessage(text, 4055, notice), strings.Repeat(line, 80)+notice(20); got != want {
+		t.Errorf("truncateMessage() = %d lines and %q, want 80 lines and %q", strings.Count(got, line), got[strings.LastIndex(got, "\n")+1:], notice(20))
+	}
+
+	if got := truncateMessage("short\n", TELEGRAM_MAX_MESSAGE_LEN, notice); got != "short\n" {
+		t.Errorf("truncateMessage() of a short text = %q, want it as is", got)
+	}
+	if got := truncateMessage(strings.Repeat("y", 20)+"\n"+line, 10, notice); got != notice(2) {
+		t.Errorf("truncateMessage() with a first line too long = %q, want the notice alone", got)
+	}
+}
+
+func TestOverflowTruncate(t *testing.T) {
+	movies := make([]Movie, 200)
+	for i := range movies {
+		movies[i] = Movie{Title: "A Movie With A Rather Long Title Number " + strconv.Itoa(i)}
+	}
+
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.Source = &fakeSource{movies: map[string][]Movie{"dream": movies}}
+	bot.Overflow = OVERFLOW_TRUNCATE
+	bot.MaxResults, bot.PageSize = 200, 200
+
+	postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+	texts := sentTexts(telegram.Calls())
+	if len(texts) != 1 || len(texts[0]) > TELEGRAM_MAX_MESSAGE_LEN {
+		t.Fatalf("sent %d messages, want one fitting in a Telegram message", len(texts))
+	}
+	shown := strings.Count(texts[0], "\n")
+	if want := bot.text(context.Background(), TRUNCATED_TEXT, 200-shown); !strings.HasSuffix(texts[0], "\n"+want) {
+		t.Errorf("sent %q, want it to end with %q", texts[0][strings.LastIndex(texts[0], "\n"):], want)
+	}
+}
+
+func TestParseIncomingRequestSizeLimit(t *testing.T) {
+	update := `{"update_id": 1, "message": {"message_id": 1, "text": "hi", "chat": {"id": 7}}}`
+	atTheLimit := update + strings.Repeat(" ", MAX_UPDATE_SIZE-len(update))
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(atTheLimit))
+	if _, err := parseIncomingRequest(httptest.NewRecorder(), r); err != nil {
+		t.Errorf("parseIncomingRequest() of %d bytes error = %v, want it parsed", len(atTheLimit), err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(atTheLimit+" "))
+	if _, err := parseIncomingRequest(httptest.NewRecorder(), r); !errors.Is(err, errUpdateTooLarge) {
+		t.Errorf("parseIncomingRequest() of %d bytes error = %v, want %v", len(atTheLimit)+1, err, errUpdateTooLarge)
+	}
+
+	// a body of exactly the limit whose read fails isn't taken for a too large one.
+	errRead := errors.New("connection reset")
+	r = httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader(atTheLimit), iotest.ErrReader(errRead)))
+	if _, err := parseIncomingRequest(httptest.NewRecorder(), r); !errors.Is(err, errRead) {
+		t.Errorf("parseIncomingRequest() of %d bytes failing to read error = %v, want %v", len(atTheLimit), err, errRead)
+	}
+
+	bot, telegram, _ := newTestBot(t, nil)
+	if rec := postUpdate(bot, atTheLimit+" "); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+	if calls := telegram.Calls(); len(calls) != 0 {
+		t.Errorf("called telegram %d times for an oversized update, want none", len(calls))
+	}
+}
+
+func TestAllowedChats(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed map[int]bool
+		chatID  int
+		answer  bool
+	}{
+		{"allowed", map[int]bool{7: true, -100123: true}, 7, true},
+		{"disallowed", map[int]bool{7: true, -100123: true}, 8, false},
+		{"empty allowlist", nil, 8, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, telegram, fixture := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+			bot.AllowedChats = tt.allowed
+
+			postUpdate(bot, messageUpdate(1, tt.chatID, "dream"))
+
+			texts := sentTexts(telegram.Calls())
+			if len(texts) != 1 {
+				t.Fatalf("sent %q, want one message", texts)
+			}
+			scraped := len(fixture.Requests()) > 0
+			if tt.answer {
+				if !scraped || !strings.HasPrefix(texts[0], "1. Inception") {
+					t.Errorf("sent %q, scraped %t, want the movies", texts, scraped)
+				}
+				return
+			}
+			if want := bot.text(context.Background(), NOT_AUTHORIZED_TEXT); texts[0] != want || scraped {
+				t.Errorf("sent %q, scraped %t, want %q before any scrape", texts, scraped, want)
+			}
+		})
+	}
+}
+
+func TestParseChatIDs(t *testing.T) {
+	ids, err := parseChatIDs(" 7, -100123,,")
+	if err != nil || !reflect.DeepEqual(ids, map[int]bool{7: true, -100123: true}) {
+		t.Errorf("parseChatIDs() = %v, %v, want 7 and -100123", ids, err)
+	}
+	if ids, err := parseChatIDs(""); err != nil || ids != nil {
+		t.Errorf("parseChatIDs(\"\") = %v, %v, want nil", ids, err)
+	}
+	if _, err := parseChatIDs("7,me"); err == nil {
+		t.Error("parseChatIDs() of an invalid ID error = nil")
+	}
+}
+
+func TestServeHTTPSecretToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		want   int
+	}{
+		{"matching", "s3cr3t", "s3cr3t", http.StatusOK},
+		{"mismatching", "s3cr3t", "guess", http.StatusForbidden},
+		{"prefix", "s3cr3t", "s3cr3", http.StatusForbidden},
+		{"missing", "s3cr3t", "", http.StatusForbidden},
+		{"not configured", "", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, telegram, _ := newTestBot(t, nil)
+			bot.SecretToken = tt.secret
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(messageUpdate(1, 7, "/help")))
+			r.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				r.Header.Set(SECRET_TOKEN_HEADER, tt.header)
+			}
+			w := httptest.NewRecorder()
+			bot.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("ServeHTTP() status = %d, want %d", w.Code, tt.want)
+			}
+			if sent := len(telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE)); (sent > 0) != (tt.want == http.StatusOK) {
+				t.Errorf("sent %d messages, want the update answered only if it was authorized", sent)
+			}
+		})
+	}
+}
+
+func TestTrendingCommand(t *testing.T) {
+	bot, telegram, imdb := newTestBot(t, fixtures{IMDB_CHART_PATH + string(CHART_MOVIEMETER) + "/": "chart.html"})
+
+	postUpdate(bot, messageUpdate(1, 7, "/trending"))
+
+	want := "1. Dune: Part Two (2024) (8.7) " + imdb.URL + "/title/tt15239678/\n2. Unrated (2025) " + imdb.URL + "/title/tt0000006/\n"
+	if texts := sentTexts(telegram.Calls()); len(texts) != 1 || texts[0] != want {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+}
+
+func TestTop250Command(t *testing.T) {
+	bot, telegram, imdb := newTestBot(t, fixtures{IMDB_CHART_PATH + string(CHART_TOP_250) + "/": "top250.html"})
+
+	postUpdate(bot, messageUpdate(1, 7, "/top250"))
+	postUpdate(bot, messageUpdate(2, 7, "/top250 2-3"))
+	postUpdate(bot, messageUpdate(3, 7, "/chart top 1"))
+
+	shawshank := "1. The Shawshank Redemption (1994) (9.3) " + imdb.URL + "/title/tt0111161/\n"
+	rest := "2. The Godfather (1972) (9.2) " + imdb.URL + "/title/tt0068646/\n3. 2001: A Space Odyssey (1968) (8.3) " + imdb.URL + "/title/tt0062622/\n"
+	want := []string{shawshank + rest, rest, shawshank}
+	if texts := sentTexts(telegram.Calls()); !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+	if requests := imdb.Requests(); len(requests) != 1 {
+		t.Errorf("requested %q, want the chart scraped once and cached", requests)
+	}
+}
+
+func TestChartCommandInvalid(t *testing.T) {
+	bot, telegram, imdb := newTestBot(t, nil)
+	ctx := context.Background()
+
+	for i, text := range []string{"/chart", "/chart worst", "/chart toptv 20-11", "/top250 1-51", "/top250 many"} {
+		postUpdate(bot, messageUpdate(i+1, 7, text))
+	}
+
+	want := []string{
+		bot.text(ctx, CHART_USAGE_TEXT, chartNames()),
+		bot.text(ctx, UNKNOWN_CHART_TEXT, "worst", chartNames()),
+		bot.text(ctx, INVALID_CHART_RANGE_TEXT, "20-11", MAX_CHART_RESULTS),
+		bot.text(ctx, INVALID_CHART_RANGE_TEXT, "1-51", MAX_CHART_RESULTS),
+		bot.text(ctx, INVALID_CHART_RANGE_TEXT, "many", MAX_CHART_RESULTS),
+	}
+	if texts := sentTexts(telegram.Calls()); !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+	if requests := imdb.Requests(); len(requests) != 0 {
+		t.Errorf("requested %q for the invalid commands", requests)
+	}
+}
+
+func TestChartRange(t *testing.T) {
+	tests := []struct {
+		text     string
+		from, to int
+		ok       bool
+	}{
+		{"", 1, DEFAULT_CHART_RESULTS, true},
+		{"20", 1, 20, true},
+		{"11-20", 11, 20, true},
+		{"5-5", 5, 5, true},
+		{"1-50", 1, MAX_CHART_RESULTS, true},
+		{"1-51", 0, 0, false},
+		{"20-11", 0, 0, false},
+		{"0", 0, 0, false},
+		{"-5", 0, 0, false},
+		{"ten", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		if from, to, ok := chartRange(tt.text); from != tt.from || to != tt.to || ok != tt.ok {
+			t.Errorf("chartRange(%q) = %d, %d, %t, want %d, %d, %t", tt.text, from, to, ok, tt.from, tt.to, tt.ok)
+		}
+	}
+}
+
+func TestAnyCommand(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.Source = &fakeSource{movies: map[string][]Movie{
+		"horror": {{Title: "Alien", Year: 1979, EndYear: 1979}, {Title: "The Shining", Year: 1980, EndYear: 1980}},
+		"space":  {{Title: "Alien", Year: 1979, EndYear: 1979}, {Title: "Interstellar", Year: 2014, EndYear: 2014}},
+	}}
+
+	postUpdate(bot, messageUpdate(1, 7, "/any horror, space"))
+
+	ctx := context.Background()
+	want := bot.text(ctx, ANY_RESULTS_TEXT, "horror, space") + "\n1. Alien (1979)\n2. The Shining (1980)\n3. Interstellar (2014)\n"
+	if texts := sentTexts(telegram.Calls()); len(texts) != 1 || texts[0] != want {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+	if searches := bot.Source.(*fakeSource).Searches(); len(searches) != 2 {
+		t.Errorf("searched %q, want a search per keyword", searches)
+	}
+}
+
+// countingSource is a MovieSource whose keyword searches take delay, and which records the most of them running at the
+// same time.
+type countingSource struct {
+	MovieSource
+	delay time.Duration
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+// Search implements the MovieSource interface.
+func (s *countingSource) Search(ctx context.Context, keywords []string) ([]Movie, error) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	return []Movie{{Title: keywords[0]}}, nil
+}
+
+func TestAnyCommandLeavesScrapes(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	source := &countingSource{delay: 10 * time.Millisecond}
+	bot.Source = source
+	// a search over the limit doesn't wait, so it fails if /any takes every slot.
+	bot.Scrapes = NewScrapeLimiter(MAX_ANY_SEARCHES+1, 0)
+
+	keywords := make([]string, MAX_KEYWORDS)
+	for i := range keywords {
+		keywords[i] = "keyword" + strconv.Itoa(i)
+	}
+	postUpdate(bot, messageUpdate(1, 7, "/any "+strings.Join(keywords, ",")))
+
+	if texts := sentTexts(telegram.Calls()); len(texts) != 1 || strings.Contains(texts[0], bot.text(context.Background(), BUSY_TEXT)) {
+		t.Errorf("sent %q, want the movies of the keywords", texts)
+	}
+	if source.maxInFlight > MAX_ANY_SEARCHES {
+		t.Errorf("searched %d keywords at the same time, want at most %d", source.maxInFlight, MAX_ANY_SEARCHES)
+	}
+}
+
+func TestMaxResults(t *testing.T) {
+	movies := make([]Movie, 30)
+	for i := range movies {
+		movies[i] = Movie{Title: "Movie " + strconv.Itoa(i+1)}
+	}
+
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"dream", 5},
+		{"/top 3 dream", 3},
+		{"/top 12 dream", 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			bot, telegram, _ := newTestBot(t, nil)
+			bot.Source = &fakeSource{movies: map[string][]Movie{"dream": movies}}
+			bot.MaxResults, bot.PageSize = 5, 50
+
+			postUpdate(bot, messageUpdate(1, 7, tt.text))
+
+			texts := sentTexts(telegram.Calls())
+			if len(texts) != 1 {
+				t.Fatalf("sent %q, want one message", texts)
+			}
+			if got := strings.Count(texts[0], "\n"); got != tt.want || !strings.HasSuffix(texts[0], ". Movie "+strconv.Itoa(tt.want)+"\n") {
+				t.Errorf("sent %q, want the first %d movies", texts[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestTopCommandInvalid(t *testing.T) {
+	ctx := context.Background()
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.Source = &fakeSource{}
+
+	for i, n := range []string{"0", "-1", "51", "ten"} {
+		postUpdate(bot, messageUpdate(i+1, 7, "/top "+n+" dream"))
+	}
+	postUpdate(bot, messageUpdate(5, 7, "/top 5"))
+
+	want := []string{
+		bot.text(ctx, INVALID_TOP_TEXT, "0", MAX_TOP_RESULTS),
+		bot.text(ctx, INVALID_TOP_TEXT, "-1", MAX_TOP_RESULTS),
+		bot.text(ctx, INVALID_TOP_TEXT, "51", MAX_TOP_RESULTS),
+		bot.text(ctx, INVALID_TOP_TEXT, "ten", MAX_TOP_RESULTS),
+		bot.text(ctx, TOP_USAGE_TEXT),
+	}
+	if texts := sentTexts(telegram.Calls()); !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+	if searches := bot.Source.(*fakeSource).Searches(); len(searches) != 0 {
+		t.Errorf("searched %q, want nothing", searches)
+	}
+}
+
+func TestGroupMessages(t *testing.T) {
+	bot := &User{ID: 2, IsBot: true, Username: "gmtm_bot"}
+	other := &User{ID: 3, IsBot: true, Username: "other_bot"}
+	user := &User{ID: 7, FirstName: "Test"}
+
+	tests := []struct {
+		name     string
+		chatType ChatType
+		text     string
+		reply    *User
+		answered bool
+	}{
+		{"plain text", CHAT_TYPE_GROUP, "good morning everyone", nil, false},
+		{"keywords", CHAT_TYPE_GROUP, "dream", nil, false},
+		{"command", CHAT_TYPE_GROUP, "/help", nil, true},
+		{"command addressed to the bot", CHAT_TYPE_SUPERGROUP, "/help@GMTM_bot", nil, true},
+		{"command addressed to another bot", CHAT_TYPE_GROUP, "/help@other_bot", nil, false},
+		{"reply to the bot", CHAT_TYPE_SUPERGROUP, "dream", bot, true},
+		{"reply to another bot", CHAT_TYPE_GROUP, "dream", other, false},
+		{"reply to a user", CHAT_TYPE_GROUP, "dream", user, false},
+		{"private", CHAT_TYPE_PRIVATE, "dream", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+			b.Username = "gmtm_bot"
+
+			message := Message{MessageID: 5, Text: tt.text, From: user, Chat: Chat{ID: -100123, Type: tt.chatType}}
+			if tt.reply != nil {
+				message.ReplyToMessage = &Message{MessageID: 4, From: tt.reply, Chat: message.Chat, Text: "1. Inception"}
+			}
+			body, _ := json.Marshal(Update{UpdateID: 1, Message: message})
+			if rec := postUpdate(b, string(body)); rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			if sent := len(telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE)); (sent > 0) != tt.answered {
+				t.Errorf("sent %d messages, want the message answered: %t", sent, tt.answered)
+			}
+		})
+	}
+}
+
+func TestForumTopics(t *testing.T) {
+	tests := []struct {
+		name  string
+		topic bool
+		want  string
+	}{
+		{"topic", true, "42"},
+		{"reply thread", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+			b.Username = "gmtm_bot"
+			b.SendTyping = true
+
+			chat := Chat{ID: -100123, Type: CHAT_TYPE_SUPERGROUP}
+			answer := &Message{MessageID: 4, From: &User{ID: 2, IsBot: true, Username: "gmtm_bot"}, Chat: chat, Text: "1. Inception"}
+			for i, text := range []string{"/help", "dream"} {
+				message := Message{MessageID: 5 + i, Text: text, Chat: chat, MessageThreadID: 42, IsTopicMessage: tt.topic, ReplyToMessage: answer}
+				body, _ := json.Marshal(Update{UpdateID: 1 + i, Message: message})
+				postUpdate(b, string(body))
+			}
+
+			calls := telegram.Calls()
+			if len(calls) != 3 {
+				t.Fatalf("called %v, want the help, the typing action and the movies sent", calls)
+			}
+			for _, call := range calls {
+				if got := call.Values.Get("message_thread_id"); got != tt.want {
+					t.Errorf("%s message_thread_id = %q, want %q", call.Method, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestForumTopicFeedback(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.AdminChatID = 99
+
+	message := Message{MessageID: 5, Text: "/feedback more horror", Chat: Chat{ID: -100123, Type: CHAT_TYPE_SUPERGROUP}, MessageThreadID: 42, IsTopicMessage: true}
+	body, _ := json.Marshal(Update{UpdateID: 1, Message: message})
+	postUpdate(bot, string(body))
+
+	// the feedback is forwarded to the admin chat, which has no such topic, and the thanks are sent in the topic.
+	sent := telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE)
+	if len(sent) != 2 {
+		t.Fatalf("sent %v, want the feedback and the thanks", sent)
+	}
+	if got := sent[0].Values.Get("message_thread_id"); sent[0].Values.Get("chat_id") != "99" || got != "" {
+		t.Errorf("forwarded the feedback to chat %s with message_thread_id %q, want the admin chat without one", sent[0].Values.Get("chat_id"), got)
+	}
+	if got := sent[1].Values.Get("message_thread_id"); got != "42" {
+		t.Errorf("sent the thanks with message_thread_id %q, want 42", got)
+	}
+}
+
+func TestQuotes(t *testing.T) {
+	tests := []struct {
+		mode     QuoteMode
+		chatType ChatType
+		want     string
+	}{
+		{QUOTE_GROUPS, CHAT_TYPE_GROUP, "5"},
+		{QUOTE_GROUPS, CHAT_TYPE_SUPERGROUP, "5"},
+		{QUOTE_GROUPS, CHAT_TYPE_PRIVATE, ""},
+		{QUOTE_ALWAYS, CHAT_TYPE_PRIVATE, "5"},
+		{QUOTE_NEVER, CHAT_TYPE_GROUP, ""},
+	}
+
+	for _, tt := range tests {
+		bot, telegram, _ := newTestBot(t, nil)
+		bot.Quotes = tt.mode
+
+		message := Message{MessageID: 5, Text: "/help", Chat: Chat{ID: -100123, Type: tt.chatType}}
+		body, _ := json.Marshal(Update{UpdateID: 1, Message: message})
+		postUpdate(bot, string(body))
+
+		sent := telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE)
+		if len(sent) != 1 {
+			t.Fatalf("sent %v, want the help", sent)
+		}
+		if got := sent[0].Values.Get("reply_to_message_id"); got != tt.want {
+			t.Errorf("reply_to_message_id in a %s chat quoting %q = %q, want %q", tt.chatType, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteDeletedMessage(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	telegram.Respond(func(call telegramCall) (int, string) {
+		if call.Values.Get("reply_to_message_id") != "" {
+			return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: message to be replied not found"}`
+		}
+		return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+	})
+
+	message := Message{MessageID: 5, Text: "/help", Chat: Chat{ID: -100123, Type: CHAT_TYPE_GROUP}}
+	body, _ := json.Marshal(Update{UpdateID: 1, Message: message})
+	if rec := postUpdate(bot, string(body)); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	sent := telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE)
+	if len(sent) != 2 || sent[1].Values.Get("reply_to_message_id") != "" || sent[1].Values.Get("text") != sent[0].Values.Get("text") {
+		t.Errorf("sent %v, want the help sent again without quoting the deleted message", sent)
+	}
+}
+
+// slowSource is a MovieSource whose searches take until the context is done, like a scrape of a stalled IMDB.
+type slowSource struct {
+	MovieSource
+}
+
+// Search implements the MovieSource interface.
+func (slowSource) Search(ctx context.Context, keywords []string) ([]Movie, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestUpdateTimeout(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.Source = slowSource{}
+	bot.UpdateTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	err := bot.processUpdate(context.Background(), &Update{UpdateID: 1, Message: Message{MessageID: 3, Text: "dream", Chat: Chat{ID: 7, Type: CHAT_TYPE_PRIVATE}}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("processUpdate() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("processUpdate() took %v, want it bounded by the update timeout", elapsed)
+	}
+
+	calls := telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE)
+	if len(calls) != 1 || calls[0].Values.Get("text") != bot.text(context.Background(), TIMEOUT_TEXT) || calls[0].Values.Get("chat_id") != "7" {
+		t.Errorf("sent %v, want the apology to chat 7", calls)
+	}
+
+	if got := (&Bot{}).updateTimeout(); got != DEFAULT_UPDATE_TIMEOUT {
+		t.Errorf("updateTimeout() of a bot without one = %v, want %v", got, DEFAULT_UPDATE_TIMEOUT)
+	}
+}
+
+func TestAdvancedCommand(t *testing.T) {
+	bot, telegram, imdb := newTestBot(t, fixtures{TITLE_SEARCH_FIXTURE: "advanced.html"})
+	ctx := context.Background()
+
+	postUpdate(bot, messageUpdate(1, 7, "/advanced genre=Horror year=2000-2010 rating=7"))
+	postUpdate(bot, messageUpdate(2, 7, "/advanced"))
+	postUpdate(bot, messageUpdate(3, 7, "/advanced genre=horror rating=eleven"))
+	postUpdate(bot, messageUpdate(4, 7, "/advanced colour=red"))
+
+	sent := sentTexts(telegram.Calls())
+	want := []string{
+		"1. The Others (2001) (7.6) " + imdb.URL + "/title/tt0230600/\n2. The Descent (2005) (7.2) " + imdb.URL + "/title/tt0435625/\n",
+		bot.text(ctx, ADVANCED_USAGE_TEXT),
+		bot.text(ctx, INVALID_ADVANCED_TEXT, "rating=eleven"),
+		bot.text(ctx, INVALID_ADVANCED_TEXT, "colour=red"),
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	wantRequest := TITLE_SEARCH_FIXTURE + "?genres=horror&release_date=2000-01-01%2C2010-12-31&user_rating=7.0%2C"
+	if requests := imdb.Requests(); len(requests) != 1 || requests[0] != wantRequest {
+		t.Errorf("requested %q, want %q", requests, wantRequest)
+	}
+}
+
+func TestShowMoreFallsBackToNewMessage(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	bot.PageSize = 2
+	telegram.Respond(func(call telegramCall) (int, string) {
+		if call.Method == TELEGRAM_API_EDIT_MESSAGE_TEXT {
+			return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: message can't be edited"}`
+		}
+		return http.StatusOK, `{"ok":true,"result":{"message_id":11}}`
+	})
+
+	postUpdate(bot, callbackQueryUpdate(1, 7, 10, moreCallbackData([]string{"dream"}, 2)))
+
+	if edited := telegram.CallsOf(TELEGRAM_API_EDIT_MESSAGE_TEXT); len(edited) != 1 || edited[0].Values.Get("message_id") != "10" {
+		t.Errorf("edited %v, want message 10 tried first", edited)
+	}
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 || !strings.Contains(sent[0], "3. Unrated") {
+		t.Errorf("sent %q, want the page as a new message", sent)
+	}
+}
+
+func TestSendTyping(t *testing.T) {
+	tests := []struct {
+		name       string
+		sendTyping bool
+		text       string
+		want       []string
+	}{
+		{"search", true, "dream", []string{TELEGRAM_API_SEND_CHAT_ACTION, TELEGRAM_API_SEND_MESSAGE}},
+		{"command", true, "/help", []string{TELEGRAM_API_SEND_MESSAGE}},
+		{"disabled", false, "dream", []string{TELEGRAM_API_SEND_MESSAGE}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+			bot.SendTyping = tt.sendTyping
+
+			postUpdate(bot, messageUpdate(1, 7, tt.text))
+
+			calls := telegram.Calls()
+			var methods []string
+			for _, call := range calls {
+				methods = append(methods, call.Method)
+			}
+			if !reflect.DeepEqual(methods, tt.want) {
+				t.Fatalf("called %q, want %q", methods, tt.want)
+			}
+			if tt.want[0] == TELEGRAM_API_SEND_CHAT_ACTION && (calls[0].Values.Get("action") != CHAT_ACTION_TYPING || calls[0].Values.Get("chat_id") != "7") {
+				t.Errorf("sent the chat action %v, want typing in chat 7", calls[0].Values)
+			}
+		})
+	}
+}
+
+func TestSendTypingFailure(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	bot.SendTyping = true
+	telegram.Respond(func(call telegramCall) (int, string) {
+		if call.Method == TELEGRAM_API_SEND_CHAT_ACTION {
+			return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+		}
+		return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+	})
+
+	postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 || !strings.HasPrefix(sent[0], "1. Inception") {
+		t.Errorf("sent %q, want the movies despite the failed chat action", sent)
+	}
+}
+
+func TestStartDeepLink(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	source := &fakeSource{movies: map[string][]Movie{"action,drama": {{Title: "Gladiator", Year: 2000, EndYear: 2000}}}}
+	bot.Source = source
+
+	postUpdate(bot, messageUpdate(1, 7, "/start action,drama"))
+	postUpdate(bot, messageUpdate(2, 7, "/start"))
+	postUpdate(bot, messageUpdate(3, 7, "/start , ,"))
+
+	ctx := context.Background()
+	greeting := bot.text(ctx, START_TEXT, bot.localize(ctx, STRANGER_NAME_TEXT))
+	if want, sent := []string{"1. Gladiator (2000)\n", greeting, greeting}, sentTexts(telegram.Calls()); !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	if searches := source.Searches(); !reflect.DeepEqual(searches, [][]string{{"action", "drama"}}) {
+		t.Errorf("searched %q, want the payload of the deep link only", searches)
+	}
+}
+
+func TestShowGenres(t *testing.T) {
+	for _, show := range []bool{false, true} {
+		bot, telegram, imdb := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+		bot.ShowGenres = show
+
+		postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+		want := "1. Inception (2010) (8.8) " + imdb.URL + "/title/tt1375666/\n"
+		if show {
+			want = "1. Inception (2010) (8.8) [Action, Adventure, Sci-Fi] " + imdb.URL + "/title/tt1375666/\n"
+		}
+		if sent := sentTexts(telegram.Calls()); len(sent) != 1 || !strings.HasPrefix(sent[0], want) {
+			t.Errorf("sent %q with ShowGenres %t, want it to start with %q", sent, show, want)
+		}
+	}
+}
+
+func TestShowPlots(t *testing.T) {
+	bot, telegram, imdb := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	bot.ShowPlots = true
+	bot.PlotLength = 40
+
+	postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+	want := "1. Inception (2010) (8.8) " + imdb.URL + "/title/tt1375666/\nA thief who steals corporate secrets…\n" +
+		"2. Bad Movie (2015–2018) (4.1) "
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 || !strings.HasPrefix(sent[0], want) {
+		t.Errorf("sent %q, want it to start with %q", sent, want)
+	}
+}
+
+func TestShowPlotsMessageLimit(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	movies := make([]Movie, 100)
+	for i := range movies {
+		movies[i] = Movie{Title: fmt.Sprintf("Movie %d", i+1), Year: 2000, EndYear: 2000, Plot: strings.Repeat("plot ", 100)}
+	}
+	bot.Source = &fakeSource{movies: map[string][]Movie{"dream": movies}}
+	bot.ShowPlots = true
+	bot.PageSize = len(movies)
+
+	postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+	sent := sentTexts(telegram.Calls())
+	if len(sent) < 2 {
+		t.Fatalf("sent %d messages, want the plots to need several", len(sent))
+	}
+	for i, text := range sent {
+		if n := utf8.RuneCountInString(text); n > TELEGRAM_MAX_MESSAGE_LEN {
+			t.Errorf("message %d is %d characters long, want at most %d", i+1, n, TELEGRAM_MAX_MESSAGE_LEN)
+		}
+	}
+	if !strings.Contains(sent[0], "\n"+strings.Repeat("plot ", 30)+"plot…\n") {
+		t.Errorf("sent %q, want the plots cut to %d characters", sent[0], DEFAULT_PLOT_LENGTH)
+	}
+}
+
+func TestFields(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	bot.Fields = FIELD_TITLE | FIELD_RATING
+	bot.ShowGenres = true
+
+	postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+	// ShowGenres adds the genres to the fields.
+	want := "1. Inception (8.8) [Action, Adventure, Sci-Fi]\n2. Bad Movie (4.1)"
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 || !strings.HasPrefix(sent[0], want) {
+		t.Errorf("sent %q, want it to start with %q", sent, want)
+	}
+}
+
+func TestAboutCommand(t *testing.T) {
+	version := Version
+	Version = "v1.2.3-test"
+	t.Cleanup(func() { Version = version })
+
+	bot, telegram, _ := newTestBot(t, nil)
+	postUpdate(bot, messageUpdate(1, 7, "/about"))
+
+	sent := sentTexts(telegram.Calls())
+	if len(sent) != 1 || !strings.Contains(sent[0], "v1.2.3-test") || !strings.Contains(sent[0], SOURCE_URL) {
+		t.Errorf("sent %q, want the version and the source of the bot", sent)
+	}
+	if want := bot.text(context.Background(), ABOUT_TEXT, "v1.2.3-test", SOURCE_URL); len(sent) == 1 && sent[0] != want {
+		t.Errorf("sent %q, want %q", sent[0], want)
+	}
+}
+
+func TestSanitizeKeyword(t *testing.T) {
+	tests := []struct {
+		keyword string
+		want    string
+	}{
+		{"time travel", "time travel"},
+		{"sci-fi", "sci-fi"},
+		{"dream?page=2", "dream page 2"},
+		{"heist&sort=year", "heist sort year"},
+		{"../../admin", "admin"},
+		{"sci-fi/horror", "sci-fi horror"},
+		{"a%26b#top", "a 26b top"},
+		{"  café   au  lait ", "café au lait"},
+		{"東京 物語", "東京 物語"},
+		{"фильм", "фильм"},
+		{"فیلم", "فیلم"},
+		{"?&/", ""},
+		{"dream\nheist", "dream heist"},
+		{"dream\x00", "dream"},
+		{"dream\u200e", "dream"},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeKeyword(tt.keyword); got != tt.want {
+			t.Errorf("sanitizeKeyword(%q) = %q, want %q", tt.keyword, got, tt.want)
+		}
+	}
+}
+
+func TestFeedbackCommand(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.AdminChatID = 99
+	ctx := context.Background()
+
+	postUpdate(bot, `{"update_id":1,"message":{"message_id":1,"text":"/feedback the /random movies are great",
+		"from":{"id":7,"is_bot":false,"first_name":"Ada","username":"ada","language_code":"en"},
+		"chat":{"id":7,"first_name":"Ada","type":"private"}}}`)
+	postUpdate(bot, messageUpdate(2, 8, "/feedback"))
+
+	sent := telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE)
+	want := []struct {
+		chatID, text string
+	}{
+		{"99", bot.text(ctx, FEEDBACK_FORWARD_TEXT, "@ada", 7, "the /random movies are great")},
+		{"7", bot.text(ctx, FEEDBACK_THANKS_TEXT)},
+		{"8", bot.text(ctx, FEEDBACK_USAGE_TEXT)},
+	}
+	if len(sent) != len(want) {
+		t.Fatalf("sent %v, want %d messages", sent, len(want))
+	}
+	for i, w := range want {
+		if sent[i].Values.Get("chat_id") != w.chatID || sent[i].Values.Get("text") != w.text {
+			t.Errorf("message %d = %q to chat %s, want %q to chat %s", i+1, sent[i].Values.Get("text"), sent[i].Values.Get("chat_id"), w.text, w.chatID)
+		}
+	}
+}
+
+func TestFeedbackCommandUnavailable(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	ctx := context.Background()
+
+	postUpdate(bot, messageUpdate(1, 7, "/feedback hello"))
+
+	bot.AdminChatID = 99
+	telegram.Respond(func(call telegramCall) (int, string) {
+		if call.Values.Get("chat_id") == "99" {
+			return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+		}
+		return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+	})
+	postUpdate(bot, messageUpdate(2, 7, "/feedback hello"))
+
+	// the second message is the forward the admin chat refused.
+	sent := sentTexts(telegram.Calls())
+	if len(sent) != 3 || sent[0] != bot.text(ctx, FEEDBACK_DISABLED_TEXT) || sent[2] != bot.text(ctx, FEEDBACK_FAILED_TEXT) {
+		t.Errorf("sent %q, want the disabled and the failed texts", sent)
+	}
+}
+
+func TestServeHTTPDuplicateUpdate(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+	update := messageUpdate(9, 7, "/help")
+
+	for i := 0; i < 2; i++ {
+		if w := postUpdate(bot, update); w.Code != http.StatusOK {
+			t.Fatalf("delivery %d: ServeHTTP() status = %d, want %d", i+1, w.Code, http.StatusOK)
+		}
+	}
+	if sent := sentTexts(telegram.Calls()); len(sent) != 1 {
+		t.Errorf("sent %q, want the redelivered update ignored", sent)
+	}
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+)
+
+// SERVICE_NAME is the name of the service reported by the health checks.
+const SERVICE_NAME = "gmtm"
+
+// HealthStatus is the JSON body of the health check responses.
+type HealthStatus struct {
+	Service         string `json:"service"`
+	Status          string `json:"status"`
+	TokenConfigured bool   `json:"token_configured"`
+}
+
+// Health answers the health checks of the deployment, e.g. on /healthz, with 200 and a HealthStatus. the bot token is
+// configured if the TELEGRAM_BOT_TOKEN environment variable is set. Telegram isn't contacted, so probing doesn't use up
+// the rate limits of the bot.
+func Health(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, os.Getenv(BOT_TOKEN_ENV) != "")
+}
+
+// HealthHandler returns the handler answering the health checks of the bot like Health does, to be mounted next to the
+// bot on another path, e.g.
+//
+//	mux.Handle("/", bot)
+//	mux.Handle("/healthz", bot.HealthHandler())
+func (b *Bot) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, b.token != "")
+	})
+}
+
+// writeHealth writes the HealthStatus of the service to w.
+func writeHealth(w http.ResponseWriter, tokenConfigured bool) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	status := HealthStatus{Service: SERVICE_NAME, Status: "ok", TokenConfigured: tokenConfigured}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		stdLogger{}.Error("error writing the health status", "error", err)
+	}
+}
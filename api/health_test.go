@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// getHealth probes handler for its health and returns the response, after checking its status and content type.
+func getHealth(t *testing.T, handler http.Handler) map[string]interface{} {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+	return body
+}
+
+func TestHealth(t *testing.T) {
+	t.Setenv(BOT_TOKEN_ENV, "")
+	want := map[string]interface{}{"service": SERVICE_NAME, "status": "ok", "token_configured": false}
+	if got := getHealth(t, http.HandlerFunc(Health)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Health() = %v, want %v", got, want)
+	}
+
+	t.Setenv(BOT_TOKEN_ENV, TEST_BOT_TOKEN)
+	want["token_configured"] = true
+	if got := getHealth(t, http.HandlerFunc(Health)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Health() with a token = %v, want %v", got, want)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", bot)
+	mux.Handle("/healthz", bot.HealthHandler())
+
+	want := map[string]interface{}{"service": SERVICE_NAME, "status": "ok", "token_configured": true}
+	if got := getHealth(t, mux); !reflect.DeepEqual(got, want) {
+		t.Errorf("HealthHandler() = %v, want %v", got, want)
+	}
+	if calls := telegram.Calls(); len(calls) != 0 {
+		t.Errorf("called Telegram %v, want the health check answered without it", calls)
+	}
+
+	if rec := postUpdate(mux, messageUpdate(1, 7, "/help")); rec.Code != http.StatusOK || len(sentTexts(telegram.Calls())) != 1 {
+		t.Errorf("status = %d, sent %q, want the webhook answered next to the health check", rec.Code, sentTexts(telegram.Calls()))
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"sort"
+	"sync"
+)
+
+// HistoryStore remembers the keyword searches of every chat, so the users can run them again with /history.
+// implementations must be safe for concurrent use.
+type HistoryStore interface {
+	// Record records a search of the keywords in the chat.
+	Record(chatID int, keywords []string) error
+
+	// Recent returns the last n searches of the chat, the most recent first.
+	Recent(chatID int, n int) ([][]string, error)
+}
+
+// MemoryHistoryStore is a HistoryStore which keeps a bounded number of searches per chat in memory.
+type MemoryHistoryStore struct {
+	size int
+
+	mu       sync.Mutex
+	searches map[int][][]string
+}
+
+// NewMemoryHistoryStore returns a MemoryHistoryStore which remembers the last size searches of every chat.
+func NewMemoryHistoryStore(size int) *MemoryHistoryStore {
+	return &MemoryHistoryStore{
+		size:     size,
+		searches: make(map[int][][]string),
+	}
+}
+
+// Record implements the HistoryStore interface. a search made before is moved to the front instead of being recorded
+// twice.
+func (s *MemoryHistoryStore) Record(chatID int, keywords []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	searches := [][]string{append([]string(nil), keywords...)}
+	for _, search := range s.searches[chatID] {
+		if !equalKeywords(search, keywords) && len(searches) < s.size {
+			searches = append(searches, search)
+		}
+	}
+	s.searches[chatID] = searches
+
+	return nil
+}
+
+// Recent implements the HistoryStore interface.
+func (s *MemoryHistoryStore) Recent(chatID int, n int) ([][]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	searches := s.searches[chatID]
+	if n < len(searches) {
+		searches = searches[:n]
+	}
+
+	return append([][]string(nil), searches...), nil
+}
+
+// equalKeywords reports whether the searches a and b have the same keywords, whatever their order, since the keywords
+// keep the order they were typed in.
+func equalKeywords(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
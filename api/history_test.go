@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryHistoryStorePerChat(t *testing.T) {
+	store := NewMemoryHistoryStore(2)
+
+	store.Record(1, []string{"action"})
+	store.Record(2, []string{"horror"})
+	store.Record(1, []string{"comedy"})
+	store.Record(1, []string{"drama"})
+
+	tests := []struct {
+		chatID, n int
+		want      [][]string
+	}{
+		{1, 10, [][]string{{"drama"}, {"comedy"}}},
+		{1, 1, [][]string{{"drama"}}},
+		{2, 10, [][]string{{"horror"}}},
+		{3, 10, nil},
+	}
+
+	for _, tt := range tests {
+		recent, err := store.Recent(tt.chatID, tt.n)
+		if err != nil {
+			t.Fatalf("Recent() error = %v", err)
+		}
+		if !reflect.DeepEqual(recent, tt.want) {
+			t.Errorf("Recent(%d, %d) = %q, want %q", tt.chatID, tt.n, recent, tt.want)
+		}
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	bot.Favorites = nil
+
+	postUpdate(bot, messageUpdate(1, 7, "dream, heist"))
+	postUpdate(bot, messageUpdate(2, 8, "horror"))
+	postUpdate(bot, messageUpdate(3, 7, "/history"))
+
+	sent := telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE)
+	if len(sent) != 3 {
+		t.Fatalf("sent %d messages, want 3", len(sent))
+	}
+	history := sent[2]
+	if text := history.Values.Get("text"); text != bot.text(context.Background(), HISTORY_TEXT) {
+		t.Errorf("sent %q, want the history", text)
+	}
+	data := callbackData(t, history.Values)
+	if want := []string{SEARCH_CALLBACK_PREFIX + "dream,heist"}; !reflect.DeepEqual(data, want) {
+		t.Fatalf("buttons = %q, want %q", data, want)
+	}
+
+	postUpdate(bot, callbackQueryUpdate(4, 7, 3, data[0]))
+
+	texts := sentTexts(telegram.Calls())
+	if len(texts) != 4 || texts[3] != texts[0] {
+		t.Errorf("sent %q, want the search run again", texts)
+	}
+}
+
+func TestMemoryHistoryStoreRecordsSearchOnce(t *testing.T) {
+	store := NewMemoryHistoryStore(10)
+
+	store.Record(1, []string{"action", "drama"})
+	store.Record(1, []string{"comedy"})
+	store.Record(1, []string{"drama", "action"})
+
+	recent, err := store.Recent(1, 10)
+	if err != nil {
+		t.Fatalf("Recent() error = %v", err)
+	}
+	if want := [][]string{{"drama", "action"}, {"comedy"}}; !reflect.DeepEqual(recent, want) {
+		t.Errorf("Recent() = %q, want %q", recent, want)
+	}
+}
@@ -0,0 +1,315 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MessageKey identifies a text the bot sends in a Catalog.
+type MessageKey string
+
+// the texts the bot sends. some of them are fmt formats, see DefaultCatalog.
+const (
+	START_TEXT                MessageKey = "start"
+	STRANGER_NAME_TEXT        MessageKey = "stranger_name"
+	HELP_TEXT                 MessageKey = "help"
+	ABOUT_TEXT                MessageKey = "about"
+	NO_RESULTS_TEXT           MessageKey = "no_results"
+	SCRAPE_FAILED_TEXT        MessageKey = "scrape_failed"
+	MEDIA_NOT_SUPPORTED_TEXT  MessageKey = "media_not_supported"
+	NO_MORE_RESULTS_TEXT      MessageKey = "no_more_results"
+	SHOW_MORE_TEXT            MessageKey = "show_more"
+	NO_KEYWORDS_TEXT          MessageKey = "no_keywords"
+	TOO_MANY_KEYWORDS_TEXT    MessageKey = "too_many_keywords"
+	YEAR_USAGE_TEXT           MessageKey = "year_usage"
+	INVALID_YEAR_RANGE_TEXT   MessageKey = "invalid_year_range"
+	UNKNOWN_GENRE_TEXT        MessageKey = "unknown_genre"
+	SORT_USAGE_TEXT           MessageKey = "sort_usage"
+	UNKNOWN_SORT_TEXT         MessageKey = "unknown_sort"
+	TYPE_USAGE_TEXT           MessageKey = "type_usage"
+	UNKNOWN_TYPE_TEXT         MessageKey = "unknown_type"
+	CHART_USAGE_TEXT          MessageKey = "chart_usage"
+	UNKNOWN_CHART_TEXT        MessageKey = "unknown_chart"
+	INVALID_CHART_RANGE_TEXT  MessageKey = "invalid_chart_range"
+	HISTORY_TEXT              MessageKey = "history"
+	NO_HISTORY_TEXT           MessageKey = "no_history"
+	SAVE_USAGE_TEXT           MessageKey = "save_usage"
+	SAVED_TEXT                MessageKey = "saved"
+	FAVORITES_TEXT            MessageKey = "favorites"
+	NO_FAVORITES_TEXT         MessageKey = "no_favorites"
+	TOO_MANY_FAVORITES_TEXT   MessageKey = "too_many_favorites"
+	FAVORITES_FAILED_TEXT     MessageKey = "favorites_failed"
+	FAVORITES_DISABLED_TEXT   MessageKey = "favorites_disabled"
+	SLOW_DOWN_TEXT            MessageKey = "slow_down"
+	TRUNCATED_TEXT            MessageKey = "truncated"
+	NOT_AUTHORIZED_TEXT       MessageKey = "not_authorized"
+	ANY_RESULTS_TEXT          MessageKey = "any_results"
+	TOP_USAGE_TEXT            MessageKey = "top_usage"
+	INVALID_TOP_TEXT          MessageKey = "invalid_top"
+	SET_DEFAULT_USAGE_TEXT    MessageKey = "set_default_usage"
+	INVALID_DEFAULT_TEXT      MessageKey = "invalid_default"
+	DEFAULTS_TEXT             MessageKey = "defaults"
+	NO_DEFAULTS_TEXT          MessageKey = "no_defaults"
+	DEFAULTS_CLEARED_TEXT     MessageKey = "defaults_cleared"
+	PREFERENCES_FAILED_TEXT   MessageKey = "preferences_failed"
+	PREFERENCES_DISABLED_TEXT MessageKey = "preferences_disabled"
+	TIMEOUT_TEXT              MessageKey = "timeout"
+	SOURCE_BUSY_TEXT          MessageKey = "source_busy"
+	SOURCE_UNAVAILABLE_TEXT   MessageKey = "source_unavailable"
+	BUSY_TEXT                 MessageKey = "busy"
+	VOICE_TOO_LONG_TEXT       MessageKey = "voice_too_long"
+	TRANSCRIPTION_FAILED_TEXT MessageKey = "transcription_failed"
+	TRANSCRIPTION_EMPTY_TEXT  MessageKey = "transcription_empty"
+	NOT_TEXT_DOCUMENT_TEXT    MessageKey = "not_text_document"
+	BATCH_TOO_LARGE_TEXT      MessageKey = "batch_too_large"
+	BATCH_FAILED_TEXT         MessageKey = "batch_failed"
+	TOO_MANY_QUERIES_TEXT     MessageKey = "too_many_queries"
+	BATCH_QUERY_TEXT          MessageKey = "batch_query"
+	FEEDBACK_USAGE_TEXT       MessageKey = "feedback_usage"
+	FEEDBACK_FORWARD_TEXT     MessageKey = "feedback_forward"
+	FEEDBACK_THANKS_TEXT      MessageKey = "feedback_thanks"
+	FEEDBACK_FAILED_TEXT      MessageKey = "feedback_failed"
+	FEEDBACK_DISABLED_TEXT    MessageKey = "feedback_disabled"
+	RELATED_RESULTS_TEXT      MessageKey = "related_results"
+	KEYWORDS_DROPPED_TEXT     MessageKey = "keywords_dropped"
+	ADVANCED_USAGE_TEXT       MessageKey = "advanced_usage"
+	INVALID_ADVANCED_TEXT     MessageKey = "invalid_advanced"
+)
+
+// Catalog holds the texts of the bot in every language it speaks, by the IETF language tag of the language, e.g. "en"
+// or "pt-br", and then by MessageKey.
+type Catalog map[string]map[MessageKey]string
+
+// DefaultCatalog is the Catalog of the bots which don't set their own. languages can be added to it, or its texts
+// changed, before the bots start answering updates.
+var DefaultCatalog = Catalog{
+	DEFAULT_LANGUAGE: {
+		START_TEXT:         "Hey %s!\nGive me some keywords (comma delimited) to recommend you movies :D",
+		STRANGER_NAME_TEXT: "dude",
+		HELP_TEXT: "Send me some keywords (comma delimited), e.g. \"time travel, dystopia\", and I'll recommend you movies.\n\n" +
+			"/start - greeting\n" +
+			"/help - show this message\n" +
+			"/about - what I am and where my source is\n" +
+			"/year <from>-<to> <keywords> - only movies released between the years, e.g. /year 2000-2010 heist\n" +
+			"/genre <genre> - movies of a genre, e.g. /genre horror\n" +
+			"/trending - the movies which are popular right now\n" +
+			"/top250 [number or range] - the best rated movies of IMDB, e.g. /top250 11-20\n" +
+			"/chart <chart> [number or range] - the titles of an IMDB chart, e.g. /chart toptv 5\n" +
+			"/advanced <key>=<value> ... - movies by genre, year, rating and sort, e.g. /advanced genre=horror year=2000-2010 rating=7\n" +
+			"/sort <relevance|rating|year> <keywords> - movies in another order, e.g. /sort rating heist\n" +
+			"/type <type> <keywords> - only the titles of a type, e.g. /type movie heist or /type series heist\n" +
+			"/random <keywords> - one random movie, e.g. /random time travel\n" +
+			"/any <keywords> - movies matching any of the keywords instead of all of them, e.g. /any heist, zombie\n" +
+			"/top <number> <keywords> - only the first movies, e.g. /top 5 heist\n" +
+			"/history - your last searches\n" +
+			"/save <title> - save a movie to your favorites\n" +
+			"/favorites - list your favorites\n" +
+			"/setdefault <key>=<value> ... - defaults of your searches, e.g. /setdefault minrating=7 sort=year top=10\n" +
+			"/defaults - show your defaults\n" +
+			"/cleardefaults - clear your defaults\n" +
+			"/feedback <text> - tell the people running me what you think",
+		ABOUT_TEXT:                "Give Me The Movie! %s\nI recommend movies matching the keywords you send me.\nSource: %s",
+		NO_RESULTS_TEXT:           "No movies found for those keywords :(",
+		SCRAPE_FAILED_TEXT:        "Sorry, I couldn't get the movies. Please try again later.",
+		MEDIA_NOT_SUPPORTED_TEXT:  "I only understand text keywords for now.",
+		NO_MORE_RESULTS_TEXT:      "That's all I've got for those keywords.",
+		SHOW_MORE_TEXT:            "Show more",
+		NO_KEYWORDS_TEXT:          "Please send me some keywords, separated by commas.",
+		TOO_MANY_KEYWORDS_TEXT:    "That's too many keywords! Please send me %d at most.",
+		YEAR_USAGE_TEXT:           "Usage: /year <from>-<to> <keywords>, e.g. /year 2000-2010 heist",
+		INVALID_YEAR_RANGE_TEXT:   "Sorry, I don't understand the year range %s. Try something like 2000-2010.",
+		UNKNOWN_GENRE_TEXT:        "Sorry, I don't know the genre \"%s\". Pick one of: %s",
+		SORT_USAGE_TEXT:           "Usage: /sort <relevance|rating|year> <keywords>, e.g. /sort rating heist",
+		UNKNOWN_SORT_TEXT:         "Sorry, I can't sort by \"%s\". Pick one of: relevance, rating, year",
+		TYPE_USAGE_TEXT:           "Usage: /type <type> <keywords>, e.g. /type movie heist",
+		UNKNOWN_TYPE_TEXT:         "Sorry, I don't know the type \"%s\". Pick one of: %s",
+		CHART_USAGE_TEXT:          "Usage: /chart <chart> [number or range], e.g. /chart toptv 11-20. The charts are: %s",
+		UNKNOWN_CHART_TEXT:        "Sorry, I don't know the chart \"%s\". Pick one of: %s",
+		INVALID_CHART_RANGE_TEXT:  "Sorry, I don't understand %s. Send a number like 20 or a range like 11-20, of %d titles at most.",
+		HISTORY_TEXT:              "Your last searches, tap one to run it again:",
+		NO_HISTORY_TEXT:           "You haven't searched anything yet.",
+		SAVE_USAGE_TEXT:           "Usage: /save <title>, e.g. /save Inception",
+		SAVED_TEXT:                "Saved \"%s\" to your favorites.",
+		FAVORITES_TEXT:            "Your favorites:",
+		NO_FAVORITES_TEXT:         "You haven't saved any movies yet. Use /save <title> or tap ❤ next to a movie.",
+		TOO_MANY_FAVORITES_TEXT:   "Your favorites are full, I can't save more movies.",
+		FAVORITES_FAILED_TEXT:     "Sorry, I couldn't get to your favorites. Please try again later.",
+		FAVORITES_DISABLED_TEXT:   "Favorites are turned off.",
+		SLOW_DOWN_TEXT:            "Whoa, slow down! Give me a few seconds before the next search.",
+		TRUNCATED_TEXT:            "(…%d more)",
+		NOT_AUTHORIZED_TEXT:       "Sorry, this bot is private.",
+		ANY_RESULTS_TEXT:          "Movies matching any of: %s",
+		TOP_USAGE_TEXT:            "Usage: /top <number> <keywords>, e.g. /top 5 heist",
+		INVALID_TOP_TEXT:          "Sorry, %s isn't a number of movies I can send. Pick one from 1 to %d.",
+		SET_DEFAULT_USAGE_TEXT:    "Usage: /setdefault <key>=<value> ..., e.g. /setdefault minrating=7 sort=year top=10",
+		INVALID_DEFAULT_TEXT:      "Sorry, I don't understand %s. Use minrating=<0-10>, sort=<relevance|rating|year> or top=<1-%d>.",
+		DEFAULTS_TEXT:             "Your searches default to: %s",
+		NO_DEFAULTS_TEXT:          "You haven't set any defaults. Use /setdefault to set some.",
+		DEFAULTS_CLEARED_TEXT:     "Your defaults are cleared.",
+		PREFERENCES_FAILED_TEXT:   "Sorry, I couldn't get to your defaults. Please try again later.",
+		PREFERENCES_DISABLED_TEXT: "Defaults are turned off.",
+		TIMEOUT_TEXT:              "Sorry, that took me too long. Please try again in a bit.",
+		SOURCE_BUSY_TEXT:          "The movie database is busy right now. Please try again in a minute.",
+		SOURCE_UNAVAILABLE_TEXT:   "The movie database is temporarily unavailable. Please try again in a few minutes.",
+		BUSY_TEXT:                 "I'm busy with a lot of searches right now. Please try again in a moment.",
+		VOICE_TOO_LONG_TEXT:       "Sorry, that recording is too long for me. Please keep it short.",
+		TRANSCRIPTION_FAILED_TEXT: "Sorry, I couldn't make out what you said. Please try again or type your keywords.",
+		TRANSCRIPTION_EMPTY_TEXT:  "I didn't hear any keywords. Please try again or type them.",
+		NOT_TEXT_DOCUMENT_TEXT:    "I only read plain .txt files, with a search on every line, e.g. \"time travel, dystopia\".",
+		BATCH_TOO_LARGE_TEXT:      "That file is too large. Please send me %d KB at most.",
+		BATCH_FAILED_TEXT:         "Sorry, I couldn't read that file. Please try again later.",
+		TOO_MANY_QUERIES_TEXT:     "That's too many searches! Please send me %d lines at most.",
+		BATCH_QUERY_TEXT:          "Results for: %s",
+		FEEDBACK_USAGE_TEXT:       "Usage: /feedback <text>, e.g. /feedback the /random movies are great",
+		FEEDBACK_FORWARD_TEXT:     "Feedback from %s (chat %d):\n%s",
+		FEEDBACK_THANKS_TEXT:      "Thanks for your feedback!",
+		FEEDBACK_FAILED_TEXT:      "Sorry, I couldn't pass your feedback on. Please try again later.",
+		FEEDBACK_DISABLED_TEXT:    "Sorry, feedback is turned off.",
+		RELATED_RESULTS_TEXT:      "Nothing matches all of your keywords. Showing related results for: %s",
+		KEYWORDS_DROPPED_TEXT:     "Your keywords are too long to search at once, so I left out: %s",
+		ADVANCED_USAGE_TEXT:       "Usage: /advanced <key>=<value> ..., e.g. /advanced genre=horror year=2000-2010 rating=7 sort=rating",
+		INVALID_ADVANCED_TEXT:     "Sorry, I don't understand %s. Use genre=<genre,...>, year=<from>-<to>, rating=<0-10> or sort=<relevance|rating|year>.",
+	},
+	"fa": {
+		START_TEXT:         "سلام %s!\nچند کلمه‌ی کلیدی (جدا شده با کاما) بفرست تا برات فیلم پیشنهاد بدم :D",
+		STRANGER_NAME_TEXT: "رفیق",
+		HELP_TEXT: "چند کلمه‌ی کلیدی (جدا شده با کاما) بفرست، مثلا \"time travel, dystopia\"، تا برات فیلم پیشنهاد بدم.\n\n" +
+			"/start - خوش‌آمدگویی\n" +
+			"/help - نمایش همین پیام\n" +
+			"/about - من کی هستم و کدم کجاست\n" +
+			"/year <from>-<to> <keywords> - فقط فیلم‌های ساخته شده بین این سال‌ها، مثلا /year 2000-2010 heist\n" +
+			"/genre <genre> - فیلم‌های یک ژانر، مثلا /genre horror\n" +
+			"/trending - فیلم‌هایی که این روزها محبوب هستن\n" +
+			"/top250 [number or range] - بهترین فیلم‌های IMDB، مثلا /top250 11-20\n" +
+			"/chart <chart> [number or range] - عنوان‌های یکی از جدول‌های IMDB، مثلا /chart toptv 5\n" +
+			"/advanced <key>=<value> ... - فیلم‌ها بر اساس ژانر، سال، امتیاز و ترتیب، مثلا /advanced genre=horror year=2000-2010 rating=7\n" +
+			"/sort <relevance|rating|year> <keywords> - فیلم‌ها به ترتیبی دیگر، مثلا /sort rating heist\n" +
+			"/type <type> <keywords> - فقط عنوان‌های یک نوع، مثلا /type movie heist یا /type series heist\n" +
+			"/random <keywords> - یک فیلم تصادفی، مثلا /random time travel\n" +
+			"/any <keywords> - فیلم‌هایی که به جای همه‌ی کلمه‌ها با حداقل یکی جور درمیان، مثلا /any heist, zombie\n" +
+			"/top <number> <keywords> - فقط اولین فیلم‌ها، مثلا /top 5 heist\n" +
+			"/history - آخرین جستجوهای تو\n" +
+			"/save <title> - ذخیره‌ی یک فیلم در علاقه‌مندی‌ها\n" +
+			"/favorites - فهرست علاقه‌مندی‌ها\n" +
+			"/setdefault <key>=<value> ... - پیش‌فرض جستجوهای تو، مثلا /setdefault minrating=7 sort=year top=10\n" +
+			"/defaults - نمایش پیش‌فرض‌ها\n" +
+			"/cleardefaults - پاک کردن پیش‌فرض‌ها\n" +
+			"/feedback <text> - نظرت رو به گرداننده‌های من بگو",
+		ABOUT_TEXT:                "Give Me The Movie! %s\nبرات فیلم‌هایی پیشنهاد می‌دم که با کلمه‌های کلیدیت جور درمیان.\nکد: %s",
+		NO_RESULTS_TEXT:           "برای این کلمه‌ها فیلمی پیدا نکردم :(",
+		SCRAPE_FAILED_TEXT:        "متاسفانه نتونستم فیلم‌ها رو بگیرم. لطفا کمی بعد دوباره امتحان کن.",
+		MEDIA_NOT_SUPPORTED_TEXT:  "فعلا فقط کلمه‌های کلیدی متنی رو می‌فهمم.",
+		NO_MORE_RESULTS_TEXT:      "برای این کلمه‌ها همین‌ها رو داشتم.",
+		SHOW_MORE_TEXT:            "بیشتر",
+		NO_KEYWORDS_TEXT:          "لطفا چند کلمه‌ی کلیدی بفرست و با کاما جداشون کن.",
+		TOO_MANY_KEYWORDS_TEXT:    "کلمه‌ها خیلی زیادن! لطفا حداکثر %d تا بفرست.",
+		YEAR_USAGE_TEXT:           "طرز استفاده: /year <from>-<to> <keywords>، مثلا /year 2000-2010 heist",
+		INVALID_YEAR_RANGE_TEXT:   "متاسفانه بازه‌ی سال %s رو متوجه نشدم. چیزی مثل 2000-2010 رو امتحان کن.",
+		UNKNOWN_GENRE_TEXT:        "متاسفانه ژانر «%s» رو نمی‌شناسم. یکی از این‌ها رو انتخاب کن: %s",
+		SORT_USAGE_TEXT:           "طرز استفاده: /sort <relevance|rating|year> <keywords>، مثلا /sort rating heist",
+		UNKNOWN_SORT_TEXT:         "متاسفانه نمی‌تونم بر اساس «%s» مرتب کنم. یکی از این‌ها رو انتخاب کن: relevance, rating, year",
+		TYPE_USAGE_TEXT:           "طرز استفاده: /type <type> <keywords>، مثلا /type movie heist",
+		UNKNOWN_TYPE_TEXT:         "متاسفانه نوع «%s» رو نمی‌شناسم. یکی از این‌ها رو انتخاب کن: %s",
+		CHART_USAGE_TEXT:          "طرز استفاده: /chart <chart> [number or range]، مثلا /chart toptv 11-20. جدول‌ها: %s",
+		UNKNOWN_CHART_TEXT:        "متاسفانه جدول «%s» رو نمی‌شناسم. یکی از این‌ها رو انتخاب کن: %s",
+		INVALID_CHART_RANGE_TEXT:  "متاسفانه %s رو متوجه نشدم. عددی مثل 20 یا بازه‌ای مثل 11-20 بفرست، حداکثر %d عنوان.",
+		HISTORY_TEXT:              "آخرین جستجوهای تو، روی هر کدوم بزن تا دوباره اجرا بشه:",
+		NO_HISTORY_TEXT:           "هنوز چیزی جستجو نکردی.",
+		SAVE_USAGE_TEXT:           "طرز استفاده: /save <title>، مثلا /save Inception",
+		SAVED_TEXT:                "«%s» به علاقه‌مندی‌هات اضافه شد.",
+		FAVORITES_TEXT:            "علاقه‌مندی‌های تو:",
+		NO_FAVORITES_TEXT:         "هنوز فیلمی ذخیره نکردی. از /save <title> استفاده کن یا کنار یک فیلم روی ❤ بزن.",
+		TOO_MANY_FAVORITES_TEXT:   "علاقه‌مندی‌هات پر شده و نمی‌تونم فیلم دیگه‌ای ذخیره کنم.",
+		FAVORITES_FAILED_TEXT:     "متاسفانه نتونستم به علاقه‌مندی‌هات دسترسی پیدا کنم. لطفا کمی بعد دوباره امتحان کن.",
+		FAVORITES_DISABLED_TEXT:   "علاقه‌مندی‌ها خاموش هستن.",
+		SLOW_DOWN_TEXT:            "یواش‌تر! چند ثانیه صبر کن و بعد دوباره جستجو کن.",
+		TRUNCATED_TEXT:            "(…و %d تای دیگر)",
+		NOT_AUTHORIZED_TEXT:       "متاسفانه این ربات خصوصی است.",
+		ANY_RESULTS_TEXT:          "فیلم‌هایی که با حداقل یکی از این‌ها جور درمیان: %s",
+		TOP_USAGE_TEXT:            "طرز استفاده: /top <number> <keywords>، مثلا /top 5 heist",
+		INVALID_TOP_TEXT:          "متاسفانه نمی‌تونم %s تا فیلم بفرستم. عددی از 1 تا %d انتخاب کن.",
+		SET_DEFAULT_USAGE_TEXT:    "طرز استفاده: /setdefault <key>=<value> ...، مثلا /setdefault minrating=7 sort=year top=10",
+		INVALID_DEFAULT_TEXT:      "متاسفانه %s رو متوجه نشدم. از minrating=<0-10>، sort=<relevance|rating|year> یا top=<1-%d> استفاده کن.",
+		DEFAULTS_TEXT:             "پیش‌فرض جستجوهای تو: %s",
+		NO_DEFAULTS_TEXT:          "هنوز پیش‌فرضی تنظیم نکردی. با /setdefault تنظیمشون کن.",
+		DEFAULTS_CLEARED_TEXT:     "پیش‌فرض‌هات پاک شدن.",
+		PREFERENCES_FAILED_TEXT:   "متاسفانه نتونستم به پیش‌فرض‌هات دسترسی پیدا کنم. لطفا کمی بعد دوباره امتحان کن.",
+		PREFERENCES_DISABLED_TEXT: "پیش‌فرض‌ها خاموش هستن.",
+		TIMEOUT_TEXT:              "متاسفانه خیلی طول کشید. لطفا کمی بعد دوباره امتحان کن.",
+		SOURCE_BUSY_TEXT:          "پایگاه فیلم‌ها الان خیلی شلوغه. لطفا یک دقیقه‌ی دیگه دوباره امتحان کن.",
+		SOURCE_UNAVAILABLE_TEXT:   "پایگاه فیلم‌ها فعلا در دسترس نیست. لطفا چند دقیقه‌ی دیگه دوباره امتحان کن.",
+		BUSY_TEXT:                 "الان سرم با جستجوهای زیادی شلوغه. لطفا چند لحظه‌ی دیگه دوباره امتحان کن.",
+		VOICE_TOO_LONG_TEXT:       "ببخشید، این صدا برام خیلی طولانیه. لطفا کوتاه‌ترش کن.",
+		TRANSCRIPTION_FAILED_TEXT: "ببخشید، نفهمیدم چی گفتی. لطفا دوباره امتحان کن یا کلمه‌های کلیدیت رو تایپ کن.",
+		TRANSCRIPTION_EMPTY_TEXT:  "هیچ کلمه‌ی کلیدی‌ای نشنیدم. لطفا دوباره امتحان کن یا تایپشون کن.",
+		NOT_TEXT_DOCUMENT_TEXT:    "فقط فایل‌های متنی .txt رو می‌خونم، با یک جستجو در هر خط، مثلا \"time travel, dystopia\".",
+		BATCH_TOO_LARGE_TEXT:      "این فایل خیلی بزرگه. لطفا حداکثر %d کیلوبایت بفرست.",
+		BATCH_FAILED_TEXT:         "ببخشید، نتونستم این فایل رو بخونم. لطفا بعدا دوباره امتحان کن.",
+		TOO_MANY_QUERIES_TEXT:     "این‌ها جستجوهای زیادی هستن! لطفا حداکثر %d خط بفرست.",
+		BATCH_QUERY_TEXT:          "نتیجه‌ها برای: %s",
+		FEEDBACK_USAGE_TEXT:       "طرز استفاده: /feedback <text>، مثلا /feedback فیلم‌های /random عالین",
+		FEEDBACK_FORWARD_TEXT:     "بازخورد از %s (چت %d):\n%s",
+		FEEDBACK_THANKS_TEXT:      "ممنون از بازخوردت!",
+		FEEDBACK_FAILED_TEXT:      "ببخشید، نتونستم بازخوردت رو برسونم. لطفا بعدا دوباره امتحان کن.",
+		FEEDBACK_DISABLED_TEXT:    "ببخشید، بازخورد خاموشه.",
+		RELATED_RESULTS_TEXT:      "فیلمی با همه‌ی کلمه‌هات جور درنمیاد. نتایج مرتبط با: %s",
+		KEYWORDS_DROPPED_TEXT:     "کلمه‌هات برای یه جستجو خیلی طولانین، برای همین این‌ها رو کنار گذاشتم: %s",
+		ADVANCED_USAGE_TEXT:       "طرز استفاده: /advanced <key>=<value> ...، مثلا /advanced genre=horror year=2000-2010 rating=7 sort=rating",
+		INVALID_ADVANCED_TEXT:     "متاسفانه %s رو متوجه نشدم. از genre=<genre,...>، year=<from>-<to>، rating=<0-10> یا sort=<relevance|rating|year> استفاده کن.",
+	},
+}
+
+// lookup returns the text of key in the language, falling back to its base language, e.g. "pt" for "pt-br", and then
+// to DEFAULT_LANGUAGE, for the languages and the texts the catalog is missing.
+func (c Catalog) lookup(language string, key MessageKey) string {
+	language = strings.ToLower(language)
+	candidates := []string{language}
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		candidates = append(candidates, language[:i])
+	}
+	candidates = append(candidates, DEFAULT_LANGUAGE)
+
+	for _, candidate := range candidates {
+		if text, ok := c[candidate][key]; ok {
+			return text
+		}
+	}
+	return string(key)
+}
+
+// languageKey is the context key of the language of the user an update is answered to.
+type languageKey struct{}
+
+// withLanguage returns a context in which the texts are sent in the language.
+func withLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, languageKey{}, language)
+}
+
+// languageFrom returns the language of ctx, or "" if the texts are sent in DEFAULT_LANGUAGE.
+func languageFrom(ctx context.Context) string {
+	language, _ := ctx.Value(languageKey{}).(string)
+	return language
+}
+
+// catalog returns the Catalog of the bot, falling back to DefaultCatalog.
+func (b *Bot) catalog() Catalog {
+	if b.Catalog == nil {
+		return DefaultCatalog
+	}
+	return b.Catalog
+}
+
+// localize returns the text of key in the language of ctx, formatted with args if there are any.
+func (b *Bot) localize(ctx context.Context, key MessageKey, args ...interface{}) string {
+	text := b.catalog().lookup(languageFrom(ctx), key)
+	if len(args) > 0 {
+		text = fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// text returns the text of key the same way localize does, escaped for the parse mode of the bot.
+func (b *Bot) text(ctx context.Context, key MessageKey, args ...interface{}) string {
+	return b.ParseMode.escape(b.localize(ctx, key, args...))
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCatalogLookup(t *testing.T) {
+	catalog := Catalog{
+		DEFAULT_LANGUAGE: {HELP_TEXT: "help", NO_RESULTS_TEXT: "no results"},
+		"pt":             {HELP_TEXT: "ajuda", NO_RESULTS_TEXT: "sem resultados"},
+		"pt-br":          {HELP_TEXT: "ajuda brasileira"},
+	}
+
+	tests := []struct {
+		language string
+		key      MessageKey
+		want     string
+	}{
+		{"pt-br", HELP_TEXT, "ajuda brasileira"},
+		{"PT-BR", HELP_TEXT, "ajuda brasileira"},
+		{"pt-br", NO_RESULTS_TEXT, "sem resultados"},
+		{"pt_PT", HELP_TEXT, "ajuda"},
+		{"de", HELP_TEXT, "help"},
+		{"", HELP_TEXT, "help"},
+		{"pt", START_TEXT, string(START_TEXT)},
+	}
+
+	for _, tt := range tests {
+		if got := catalog.lookup(tt.language, tt.key); got != tt.want {
+			t.Errorf("lookup(%q, %q) = %q, want %q", tt.language, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultCatalogIsComplete(t *testing.T) {
+	for language, texts := range DefaultCatalog {
+		for key := range texts {
+			if _, ok := DefaultCatalog[DEFAULT_LANGUAGE][key]; !ok {
+				t.Errorf("%s has the text %q, which %s is missing", language, key, DEFAULT_LANGUAGE)
+			}
+		}
+	}
+}
+
+func TestLanguageOfTheSender(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.Catalog = Catalog{
+		DEFAULT_LANGUAGE: {HELP_TEXT: "help"},
+		"fa":             DefaultCatalog["fa"],
+		"eo":             {HELP_TEXT: "helpo"},
+	}
+
+	for i, language := range []string{"fa", "eo", "de", ""} {
+		update := Update{UpdateID: i + 1, Message: Message{
+			MessageID: 1,
+			Text:      "/help",
+			Chat:      Chat{ID: 7, Type: CHAT_TYPE_PRIVATE},
+			From:      &User{ID: 7, FirstName: "Test", LanguageCode: language},
+		}}
+		body, _ := json.Marshal(update)
+		postUpdate(bot, string(body))
+	}
+
+	want := []string{DefaultCatalog["fa"][HELP_TEXT], "helpo", "help", "help"}
+	if texts := sentTexts(telegram.Calls()); !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+}
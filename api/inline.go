@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// InlineQuery is a Telegram object that we receive when a user types "@bot keywords" in any chat.
+type InlineQuery struct {
+	ID     string `json:"id"`
+	From   User   `json:"from"`
+	Query  string `json:"query"`
+	Offset string `json:"offset"`
+}
+
+// String implements the fmt.String interface to get the representation of an InlineQuery as a string.
+func (q InlineQuery) String() string {
+	return fmt.Sprintf("(id: %s, query: %s, from: %s)", q.ID, q.Query, q.From)
+}
+
+// InlineQueryResultArticle is a result of an inline query. choosing it sends InputMessageContent to the chat.
+type InlineQueryResultArticle struct {
+	Type                string                  `json:"type"`
+	ID                  string                  `json:"id"`
+	Title               string                  `json:"title"`
+	Description         string                  `json:"description,omitempty"`
+	URL                 string                  `json:"url,omitempty"`
+	ThumbnailURL        string                  `json:"thumbnail_url,omitempty"`
+	InputMessageContent InputTextMessageContent `json:"input_message_content"`
+}
+
+// InputTextMessageContent is the text message sent when an InlineQueryResultArticle is chosen.
+type InputTextMessageContent struct {
+	MessageText string `json:"message_text"`
+	ParseMode   string `json:"parse_mode,omitempty"`
+}
+
+// handleInlineQuery searches the keywords of the query and answers it with a result per movie. queries without
+// keywords we can search, and failed searches, are answered with no results, so the user sees an empty list rather
+// than a spinner.
+func (b *Bot) handleInlineQuery(ctx context.Context, query *InlineQuery) (string, error) {
+	var movies []Movie
+	keywords := getKeywords(query.Query)
+	if _, ok := b.checkKeywords(ctx, keywords); ok {
+		var err error
+		movies, err = b.getMovies(ctx, keywords, b.defaultFilter())
+		if err != nil && !errors.Is(err, ErrNoResults) {
+			b.logger(ctx).Error("failed to search inline query", "inline_query_id", query.ID, "error", err)
+		}
+	}
+
+	maxResults := INLINE_QUERY_MAX_RESULTS
+	if b.MaxResults > 0 && b.MaxResults < maxResults {
+		maxResults = b.MaxResults
+	}
+	if len(movies) > maxResults {
+		movies = movies[:maxResults]
+	}
+
+	results := make([]InlineQueryResultArticle, len(movies))
+	for i, movie := range movies {
+		results[i] = b.inlineResult(strconv.Itoa(i), movie)
+	}
+
+	return b.answerInlineQuery(ctx, query.ID, results)
+}
+
+// inlineResult returns the article of movie, which sends the movie formatted in the parse mode of the bot.
+func (b *Bot) inlineResult(id string, movie Movie) InlineQueryResultArticle {
+	var description []string
+	if movie.Year != 0 {
+		description = append(description, formatYears(movie.Year, movie.EndYear))
+	}
+	if movie.Rating > 0 {
+		description = append(description, fmt.Sprintf("(%.1f)", movie.Rating))
+	}
+
+	content := InputTextMessageContent{MessageText: formatMovie(b.formatOptions(), "", movie)}
+	if b.ParseMode != PARSE_MODE_NONE {
+		content.ParseMode = string(b.ParseMode)
+	}
+
+	return InlineQueryResultArticle{
+		Type:                "article",
+		ID:                  id,
+		Title:               movie.Title,
+		Description:         strings.Join(description, " "),
+		URL:                 movie.URL,
+		ThumbnailURL:        movie.PosterURL,
+		InputMessageContent: content,
+	}
+}
+
+// answerInlineQuery answers the inline query with results, which Telegram caches for INLINE_QUERY_CACHE_TIME. the
+// results are cached for the user only if the bot is restricted to some chats, so they aren't shown to anyone else. it
+// returns the body of the telegram response.
+func (b *Bot) answerInlineQuery(ctx context.Context, queryID string, results []InlineQueryResultArticle) (string, error) {
+	encoded, err := json.Marshal(results)
+	if err != nil {
+		return "", err
+	}
+
+	values := url.Values{
+		"inline_query_id": {queryID},
+		"results":         {string(encoded)},
+		"cache_time":      {strconv.Itoa(int(INLINE_QUERY_CACHE_TIME.Seconds()))},
+	}
+	if len(b.AllowedChats) > 0 {
+		values.Set("is_personal", "true")
+	}
+	return b.callAPI(ctx, TELEGRAM_API_ANSWER_INLINE_QUERY, values)
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// inlineQueryUpdate returns the JSON of an update with the inline query typed by a user, as Telegram posts it.
+func inlineQueryUpdate(updateID int, query string) string {
+	return fmt.Sprintf(`{"update_id":%d,"inline_query":{"id":"inline%d","from":{"id":7,"is_bot":false,"first_name":"Test","language_code":"en"},"query":%q,"offset":""}}`, updateID, updateID, query)
+}
+
+// inlineResults decodes the results of the answerInlineQuery call.
+func inlineResults(t *testing.T, call telegramCall) []InlineQueryResultArticle {
+	t.Helper()
+
+	var results []InlineQueryResultArticle
+	if err := json.Unmarshal([]byte(call.Values.Get("results")), &results); err != nil {
+		t.Fatalf("decoding the inline results: %v", err)
+	}
+	return results
+}
+
+func TestInlineQuery(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+	if rec := postUpdate(bot, inlineQueryUpdate(1, "dream")); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	answers := telegram.CallsOf(TELEGRAM_API_ANSWER_INLINE_QUERY)
+	if len(answers) != 1 {
+		t.Fatalf("answered %d inline queries, want 1", len(answers))
+	}
+	answer := answers[0].Values
+	if answer.Get("inline_query_id") != "inline1" || answer.Get("cache_time") != strconv.Itoa(int(INLINE_QUERY_CACHE_TIME.Seconds())) {
+		t.Errorf("answered %v, want the query cached for INLINE_QUERY_CACHE_TIME", answer)
+	}
+
+	results := inlineResults(t, answers[0])
+	if len(results) != 3 {
+		t.Fatalf("answered %d results, want a result per movie", len(results))
+	}
+	want := InlineQueryResultArticle{
+		Type:                "article",
+		ID:                  "0",
+		Title:               "Inception",
+		Description:         "(2010) (8.8)",
+		URL:                 results[0].URL,
+		ThumbnailURL:        "https://m.media-amazon.com/images/inception.jpg",
+		InputMessageContent: InputTextMessageContent{MessageText: "Inception (2010) (8.8) " + results[0].URL},
+	}
+	if !reflect.DeepEqual(results[0], want) {
+		t.Errorf("first result = %+v, want %+v", results[0], want)
+	}
+	if sent := telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE); len(sent) != 0 {
+		t.Errorf("sent %d messages, want the query answered inline only", len(sent))
+	}
+}
+
+func TestInlineQueryEmpty(t *testing.T) {
+	for _, query := range []string{"", " , "} {
+		bot, telegram, fixture := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+		postUpdate(bot, inlineQueryUpdate(1, query))
+
+		answers := telegram.CallsOf(TELEGRAM_API_ANSWER_INLINE_QUERY)
+		if len(answers) != 1 || len(inlineResults(t, answers[0])) != 0 {
+			t.Errorf("answered %v for %q, want no results", answers, query)
+		}
+		if requests := fixture.Requests(); len(requests) != 0 {
+			t.Errorf("scraped %q for %q, want no search", requests, query)
+		}
+	}
+}
+
+func TestInlineQueryMaxResults(t *testing.T) {
+	movies := make([]Movie, INLINE_QUERY_MAX_RESULTS+10)
+	for i := range movies {
+		movies[i] = Movie{Title: "Movie " + strconv.Itoa(i)}
+	}
+
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.Source = &fakeSource{movies: map[string][]Movie{"dream": movies}}
+	bot.MaxResults = 0
+
+	postUpdate(bot, inlineQueryUpdate(1, "dream"))
+
+	answers := telegram.CallsOf(TELEGRAM_API_ANSWER_INLINE_QUERY)
+	if len(answers) != 1 {
+		t.Fatalf("answered %d inline queries, want 1", len(answers))
+	}
+	if results := inlineResults(t, answers[0]); len(results) != INLINE_QUERY_MAX_RESULTS {
+		t.Errorf("answered %d results, want the %d Telegram allows", len(results), INLINE_QUERY_MAX_RESULTS)
+	}
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger is the structured logger of a Bot. args are alternating keys and values, e.g. "update_id", 42. a *slog.Logger
+// satisfies it.
+type Logger interface {
+	Info(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// stdLogger is the Logger used when none is configured. it writes "level msg key=value ..." lines with the log
+// package.
+type stdLogger struct{}
+
+// Info implements the Logger interface.
+func (stdLogger) Info(msg string, args ...interface{}) {
+	log.Print(formatLogLine("INFO", msg, args))
+}
+
+// Error implements the Logger interface.
+func (stdLogger) Error(msg string, args ...interface{}) {
+	log.Print(formatLogLine("ERROR", msg, args))
+}
+
+// requestLogger is a Logger adding the request ID of an update to every entry, so the entries of the updates answered
+// at the same time can be told apart.
+type requestLogger struct {
+	logger    Logger
+	requestID string
+}
+
+// Info implements the Logger interface.
+func (l requestLogger) Info(msg string, args ...interface{}) {
+	l.logger.Info(msg, append([]interface{}{"request_id", l.requestID}, args...)...)
+}
+
+// Error implements the Logger interface.
+func (l requestLogger) Error(msg string, args ...interface{}) {
+	l.logger.Error(msg, append([]interface{}{"request_id", l.requestID}, args...)...)
+}
+
+// requestIDKey is the context key of the request ID of the update being answered.
+type requestIDKey struct{}
+
+// withRequestID returns a copy of ctx carrying the request ID of an update.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFrom returns the request ID carried by ctx, or "" if it has none.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID returns a short random ID for an update, e.g. "9f86d081". every delivery of an update gets its own.
+func newRequestID() string {
+	var id [4]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// formatLogLine formats a log entry as "level msg key=value ...". a trailing key without a value is logged as
+// !BADKEY, the way slog does.
+func formatLogLine(level, msg string, args []interface{}) string {
+	var line strings.Builder
+	line.WriteString(level + " " + msg)
+
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fmt.Fprintf(&line, " !BADKEY=%v", args[i])
+			break
+		}
+		fmt.Fprintf(&line, " %v=%q", args[i], fmt.Sprint(args[i+1]))
+	}
+
+	return line.String()
+}
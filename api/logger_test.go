@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// logEntry is an entry logged to a capturingLogger.
+type logEntry struct {
+	level string
+	msg   string
+	attrs map[string]string
+}
+
+// capturingLogger is a Logger keeping its entries, so the tests can assert their keys.
+type capturingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+// Info implements the Logger interface.
+func (l *capturingLogger) Info(msg string, args ...interface{}) {
+	l.log("INFO", msg, args)
+}
+
+// Error implements the Logger interface.
+func (l *capturingLogger) Error(msg string, args ...interface{}) {
+	l.log("ERROR", msg, args)
+}
+
+func (l *capturingLogger) log(level, msg string, args []interface{}) {
+	entry := logEntry{level: level, msg: msg, attrs: map[string]string{}}
+	for i := 0; i+1 < len(args); i += 2 {
+		entry.attrs[fmt.Sprint(args[i])] = fmt.Sprint(args[i+1])
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+// Entries returns the entries logged so far of the given level.
+func (l *capturingLogger) Entries(level string) []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var entries []logEntry
+	for _, entry := range l.entries {
+		if entry.level == level {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func TestLoggerSendFailure(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	logger := &capturingLogger{}
+	bot.Logger = logger
+
+	// the errors of the http package carry the URL of the request, and with it the token.
+	telegram.Close()
+
+	postUpdate(bot, messageUpdate(42, 7, "dream"))
+
+	var answering *logEntry
+	for _, entry := range logger.Entries("ERROR") {
+		if entry.msg == "error answering update" {
+			entry := entry
+			answering = &entry
+		}
+	}
+	if answering == nil {
+		t.Fatalf("logged %v, want the failed answer", logger.Entries("ERROR"))
+	}
+	for _, key := range []string{"request_id", "update_id", "error"} {
+		if answering.attrs[key] == "" {
+			t.Errorf("logged %v, want the %s key", answering.attrs, key)
+		}
+	}
+	if !strings.Contains(answering.attrs["error"], "/bot<token>/") {
+		t.Errorf("logged error %q, want the redacted URL", answering.attrs["error"])
+	}
+	if answering.attrs["update_id"] != "42" {
+		t.Errorf("logged update_id %q, want 42", answering.attrs["update_id"])
+	}
+
+	for _, level := range []string{"INFO", "ERROR"} {
+		for _, entry := range logger.Entries(level) {
+			for key, value := range entry.attrs {
+				if strings.Contains(value, "/bot"+TEST_BOT_TOKEN) {
+					t.Errorf("logged the token in %s=%q of %q", key, value, entry.msg)
+				}
+			}
+		}
+	}
+}
+
+func TestLoggerBadRequest(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	logger := &capturingLogger{}
+	bot.Logger = logger
+	telegram.Respond(func(telegramCall) (int, string) {
+		return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+	})
+
+	postUpdate(bot, messageUpdate(42, 7, "dream"))
+
+	entries := logger.Entries("ERROR")
+	if len(entries) == 0 {
+		t.Fatal("logged no errors, want the failed answer")
+	}
+	last := entries[len(entries)-1]
+	if last.attrs["update_id"] != "42" || !strings.Contains(last.attrs["response_body"], "chat not found") {
+		t.Errorf("logged %q %v, want the update ID and the response body", last.msg, last.attrs)
+	}
+}
+
+func TestFormatLogLine(t *testing.T) {
+	tests := []struct {
+		args []interface{}
+		want string
+	}{
+		{nil, "INFO msg"},
+		{[]interface{}{"update_id", 42, "error", "a b"}, `INFO msg update_id="42" error="a b"`},
+		{[]interface{}{"update_id"}, "INFO msg !BADKEY=update_id"},
+	}
+
+	for _, tt := range tests {
+		if got := formatLogLine("INFO", "msg", tt.args); got != tt.want {
+			t.Errorf("formatLogLine(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLoggerRequestID(t *testing.T) {
+	bot, _, _ := newTestBot(t, fixtures{})
+	logger := &capturingLogger{}
+	bot.Logger = logger
+
+	var ids []string
+	for i := 1; i <= 2; i++ {
+		logger.mu.Lock()
+		before := len(logger.entries)
+		logger.mu.Unlock()
+
+		postUpdate(bot, messageUpdate(i, 7, "dream"))
+
+		logger.mu.Lock()
+		entries := append([]logEntry(nil), logger.entries[before:]...)
+		logger.mu.Unlock()
+
+		msgs := make(map[string]bool)
+		for _, entry := range entries {
+			msgs[entry.msg] = true
+		}
+		for _, msg := range []string{"error getting movies", "telegram responded", "successfully answered update"} {
+			if !msgs[msg] {
+				t.Errorf("logged %v for update %d, want %q logged by the search and the answer", entries, i, msg)
+			}
+		}
+
+		id := entries[0].attrs["request_id"]
+		if len(id) != 8 {
+			t.Errorf("logged the request ID %q, want 8 hex digits", id)
+		}
+		for _, entry := range entries {
+			if entry.attrs["request_id"] != id {
+				t.Errorf("logged %q with the request ID %q, want %q like the other entries of update %d", entry.msg, entry.attrs["request_id"], id, i)
+			}
+		}
+		ids = append(ids, id)
+	}
+
+	if ids[0] == ids[1] {
+		t.Errorf("logged the request ID %q for both updates, want one per update", ids[0])
+	}
+}
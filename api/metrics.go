@@ -0,0 +1,37 @@
+package handler
+
+import "time"
+
+// Metrics receives the measurements of a Bot. implement it to export them, e.g. as Prometheus counters and
+// histograms. implementations must be safe for concurrent use.
+type Metrics interface {
+	// UpdateReceived is called for every update parsed by the webhook.
+	UpdateReceived()
+
+	// ScrapeDone is called after every search of the MovieSource with how long it took. err is nil if it succeeded.
+	ScrapeDone(duration time.Duration, err error)
+
+	// TelegramSendDone is called after every message sent to Telegram, retries included, with how long it took. err is
+	// nil if it succeeded.
+	TelegramSendDone(duration time.Duration, err error)
+}
+
+// nopMetrics is the Metrics used when none is configured. it drops everything.
+type nopMetrics struct{}
+
+// UpdateReceived implements the Metrics interface.
+func (nopMetrics) UpdateReceived() {}
+
+// ScrapeDone implements the Metrics interface.
+func (nopMetrics) ScrapeDone(time.Duration, error) {}
+
+// TelegramSendDone implements the Metrics interface.
+func (nopMetrics) TelegramSendDone(time.Duration, error) {}
+
+// metrics returns the Metrics of the bot, falling back to one which drops everything.
+func (b *Bot) metrics() Metrics {
+	if b.Metrics == nil {
+		return nopMetrics{}
+	}
+	return b.Metrics
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingMetrics is a Metrics counting the measurements it receives.
+type countingMetrics struct {
+	mu                             sync.Mutex
+	updates                        int
+	scrapes, scrapeFailures        int
+	sends, sendFailures            int
+	scrapeDurations, sendDurations []time.Duration
+}
+
+// UpdateReceived implements the Metrics interface.
+func (m *countingMetrics) UpdateReceived() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updates++
+}
+
+// ScrapeDone implements the Metrics interface.
+func (m *countingMetrics) ScrapeDone(duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scrapes++
+	if err != nil {
+		m.scrapeFailures++
+	}
+	m.scrapeDurations = append(m.scrapeDurations, duration)
+}
+
+// TelegramSendDone implements the Metrics interface.
+func (m *countingMetrics) TelegramSendDone(duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sends++
+	if err != nil {
+		m.sendFailures++
+	}
+	m.sendDurations = append(m.sendDurations, duration)
+}
+
+// counts returns the counters of m as updates, scrapes, failed scrapes, sends and failed sends.
+func (m *countingMetrics) counts() [5]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return [5]int{m.updates, m.scrapes, m.scrapeFailures, m.sends, m.sendFailures}
+}
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixtures fixtures
+		status   int
+		want     [5]int
+	}{
+		{"answered", fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"}, http.StatusOK, [5]int{1, 1, 0, 1, 0}},
+		{"scrape failed", fixtures{}, http.StatusOK, [5]int{1, 1, 1, 1, 0}},
+		{"send failed", fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"}, http.StatusBadRequest, [5]int{1, 1, 0, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, telegram, _ := newTestBot(t, tt.fixtures)
+			metrics := &countingMetrics{}
+			bot.Metrics = metrics
+			telegram.Respond(func(telegramCall) (int, string) {
+				if tt.status != http.StatusOK {
+					return tt.status, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+				}
+				return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+			})
+
+			postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+			if got := metrics.counts(); got != tt.want {
+				t.Errorf("counted [updates scrapes failed sends failed] = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsCachedSearch(t *testing.T) {
+	bot, _, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	metrics := &countingMetrics{}
+	bot.Metrics = metrics
+
+	postUpdate(bot, messageUpdate(1, 7, "dream"))
+	postUpdate(bot, messageUpdate(2, 7, "dream"))
+
+	if got := metrics.counts(); got[0] != 2 || got[1] != 1 || got[3] != 2 {
+		t.Errorf("counted [updates scrapes failed sends failed] = %v, want two updates and sends but one scrape", got)
+	}
+	for _, d := range append(metrics.scrapeDurations, metrics.sendDurations...) {
+		if d <= 0 {
+			t.Errorf("measured a duration of %v, want it positive", d)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware wraps a handler into another one, doing something before or after it, e.g. RequestLogger, or instead
+// of it, e.g. SecretTokenAuth. the middlewares of this package are composed with Chain.
+type Middleware func(next http.Handler) http.Handler
+
+// Chain returns h wrapped in the middlewares. the first middleware is the outermost one: it gets the request first and
+// the response last, so
+//
+//	Chain(bot, RequestLogger(nil), MetricsMiddleware(m), RecoverMiddleware(nil), SecretTokenAuth(token))
+//
+// logs and measures the requests SecretTokenAuth refuses, and the ones panicking as a 500 since RecoverMiddleware is
+// inside RequestLogger and MetricsMiddleware.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// RecoverMiddleware returns a Middleware recovering from the panics of the handler, logging them with the stack with
+// logger, or with the log package if it is nil, and responding with 500, so one bad update doesn't take down the
+// process for the following ones. the request is given a request ID, which a Bot logs the update with, so the panic
+// is logged with the same ID as the entries of the update. http.ErrAbortHandler is panicked again, since it is how a
+// handler asks the server to abort the response.
+func RecoverMiddleware(logger Logger) Middleware {
+	if logger == nil {
+		logger = stdLogger{}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := requestIDFrom(r.Context())
+			if id == "" {
+				id = newRequestID()
+				r = r.WithContext(withRequestID(r.Context(), id))
+			}
+
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				requestLogger{logger: logger, requestID: id}.Error("recovered from a panic", "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+				w.WriteHeader(http.StatusInternalServerError)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestLogger returns a Middleware logging every request with its method, path, status code and duration, with
+// logger, or with the log package if it is nil.
+func RequestLogger(logger Logger) Middleware {
+	if logger == nil {
+		logger = stdLogger{}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			logger.Info("served request", "method", r.Method, "path", r.URL.Path, "status", recorder.status, "duration", time.Since(start))
+		})
+	}
+}
+
+// SecretTokenAuth returns a Middleware refusing with 403 the requests which don't carry token in the
+// SECRET_TOKEN_HEADER, like a Bot does with its SecretToken. an empty token refuses nothing.
+func SecretTokenAuth(token string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasSecretToken(r, token) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasSecretToken reports whether r carries token in the SECRET_TOKEN_HEADER, or token is empty. the tokens are compared
+// in constant time so the secret can't be guessed from the time the comparison takes.
+func hasSecretToken(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(SECRET_TOKEN_HEADER)), []byte(token)) == 1
+}
+
+// RequestMetrics receives the measurements of the requests served through MetricsMiddleware. implementations must be
+// safe for concurrent use.
+type RequestMetrics interface {
+	// RequestDone is called after every request with its status code and how long it took to serve.
+	RequestDone(status int, duration time.Duration)
+}
+
+// MetricsMiddleware returns a Middleware passing the status code and the duration of every request to metrics.
+func MetricsMiddleware(metrics RequestMetrics) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			metrics.RequestDone(recorder.status, time.Since(start))
+		})
+	}
+}
+
+// statusRecorder is a http.ResponseWriter remembering the status code written to it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
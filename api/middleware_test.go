@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	logger := &capturingLogger{}
+	calls, requestID := 0, ""
+	h := RecoverMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		requestID = requestIDFrom(r.Context())
+		if r.URL.Path == "/panic" {
+			var update *Update
+			_ = update.UpdateID
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/panic", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status of the panicking request = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	entries := logger.Entries("ERROR")
+	if len(entries) != 1 || entries[0].attrs["stack"] == "" || requestID == "" || entries[0].attrs["request_id"] != requestID {
+		t.Errorf("logged %v, want the panic with its stack and the request ID %q the handler got", entries, requestID)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rec.Code != http.StatusOK || calls != 2 {
+		t.Errorf("status of the next request = %d after %d calls, want %d after 2", rec.Code, calls, http.StatusOK)
+	}
+}
+
+func TestRecoverMiddlewareAbortHandler(t *testing.T) {
+	h := RecoverMiddleware(nil)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler panicked again", p)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+}
+
+func TestRecoverMiddlewareBotLogger(t *testing.T) {
+	bot, _, _ := newTestBot(t, nil)
+	logger := &capturingLogger{}
+	bot.Logger = logger
+	// the fakeSource doesn't implement Trending, so /trending panics.
+	bot.Source = &fakeSource{}
+
+	w := postUpdate(RecoverMiddleware(bot.Logger)(bot), messageUpdate(1, 7, "/trending"))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status of the panicking update = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	entries := logger.Entries("ERROR")
+	if len(entries) != 1 || entries[0].msg != "recovered from a panic" || entries[0].attrs["request_id"] == "" {
+		t.Errorf("logged %v, want the panic logged with a request ID by the logger of the bot", entries)
+	}
+}
+
+func TestSecretTokenAuth(t *testing.T) {
+	h := SecretTokenAuth("s3cr3t")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for header, want := range map[string]int{"s3cr3t": http.StatusNoContent, "": http.StatusForbidden, "S3CR3T": http.StatusForbidden} {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if header != "" {
+			r.Header.Set(SECRET_TOKEN_HEADER, header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+
+		if rec.Code != want {
+			t.Errorf("status with the secret token %q = %d, want %d", header, rec.Code, want)
+		}
+	}
+}
+
+// recordingMetrics is a RequestMetrics keeping the status codes of the requests.
+type recordingMetrics struct {
+	mu       sync.Mutex
+	statuses []int
+}
+
+// RequestDone implements the RequestMetrics interface.
+func (m *recordingMetrics) RequestDone(status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.statuses = append(m.statuses, status)
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	named := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name+" in")
+				next.ServeHTTP(w, r)
+				order = append(order, name+" out")
+			})
+		}
+	}
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), named("first"), named("second"))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+
+	want := []string{"first in", "second in", "handler", "second out", "first out"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("ran %q, want %q", order, want)
+	}
+
+	if h := Chain(http.NotFoundHandler()); h == nil {
+		t.Error("Chain() without middlewares = nil, want the handler")
+	}
+}
+
+func TestChainLogsAndMeasures(t *testing.T) {
+	logger, metrics := &capturingLogger{}, &recordingMetrics{}
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("bad update")
+		}
+		w.Write([]byte("ok"))
+	}), RequestLogger(logger), MetricsMiddleware(metrics), RecoverMiddleware(logger), SecretTokenAuth("s3cr3t"))
+
+	for _, path := range []string{"/", "/panic", "/refused"} {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		if path != "/refused" {
+			r.Header.Set(SECRET_TOKEN_HEADER, "s3cr3t")
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	want := []int{http.StatusOK, http.StatusInternalServerError, http.StatusForbidden}
+	if !reflect.DeepEqual(metrics.statuses, want) {
+		t.Errorf("measured the statuses %v, want %v", metrics.statuses, want)
+	}
+	entries := logger.Entries("INFO")
+	if len(entries) != len(want) {
+		t.Fatalf("logged %d requests, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if entry.attrs["method"] != http.MethodPost || entry.attrs["status"] != fmt.Sprint(want[i]) || entry.attrs["duration"] == "" {
+			t.Errorf("logged %v for request %d, want its method, status %d and duration", entry.attrs, i+1, want[i])
+		}
+	}
+	if path := entries[2].attrs["path"]; path != "/refused" {
+		t.Errorf("logged the path %q, want /refused", path)
+	}
+}
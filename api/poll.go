@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Poll answers the updates of the bot fetched with getUpdates, as an alternative to the webhook for a bot which can't
+// be reached over https. it returns once ctx is done. Telegram doesn't deliver the updates with getUpdates while a
+// webhook is set, see DeleteWebhook.
+//
+// the updates are long polled for POLL_TIMEOUT, which is shorter than HTTP_CLIENT_TIMEOUT so the requests don't time
+// out while Telegram waits for updates. failed polls are logged and retried with exponential backoff. the updates
+// answered last are confirmed before returning, so they aren't delivered again once the bot is restarted.
+func (b *Bot) Poll(ctx context.Context) {
+	b.poll(ctx, ctx)
+}
+
+// poll is Poll, polling the updates until pollCtx is done and answering them with updateCtx. a Server stops polling
+// on shutdown, while the updates already polled are still answered.
+func (b *Bot) poll(pollCtx, updateCtx context.Context) {
+	offset := 0
+	confirmed := 0
+	failures := 0
+
+	for pollCtx.Err() == nil {
+		updates, err := b.getUpdates(pollCtx, offset, POLL_TIMEOUT)
+		if err != nil {
+			if pollCtx.Err() != nil {
+				break
+			}
+
+			b.logger(pollCtx).Error("error getting updates", "error", err)
+			wait(pollCtx, retryDelay(failures, b.retryBaseDelay(), nil))
+			if failures < b.maxRetries() {
+				failures++
+			}
+			continue
+		}
+		failures = 0
+		confirmed = offset
+
+		for _, update := range updates {
+			// the next poll confirms the updates up to offset, so Telegram doesn't deliver them again.
+			offset = update.UpdateID + 1
+
+			// the errors are logged by processUpdate, and the update isn't polled again either way.
+			b.processUpdate(updateCtx, &update)
+		}
+	}
+
+	if offset != confirmed {
+		b.confirmUpdates(updateCtx, offset)
+	}
+}
+
+// confirmUpdates confirms the updates before offset, without waiting for the next ones, so Telegram doesn't deliver
+// them again. it is given POLL_CONFIRM_TIMEOUT, even if ctx is done, since the bot is stopping.
+func (b *Bot) confirmUpdates(ctx context.Context, offset int) {
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, POLL_CONFIRM_TIMEOUT)
+	defer cancel()
+
+	if _, err := b.getUpdates(ctx, offset, 0); err != nil {
+		b.logger(ctx).Error("error confirming the last updates", "offset", offset, "error", err)
+	}
+}
+
+// getUpdates polls the updates from offset on, waiting for them up to timeout.
+func (b *Bot) getUpdates(ctx context.Context, offset int, timeout time.Duration) ([]Update, error) {
+	values := url.Values{
+		"offset":  {strconv.Itoa(offset)},
+		"timeout": {strconv.Itoa(int(timeout / time.Second))},
+	}
+
+	body, err := b.callAPI(ctx, TELEGRAM_API_GET_UPDATES, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var response TelegramResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return nil, fmt.Errorf("decoding getUpdates response: %w", err)
+	}
+
+	var updates []Update
+	if err := json.Unmarshal(response.Result, &updates); err != nil {
+		return nil, fmt.Errorf("decoding updates: %w", err)
+	}
+
+	return updates, nil
+}
+
+// wait waits for d, or until ctx is done.
+func wait(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
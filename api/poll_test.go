@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPollTracksOffset(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	telegram.Respond(func(call telegramCall) (int, string) {
+		if call.Method != TELEGRAM_API_GET_UPDATES {
+			return http.StatusOK, `{"ok":true,"result":{"message_id":2}}`
+		}
+		switch call.Values.Get("offset") {
+		case "0":
+			return http.StatusOK, `{"ok":true,"result":[` + messageUpdate(10, 7, "/help") + `,` + messageUpdate(11, 8, "/help") + `]}`
+		default:
+			// the bot is stopped once it has polled past the updates. the client may see the cancellation before
+			// the response, in which case the offset is confirmed once more on the way out.
+			stop()
+			return http.StatusOK, `{"ok":true,"result":[]}`
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		bot.Poll(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Poll didn't return once ctx was canceled")
+	}
+
+	var offsets []string
+	for _, poll := range telegram.CallsOf(TELEGRAM_API_GET_UPDATES) {
+		offsets = append(offsets, poll.Values.Get("offset"))
+	}
+	if len(offsets) < 2 || offsets[0] != "0" {
+		t.Fatalf("polled the offsets %q, want 0 then 12", offsets)
+	}
+	for _, offset := range offsets[1:] {
+		if offset != "12" {
+			t.Errorf("polled the offsets %q, want 0 then 12", offsets)
+		}
+	}
+
+	var chats []string
+	for _, sent := range telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE) {
+		chats = append(chats, sent.Values.Get("chat_id"))
+	}
+	if want := []string{"7", "8"}; !reflect.DeepEqual(chats, want) {
+		t.Errorf("answered the chats %q, want %q", chats, want)
+	}
+}
+
+func TestPollRetriesFailedPolls(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	polls := 0
+	telegram.Respond(func(call telegramCall) (int, string) {
+		polls++
+		if polls == 1 {
+			return http.StatusBadGateway, `{"ok":false,"error_code":502,"description":"Bad Gateway"}`
+		}
+		stop()
+		return http.StatusOK, `{"ok":true,"result":[]}`
+	})
+
+	bot.Poll(ctx)
+
+	if polls := telegram.CallsOf(TELEGRAM_API_GET_UPDATES); len(polls) < 2 {
+		t.Errorf("polled %d times, want the failed poll retried", len(polls))
+	}
+}
+
+func TestPollConfirmsLastUpdates(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+
+	pollCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	telegram.Respond(func(call telegramCall) (int, string) {
+		switch {
+		case call.Method == TELEGRAM_API_GET_UPDATES && call.Values.Get("offset") == "0":
+			return http.StatusOK, `{"ok":true,"result":[{"update_id":5,"message":{"message_id":1,"text":"/help","chat":{"id":7,"type":"private"}}}]}`
+		case call.Method == TELEGRAM_API_GET_UPDATES:
+			return http.StatusOK, `{"ok":true,"result":[]}`
+		}
+		// the bot is stopped while it answers the update, before polling again.
+		stop()
+		return http.StatusOK, `{"ok":true,"result":{"message_id":2}}`
+	})
+
+	done := make(chan struct{})
+	go func() {
+		bot.poll(pollCtx, context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("poll didn't return once stopped")
+	}
+
+	polls := telegram.CallsOf(TELEGRAM_API_GET_UPDATES)
+	if len(polls) != 2 {
+		t.Fatalf("polled %d times, want 2: %v", len(polls), polls)
+	}
+	if polls[0].Values.Get("timeout") != strconv.Itoa(int(POLL_TIMEOUT/time.Second)) {
+		t.Errorf("first poll timeout = %q, want a long poll", polls[0].Values.Get("timeout"))
+	}
+	if last := polls[1].Values; last.Get("offset") != "6" || last.Get("timeout") != "0" {
+		t.Errorf("last poll offset = %q, timeout = %q, want the updates up to 5 confirmed without waiting", last.Get("offset"), last.Get("timeout"))
+	}
+	if sent := telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE); len(sent) != 1 {
+		t.Errorf("sent %d messages, want the update answered once", len(sent))
+	}
+}
+
+func TestPollWithoutUpdatesDoesNotConfirm(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+
+	pollCtx, stop := context.WithCancel(context.Background())
+	telegram.Respond(func(call telegramCall) (int, string) {
+		stop()
+		return http.StatusOK, `{"ok":true,"result":[]}`
+	})
+
+	bot.poll(pollCtx, context.Background())
+	if polls := telegram.CallsOf(TELEGRAM_API_GET_UPDATES); len(polls) != 1 {
+		t.Errorf("polled %d times, want no confirmation of an empty poll", len(polls))
+	}
+}
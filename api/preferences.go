@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Preferences are the defaults a chat has set for its keyword searches with /setdefault. zero fields fall back to the
+// defaults of the bot.
+type Preferences struct {
+	// MinRating drops the movies rated below it, instead of the MinRating of the bot.
+	MinRating float64
+
+	// SortBy is the order of the movies.
+	SortBy SortBy
+
+	// MaxResults caps the number of movies sent, instead of the MaxResults of the bot.
+	MaxResults int
+}
+
+// String returns the preferences the way /setdefault takes them, e.g. "minrating=7 sort=year top=10". the zero fields
+// are left out.
+func (p Preferences) String() string {
+	var pairs []string
+	if p.MinRating > 0 {
+		pairs = append(pairs, "minrating="+strconv.FormatFloat(p.MinRating, 'f', -1, 64))
+	}
+	if p.SortBy != "" {
+		pairs = append(pairs, "sort="+string(p.SortBy))
+	}
+	if p.MaxResults > 0 {
+		pairs = append(pairs, "top="+strconv.Itoa(p.MaxResults))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// set parses a "key=value" pair of /setdefault and sets the preference it names. the keys are minrating, from 0 to
+// 10, sort, one of sortBys, and top, from 1 to MAX_TOP_RESULTS.
+func (p *Preferences) set(pair string) error {
+	i := strings.Index(pair, "=")
+	if i < 0 {
+		return errors.New("invalid preference " + pair + ". expected key=value")
+	}
+	key, value := strings.ToLower(pair[:i]), pair[i+1:]
+
+	switch key {
+	case "minrating":
+		rating, err := strconv.ParseFloat(value, 64)
+		if err != nil || rating < 0 || rating > 10 {
+			return errors.New("invalid minimum rating " + value)
+		}
+		p.MinRating = rating
+
+	case "sort":
+		by := SortBy(strings.ToLower(value))
+		if !isSortBy(by) {
+			return errors.New("invalid sort " + value)
+		}
+		p.SortBy = by
+
+	case "top":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > MAX_TOP_RESULTS {
+			return errors.New("invalid number of movies " + value)
+		}
+		p.MaxResults = n
+
+	default:
+		return errors.New("unknown preference " + key)
+	}
+
+	return nil
+}
+
+// PreferencesStore remembers the Preferences of every chat. implementations must be safe for concurrent use.
+type PreferencesStore interface {
+	// Get returns the preferences of the chat, the zero Preferences if it has set none.
+	Get(chatID int) (Preferences, error)
+
+	// Set replaces the preferences of the chat.
+	Set(chatID int, preferences Preferences) error
+
+	// Clear forgets the preferences of the chat.
+	Clear(chatID int) error
+}
+
+// MemoryPreferencesStore is a PreferencesStore which keeps the preferences in memory.
+type MemoryPreferencesStore struct {
+	mu          sync.Mutex
+	preferences map[int]Preferences
+}
+
+// NewMemoryPreferencesStore returns an empty MemoryPreferencesStore.
+func NewMemoryPreferencesStore() *MemoryPreferencesStore {
+	return &MemoryPreferencesStore{preferences: make(map[int]Preferences)}
+}
+
+// Get implements the PreferencesStore interface.
+func (s *MemoryPreferencesStore) Get(chatID int) (Preferences, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.preferences[chatID], nil
+}
+
+// Set implements the PreferencesStore interface.
+func (s *MemoryPreferencesStore) Set(chatID int, preferences Preferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preferences[chatID] = preferences
+	return nil
+}
+
+// Clear implements the PreferencesStore interface.
+func (s *MemoryPreferencesStore) Clear(chatID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.preferences, chatID)
+	return nil
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreferencesSet(t *testing.T) {
+	tests := []struct {
+		pair    string
+		want    Preferences
+		wantErr bool
+	}{
+		{pair: "minrating=7", want: Preferences{MinRating: 7}},
+		{pair: "MinRating=7.5", want: Preferences{MinRating: 7.5}},
+		{pair: "sort=Year", want: Preferences{SortBy: SORT_BY_YEAR}},
+		{pair: "top=10", want: Preferences{MaxResults: 10}},
+		{pair: "minrating=11", wantErr: true},
+		{pair: "minrating=high", wantErr: true},
+		{pair: "sort=length", wantErr: true},
+		{pair: "top=0", wantErr: true},
+		{pair: "top=51", wantErr: true},
+		{pair: "colour=red", wantErr: true},
+		{pair: "top", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var prefs Preferences
+		err := prefs.set(tt.pair)
+		if (err != nil) != tt.wantErr || prefs != tt.want {
+			t.Errorf("set(%q) = %+v, %v, want %+v, error %t", tt.pair, prefs, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if got, want := (Preferences{MinRating: 7, SortBy: SORT_BY_YEAR, MaxResults: 10}).String(), "minrating=7 sort=year top=10"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestDefaultsCommands(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.Source = &fakeSource{movies: map[string][]Movie{"dream": {
+		{Title: "Old", Year: 1990, EndYear: 1990, Rating: 9},
+		{Title: "Unrated", Year: 2022, EndYear: 2022},
+		{Title: "New", Year: 2020, EndYear: 2020, Rating: 7.5},
+		{Title: "Bad", Year: 2021, EndYear: 2021, Rating: 3},
+	}}}
+	bot.Preferences = NewMemoryPreferencesStore()
+
+	for i, text := range []string{
+		"/defaults",
+		"/setdefault minrating=7 sort=year top=1",
+		"/setdefault top=foo",
+		"dream",
+		"/defaults",
+		"/cleardefaults",
+		"/defaults",
+		"dream",
+	} {
+		postUpdate(bot, messageUpdate(i+1, 7, text))
+	}
+
+	ctx := context.Background()
+	prefs := Preferences{MinRating: 7, SortBy: SORT_BY_YEAR, MaxResults: 1}
+	want := []string{
+		bot.text(ctx, NO_DEFAULTS_TEXT),
+		bot.text(ctx, DEFAULTS_TEXT, prefs),
+		bot.text(ctx, INVALID_DEFAULT_TEXT, "top=foo", MAX_TOP_RESULTS),
+		"1. New (2020) (7.5)\n",
+		bot.text(ctx, DEFAULTS_TEXT, prefs),
+		bot.text(ctx, DEFAULTS_CLEARED_TEXT),
+		bot.text(ctx, NO_DEFAULTS_TEXT),
+	}
+	texts := sentTexts(telegram.Calls())
+	if len(texts) != len(want)+1 || !reflect.DeepEqual(texts[:len(want)], want) {
+		t.Fatalf("sent %q, want %q and the movies", texts, want)
+	}
+	if last := texts[len(want)]; !strings.HasPrefix(last, "1. Old (1990)") || strings.Count(last, "\n") != 4 {
+		t.Errorf("sent %q after clearing the defaults, want every movie in the order of the source", last)
+	}
+}
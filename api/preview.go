@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// PreviewCall is a Telegram API call a Bot in preview mode would have made.
+type PreviewCall struct {
+	Method string            `json:"method"`
+	Params map[string]string `json:"params"`
+}
+
+// previewKey is the context key of the preview of the update being answered.
+type previewKey struct{}
+
+// preview collects the Telegram API calls made while answering an update in preview mode.
+type preview struct {
+	mu    sync.Mutex
+	calls []PreviewCall
+}
+
+// withPreview returns a context in which the Telegram API calls are recorded by p instead of being made.
+func withPreview(ctx context.Context, p *preview) context.Context {
+	return context.WithValue(ctx, previewKey{}, p)
+}
+
+// previewFrom returns the preview of ctx, or nil if the calls made with ctx are real.
+func previewFrom(ctx context.Context) *preview {
+	p, _ := ctx.Value(previewKey{}).(*preview)
+	return p
+}
+
+// record records a call of the Telegram API method with values.
+func (p *preview) record(method string, values url.Values) {
+	params := make(map[string]string, len(values))
+	for key := range values {
+		params[key] = values.Get(key)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, PreviewCall{Method: strings.TrimPrefix(method, "/"), Params: params})
+}
+
+// write writes the recorded calls to w as a JSON array.
+func (p *preview) write(w http.ResponseWriter) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	calls := p.calls
+	if calls == nil {
+		calls = []PreviewCall{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(calls)
+}
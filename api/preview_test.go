@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	bot.Preview = true
+
+	for i := 0; i < 2; i++ {
+		rec := postUpdate(bot, messageUpdate(1, 7, "dream"))
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("status = %d, content type %q, want a JSON preview", rec.Code, rec.Header().Get("Content-Type"))
+		}
+
+		var calls []PreviewCall
+		if err := json.Unmarshal(rec.Body.Bytes(), &calls); err != nil {
+			t.Fatalf("decoding the preview: %v", err)
+		}
+		var sent []PreviewCall
+		for _, call := range calls {
+			if call.Method == strings.TrimPrefix(TELEGRAM_API_SEND_MESSAGE, "/") {
+				sent = append(sent, call)
+			}
+		}
+		if len(sent) != 1 || sent[0].Params["chat_id"] != "7" || !strings.HasPrefix(sent[0].Params["text"], "1. Inception (2010)") {
+			t.Errorf("previewed %+v, want the list of movies sent to chat 7", calls)
+		}
+	}
+
+	if calls := telegram.Calls(); len(calls) != 0 {
+		t.Errorf("called telegram %d times in preview mode, want none", len(calls))
+	}
+}
+
+func TestLoadConfigPreview(t *testing.T) {
+	t.Setenv(BOT_TOKEN_ENV, TEST_BOT_TOKEN)
+
+	if cfg, err := LoadConfig(); err != nil || cfg.Preview {
+		t.Errorf("LoadConfig() preview = %t, %v, want it off by default", cfg.Preview, err)
+	}
+
+	t.Setenv(PREVIEW_ENV, "true")
+	cfg, err := LoadConfig()
+	if err != nil || !cfg.Preview {
+		t.Fatalf("LoadConfig() preview = %t, %v, want it on", cfg.Preview, err)
+	}
+	if bot, err := NewHandlerFromConfig(cfg); err != nil || !bot.Preview {
+		t.Errorf("NewHandlerFromConfig() preview = %v, want it on", err)
+	}
+
+	t.Setenv(PREVIEW_ENV, "maybe")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig() of an invalid preview error = nil")
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket rate limiter keyed by chat ID. it is safe for concurrent use.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[int]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// bucket holds the tokens left to a chat at a point in time.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter which allows a chat rate messages per second on average, and up to burst
+// messages at once. rate must be positive.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[int]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of the chat and reports whether there was one left.
+func (l *RateLimiter) Allow(chatID int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[chatID]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[chatID] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// sweep drops the buckets which have been idle long enough to be full again, since they are no different from the
+// fresh bucket Allow creates. so abandoned chats don't leak memory. it runs at most once per refill period.
+func (l *RateLimiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+	l.lastSweep = now
+
+	for chatID, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, chatID)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock of a test, which only moves when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Now returns the time of the clock.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	const burst = 5
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	limiter := NewRateLimiter(1, burst)
+	limiter.now = clock.Now
+
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limiter.Allow(7) {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != burst {
+		t.Errorf("allowed %d messages at once, want the burst of %d", allowed, burst)
+	}
+	if !limiter.Allow(8) {
+		t.Error("another chat was limited by the messages of chat 7")
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	limiter := NewRateLimiter(2, 1)
+	limiter.now = clock.Now
+
+	if !limiter.Allow(7) || limiter.Allow(7) {
+		t.Fatal("want the first message allowed and the second one limited")
+	}
+
+	clock.Advance(250 * time.Millisecond)
+	if limiter.Allow(7) {
+		t.Error("allowed a message before a token was refilled")
+	}
+	clock.Advance(250 * time.Millisecond)
+	if !limiter.Allow(7) {
+		t.Error("limited a message once a token was refilled")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	limiter := NewRateLimiter(1, 2)
+	limiter.now = clock.Now
+
+	for chatID := 0; chatID < 10; chatID++ {
+		limiter.Allow(chatID)
+	}
+	clock.Advance(2 * time.Second)
+	limiter.Allow(100)
+
+	if n := len(limiter.buckets); n != 1 {
+		t.Errorf("%d buckets are kept, want the idle ones dropped", n)
+	}
+}
+
+func TestAnswerTextRateLimited(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+	bot.Limiter = NewRateLimiter(0.001, 1)
+
+	postUpdate(bot, messageUpdate(1, 7, "/help"))
+	postUpdate(bot, messageUpdate(2, 7, "/help"))
+
+	sent := sentTexts(telegram.Calls())
+	want := []string{bot.text(context.Background(), HELP_TEXT), bot.text(context.Background(), SLOW_DOWN_TEXT)}
+	if len(sent) != 2 || sent[0] != want[0] || sent[1] != want[1] {
+		t.Errorf("sent %q, want the help text and then the slow down text", sent)
+	}
+
+	if w := postUpdate(bot, messageUpdate(3, 8, "/help")); w.Code != http.StatusOK {
+		t.Errorf("ServeHTTP() status = %d for another chat", w.Code)
+	}
+}
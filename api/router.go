@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Router is a http.Handler which hosts several bots in one process. each bot is added under a key, and the updates
+// posted to a path ending with the key, e.g. /webhook/<key>, are answered by that bot. the key can be the token of the
+// bot, as Telegram suggests for the webhook URLs, or any other secret. the bots share nothing but the process: each
+// has its own token, client and stores.
+type Router struct {
+	mu   sync.RWMutex
+	bots map[string]*Bot
+}
+
+// NewRouter returns a Router without any bot.
+func NewRouter() *Router {
+	return &Router{bots: make(map[string]*Bot)}
+}
+
+// Add adds the bot under key. the key must be a single, non-empty, path segment not used by another bot.
+func (rt *Router) Add(key string, bot *Bot) error {
+	if key == "" || strings.Contains(key, "/") {
+		return errors.New("invalid bot key " + key + ". expected a single path segment")
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if _, ok := rt.bots[key]; ok {
+		return errors.New("a bot is already added under the key " + key)
+	}
+	rt.bots[key] = bot
+	return nil
+}
+
+// Remove removes the bot added under key, if there is one.
+func (rt *Router) Remove(key string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	delete(rt.bots, key)
+}
+
+// ServeHTTP implements the http.Handler interface. the request is served by the bot added under the last segment of
+// its path, and answered with 404 if there is none.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	key := path[strings.LastIndex(path, "/")+1:]
+
+	rt.mu.RLock()
+	bot, ok := rt.bots[key]
+	rt.mu.RUnlock()
+
+	if !ok {
+		// the key may be the token of a bot, so it isn't logged.
+		stdLogger{}.Info("refusing update for an unknown bot", "remote_addr", r.RemoteAddr)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	bot.ServeHTTP(w, r)
+}
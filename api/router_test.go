@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	first, firstTelegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	second, secondTelegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "genre.html"})
+	second.token = "OTHER"
+
+	router := NewRouter()
+	if err := router.Add("first", first); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := router.Add("second", second); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	post := func(path, body string) int {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	if code := post("/webhook/first", messageUpdate(1, 7, "dream")); code != http.StatusOK {
+		t.Errorf("status of the first bot = %d, want %d", code, http.StatusOK)
+	}
+	if code := post("/webhook/second/", messageUpdate(1, 7, "horror")); code != http.StatusOK {
+		t.Errorf("status of the second bot = %d, want %d", code, http.StatusOK)
+	}
+	if code := post("/webhook/third", messageUpdate(2, 7, "dream")); code != http.StatusNotFound {
+		t.Errorf("status of an unknown bot = %d, want %d", code, http.StatusNotFound)
+	}
+
+	// the update IDs are the same: the bots don't share which updates they've handled.
+	firstCalls, secondCalls := firstTelegram.Calls(), secondTelegram.Calls()
+	if len(firstCalls) != 1 || firstCalls[0].Method != TELEGRAM_API_SEND_MESSAGE || !strings.HasPrefix(firstCalls[0].Values.Get("text"), "1. Inception ") {
+		t.Errorf("the first bot called %v, want the movies of its own source", firstCalls)
+	}
+	if len(secondCalls) != 1 || secondCalls[0].Method != "/botOTHER"+TELEGRAM_API_SEND_MESSAGE || !strings.HasPrefix(secondCalls[0].Values.Get("text"), "1. The Shining ") {
+		t.Errorf("the second bot called %v, want the movies of its own source with its own token", secondCalls)
+	}
+
+	if history, _ := first.History.Recent(7, DEFAULT_HISTORY_SIZE); !reflect.DeepEqual(history, [][]string{{"dream"}}) {
+		t.Errorf("history of the first bot = %q, want its own search only", history)
+	}
+	if history, _ := second.History.Recent(7, DEFAULT_HISTORY_SIZE); !reflect.DeepEqual(history, [][]string{{"horror"}}) {
+		t.Errorf("history of the second bot = %q, want its own search only", history)
+	}
+
+	router.Remove("first")
+	if code := post("/webhook/first", messageUpdate(3, 7, "dream")); code != http.StatusNotFound {
+		t.Errorf("status of a removed bot = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestRouterAdd(t *testing.T) {
+	router := NewRouter()
+	bot := &Bot{}
+
+	for _, key := range []string{"", "a/b"} {
+		if err := router.Add(key, bot); err == nil {
+			t.Errorf("Add(%q) error = nil", key)
+		}
+	}
+	if err := router.Add("key", bot); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := router.Add("key", &Bot{}); err == nil {
+		t.Error("Add() of a key already added error = nil")
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// ErrBusy is returned instead of searching when the searches already running keep the ScrapeLimiter full.
+var ErrBusy = errors.New("too many searches running")
+
+// ScrapeLimiter limits the number of searches running at once, since every scrape holds a collector and its sockets,
+// and a burst of updates would otherwise start as many of them. its zero value isn't usable, see NewScrapeLimiter. it
+// is safe for concurrent use, and can be shared by several bots to limit the searches of the whole process.
+type ScrapeLimiter struct {
+	slots *semaphore.Weighted
+	wait  time.Duration
+}
+
+// NewScrapeLimiter returns a ScrapeLimiter which lets max searches run at once. a search over the limit waits up to
+// wait for another to finish. max must be positive.
+func NewScrapeLimiter(max int, wait time.Duration) *ScrapeLimiter {
+	return &ScrapeLimiter{
+		slots: semaphore.NewWeighted(int64(max)),
+		wait:  wait,
+	}
+}
+
+// Do calls search once fewer than max searches are running. it returns ErrBusy if none finishes within the wait of
+// the limiter, and the error of ctx if ctx is done first. the slot of search is freed once it returns, even if it
+// panics.
+func (l *ScrapeLimiter) Do(ctx context.Context, search func() error) error {
+	if !l.slots.TryAcquire(1) {
+		waitCtx, cancel := context.WithTimeout(ctx, l.wait)
+		defer cancel()
+
+		if err := l.slots.Acquire(waitCtx, 1); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return ErrBusy
+		}
+	}
+	defer l.slots.Release(1)
+
+	return search()
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScrapeLimiterCap(t *testing.T) {
+	const max = 3
+	limiter := NewScrapeLimiter(max, time.Second)
+
+	var running, peak int32
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- limiter.Do(context.Background(), func() error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Do() error = %v, want the searches over the cap to wait for a slot", err)
+		}
+	}
+	if peak != max {
+		t.Errorf("ran %d searches at once, want %d", peak, max)
+	}
+}
+
+func TestScrapeLimiterBusy(t *testing.T) {
+	limiter := NewScrapeLimiter(1, 10*time.Millisecond)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	go limiter.Do(context.Background(), func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	called := false
+	if err := limiter.Do(context.Background(), func() error { called = true; return nil }); !errors.Is(err, ErrBusy) || called {
+		t.Errorf("Do() of a full limiter = %v, called %t, want %v without searching", err, called, ErrBusy)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewScrapeLimiter(1, time.Minute).Do(ctx, func() error { return nil }); err != nil {
+		t.Errorf("Do() of a free slot with a canceled context = %v, want the search left to notice", err)
+	}
+	limiter.wait = time.Minute
+	if err := limiter.Do(ctx, func() error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() of a full limiter with a canceled context = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+}
+
+func TestScrapeLimiterReleases(t *testing.T) {
+	limiter := NewScrapeLimiter(1, 0)
+	failure := errors.New("scrape failed")
+
+	if err := limiter.Do(context.Background(), func() error { return failure }); err != failure {
+		t.Fatalf("Do() = %v, want the error of the search %v", err, failure)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Do() recovered the panic of the search")
+			}
+		}()
+		limiter.Do(context.Background(), func() error { panic("scraper bug") })
+	}()
+
+	if err := limiter.Do(context.Background(), func() error { return nil }); err != nil {
+		t.Errorf("Do() after a failed and a panicking search = %v, want their slots freed", err)
+	}
+}
+
+func TestScrapeLimiterBot(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	bot.Scrapes = NewScrapeLimiter(1, 10*time.Millisecond)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	go bot.Scrapes.Do(context.Background(), func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	postUpdate(bot, messageUpdate(1, 7, "dream"))
+	close(release)
+	waitFor(t, func() bool {
+		if !bot.Scrapes.slots.TryAcquire(1) {
+			return false
+		}
+		bot.Scrapes.slots.Release(1)
+		return true
+	})
+	postUpdate(bot, messageUpdate(2, 7, "dream"))
+
+	sent := sentTexts(telegram.Calls())
+	if len(sent) != 2 || sent[0] != bot.text(context.Background(), BUSY_TEXT) || !strings.HasPrefix(sent[1], "1. Inception ") {
+		t.Errorf("sent %q, want the busy text and then the movies", sent)
+	}
+}
@@ -0,0 +1,903 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// Selectors are the CSS selectors a Scraper finds the movies on an IMDB page with.
+type Selectors struct {
+	// Item matches the element of every movie. the other selectors, except Next, are relative to it.
+	Item   string
+	Title  string
+	Year   string
+	Rating string
+
+	// Poster matches the poster image of a movie. it is relative to the Item element, or to its parent if the Item
+	// has no such image, since the search results put the image next to the movie content.
+	Poster string
+
+	// Genre matches the comma separated genres of a movie. empty means the page doesn't list them.
+	Genre string
+
+	// Plot matches the short plot summary of a movie. empty means the page doesn't have it.
+	Plot string
+
+	// Rank matches the text starting with the rank of a movie on a chart, e.g. "1. The Shawshank Redemption". empty
+	// means the page isn't a chart. the movies whose rank isn't found are ranked by their position.
+	Rank string
+
+	// Next matches the link to the next page of results. empty means the movies are all on a single page.
+	Next string
+
+	// Count matches the text telling which of the results are on the page out of how many, e.g. "1-50 of 1,234
+	// titles.", which the number of pages is worked out from. empty means the Next links are followed one at a time.
+	Count string
+}
+
+// DefaultSelectors match the layout of the IMDB search results.
+var DefaultSelectors = Selectors{
+	Item:   `div[class~="lister-item-content"]`,
+	Title:  `h3[class="lister-item-header"] a`,
+	Year:   `h3[class="lister-item-header"] span[class~="lister-item-year"]`,
+	Rating: `div[class~="ratings-imdb-rating"] strong`,
+	Poster: `div[class~="lister-item-image"] img`,
+	Genre:  `span[class~="genre"]`,
+	Plot:   `p:not([class~="text-small"])`,
+	Next:   `a[class~="lister-page-next"]`,
+	Count:  `div[class~="desc"] span`,
+}
+
+// DefaultChartSelectors match the layout of the IMDB charts, which list the movies in the rows of a table.
+var DefaultChartSelectors = Selectors{
+	Item:   `table[class~="chart"] tbody tr`,
+	Title:  `td[class~="titleColumn"] a`,
+	Year:   `td[class~="titleColumn"] span[class~="secondaryInfo"]`,
+	Rating: `td[class~="imdbRating"] strong`,
+	Poster: `td[class~="posterColumn"] img`,
+	Rank:   `td[class~="titleColumn"]`,
+}
+
+// Scraper is a MovieSource which scrapes movies out of the IMDB search results and charts. its fields can be changed
+// to point it at another server, e.g. in tests, or to follow a change of the IMDB layout.
+type Scraper struct {
+	// BaseURL is the IMDB URL the searches are made against and the movie links are resolved against.
+	BaseURL string
+
+	// Selectors find the movies on a result page.
+	Selectors Selectors
+
+	// ChartSelectors find the movies on the charts, e.g. the most popular movies.
+	ChartSelectors Selectors
+
+	// MaxPages is the number of result pages scraped for each search. zero means DEFAULT_MAX_PAGES.
+	MaxPages int
+
+	// RequestTimeout bounds every request to IMDB. zero means DEFAULT_SCRAPE_TIMEOUT.
+	RequestTimeout time.Duration
+
+	// Delay is the pause between two requests to IMDB, so following the pages of a search stays polite. it's only
+	// applied if MaxPages is more than one, since colly pauses after every request, even the last one.
+	Delay time.Duration
+
+	// RandomDelay is the upper bound of a random pause added to Delay, so the requests aren't evenly spaced like a
+	// bot's. the defaults pause for 1s ± 500ms. it's only applied when Delay is, and zero adds no pause.
+	RandomDelay time.Duration
+
+	// Parallelism is the number of result pages fetched at the same time. zero means DEFAULT_SCRAPE_PARALLELISM.
+	Parallelism int
+
+	// MaxAttempts is the number of times a page is requested when IMDB throttles or is unavailable, answering 429 or
+	// 502 to 504. the other errors, e.g. a 404, aren't retried. zero means DEFAULT_SCRAPE_ATTEMPTS.
+	MaxAttempts int
+
+	// RetryBaseDelay is the delay before the first retry, doubled on every following one, unless IMDB asks for
+	// another one with Retry-After. zero means DEFAULT_SCRAPE_RETRY_DELAY.
+	RetryBaseDelay time.Duration
+
+	// UserAgent identifies the scraper to IMDB. empty means DEFAULT_USER_AGENT.
+	UserAgent string
+
+	// IgnoreRobotsTxt scrapes the pages the robots.txt of IMDB disallows for UserAgent. by default they aren't
+	// requested, and the search fails instead.
+	IgnoreRobotsTxt bool
+
+	// Proxy is the URL of the proxy the requests to IMDB go through, http, https or socks5. empty honors the
+	// HTTPS_PROXY environment variable.
+	Proxy string
+
+	// Locale is the language and region IMDB localizes the results for, e.g. the titles, sent as the Accept-Language
+	// of the requests. it is one of locales. empty means DEFAULT_LOCALE.
+	Locale string
+}
+
+// locales are the locales IMDB localizes its pages for.
+var locales = []string{
+	"en-US", "en-GB", "en-CA", "en-AU", "en-IN", "de-DE", "es-ES", "es-MX", "fr-FR", "fr-CA", "hi-IN", "it-IT", "pt-BR",
+}
+
+// isLocale reports whether locale is one of locales, ignoring case.
+func isLocale(locale string) bool {
+	for _, l := range locales {
+		if strings.EqualFold(l, locale) {
+			return true
+		}
+	}
+	return false
+}
+
+// locale returns the Locale of the scraper, falling back to DEFAULT_LOCALE. an error is returned if it isn't
+// supported.
+func (s *Scraper) locale() (string, error) {
+	if s.Locale == "" {
+		return DEFAULT_LOCALE, nil
+	}
+	if !isLocale(s.Locale) {
+		return "", fmt.Errorf("unsupported locale %q. expected one of %s", s.Locale, strings.Join(locales, ", "))
+	}
+	return s.Locale, nil
+}
+
+// NewScraper returns a Scraper for www.imdb.com.
+func NewScraper() *Scraper {
+	return &Scraper{
+		BaseURL:        IMDB_BASE_URL,
+		Selectors:      DefaultSelectors,
+		ChartSelectors: DefaultChartSelectors,
+		MaxPages:       DEFAULT_MAX_PAGES,
+		RequestTimeout: DEFAULT_SCRAPE_TIMEOUT,
+		Delay:          DEFAULT_SCRAPE_DELAY,
+		RandomDelay:    DEFAULT_SCRAPE_RANDOM_DELAY,
+		Parallelism:    DEFAULT_SCRAPE_PARALLELISM,
+		MaxAttempts:    DEFAULT_SCRAPE_ATTEMPTS,
+		RetryBaseDelay: DEFAULT_SCRAPE_RETRY_DELAY,
+		UserAgent:      DEFAULT_USER_AGENT,
+		Locale:         DEFAULT_LOCALE,
+	}
+}
+
+// maxPages returns the number of result pages to scrape, falling back to DEFAULT_MAX_PAGES.
+func (s *Scraper) maxPages() int {
+	if s.MaxPages <= 0 {
+		return DEFAULT_MAX_PAGES
+	}
+	return s.MaxPages
+}
+
+// requestTimeout returns the timeout of a request to IMDB, falling back to DEFAULT_SCRAPE_TIMEOUT.
+func (s *Scraper) requestTimeout() time.Duration {
+	if s.RequestTimeout <= 0 {
+		return DEFAULT_SCRAPE_TIMEOUT
+	}
+	return s.RequestTimeout
+}
+
+// parallelism returns the number of pages fetched at the same time, falling back to DEFAULT_SCRAPE_PARALLELISM.
+func (s *Scraper) parallelism() int {
+	if s.Parallelism <= 0 {
+		return DEFAULT_SCRAPE_PARALLELISM
+	}
+	return s.Parallelism
+}
+
+// maxAttempts returns the number of times a page is requested, falling back to DEFAULT_SCRAPE_ATTEMPTS.
+func (s *Scraper) maxAttempts() int {
+	if s.MaxAttempts <= 0 {
+		return DEFAULT_SCRAPE_ATTEMPTS
+	}
+	return s.MaxAttempts
+}
+
+// retryBaseDelay returns the delay before the first retry of a page, falling back to DEFAULT_SCRAPE_RETRY_DELAY.
+func (s *Scraper) retryBaseDelay() time.Duration {
+	if s.RetryBaseDelay <= 0 {
+		return DEFAULT_SCRAPE_RETRY_DELAY
+	}
+	return s.RetryBaseDelay
+}
+
+// userAgent returns the User-Agent of the requests to IMDB, falling back to DEFAULT_USER_AGENT.
+func (s *Scraper) userAgent() string {
+	if s.UserAgent == "" {
+		return DEFAULT_USER_AGENT
+	}
+	return s.UserAgent
+}
+
+// Search implements the MovieSource interface. it constructs an IMDB URL which will be used to scrape movies out of
+// it, from the keywords sanitized by sanitizeKeyword and query escaped. an error is returned if no keyword is left to
+// search or IMDB couldn't be scraped. the trailing keywords which would make the URL too long are dropped, see
+// fitKeywords. up to MaxPages pages of results are scraped, see scrape, and the scrape is aborted once ctx is done or a
+// request takes longer than RequestTimeout.
+func (s *Scraper) Search(ctx context.Context, keywords []string) ([]Movie, error) {
+	keywords = fitKeywords(s.QueryBudget(), keywords)
+	escaped := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		if sanitized := sanitizeKeyword(keyword); sanitized != "" {
+			escaped = append(escaped, url.QueryEscape(sanitized))
+		}
+	}
+	if len(escaped) == 0 {
+		return nil, fmt.Errorf("%w: no keywords to search", ErrInvalidKeywords)
+	}
+
+	return s.scrape(ctx, s.BaseURL+IMDB_KEYWORD_SEARCH_PATH+strings.Join(escaped, "%2C"), s.Selectors)
+}
+
+// QueryBudget implements the QueryBudgeter interface. the keyword search URL is at most MAX_SEARCH_URL_LEN characters
+// long, since servers reject the longer URLs.
+func (s *Scraper) QueryBudget() int {
+	return MAX_SEARCH_URL_LEN - len(s.BaseURL) - len(IMDB_KEYWORD_SEARCH_PATH)
+}
+
+// fitKeywords returns the first of the keywords, in the order they are given rather than sorted, which take at most
+// budget characters once sanitized, query escaped and separated. at least one keyword is kept, however long it is.
+func fitKeywords(budget int, keywords []string) []string {
+	length := 0
+	for i, keyword := range keywords {
+		if i > 0 {
+			length += len("%2C")
+		}
+		length += len(url.QueryEscape(sanitizeKeyword(keyword)))
+
+		if length > budget && i > 0 {
+			return keywords[:i]
+		}
+	}
+	return keywords
+}
+
+// genres are the genres known to the IMDB genre search.
+var genres = []string{
+	"action", "adventure", "animation", "biography", "comedy", "crime", "documentary", "drama", "family", "fantasy",
+	"film-noir", "history", "horror", "music", "musical", "mystery", "romance", "sci-fi", "sport", "thriller", "war",
+	"western",
+}
+
+// isGenre reports whether genre is one of the known genres.
+func isGenre(genre string) bool {
+	for _, g := range genres {
+		if g == genre {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchGenre implements the MovieSource interface. it scrapes the IMDB genre search the same way Search scrapes the
+// keyword search.
+func (s *Scraper) SearchGenre(ctx context.Context, genre string) ([]Movie, error) {
+	return s.scrape(ctx, s.BaseURL+IMDB_GENRE_SEARCH_PATH+url.QueryEscape(genre), s.Selectors)
+}
+
+// SearchByTitle implements the MovieSource interface. it scrapes the IMDB advanced title search the same way Search
+// scrapes the keyword search.
+func (s *Scraper) SearchByTitle(ctx context.Context, params TitleSearchParams) ([]Movie, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	return s.scrape(ctx, s.BaseURL+IMDB_TITLE_SEARCH_PATH+imdbTitleSearchValues(params).Encode(), s.Selectors)
+}
+
+// imdbSorts are the values of the sort parameter of the IMDB title search for the SortBys. SORT_BY_RELEVANCE needs
+// none.
+var imdbSorts = map[SortBy]string{
+	SORT_BY_RATING: "user_rating,desc",
+	SORT_BY_YEAR:   "release_date,desc",
+}
+
+// imdbTitleSearchValues returns the query of the IMDB title search for params. the ranges are "min,max", either end
+// being left empty if it's open.
+func imdbTitleSearchValues(params TitleSearchParams) url.Values {
+	values := url.Values{}
+	if len(params.Genres) > 0 {
+		values.Set("genres", strings.Join(params.Genres, ","))
+	}
+
+	if params.MinYear != 0 || params.MaxYear != 0 {
+		var from, to string
+		if params.MinYear != 0 {
+			from = fmt.Sprintf("%04d-01-01", params.MinYear)
+		}
+		if params.MaxYear != 0 {
+			to = fmt.Sprintf("%04d-12-31", params.MaxYear)
+		}
+		values.Set("release_date", from+","+to)
+	}
+
+	if params.MinRating > 0 {
+		values.Set("user_rating", strconv.FormatFloat(params.MinRating, 'f', 1, 64)+",")
+	}
+
+	if sort, ok := imdbSorts[params.SortBy]; ok {
+		values.Set("sort", sort)
+	}
+
+	return values
+}
+
+// Trending implements the MovieSource interface. it scrapes the IMDB most popular movies chart, see Chart.
+func (s *Scraper) Trending(ctx context.Context) ([]Movie, error) {
+	return s.Chart(ctx, CHART_MOVIEMETER)
+}
+
+// Chart implements the MovieSource interface. it scrapes the IMDB chart with ChartSelectors.
+func (s *Scraper) Chart(ctx context.Context, chart Chart) ([]Movie, error) {
+	if !isChart(chart) {
+		return nil, fmt.Errorf("unknown chart %q", chart)
+	}
+	return s.scrape(ctx, s.BaseURL+IMDB_CHART_PATH+string(chart)+"/", s.ChartSelectors)
+}
+
+// limitRule returns the rule limiting the requests of a scrape to IMDB: Parallelism at the same time, paused by Delay
+// and RandomDelay if more than one page is scraped.
+func (s *Scraper) limitRule() *colly.LimitRule {
+	rule := &colly.LimitRule{DomainGlob: "*", Parallelism: s.parallelism()}
+	if s.maxPages() > 1 {
+		rule.Delay = s.Delay
+		rule.RandomDelay = s.RandomDelay
+	}
+	return rule
+}
+
+// scrape scrapes the movies listed on the IMDB page at URL with selectors. see Search. the pages are fetched
+// asynchronously, up to Parallelism at the same time, and every movie is tagged with its page and position so the
+// result keeps the order of IMDB whichever page arrives first. if selectors have a Next link, up to MaxPages pages
+// are scraped, but no page past the last one. only the host of BaseURL is scraped, as its robots.txt allows unless
+// IgnoreRobotsTxt is set.
+func (s *Scraper) scrape(ctx context.Context, URL string, selectors Selectors) ([]Movie, error) {
+	base, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	locale, err := s.locale()
+	if err != nil {
+		return nil, err
+	}
+
+	c := colly.NewCollector(colly.Async(true), colly.UserAgent(s.userAgent()), colly.AllowedDomains(base.Host))
+	c.IgnoreRobotsTxt = s.IgnoreRobotsTxt
+	var transport http.RoundTripper = http.DefaultTransport
+	if s.Proxy != "" {
+		proxy, err := parseProxyURL(s.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxied := proxyTransport(proxy)
+		defer proxied.CloseIdleConnections()
+		transport = proxied
+	}
+
+	c.WithTransport(contextTransport{ctx: ctx, base: transport, userAgent: s.userAgent()})
+	c.SetRequestTimeout(s.requestTimeout())
+	if err := c.Limit(s.limitRule()); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var movies []pagedMovie
+	var scrapeErr error
+
+	// requested is the last page requested so far, so no page is requested twice.
+	requested := 1
+
+	// visit requests a page with its own colly context, which the retries of the page share, and its own header, since
+	// colly sets the User-Agent in it.
+	visit := func(URL string, page int) error {
+		pageCtx := colly.NewContext()
+		pageCtx.Put("page", page)
+		return c.Request(http.MethodGet, URL, nil, pageCtx, http.Header{"Accept-Language": {locale}})
+	}
+
+	setErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if scrapeErr == nil {
+			scrapeErr = err
+		}
+	}
+
+	// the transient errors are retried by the goroutine of the failed request, which waits for the delay first. the
+	// attempts are counted in the colly context of the page, which the retries share.
+	c.OnError(func(response *colly.Response, err error) {
+		attempt, _ := response.Ctx.GetAny("attempt").(int)
+		if transientStatus(response.StatusCode) && attempt+1 < s.maxAttempts() {
+			response.Ctx.Put("attempt", attempt+1)
+			wait(ctx, scrapeRetryDelay(attempt, s.retryBaseDelay(), response.Headers))
+			if err = response.Request.Retry(); err == nil {
+				return
+			}
+		}
+		kind := ErrScrapeFailed
+		if response.StatusCode == http.StatusTooManyRequests {
+			kind = ErrRateLimited
+		}
+		setErr(fmt.Errorf("%w: scraping %s, status code %d: %v", kind, response.Request.URL, response.StatusCode, err))
+	})
+
+	c.OnHTML(selectors.Item, func(element *colly.HTMLElement) {
+		rating, _ := parseRating(element.ChildText(selectors.Rating))
+		yearText := element.ChildText(selectors.Year)
+		from, to := parseYears(yearText)
+		movie := Movie{
+			Title:     element.ChildText(selectors.Title),
+			Year:      from,
+			EndYear:   to,
+			Kind:      parseKind(yearText, from, to),
+			Rating:    rating,
+			URL:       s.imdbLink(element.ChildAttr(selectors.Title, "href")),
+			PosterURL: posterLink(element, selectors.Poster),
+		}
+		if selectors.Genre != "" {
+			movie.Genres = parseGenres(element.ChildText(selectors.Genre))
+		}
+		if selectors.Plot != "" {
+			movie.Plot = parsePlot(element.ChildText(selectors.Plot))
+		}
+		if selectors.Rank != "" {
+			movie.Rank = parseRank(element.ChildText(selectors.Rank))
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		movies = append(movies, pagedMovie{movie: movie, page: element.Request.Ctx.GetAny("page").(int), position: element.Index})
+	})
+
+	// the pages after the first one are only requested once a page links the next one, so no page past the last one
+	// is. if the first page tells the number of pages, the following ones are requested at once, so they are fetched
+	// in parallel, otherwise the Next links are followed one page at a time.
+	if selectors.Next != "" {
+		c.OnHTML(selectors.Next, func(element *colly.HTMLElement) {
+			element.Request.Ctx.Put("next", true)
+		})
+		if selectors.Count != "" {
+			c.OnHTML(selectors.Count, func(element *colly.HTMLElement) {
+				if pages, ok := parsePageCount(element.Text); ok {
+					element.Request.Ctx.Put("pages", pages)
+				}
+			})
+		}
+		c.OnScraped(func(response *colly.Response) {
+			page := response.Ctx.GetAny("page").(int)
+			if response.Ctx.GetAny("next") == nil {
+				return
+			}
+			last := page + 1
+			if pages, ok := response.Ctx.GetAny("pages").(int); ok && page == 1 {
+				last = pages
+			}
+			if last > s.maxPages() {
+				last = s.maxPages()
+			}
+
+			mu.Lock()
+			first := requested + 1
+			if last > requested {
+				requested = last
+			}
+			mu.Unlock()
+
+			for next := first; next <= last; next++ {
+				pageURL, err := withPage(URL, next)
+				if err == nil {
+					err = visit(pageURL, next)
+				}
+				if err != nil {
+					setErr(fmt.Errorf("%w: %v", ErrScrapeFailed, err))
+				}
+			}
+		})
+	}
+
+	if err := visit(URL, 1); err != nil {
+		setErr(fmt.Errorf("%w: %v", ErrScrapeFailed, err))
+	}
+	c.Wait()
+
+	if scrapeErr != nil {
+		return nil, scrapeErr
+	}
+
+	sort.Slice(movies, func(i, j int) bool {
+		if movies[i].page != movies[j].page {
+			return movies[i].page < movies[j].page
+		}
+		return movies[i].position < movies[j].position
+	})
+
+	result := make([]Movie, len(movies))
+	for i, paged := range movies {
+		result[i] = paged.movie
+		if selectors.Rank != "" && result[i].Rank == 0 {
+			result[i].Rank = i + 1
+		}
+	}
+	return result, nil
+}
+
+// pageCountPattern matches the text telling which of the results are on a page out of how many, e.g. "1-50 of 1,234
+// titles.".
+var pageCountPattern = regexp.MustCompile(`([\d,]+)\s*-\s*([\d,]+)\s+of\s+([\d,]+)`)
+
+// parsePageCount parses the number of pages of the results out of the text matched by Selectors.Count. ok is false if
+// the text doesn't tell it.
+func parsePageCount(text string) (pages int, ok bool) {
+	match := pageCountPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, false
+	}
+	var numbers [3]int
+	for i, number := range match[1:] {
+		n, err := strconv.Atoi(strings.ReplaceAll(number, ",", ""))
+		if err != nil {
+			return 0, false
+		}
+		numbers[i] = n
+	}
+
+	from, to, total := numbers[0], numbers[1], numbers[2]
+	if from != 1 || to < from || total < to {
+		return 0, false
+	}
+	perPage := to - from + 1
+	return (total + perPage - 1) / perPage, true
+}
+
+// withPage returns URL with the page of the results set in its "page" parameter. the first page is URL itself.
+func withPage(URL string, page int) (string, error) {
+	if page == 1 {
+		return URL, nil
+	}
+
+	u, err := url.Parse(URL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// transientStatus reports whether an IMDB response with the status code is worth retrying: IMDB throttles with 429,
+// and answers 502 to 504 while it's unavailable.
+func transientStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// scrapeRetryDelay returns how long to wait before retrying a page. the Retry-After header of the response, in seconds
+// or as a date, is used as is. otherwise the delay is base doubled for every previous attempt, plus up to base of
+// random jitter, like retryDelay.
+func scrapeRetryDelay(attempt int, base time.Duration, headers *http.Header) time.Duration {
+	if headers != nil {
+		if retryAfter := headers.Get("Retry-After"); retryAfter != "" {
+			if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+			if date, err := http.ParseTime(retryAfter); err == nil {
+				return time.Until(date)
+			}
+		}
+	}
+
+	return retryDelay(attempt, base, nil)
+}
+
+// pagedMovie is a scraped movie along with the page it was found on and its position on the page.
+type pagedMovie struct {
+	movie    Movie
+	page     int
+	position int
+}
+
+// posterLink returns the absolute URL of the poster image matched by selector of the movie of element, or "" if it has
+// none. see Selectors.Poster. IMDB loads the images lazily, so the "loadlate" attribute holds the actual image and
+// "src" a placeholder when it's set.
+func posterLink(element *colly.HTMLElement, selector string) string {
+	img := element.DOM.Find(selector).First()
+	if img.Length() == 0 {
+		img = element.DOM.Parent().Find(selector).First()
+	}
+
+	src, ok := img.Attr("loadlate")
+	if !ok {
+		src = img.AttrOr("src", "")
+	}
+	if src == "" {
+		return ""
+	}
+
+	return element.Request.AbsoluteURL(src)
+}
+
+// filter holds the constraints a scraped movie has to satisfy to be recommended. zero fields don't constrain anything.
+type filter struct {
+	minRating float64
+	minYear   int
+	maxYear   int
+
+	// genres keeps the movies of all these genres only, ignoring case. the movies whose genres are unknown are dropped.
+	genres []string
+
+	// kinds keeps the titles of any of these kinds only. the titles whose kind is unknown are dropped.
+	kinds []Kind
+
+	// keepDuplicates keeps the movies listed more than once, which are merged by default. see dedupMovies.
+	keepDuplicates bool
+}
+
+// keep reports whether movie satisfies the filter. movies without a rating or a year are dropped by the corresponding
+// constraint.
+func (f filter) keep(movie Movie) bool {
+	if f.minRating > 0 && movie.Rating < f.minRating {
+		return false
+	}
+
+	if (f.minYear != 0 || f.maxYear != 0) && movie.Year == 0 {
+		return false
+	}
+
+	if f.minYear != 0 && movie.Year < f.minYear || f.maxYear != 0 && movie.Year > f.maxYear {
+		return false
+	}
+
+	for _, genre := range f.genres {
+		if !hasGenre(movie, genre) {
+			return false
+		}
+	}
+
+	if len(f.kinds) > 0 && !hasKind(movie, f.kinds) {
+		return false
+	}
+
+	return true
+}
+
+// hasKind reports whether movie is of one of kinds.
+func hasKind(movie Movie, kinds []Kind) bool {
+	for _, kind := range kinds {
+		if movie.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGenre reports whether genre is one of the genres of movie, ignoring case.
+func hasGenre(movie Movie, genre string) bool {
+	for _, g := range movie.Genres {
+		if strings.EqualFold(g, genre) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the movies satisfying the filter, in the same order. the duplicates are merged first, unless the
+// filter keeps them.
+func (f filter) apply(movies []Movie) []Movie {
+	if !f.keepDuplicates {
+		movies = dedupMovies(movies)
+	}
+
+	var kept []Movie
+	for _, movie := range movies {
+		if f.keep(movie) {
+			kept = append(kept, movie)
+		}
+	}
+	return kept
+}
+
+// movieKey identifies a movie among the movies of a search: the movies with the same title, ignoring case and spacing,
+// and the same year are the same movie.
+type movieKey struct {
+	title string
+	year  int
+}
+
+// keyOf returns the movieKey of movie.
+func keyOf(movie Movie) movieKey {
+	return movieKey{title: strings.ToLower(strings.Join(strings.Fields(movie.Title), " ")), year: movie.Year}
+}
+
+// dedupMovies returns the movies with the duplicates merged into the first one of them, in the same order. the merged
+// movie has the highest rating of the duplicates, and what the first one is missing, e.g. its links, is taken from the
+// others.
+func dedupMovies(movies []Movie) []Movie {
+	seen := make(map[movieKey]int, len(movies))
+
+	var deduped []Movie
+	for _, movie := range movies {
+		key := keyOf(movie)
+		i, ok := seen[key]
+		if !ok {
+			seen[key] = len(deduped)
+			deduped = append(deduped, movie)
+			continue
+		}
+
+		merged := &deduped[i]
+		if movie.Rating > merged.Rating {
+			merged.Rating = movie.Rating
+		}
+		if merged.URL == "" {
+			merged.URL = movie.URL
+		}
+		if merged.PosterURL == "" {
+			merged.PosterURL = movie.PosterURL
+		}
+		if merged.Genres == nil {
+			merged.Genres = movie.Genres
+		}
+		if merged.Plot == "" {
+			merged.Plot = movie.Plot
+		}
+		if merged.Kind == "" {
+			merged.Kind = movie.Kind
+		}
+	}
+	return deduped
+}
+
+// yearsRegexp matches the release year of a title, or the years a TV series ran such as "2010–2015" or "2010– ".
+var yearsRegexp = regexp.MustCompile(`(\d{4})(\s*[–-]\s*(\d{4})?)?`)
+
+// parseYears parses the IMDB year text of a title, e.g. "(2010)" or "(I) (2010–2015)". from is 0 if the title has no
+// year, to is equal to from for a single year and 0 for a TV series which is still running.
+func parseYears(text string) (from, to int) {
+	match := yearsRegexp.FindStringSubmatch(text)
+	if match == nil {
+		return 0, 0
+	}
+
+	from, _ = strconv.Atoi(match[1])
+	switch {
+	case match[3] != "":
+		to, _ = strconv.Atoi(match[3])
+	case match[2] == "":
+		to = from
+	}
+
+	return from, to
+}
+
+// kindMarkers map the markers IMDB puts after the year of the titles which aren't movies to their Kinds. the longer
+// markers come first, since they contain the shorter ones.
+var kindMarkers = []struct {
+	marker string
+	kind   Kind
+}{
+	{"TV Mini Series", KIND_SERIES},
+	{"TV Mini-Series", KIND_SERIES},
+	{"TV Series", KIND_SERIES},
+	{"TV Short", KIND_SHORT},
+	{"TV Movie", KIND_TV_MOVIE},
+	{"TV Special", KIND_SPECIAL},
+	{"Video Game", KIND_GAME},
+	{"Video", KIND_VIDEO},
+	{"Short", KIND_SHORT},
+}
+
+// parseKind parses the Kind of a title from the text of its year, e.g. "(2012 Short)", and the years parsed from it.
+// a title without a marker is a movie, or a series if it ran for a range of years, e.g. "(2010–2015)". the Kind is
+// unknown if the text has neither a marker nor a year.
+func parseKind(text string, from, to int) Kind {
+	for _, m := range kindMarkers {
+		if strings.Contains(text, m.marker) {
+			return m.kind
+		}
+	}
+
+	switch {
+	case from == 0:
+		return ""
+	case to != from:
+		return KIND_SERIES
+	}
+	return KIND_MOVIE
+}
+
+// imdbLink resolves the href of a title, which is usually relative, to an absolute URL under BaseURL. the query, which
+// only carries tracking parameters, is dropped. it returns an empty string if href is empty or invalid.
+func (s *Scraper) imdbLink(href string) string {
+	if href == "" {
+		return ""
+	}
+
+	base, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return ""
+	}
+
+	ref, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+
+	link := base.ResolveReference(ref)
+	link.RawQuery = ""
+	link.Fragment = ""
+
+	return link.String()
+}
+
+// parseGenres parses the comma separated genres of a title, e.g. "Action, Adventure, Sci-Fi". it returns nil if
+// there are none.
+func parseGenres(text string) []string {
+	var genres []string
+	for _, genre := range strings.Split(text, ",") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			genres = append(genres, genre)
+		}
+	}
+	return genres
+}
+
+// parsePlot parses the plot summary of a title. IMDB invites to add one to the titles which have none, and the plot is
+// empty for them.
+func parsePlot(text string) string {
+	plot := strings.Join(strings.Fields(text), " ")
+	if strings.HasPrefix(plot, "Add a Plot") {
+		return ""
+	}
+	return plot
+}
+
+// rankRegexp matches the rank starting the text of a chart row, e.g. "1. The Shawshank Redemption".
+var rankRegexp = regexp.MustCompile(`^\s*(\d+)\.\s`)
+
+// parseRank parses the rank of a title on an IMDB chart, zero if text doesn't start with one.
+func parseRank(text string) int {
+	match := rankRegexp.FindStringSubmatch(text)
+	if match == nil {
+		return 0
+	}
+	rank, _ := strconv.Atoi(match[1])
+	return rank
+}
+
+// parseRating parses the IMDB rating of a title. ok is false if the title has no rating yet.
+func parseRating(text string) (rating float64, ok bool) {
+	rating, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return 0, false
+	}
+	return rating, true
+}
+
+// contextTransport is a http.RoundTripper which binds every request to ctx. colly has no notion of context.Context, so
+// this is how a cancelled webhook request stops the scraper. the requests without a User-Agent are sent with
+// userAgent: colly drops its own when a request has headers of its own, and never sets it on robots.txt.
+type contextTransport struct {
+	ctx       context.Context
+	base      http.RoundTripper
+	userAgent string
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t contextTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := t.ctx.Err(); err != nil {
+		return nil, err
+	}
+	r = r.Clone(t.ctx)
+	if r.Header.Get("User-Agent") == "" {
+		r.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.base.RoundTrip(r)
+}
@@ -0,0 +1,862 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// KEYWORD_SEARCH_FIXTURE is the URL of the keyword search of a fixture server, without its keywords.
+const KEYWORD_SEARCH_FIXTURE = "/search/keyword/"
+
+func TestScraperSearchCanceledContext(t *testing.T) {
+	scraper, server := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := scraper.Search(ctx, []string{"dream"}); err == nil {
+		t.Error("Search() error = nil with a canceled context")
+	}
+	if requests := server.Requests(); len(requests) != 0 {
+		t.Errorf("requested %q with a canceled context, want nothing", requests)
+	}
+}
+
+func TestScraperSearch(t *testing.T) {
+	scraper, server := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+	movies, err := scraper.Search(context.Background(), []string{"dream", "heist"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	want := []Movie{
+		{
+			Title:     "Inception",
+			Year:      2010,
+			EndYear:   2010,
+			Rating:    8.8,
+			URL:       server.URL + "/title/tt1375666/",
+			PosterURL: "https://m.media-amazon.com/images/inception.jpg",
+			Genres:    []string{"Action", "Adventure", "Sci-Fi"},
+			Plot: "A thief who steals corporate secrets through the use of dream-sharing technology is given the " +
+				"inverse task of planting an idea into the mind of a C.E.O.",
+			Kind: KIND_MOVIE,
+		},
+		{
+			Title:   "Bad Movie",
+			Year:    2015,
+			EndYear: 2018,
+			Rating:  4.1,
+			URL:     server.URL + "/title/tt0000002/",
+			Kind:    KIND_SERIES,
+		},
+		{
+			Title: "Unrated",
+			URL:   server.URL + "/title/tt0000003/",
+		},
+	}
+	if !reflect.DeepEqual(movies, want) {
+		t.Errorf("Search() = %+v, want %+v", movies, want)
+	}
+
+	if requests := server.Requests(); len(requests) != 1 || requests[0] != KEYWORD_SEARCH_FIXTURE+"?keywords=dream%2Cheist" {
+		t.Errorf("requested %q, want the keyword search of dream and heist", requests)
+	}
+}
+
+func TestScraperSearchEmptyPage(t *testing.T) {
+	scraper, _ := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "empty.html"})
+
+	movies, err := scraper.Search(context.Background(), []string{"nothing"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(movies) != 0 {
+		t.Errorf("Search() = %+v, want no movies", movies)
+	}
+}
+
+func TestScraperSearchMalformedPage(t *testing.T) {
+	scraper, server := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "malformed.html"})
+
+	movies, err := scraper.Search(context.Background(), []string{"broken"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(movies) != 2 {
+		t.Fatalf("Search() found %d movies, want 2: %+v", len(movies), movies)
+	}
+
+	if !strings.HasPrefix(movies[0].Title, "Broken") || movies[0].URL != server.URL+"/title/tt0000004/" {
+		t.Errorf("first movie = %+v, want the broken markup one", movies[0])
+	}
+	if movies[0].Rating != 0 {
+		t.Errorf("first movie rating = %v, want 0 for an unparsable rating", movies[0].Rating)
+	}
+	if movies[1].URL != server.URL+"/title/tt0000005/" {
+		t.Errorf("second movie = %+v, want the unclosed one", movies[1])
+	}
+}
+
+func TestScraperSearchNotFound(t *testing.T) {
+	scraper, _ := newFixtureScraper(t, fixtures{})
+
+	if _, err := scraper.Search(context.Background(), []string{"missing"}); !errors.Is(err, ErrScrapeFailed) {
+		t.Errorf("Search() error = %v, want ErrScrapeFailed", err)
+	}
+}
+
+func TestFitKeywords(t *testing.T) {
+	long := strings.Repeat("z", MAX_SEARCH_URL_LEN/2)
+	tests := []struct {
+		name     string
+		keywords []string
+		want     []string
+	}{
+		{name: "short", keywords: []string{"b", "a"}, want: []string{"b", "a"}},
+		{name: "drops the last given", keywords: []string{long, "a", long}, want: []string{long, "a"}},
+		{name: "keeps the order given", keywords: []string{"zz", long, long, "aa"}, want: []string{"zz", long}},
+		{name: "keeps a single long keyword", keywords: []string{long + long}, want: []string{long + long}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fitKeywords(NewScraper().QueryBudget(), tt.keywords); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fitKeywords() kept %d keywords %.10q, want %d %.10q", len(got), got, len(tt.want), tt.want)
+			}
+		})
+	}
+}
+
+func TestScraperSearchPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxPages int
+		want     []string
+	}{
+		{name: "one page", maxPages: 1, want: []string{"The Matrix", "The Terminator"}},
+		{name: "two pages", maxPages: 2, want: []string{"The Matrix", "The Terminator", "Blade Runner", "Ghost in the Shell"}},
+		{name: "more pages than the results", maxPages: 5, want: []string{"The Matrix", "The Terminator", "Blade Runner", "Ghost in the Shell"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// there are two pages of results, so page 3 is past the last one.
+			scraper, server := newFixtureScraper(t, fixtures{
+				KEYWORD_SEARCH_FIXTURE:             "page1.html",
+				KEYWORD_SEARCH_FIXTURE + "?page=2": "page2.html",
+				KEYWORD_SEARCH_FIXTURE + "?page=3": "page3.html",
+			})
+			scraper.MaxPages = tt.maxPages
+
+			movies, err := scraper.Search(context.Background(), []string{"cyberpunk"})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			var titles []string
+			for _, movie := range movies {
+				titles = append(titles, movie.Title)
+			}
+			if !reflect.DeepEqual(titles, tt.want) {
+				t.Errorf("Search() = %q, want %q", titles, tt.want)
+			}
+			// the next page is linked twice, and requested once. no page past the last one is requested.
+			if requests := server.Requests(); len(requests) != len(tt.want)/2 {
+				t.Errorf("requested %q, want %d pages", requests, len(tt.want)/2)
+			}
+		})
+	}
+}
+
+func TestScraperSearchServerError(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	scraper := NewScraper()
+	scraper.BaseURL = server.URL
+	scraper.IgnoreRobotsTxt = true
+
+	_, err := scraper.Search(context.Background(), []string{"dream"})
+	if !errors.Is(err, ErrScrapeFailed) {
+		t.Fatalf("Search() error = %v, want ErrScrapeFailed", err)
+	}
+	if !strings.Contains(err.Error(), "500") {
+		t.Errorf("Search() error = %v, want it to carry the status code", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("requested the page %d times, want a 500 not retried", n)
+	}
+}
+
+func TestScraperImdbLink(t *testing.T) {
+	scraper := NewScraper()
+
+	tests := []struct {
+		href, want string
+	}{
+		{"/title/tt1375666/", "https://www.imdb.com/title/tt1375666/"},
+		{"/title/tt1375666/?ref_=kw_li_tt", "https://www.imdb.com/title/tt1375666/"},
+		{"title/tt0000002/#cast", "https://www.imdb.com/title/tt0000002/"},
+		{"https://m.imdb.com/title/tt0000003/", "https://m.imdb.com/title/tt0000003/"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := scraper.imdbLink(tt.href); got != tt.want {
+			t.Errorf("imdbLink(%q) = %q, want %q", tt.href, got, tt.want)
+		}
+	}
+}
+
+func TestScraperSearchLinks(t *testing.T) {
+	scraper, server := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+	movies, err := scraper.Search(context.Background(), []string{"dream"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	for _, movie := range movies {
+		if !strings.HasPrefix(movie.URL, server.URL+"/title/tt") || strings.Contains(movie.URL, "?") {
+			t.Errorf("%s links to %q, want an absolute link to its title, without the query", movie.Title, movie.URL)
+		}
+	}
+}
+
+func TestScraperCustomSelectors(t *testing.T) {
+	scraper, server := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "custom.html"})
+	scraper.Selectors = Selectors{
+		Item:   `li[class~="ipc-metadata-list-summary-item"]`,
+		Title:  `a[class~="ipc-title-link-wrapper"]`,
+		Year:   `span[class~="dli-title-metadata-item"]`,
+		Rating: `span[class~="ipc-rating-star--rating"]`,
+	}
+
+	movies, err := scraper.Search(context.Background(), []string{"crime"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	want := []Movie{
+		{Title: "Pulp Fiction", Year: 1994, EndYear: 1994, Rating: 8.9, URL: server.URL + "/title/tt0110912/", Kind: KIND_MOVIE},
+		{Title: "Fight Club", Year: 1999, EndYear: 1999, Rating: 8.8, URL: server.URL + "/title/tt0137523/", Kind: KIND_MOVIE},
+	}
+	if !reflect.DeepEqual(movies, want) {
+		t.Errorf("Search() = %+v, want %+v", movies, want)
+	}
+
+	// the default selectors don't match the layout.
+	scraper.Selectors = DefaultSelectors
+	if movies, err := scraper.Search(context.Background(), []string{"crime"}); err != nil || len(movies) != 0 {
+		t.Errorf("Search() with the default selectors = %+v, %v, want no movies", movies, err)
+	}
+}
+
+func TestScraperSearchEscapesKeywords(t *testing.T) {
+	scraper, server := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+	if _, err := scraper.Search(context.Background(), getKeywords("Time Travel, café&bar")); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	want := IMDB_KEYWORD_SEARCH_PATH + "time+travel%2Ccaf%C3%A9+bar"
+	if requests := server.Requests(); len(requests) != 1 || requests[0] != want {
+		t.Errorf("requested %q, want %q", requests, want)
+	}
+}
+
+func TestScraperSearchTimeout(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("testdata", "search.html"))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			w.Write(page)
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	scraper := NewScraper()
+	scraper.BaseURL = server.URL
+	scraper.IgnoreRobotsTxt = true
+	scraper.MaxAttempts = 1
+	scraper.RequestTimeout = 20 * time.Millisecond
+
+	start := time.Now()
+	movies, err := scraper.Search(context.Background(), []string{"dream"})
+	if !errors.Is(err, ErrScrapeFailed) || movies != nil {
+		t.Errorf("Search() = %v, %v, want %v", movies, err, ErrScrapeFailed)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Search() took %v, want it to stop after the request timeout", elapsed)
+	}
+}
+
+func TestScraperLimitRule(t *testing.T) {
+	scraper := NewScraper()
+	scraper.Delay, scraper.RandomDelay, scraper.Parallelism = time.Second, 500*time.Millisecond, 2
+	scraper.MaxPages = 3
+
+	if rule := scraper.limitRule(); rule.Parallelism != 2 || rule.Delay != time.Second || rule.RandomDelay != 500*time.Millisecond {
+		t.Errorf("limitRule() = %+v, want the parallelism and the delays of the scraper", rule)
+	}
+
+	scraper.MaxPages = 1
+	if rule := scraper.limitRule(); rule.Delay != 0 || rule.RandomDelay != 0 {
+		t.Errorf("limitRule() of a single page = %+v, want no delay", rule)
+	}
+}
+
+func TestScraperSearchParallelPages(t *testing.T) {
+	want := []string{"The Matrix", "The Terminator", "Blade Runner", "Ghost in the Shell", "Akira", "Tetsuo: The Iron Man"}
+
+	for i := 0; i < 5; i++ {
+		scraper, server := newFixtureScraper(t, fixtures{
+			KEYWORD_SEARCH_FIXTURE:             "page1of3.html",
+			KEYWORD_SEARCH_FIXTURE + "?page=2": "page2of3.html",
+			KEYWORD_SEARCH_FIXTURE + "?page=3": "page3.html",
+		})
+		scraper.MaxPages, scraper.Parallelism = 3, 3
+		server.SetLatency(50 * time.Millisecond)
+
+		movies, err := scraper.Search(context.Background(), []string{"cyberpunk"})
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		if got := titles(movies); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Search() = %q, want %q", got, want)
+		}
+		if requests := server.Requests(); len(requests) != 3 {
+			t.Errorf("requested %q, want every page once", requests)
+		}
+		if n := server.MaxInFlight(); n < 2 {
+			t.Errorf("fetched at most %d pages at the same time, want them fetched in parallel", n)
+		}
+	}
+}
+
+func TestScraperSearchFollowsNextPages(t *testing.T) {
+	want := []string{"The Matrix", "The Terminator", "Blade Runner", "Ghost in the Shell", "Akira", "Tetsuo: The Iron Man"}
+
+	scraper, server := newFixtureScraper(t, fixtures{
+		KEYWORD_SEARCH_FIXTURE:             "page1of3.html",
+		KEYWORD_SEARCH_FIXTURE + "?page=2": "page2of3.html",
+		KEYWORD_SEARCH_FIXTURE + "?page=3": "page3.html",
+	})
+	scraper.MaxPages, scraper.Parallelism = 5, 3
+	// without the number of pages, each page is only requested once the page before links it.
+	scraper.Selectors.Count = ""
+	server.SetLatency(10 * time.Millisecond)
+
+	movies, err := scraper.Search(context.Background(), []string{"cyberpunk"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if got := titles(movies); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Search() = %q, want %q", got, want)
+	}
+	if requests := server.Requests(); len(requests) != 3 {
+		t.Errorf("requested %q, want the three pages", requests)
+	}
+	if n := server.MaxInFlight(); n != 1 {
+		t.Errorf("fetched %d pages at the same time, want one after the other", n)
+	}
+}
+
+func TestParsePageCount(t *testing.T) {
+	tests := []struct {
+		text  string
+		pages int
+		ok    bool
+	}{
+		{"1-50 of 1,234 titles.", 25, true},
+		{"1-2 of 4 titles.", 2, true},
+		{"1-50 of 50 titles.", 1, true},
+		{"51-100 of 1,234 titles.", 0, false},
+		{"1-50 of 20 titles.", 0, false},
+		{"No results.", 0, false},
+	}
+
+	for _, tt := range tests {
+		if pages, ok := parsePageCount(tt.text); pages != tt.pages || ok != tt.ok {
+			t.Errorf("parsePageCount(%q) = %d, %v, want %d, %v", tt.text, pages, ok, tt.pages, tt.ok)
+		}
+	}
+}
+
+func TestScraperTrending(t *testing.T) {
+	scraper, server := newFixtureScraper(t, fixtures{IMDB_CHART_PATH + string(CHART_MOVIEMETER) + "/": "chart.html"})
+
+	movies, err := scraper.Trending(context.Background())
+	if err != nil {
+		t.Fatalf("Trending() error = %v", err)
+	}
+
+	want := []Movie{
+		{
+			Title:     "Dune: Part Two",
+			Year:      2024,
+			EndYear:   2024,
+			Rating:    8.7,
+			URL:       server.URL + "/title/tt15239678/",
+			PosterURL: "https://m.media-amazon.com/images/dune.jpg",
+			Kind:      KIND_MOVIE,
+			Rank:      1,
+		},
+		{
+			Title:     "Unrated",
+			Year:      2025,
+			EndYear:   2025,
+			URL:       server.URL + "/title/tt0000006/",
+			PosterURL: "https://m.media-amazon.com/images/unrated.jpg",
+			Kind:      KIND_MOVIE,
+			Rank:      2,
+		},
+	}
+	if !reflect.DeepEqual(movies, want) {
+		t.Errorf("Trending() = %+v, want %+v", movies, want)
+	}
+}
+
+func TestScraperChart(t *testing.T) {
+	scraper, server := newFixtureScraper(t, fixtures{IMDB_CHART_PATH + string(CHART_TOP_250) + "/": "top250.html"})
+
+	movies, err := scraper.Chart(context.Background(), CHART_TOP_250)
+	if err != nil {
+		t.Fatalf("Chart() error = %v", err)
+	}
+
+	want := []string{"1 The Shawshank Redemption 9.3", "2 The Godfather 9.2", "3 2001: A Space Odyssey 8.3"}
+	var got []string
+	for _, movie := range movies {
+		got = append(got, fmt.Sprintf("%d %s %.1f", movie.Rank, movie.Title, movie.Rating))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Chart() = %q, want %q", got, want)
+	}
+
+	if _, err := scraper.Chart(context.Background(), "worst"); err == nil {
+		t.Error("Chart() of an unknown chart error = nil")
+	}
+	if requests := server.Requests(); len(requests) != 1 {
+		t.Errorf("requested %q, want the Top 250 only", requests)
+	}
+}
+
+func TestParseRank(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"\n      1.\n      The Shawshank Redemption (1994)", 1},
+		{"250. Dersu Uzala", 250},
+		{"The Godfather (1972)", 0},
+		{"2001: A Space Odyssey", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRank(tt.text); got != tt.want {
+			t.Errorf("parseRank(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestScraperSearchRetries(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("testdata", "search.html"))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		failures     int32
+		status       int
+		retryAfter   string
+		wantErr      error
+		wantRequests int32
+	}{
+		{"unavailable twice", 2, http.StatusServiceUnavailable, "", nil, 3},
+		{"throttled with retry after", 1, http.StatusTooManyRequests, "0", nil, 2},
+		{"throttled too often", 3, http.StatusTooManyRequests, "", ErrRateLimited, 3},
+		{"not found", 1, http.StatusNotFound, "", ErrScrapeFailed, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= tt.failures {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					http.Error(w, http.StatusText(tt.status), tt.status)
+					return
+				}
+				w.Write(page)
+			}))
+			t.Cleanup(server.Close)
+
+			scraper := NewScraper()
+			scraper.BaseURL = server.URL
+			scraper.IgnoreRobotsTxt = true
+			scraper.MaxAttempts = 3
+			scraper.RetryBaseDelay = time.Millisecond
+
+			movies, err := scraper.Search(context.Background(), []string{"dream"})
+			if tt.wantErr == nil && (err != nil || len(movies) != 3 || movies[0].Title != "Inception") {
+				t.Errorf("Search() = %v, %v, want the movies of the page", movies, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Search() error = %v, want %v", err, tt.wantErr)
+			}
+			if n := atomic.LoadInt32(&requests); n != tt.wantRequests {
+				t.Errorf("requested the page %d times, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestScrapeRetryDelay(t *testing.T) {
+	base := 100 * time.Millisecond
+	header := func(retryAfter string) *http.Header {
+		return &http.Header{"Retry-After": []string{retryAfter}}
+	}
+
+	if got := scrapeRetryDelay(0, base, header("7")); got != 7*time.Second {
+		t.Errorf("scrapeRetryDelay() of Retry-After: 7 = %v, want 7s", got)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := scrapeRetryDelay(0, base, header(date)); got <= 58*time.Second || got > time.Minute {
+		t.Errorf("scrapeRetryDelay() of Retry-After: %s = %v, want about a minute", date, got)
+	}
+	for attempt, min := range []time.Duration{base, 2 * base, 4 * base} {
+		for _, headers := range []*http.Header{nil, header("soon")} {
+			if got := scrapeRetryDelay(attempt, base, headers); got < min || got > min+base {
+				t.Errorf("scrapeRetryDelay(%d) = %v, want %v plus up to %v of jitter", attempt, got, min, base)
+			}
+		}
+	}
+}
+
+func TestImdbTitleSearchValues(t *testing.T) {
+	tests := []struct {
+		params TitleSearchParams
+		want   string
+	}{
+		{TitleSearchParams{}, ""},
+		{TitleSearchParams{Genres: []string{"horror", "sci-fi"}}, "genres=horror%2Csci-fi"},
+		{TitleSearchParams{MinYear: 2000, MaxYear: 2010}, "release_date=2000-01-01%2C2010-12-31"},
+		{TitleSearchParams{MinYear: 1990}, "release_date=1990-01-01%2C"},
+		{TitleSearchParams{MaxYear: 1960}, "release_date=%2C1960-12-31"},
+		{TitleSearchParams{MinRating: 7}, "user_rating=7.0%2C"},
+		{TitleSearchParams{SortBy: SORT_BY_RELEVANCE}, ""},
+		{
+			TitleSearchParams{Genres: []string{"horror"}, MinYear: 2000, MaxYear: 2010, MinRating: 7.5, SortBy: SORT_BY_RATING},
+			"genres=horror&release_date=2000-01-01%2C2010-12-31&sort=user_rating%2Cdesc&user_rating=7.5%2C",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := imdbTitleSearchValues(tt.params).Encode(); got != tt.want {
+			t.Errorf("imdbTitleSearchValues(%+v) = %q, want %q", tt.params, got, tt.want)
+		}
+	}
+}
+
+func TestScraperSearchByTitle(t *testing.T) {
+	scraper, server := newFixtureScraper(t, fixtures{TITLE_SEARCH_FIXTURE: "advanced.html"})
+
+	params := TitleSearchParams{Genres: []string{"horror"}, MinYear: 2000, MaxYear: 2010, MinRating: 7, SortBy: SORT_BY_YEAR}
+	movies, err := scraper.SearchByTitle(context.Background(), params)
+	if err != nil {
+		t.Fatalf("SearchByTitle() error = %v", err)
+	}
+	if len(movies) != 2 || movies[0].Title != "The Others" || movies[1].Year != 2005 || movies[1].Rating != 7.2 {
+		t.Errorf("SearchByTitle() = %+v, want The Others and The Descent", movies)
+	}
+	want := TITLE_SEARCH_FIXTURE + "?genres=horror&release_date=2000-01-01%2C2010-12-31&sort=release_date%2Cdesc&user_rating=7.0%2C"
+	if requests := server.Requests(); len(requests) != 1 || requests[0] != want {
+		t.Errorf("requested %q, want %q", requests, want)
+	}
+
+	for _, invalid := range []TitleSearchParams{
+		{Genres: []string{"spaghetti"}},
+		{MinYear: 2010, MaxYear: 2000},
+		{MinRating: 11},
+		{SortBy: "length"},
+	} {
+		if _, err := scraper.SearchByTitle(context.Background(), invalid); err == nil {
+			t.Errorf("SearchByTitle(%+v) error = nil", invalid)
+		}
+	}
+	if requests := server.Requests(); len(requests) != 1 {
+		t.Errorf("requested %q, want the invalid params not searched", requests)
+	}
+}
+
+func TestScraperUserAgent(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("testdata", "search.html"))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+
+	for _, tt := range []struct{ userAgent, want string }{
+		{"", DEFAULT_USER_AGENT},
+		{"moviebot/2.0 (+https://example.com/bot)", "moviebot/2.0 (+https://example.com/bot)"},
+	} {
+		var mu sync.Mutex
+		var userAgents []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			userAgents = append(userAgents, r.URL.Path+" "+r.UserAgent())
+			mu.Unlock()
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(page)
+		}))
+
+		scraper := NewScraper()
+		scraper.BaseURL = server.URL
+		scraper.UserAgent = tt.userAgent
+		if _, err := scraper.Search(context.Background(), []string{"dream"}); err != nil {
+			t.Errorf("Search() error = %v", err)
+		}
+		server.Close()
+
+		want := []string{"/robots.txt " + tt.want, KEYWORD_SEARCH_FIXTURE + " " + tt.want}
+		if !reflect.DeepEqual(userAgents, want) {
+			t.Errorf("requested %q with the User-Agent %q, want %q", userAgents, tt.userAgent, want)
+		}
+	}
+}
+
+func TestScraperLocale(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("testdata", "search.html"))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+
+	for _, tt := range []struct{ locale, want string }{
+		{"", DEFAULT_LOCALE},
+		{"de-DE", "de-DE"},
+	} {
+		var mu sync.Mutex
+		var languages []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			mu.Lock()
+			languages = append(languages, r.Header.Get("Accept-Language"))
+			mu.Unlock()
+			w.Write(page)
+		}))
+
+		scraper := NewScraper()
+		scraper.BaseURL = server.URL
+		scraper.Locale = tt.locale
+		if _, err := scraper.Search(context.Background(), []string{"dream"}); err != nil {
+			t.Errorf("Search() error = %v", err)
+		}
+		server.Close()
+
+		if want := []string{tt.want}; !reflect.DeepEqual(languages, want) {
+			t.Errorf("requested with the Accept-Language %q for the locale %q, want %q", languages, tt.locale, want)
+		}
+	}
+}
+
+func TestScraperUnsupportedLocale(t *testing.T) {
+	scraper, imdb := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	scraper.Locale = "xx-XX"
+
+	if _, err := scraper.Search(context.Background(), []string{"dream"}); err == nil || !strings.Contains(err.Error(), "xx-XX") {
+		t.Errorf("Search() error = %v, want the unsupported locale", err)
+	}
+	if requests := imdb.Requests(); len(requests) != 0 {
+		t.Errorf("requested %q in an unsupported locale", requests)
+	}
+}
+
+func TestScraperRobotsTxt(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /search/\n"))
+			return
+		}
+		atomic.AddInt32(&requests, 1)
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	scraper := NewScraper()
+	scraper.BaseURL = server.URL
+	if _, err := scraper.Search(context.Background(), []string{"dream"}); !errors.Is(err, ErrScrapeFailed) {
+		t.Errorf("Search() of a page robots.txt disallows error = %v, want %v", err, ErrScrapeFailed)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("requested %d disallowed pages, want none", n)
+	}
+}
+
+func TestScraperAllowedDomains(t *testing.T) {
+	var elsewhere int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&elsewhere, 1)
+	}))
+	t.Cleanup(other.Close)
+
+	page := `<html><body><div class="lister-list"><div class="lister-item-content"><h3 class="lister-item-header">` +
+		`<a href="/title/tt1375666/">Inception</a></h3></div></div>` +
+		`<a href="` + other.URL + `/search/keyword/?page=2" class="lister-page-next">Next</a></body></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(page))
+	}))
+	t.Cleanup(server.Close)
+
+	scraper := NewScraper()
+	scraper.BaseURL = server.URL
+	scraper.IgnoreRobotsTxt = true
+	scraper.MaxPages = 2
+	scraper.Delay, scraper.RandomDelay = 0, 0
+
+	// both pages are requested from BaseURL, whichever host the Next link points to.
+	movies, err := scraper.Search(context.Background(), []string{"dream"})
+	if err != nil || len(movies) != 2 {
+		t.Errorf("Search() = %v, %v, want the movies of the pages of BaseURL", movies, err)
+	}
+	if n := atomic.LoadInt32(&elsewhere); n != 0 {
+		t.Errorf("followed %d links off the host of BaseURL, want none", n)
+	}
+}
+
+func TestScraperDelaysPages(t *testing.T) {
+	pages := fixtures{
+		KEYWORD_SEARCH_FIXTURE:             "page1of3.html",
+		KEYWORD_SEARCH_FIXTURE + "?page=2": "page2of3.html",
+		KEYWORD_SEARCH_FIXTURE + "?page=3": "page3.html",
+	}
+	served := make(map[string][]byte, len(pages))
+	for url, file := range pages {
+		page, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatalf("reading fixture: %v", err)
+		}
+		served[url] = page
+	}
+
+	var mu sync.Mutex
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+
+		url := r.URL.Path
+		if page := r.URL.Query().Get("page"); page != "" {
+			url += "?page=" + page
+		}
+		w.Write(served[url])
+	}))
+	t.Cleanup(server.Close)
+
+	const delay = 50 * time.Millisecond
+	scraper := NewScraper()
+	scraper.BaseURL = server.URL
+	scraper.IgnoreRobotsTxt = true
+	scraper.MaxPages, scraper.Parallelism = 3, 1
+	scraper.Delay, scraper.RandomDelay = delay, 0
+
+	if _, err := scraper.Search(context.Background(), []string{"cyberpunk"}); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(times) != 3 {
+		t.Fatalf("requested %d pages, want 3", len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < delay {
+			t.Errorf("requested page %d %v after page %d, want at least %v", i+1, gap, i, delay)
+		}
+	}
+
+	if defaults := NewScraper(); defaults.Delay != DEFAULT_SCRAPE_DELAY || defaults.RandomDelay != DEFAULT_SCRAPE_RANDOM_DELAY {
+		t.Errorf("NewScraper() delays = %v, %v, want %v, %v", defaults.Delay, defaults.RandomDelay, DEFAULT_SCRAPE_DELAY, DEFAULT_SCRAPE_RANDOM_DELAY)
+	}
+}
+
+func TestParseGenres(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"\nAction, Adventure, Sci-Fi            ", []string{"Action", "Adventure", "Sci-Fi"}},
+		{"Horror", []string{"Horror"}},
+		{" , Drama,, ", []string{"Drama"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		if got := parseGenres(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseGenres(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParsePlot(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"\nA thief who steals\n   corporate secrets.  ", "A thief who steals corporate secrets."},
+		{"Add a Plot »", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := parsePlot(tt.text); got != tt.want {
+			t.Errorf("parsePlot(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestScraperSearchInjection(t *testing.T) {
+	scraper, server := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+	if _, err := scraper.Search(context.Background(), []string{"dream?page=2&sort=year", "../title/tt0000001", "東京"}); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	want := IMDB_KEYWORD_SEARCH_PATH + "dream+page+2+sort+year%2Ctitle+tt0000001%2C%E6%9D%B1%E4%BA%AC"
+	if requests := server.Requests(); len(requests) != 1 || requests[0] != want {
+		t.Errorf("requested %q, want %q", requests, want)
+	}
+
+	if _, err := scraper.Search(context.Background(), []string{"dream\r\nHost: evil"}); err != nil {
+		t.Fatalf("Search() of a keyword with control characters error = %v", err)
+	}
+	if requests, want := server.Requests(), IMDB_KEYWORD_SEARCH_PATH+"dream+Host+evil"; len(requests) != 2 || requests[1] != want {
+		t.Errorf("requested %q, want the control characters replaced with spaces in %q", requests, want)
+	}
+	if _, err := scraper.Search(context.Background(), []string{"?&/"}); !errors.Is(err, ErrInvalidKeywords) {
+		t.Errorf("Search() of a keyword without any letter error = %v, want %v", err, ErrInvalidKeywords)
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// the errors SearchMovies fails with, wrapped with the details of the failure. they tell the kinds of failures apart
+// with errors.Is.
+var (
+	// ErrNoResults is returned when no movie satisfies the search.
+	ErrNoResults = errors.New("no movies found")
+
+	// ErrScrapeFailed is returned when the MovieSource couldn't get the movies.
+	ErrScrapeFailed = errors.New("getting the movies failed")
+
+	// ErrRateLimited is returned when the MovieSource refused the search for being sent too many, even after retrying.
+	ErrRateLimited = errors.New("rate limited by the movie source")
+
+	// ErrInvalidKeywords is returned when there are no keywords to search, or more than MAX_KEYWORDS of them.
+	ErrInvalidKeywords = errors.New("invalid keywords")
+)
+
+// SearchOptions control which movies SearchMovies returns, and in which order. the zero value returns every movie
+// found by a Scraper of IMDB, in the order of relevance.
+type SearchOptions struct {
+	// Source finds the movies. nil means NewScraper().
+	Source MovieSource
+
+	// MinRating drops the movies rated below it. zero keeps every movie, rated or not.
+	MinRating float64
+
+	// MinYear and MaxYear drop the movies released before or after them, and the movies without a known year. zero
+	// leaves that end of the range open.
+	MinYear int
+	MaxYear int
+
+	// Genres drops the movies which aren't of all these genres, e.g. "action", ignoring case, and the movies without
+	// known genres. empty keeps every movie.
+	Genres []string
+
+	// Kinds drops the titles which aren't of any of these Kinds, e.g. the TV series when it is only KIND_MOVIE, and the
+	// titles of an unknown Kind. empty keeps every title.
+	Kinds []Kind
+
+	// SortBy is the order of the movies. empty means SORT_BY_RELEVANCE.
+	SortBy SortBy
+
+	// MaxResults caps the number of movies returned, after they are sorted. zero doesn't cap them.
+	MaxResults int
+
+	// KeepDuplicates keeps the movies the Source lists more than once. by default they are merged into one, with the
+	// highest rating of them.
+	KeepDuplicates bool
+
+	// Fallback searches the keywords again without the last of them if no movie satisfies the search, since a
+	// misspelled keyword matches nothing. the keywords are dropped in the order they are given, so the last one the
+	// user typed is, like ParseKeywords keeps them. the search is loosened only once, and a single keyword isn't.
+	Fallback bool
+}
+
+// SearchMovies returns the movies matching all the keywords which satisfy opts. it is what the bot answers a search
+// with, without anything Telegram: it can be used by any program looking for movies. it fails with ErrNoResults if
+// there are none, and with the other sentinel errors above for the failures they describe.
+func SearchMovies(ctx context.Context, keywords []string, opts SearchOptions) ([]Movie, error) {
+	movies, _, err := searchMovies(ctx, keywords, opts)
+	return movies, err
+}
+
+// searchMovies is SearchMovies, also returning the keywords the movies were found with: fewer than keywords if the
+// search fell back to a looser one.
+func searchMovies(ctx context.Context, keywords []string, opts SearchOptions) ([]Movie, []string, error) {
+	switch {
+	case len(keywords) == 0:
+		return nil, nil, fmt.Errorf("%w: no keywords to search", ErrInvalidKeywords)
+	case len(keywords) > MAX_KEYWORDS:
+		return nil, nil, fmt.Errorf("%w: %d keywords, at most %d can be searched", ErrInvalidKeywords, len(keywords), MAX_KEYWORDS)
+	case opts.SortBy != "" && !isSortBy(opts.SortBy):
+		return nil, nil, fmt.Errorf("unknown sort %q", opts.SortBy)
+	}
+
+	source := opts.Source
+	if source == nil {
+		source = NewScraper()
+	}
+
+	searched := keywords
+	movies, err := source.Search(ctx, searched)
+	if err != nil {
+		return nil, nil, err
+	}
+	movies = opts.apply(movies)
+
+	if len(movies) == 0 && opts.Fallback && len(keywords) > 1 {
+		searched = keywords[:len(keywords)-1]
+		movies, err = source.Search(ctx, searched)
+		if err != nil {
+			return nil, nil, err
+		}
+		movies = opts.apply(movies)
+	}
+
+	if len(movies) == 0 {
+		return nil, nil, fmt.Errorf("%w for %s", ErrNoResults, strings.Join(keywords, ", "))
+	}
+	return movies, searched, nil
+}
+
+// ParseKeywords parses comma separated keywords, e.g. "time travel, dystopia", the way the bot parses the searches of
+// its users. the keywords are normalized, and keep the order they were typed in.
+func ParseKeywords(text string) []string {
+	return getKeywords(text)
+}
+
+// apply returns the movies satisfying the filter of opts, sorted and capped as opts say.
+func (opts SearchOptions) apply(movies []Movie) []Movie {
+	f := filter{
+		minRating:      opts.MinRating,
+		minYear:        opts.MinYear,
+		maxYear:        opts.MaxYear,
+		genres:         opts.Genres,
+		kinds:          opts.Kinds,
+		keepDuplicates: opts.KeepDuplicates,
+	}
+	movies = f.apply(movies)
+	if opts.SortBy != "" {
+		movies = sortMovies(movies, opts.SortBy)
+	}
+	if opts.MaxResults > 0 && len(movies) > opts.MaxResults {
+		movies = movies[:opts.MaxResults]
+	}
+	return movies
+}
@@ -0,0 +1,406 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// titles returns the titles of movies, in order.
+func titles(movies []Movie) []string {
+	var titles []string
+	for _, movie := range movies {
+		titles = append(titles, movie.Title)
+	}
+	return titles
+}
+
+func TestSearchMoviesMinRating(t *testing.T) {
+	tests := []struct {
+		minRating float64
+		want      []string
+	}{
+		{minRating: 0, want: []string{"Inception", "Bad Movie", "Unrated"}},
+		{minRating: 4.1, want: []string{"Inception", "Bad Movie"}},
+		{minRating: 5, want: []string{"Inception"}},
+		{minRating: 9, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.minRating), func(t *testing.T) {
+			scraper, _ := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+			movies, err := SearchMovies(context.Background(), []string{"dream"}, SearchOptions{Source: scraper, MinRating: tt.minRating})
+			if tt.want == nil {
+				if !errors.Is(err, ErrNoResults) {
+					t.Fatalf("SearchMovies() = %q, %v, want ErrNoResults", titles(movies), err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			if got := titles(movies); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchMovies() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRating(t *testing.T) {
+	tests := []struct {
+		text   string
+		rating float64
+		ok     bool
+	}{
+		{"8.8", 8.8, true},
+		{" 7 ", 7, true},
+		{"", 0, false},
+		{"not a rating", 0, false},
+	}
+
+	for _, tt := range tests {
+		if rating, ok := parseRating(tt.text); rating != tt.rating || ok != tt.ok {
+			t.Errorf("parseRating(%q) = %v, %v, want %v, %v", tt.text, rating, ok, tt.rating, tt.ok)
+		}
+	}
+}
+
+func TestSearchMoviesYearRange(t *testing.T) {
+	tests := []struct {
+		name             string
+		minYear, maxYear int
+		want             []string
+	}{
+		{name: "any year", want: []string{"Back to the Future", "Goodfellas", "Fight Club", "Gladiator", "Person of Interest", "Stranger Things", "Untitled Project"}},
+		{name: "inclusive", minYear: 1990, maxYear: 2000, want: []string{"Goodfellas", "Fight Club", "Gladiator"}},
+		{name: "single year", minYear: 1999, maxYear: 1999, want: []string{"Fight Club"}},
+		{name: "open end", minYear: 2011, want: []string{"Person of Interest", "Stranger Things"}},
+		{name: "open start", maxYear: 1990, want: []string{"Back to the Future", "Goodfellas"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scraper, _ := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "years.html"})
+
+			movies, err := SearchMovies(context.Background(), []string{"classic"}, SearchOptions{Source: scraper, MinYear: tt.minYear, MaxYear: tt.maxYear})
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			if got := titles(movies); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchMovies() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchMoviesKinds(t *testing.T) {
+	tests := []struct {
+		name  string
+		kinds []Kind
+		want  []string
+	}{
+		{name: "any kind", want: []string{"Back to the Future", "Goodfellas", "Fight Club", "Gladiator", "Person of Interest", "Stranger Things", "Untitled Project"}},
+		{name: "movies", kinds: []Kind{KIND_MOVIE}, want: []string{"Back to the Future", "Goodfellas", "Fight Club", "Gladiator"}},
+		{name: "series", kinds: []Kind{KIND_SERIES}, want: []string{"Person of Interest", "Stranger Things"}},
+		{name: "both", kinds: []Kind{KIND_SERIES, KIND_MOVIE}, want: []string{"Back to the Future", "Goodfellas", "Fight Club", "Gladiator", "Person of Interest", "Stranger Things"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scraper, _ := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "years.html"})
+
+			movies, err := SearchMovies(context.Background(), []string{"classic"}, SearchOptions{Source: scraper, Kinds: tt.kinds})
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			if got := titles(movies); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchMovies() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYears(t *testing.T) {
+	tests := []struct {
+		text     string
+		from, to int
+	}{
+		{"(2010)", 2010, 2010},
+		{"(I) (2000)", 2000, 2000},
+		{"(2011–2016 TV Series)", 2011, 2016},
+		{"(2016– )", 2016, 0},
+		{"", 0, 0},
+		{"(19", 0, 0},
+	}
+
+	for _, tt := range tests {
+		if from, to := parseYears(tt.text); from != tt.from || to != tt.to {
+			t.Errorf("parseYears(%q) = %d, %d, want %d, %d", tt.text, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	tests := []struct {
+		text     string
+		from, to int
+		want     Kind
+	}{
+		{"(2010)", 2010, 2010, KIND_MOVIE},
+		{"(I) (2000)", 2000, 2000, KIND_MOVIE},
+		{"(2011–2016 TV Series)", 2011, 2016, KIND_SERIES},
+		{"(2016– )", 2016, 0, KIND_SERIES},
+		{"(2016 TV Mini Series)", 2016, 2016, KIND_SERIES},
+		{"(2012 Short)", 2012, 2012, KIND_SHORT},
+		{"(2019 TV Short)", 2019, 2019, KIND_SHORT},
+		{"(2005 TV Movie)", 2005, 2005, KIND_TV_MOVIE},
+		{"(2018 TV Special)", 2018, 2018, KIND_SPECIAL},
+		{"(2003 Video)", 2003, 2003, KIND_VIDEO},
+		{"(2013 Video Game)", 2013, 2013, KIND_GAME},
+		{"", 0, 0, ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseKind(tt.text, tt.from, tt.to); got != tt.want {
+			t.Errorf("parseKind(%q, %d, %d) = %q, want %q", tt.text, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestMergeMovies(t *testing.T) {
+	horror := []Movie{{Title: "Alien", Year: 1979}, {Title: "The Thing", Year: 1982}, {Title: "Hereditary", Year: 2018}}
+	space := []Movie{{Title: "alien", Year: 1979}, {Title: "Interstellar", Year: 2014}, {Title: "The Thing", Year: 2011}}
+
+	want := []string{"Alien", "The Thing", "Interstellar", "Hereditary", "The Thing"}
+	merged := mergeMovies([][]Movie{horror, space})
+	if got := titles(merged); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeMovies() = %q, want %q", got, want)
+	}
+	if merged[4].Year != 2011 {
+		t.Errorf("mergeMovies() dropped the remake of another year: %+v", merged)
+	}
+}
+
+func TestSearchMoviesOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SearchOptions
+		want []string
+	}{
+		{"relevance", SearchOptions{}, []string{"Back to the Future", "Goodfellas", "Fight Club", "Gladiator", "Person of Interest", "Stranger Things", "Untitled Project"}},
+		{"latest first", SearchOptions{SortBy: SORT_BY_YEAR, MaxResults: 3}, []string{"Stranger Things", "Person of Interest", "Gladiator"}},
+		{"range and sort", SearchOptions{MinYear: 1985, MaxYear: 1999, SortBy: SORT_BY_YEAR}, []string{"Fight Club", "Goodfellas", "Back to the Future"}},
+		{"movies only", SearchOptions{Kinds: []Kind{KIND_MOVIE}, MaxResults: 2}, []string{"Back to the Future", "Goodfellas"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scraper, _ := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "years.html"})
+			tt.opts.Source = scraper
+
+			movies, err := SearchMovies(context.Background(), []string{"classic"}, tt.opts)
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			if got := titles(movies); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchMovies() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchMoviesErrors(t *testing.T) {
+	scraper, _ := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	tooMany := make([]string, MAX_KEYWORDS+1)
+	for i := range tooMany {
+		tooMany[i] = "dream"
+	}
+
+	tests := []struct {
+		name     string
+		keywords []string
+		opts     SearchOptions
+		want     error
+	}{
+		{"no keywords", nil, SearchOptions{Source: scraper}, ErrInvalidKeywords},
+		{"too many keywords", tooMany, SearchOptions{Source: scraper}, ErrInvalidKeywords},
+		{"not found", []string{"dream"}, SearchOptions{Source: &fakeSource{}}, ErrNoResults},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SearchMovies(context.Background(), tt.keywords, tt.opts); !errors.Is(err, tt.want) {
+				t.Errorf("SearchMovies() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := SearchMovies(context.Background(), []string{"dream"}, SearchOptions{Source: scraper, SortBy: "length"}); err == nil {
+		t.Error("SearchMovies() of an unknown sort error = nil")
+	}
+
+	broken, _ := newFixtureScraper(t, fixtures{})
+	if _, err := SearchMovies(context.Background(), []string{"dream"}, SearchOptions{Source: broken}); !errors.Is(err, ErrScrapeFailed) {
+		t.Errorf("SearchMovies() of a failed scrape error = %v, want %v", err, ErrScrapeFailed)
+	}
+}
+
+func TestDedupMovies(t *testing.T) {
+	movies := []Movie{
+		{Title: "Inception", Year: 2010, Rating: 8.7},
+		{Title: "Memento", Year: 2000, Rating: 8.4, URL: "memento"},
+		{Title: " INCEPTION ", Year: 2010, Rating: 8.8, URL: "inception", PosterURL: "poster", Genres: []string{"Sci-Fi"}, Kind: KIND_MOVIE},
+		{Title: "Inception", Year: 2020, Rating: 5.1},
+		{Title: "Memento", Year: 2000, Rating: 8.3, URL: "other"},
+	}
+
+	want := []Movie{
+		{Title: "Inception", Year: 2010, Rating: 8.8, URL: "inception", PosterURL: "poster", Genres: []string{"Sci-Fi"}, Kind: KIND_MOVIE},
+		{Title: "Memento", Year: 2000, Rating: 8.4, URL: "memento"},
+		{Title: "Inception", Year: 2020, Rating: 5.1},
+	}
+	if got := dedupMovies(movies); !reflect.DeepEqual(got, want) {
+		t.Errorf("dedupMovies() = %+v, want %+v", got, want)
+	}
+	if len(movies) != 5 || movies[0].Rating != 8.7 {
+		t.Errorf("dedupMovies() changed its argument to %+v", movies)
+	}
+}
+
+func TestSearchDuplicates(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		bot, telegram, imdb := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "duplicates.html"})
+		bot.KeepDuplicates = keep
+
+		postUpdate(bot, messageUpdate(1, 7, "dream"))
+
+		want := "1. Inception (2010) (8.8) " + imdb.URL + "/title/tt1375666/\n" +
+			"2. Memento (2000) (8.4) " + imdb.URL + "/title/tt0209144/\n" +
+			"3. Inception (2020) (5.1) " + imdb.URL + "/title/tt0000004/\n"
+		if keep {
+			want = "1. Inception (2010) (8.7) " + imdb.URL + "/title/tt1375666/\n" +
+				"2. Memento (2000) (8.4) " + imdb.URL + "/title/tt0209144/\n" +
+				"3. INCEPTION (2010) (8.8) " + imdb.URL + "/title/tt1375666/\n" +
+				"4. Inception (2020) (5.1) " + imdb.URL + "/title/tt0000004/\n" +
+				"5. Memento (2000) (8.3) " + imdb.URL + "/title/tt0209144/\n"
+		}
+		if sent := sentTexts(telegram.Calls()); len(sent) != 1 || sent[0] != want {
+			t.Errorf("sent %q with KeepDuplicates %t, want %q", sent, keep, want)
+		}
+	}
+}
+
+func TestSearchMoviesErrorKinds(t *testing.T) {
+	throttled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	t.Cleanup(throttled.Close)
+	rateLimited := NewScraper()
+	rateLimited.BaseURL = throttled.URL
+	rateLimited.IgnoreRobotsTxt = true
+	rateLimited.MaxAttempts = 1
+
+	scraper, _ := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	broken, _ := newFixtureScraper(t, fixtures{})
+
+	tests := []struct {
+		name     string
+		keywords []string
+		source   MovieSource
+		want     error
+		notWant  []error
+	}{
+		{"rate limited", []string{"dream"}, rateLimited, ErrRateLimited, []error{ErrScrapeFailed, ErrNoResults}},
+		{"scrape failed", []string{"dream"}, broken, ErrScrapeFailed, []error{ErrRateLimited, ErrNoResults}},
+		{"nothing to search", []string{"?&/"}, scraper, ErrInvalidKeywords, []error{ErrScrapeFailed, ErrNoResults}},
+		{"no results", []string{"dream"}, &fakeSource{}, ErrNoResults, []error{ErrScrapeFailed, ErrInvalidKeywords}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SearchMovies(context.Background(), tt.keywords, SearchOptions{Source: tt.source})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("SearchMovies() error = %v, want %v", err, tt.want)
+			}
+			for _, other := range tt.notWant {
+				if errors.Is(err, other) {
+					t.Errorf("SearchMovies() error = %v, want it not to be %v", err, other)
+				}
+			}
+		})
+	}
+
+	if !errors.Is(ErrCircuitOpen, ErrScrapeFailed) {
+		t.Errorf("ErrCircuitOpen = %v, want it to be %v", ErrCircuitOpen, ErrScrapeFailed)
+	}
+}
+
+func TestSearchMoviesGenres(t *testing.T) {
+	scraper, _ := newFixtureScraper(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+
+	tests := []struct {
+		genres []string
+		want   []string
+	}{
+		{nil, []string{"Inception", "Bad Movie", "Unrated"}},
+		{[]string{"sci-fi"}, []string{"Inception"}},
+		{[]string{"ACTION", "Adventure"}, []string{"Inception"}},
+		{[]string{"action", "drama"}, nil},
+	}
+
+	for _, tt := range tests {
+		movies, err := SearchMovies(context.Background(), []string{"dream"}, SearchOptions{Source: scraper, Genres: tt.genres})
+		if tt.want == nil && !errors.Is(err, ErrNoResults) {
+			t.Errorf("SearchMovies() of the genres %q error = %v, want %v", tt.genres, err, ErrNoResults)
+			continue
+		}
+		if got := titles(movies); tt.want != nil && (err != nil || !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("SearchMovies() of the genres %q = %q, %v, want %q", tt.genres, got, err, tt.want)
+		}
+	}
+}
+
+func TestSearchMoviesFallbackDropsLastTypedKeyword(t *testing.T) {
+	source := &fakeSource{movies: map[string][]Movie{
+		"zombie,comedy": {{Title: "Shaun of the Dead"}},
+	}}
+
+	keywords := ParseKeywords("Zombie, Comedy, Misspeled")
+	movies, searched, err := searchMovies(context.Background(), keywords, SearchOptions{Source: source, Fallback: true})
+	if err != nil {
+		t.Fatalf("searchMovies() error = %v", err)
+	}
+
+	if len(movies) != 1 || movies[0].Title != "Shaun of the Dead" {
+		t.Errorf("searchMovies() = %+v, want the movies of the first two keywords", movies)
+	}
+	if want := []string{"zombie", "comedy"}; !reflect.DeepEqual(searched, want) {
+		t.Errorf("searched %q, want %q", searched, want)
+	}
+	if want := [][]string{{"zombie", "comedy", "misspeled"}, {"zombie", "comedy"}}; !reflect.DeepEqual(source.Searches(), want) {
+		t.Errorf("searches = %q, want %q", source.Searches(), want)
+	}
+}
+
+func TestParseKeywordsKeepsOrder(t *testing.T) {
+	if got, want := ParseKeywords("Time Travel, dystopia,, Action"), []string{"time travel", "dystopia", "action"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseKeywords() = %q, want %q", got, want)
+	}
+}
+
+func TestCacheKeyIgnoresOrder(t *testing.T) {
+	if a, b := cacheKey("keywords", ParseKeywords("action, drama")), cacheKey("keywords", ParseKeywords("Drama,Action")); a != b {
+		t.Errorf("cacheKey() = %q and %q for the same keywords typed in another order", a, b)
+	}
+
+	keywords := []string{"drama", "action"}
+	cacheKey("keywords", keywords)
+	if keywords[0] != "drama" {
+		t.Errorf("cacheKey() sorted its terms in place: %q", keywords)
+	}
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SendQueue sends the messages of the bots one at a time, within a global rate, since Telegram limits the messages a
+// bot sends per second whichever chats they go to, and the updates answered concurrently would together exceed it.
+// the chats take turns, so one chat sent many messages doesn't hold back the others. its zero value isn't usable, see
+// NewSendQueue. it is safe for concurrent use, and can be shared by several bots of the same token.
+type SendQueue struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[int][]*queuedSend
+	turns   []int
+	running bool
+
+	// last is when the last message was sent. it is only used by the worker, which a new one takes over when started.
+	last time.Time
+}
+
+// queuedSend is a send waiting in a SendQueue.
+type queuedSend struct {
+	ctx  context.Context
+	send func() (string, error)
+	done chan sendResult
+}
+
+// sendResult is the outcome of a queuedSend.
+type sendResult struct {
+	body string
+	err  error
+}
+
+// NewSendQueue returns a SendQueue which sends at most rate messages per second. rate must be positive.
+func NewSendQueue(rate int) *SendQueue {
+	return &SendQueue{
+		interval: time.Second / time.Duration(rate),
+		pending:  make(map[int][]*queuedSend),
+	}
+}
+
+// Do queues send, a call sending a message to the chat, and returns what it returns once it is sent. if ctx is done
+// first, the error of ctx is returned and send is dropped from the queue instead of being called.
+func (q *SendQueue) Do(ctx context.Context, chatID int, send func() (string, error)) (string, error) {
+	s := &queuedSend{ctx: ctx, send: send, done: make(chan sendResult, 1)}
+
+	q.mu.Lock()
+	if len(q.pending[chatID]) == 0 {
+		q.turns = append(q.turns, chatID)
+	}
+	q.pending[chatID] = append(q.pending[chatID], s)
+	if !q.running {
+		q.running = true
+		go q.work()
+	}
+	q.mu.Unlock()
+
+	select {
+	case result := <-s.done:
+		return result.body, result.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// work sends the queued messages, at most one per interval, until the queue is empty. the sends whose context is done
+// are dropped without waiting for their turn.
+func (q *SendQueue) work() {
+	for {
+		s, ok := q.next()
+		if !ok {
+			return
+		}
+		if s.ctx.Err() != nil {
+			continue
+		}
+
+		if wait := q.interval - time.Since(q.last); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-s.ctx.Done():
+				timer.Stop()
+				continue
+			}
+		}
+
+		q.last = time.Now()
+		body, err := s.send()
+		s.done <- sendResult{body: body, err: err}
+	}
+}
+
+// next pops the first send of the chat whose turn it is, which takes its turn again after the others if it has more
+// sends queued. ok is false, and the worker is stopped, once the queue is empty.
+func (q *SendQueue) next() (s *queuedSend, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.turns) == 0 {
+		q.running = false
+		return nil, false
+	}
+
+	chatID := q.turns[0]
+	q.turns = q.turns[1:]
+	sends := q.pending[chatID]
+	s = sends[0]
+	if len(sends) > 1 {
+		q.pending[chatID] = sends[1:]
+		q.turns = append(q.turns, chatID)
+	} else {
+		delete(q.pending, chatID)
+	}
+
+	return s, true
+}
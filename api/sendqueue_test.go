@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendQueueRate(t *testing.T) {
+	const rate, sends = 50, 10
+	queue := NewSendQueue(rate)
+
+	var mu sync.Mutex
+	var sent []time.Time
+	var wg sync.WaitGroup
+	for i := 0; i < sends; i++ {
+		wg.Add(1)
+		go func(chatID int) {
+			defer wg.Done()
+			queue.Do(context.Background(), chatID, func() (string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				sent = append(sent, time.Now())
+				return "", nil
+			})
+		}(i % 3)
+	}
+	wg.Wait()
+
+	if len(sent) != sends {
+		t.Fatalf("sent %d messages, want %d", len(sent), sends)
+	}
+	interval := time.Second / rate
+	for i := 1; i < len(sent); i++ {
+		// the timer may fire a little early on some platforms.
+		if gap := sent[i].Sub(sent[i-1]); gap < interval-time.Millisecond {
+			t.Errorf("message %d sent %v after the previous one, want at least %v", i, gap, interval)
+		}
+	}
+	if elapsed, want := sent[len(sent)-1].Sub(sent[0]), (sends-1)*interval; elapsed < want-time.Millisecond {
+		t.Errorf("sent %d messages in %v, want at least %v at %d per second", sends, elapsed, want, rate)
+	}
+}
+
+func TestSendQueueTurns(t *testing.T) {
+	queue := NewSendQueue(1000)
+
+	// the worker is held by the first send until the others are queued, so their order depends on the turns only.
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []int
+	record := func(chatID int) func() (string, error) {
+		return func() (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, chatID)
+			return "", nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		queue.Do(context.Background(), 0, func() (string, error) {
+			<-release
+			return "", nil
+		})
+	}()
+	waitFor(t, func() bool {
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		return len(queue.turns) == 0 && queue.running
+	})
+
+	for i, chatID := range []int{1, 1, 1, 2} {
+		wg.Add(1)
+		go func(chatID int) {
+			defer wg.Done()
+			queue.Do(context.Background(), chatID, record(chatID))
+		}(chatID)
+		waitFor(t, func() bool {
+			queue.mu.Lock()
+			defer queue.mu.Unlock()
+			queued := 0
+			for _, sends := range queue.pending {
+				queued += len(sends)
+			}
+			return queued == i+1
+		})
+	}
+	close(release)
+	wg.Wait()
+
+	want := []int{1, 2, 1, 1}
+	if len(order) != len(want) {
+		t.Fatalf("sent to %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("sent to %v, want %v", order, want)
+		}
+	}
+}
+
+func TestSendQueueCanceled(t *testing.T) {
+	queue := NewSendQueue(1)
+
+	// the first send starts the interval, so the second one waits for its turn when its context is canceled.
+	queue.Do(context.Background(), 1, func() (string, error) { return "", nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	called := false
+	if _, err := queue.Do(ctx, 1, func() (string, error) {
+		called = true
+		return "", nil
+	}); err != context.DeadlineExceeded {
+		t.Errorf("Do() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the next send is only made after the interval, by which time the canceled one was dropped.
+	queue.Do(context.Background(), 1, func() (string, error) { return "", nil })
+	if called {
+		t.Error("the canceled send was sent")
+	}
+}
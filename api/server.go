@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Server serves a handler, e.g. a Bot or a Router, over HTTP and answers the updates of the bots it polls, as a long
+// running service. Shutdown stops it gracefully: the updates being answered are drained, up to the deadline of the
+// shutdown, and the scrapes and the Telegram calls still running at the deadline are canceled.
+type Server struct {
+	server *http.Server
+
+	// ctx is the context of the requests and the polled updates, canceled once the shutdown deadline passes.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// pollCtx is the context of the polls, canceled as soon as the shutdown starts.
+	pollCtx     context.Context
+	stopPolling context.CancelFunc
+	polls       sync.WaitGroup
+}
+
+// NewServer returns a Server serving handler on addr, e.g. ":8080".
+func NewServer(addr string, handler http.Handler) *Server {
+	s := &Server{}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.pollCtx, s.stopPolling = context.WithCancel(context.Background())
+	s.server = &http.Server{
+		Addr:        addr,
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return s.ctx },
+	}
+	return s
+}
+
+// ListenAndServe serves the handler on the address of the server. it returns nil once the server is shut down, and
+// the error it failed with otherwise.
+func (s *Server) ListenAndServe() error {
+	return serverError(s.server.ListenAndServe())
+}
+
+// Serve serves the handler on the connections accepted on l, like ListenAndServe.
+func (s *Server) Serve(l net.Listener) error {
+	return serverError(s.server.Serve(l))
+}
+
+// serverError returns err, unless it only says the server was shut down.
+func serverError(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Poll answers the updates of bot fetched with getUpdates in the background, see Bot.Poll, until the server is shut
+// down.
+func (s *Server) Poll(bot *Bot) {
+	s.polls.Add(1)
+	go func() {
+		defer s.polls.Done()
+		bot.poll(s.pollCtx, s.ctx)
+	}()
+}
+
+// Shutdown stops the server from accepting requests and polling updates, then waits for the requests and the updates
+// being answered until ctx is done. the ones still running then are canceled, and the error of ctx is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopPolling()
+
+	// the answers still running at the deadline are canceled, so they return instead of being abandoned.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.cancel()
+		case <-stop:
+		}
+	}()
+
+	err := s.server.Shutdown(ctx)
+
+	polled := make(chan struct{})
+	go func() {
+		s.polls.Wait()
+		close(polled)
+	}()
+	select {
+	case <-polled:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	s.cancel()
+	return err
+}
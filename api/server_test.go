@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerShutdownDrainsRequests(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+
+	answering := make(chan struct{})
+	release := make(chan struct{})
+	telegram.Respond(func(call telegramCall) (int, string) {
+		if call.Method == TELEGRAM_API_SEND_MESSAGE {
+			close(answering)
+			<-release
+		}
+		return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	server := NewServer("", bot)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(l) }()
+
+	responses := make(chan int, 1)
+	go func() {
+		resp, err := http.Post("http://"+l.Addr().String()+"/", "application/json", strings.NewReader(messageUpdate(1, 7, "/help")))
+		if err != nil {
+			t.Errorf("Post() error = %v", err)
+			close(responses)
+			return
+		}
+		resp.Body.Close()
+		responses <- resp.StatusCode
+	}()
+
+	select {
+	case <-answering:
+	case <-time.After(time.Second):
+		t.Fatal("the update wasn't answered")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutDown := make(chan error, 1)
+	go func() { shutDown <- server.Shutdown(ctx) }()
+
+	// the new connections are refused once the shutdown started, while the update is still being answered.
+	waitFor(t, func() bool {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	})
+	select {
+	case err := <-shutDown:
+		t.Fatalf("Shutdown() = %v before the update was answered, want it to wait", err)
+	default:
+	}
+
+	close(release)
+	select {
+	case err := <-shutDown:
+		if err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown() didn't return once the update was answered")
+	}
+	if status := <-responses; status != http.StatusOK {
+		t.Errorf("status = %d, want the update answered with %d", status, http.StatusOK)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve() error = %v, want nil once shut down", err)
+	}
+}
+
+func TestServerShutdownConfirmsPolledUpdates(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+
+	// the long polls following the first one wait until the test ends, so only the shutdown stops them.
+	release := make(chan struct{})
+	defer close(release)
+	telegram.Respond(func(call telegramCall) (int, string) {
+		switch {
+		case call.Method != TELEGRAM_API_GET_UPDATES:
+			return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+		case call.Values.Get("offset") == "0":
+			return http.StatusOK, `{"ok":true,"result":[` + messageUpdate(5, 7, "/help") + `]}`
+		case call.Values.Get("timeout") != "0":
+			<-release
+		}
+		return http.StatusOK, `{"ok":true,"result":[]}`
+	})
+
+	server := NewServer("", bot)
+	server.Poll(bot)
+	waitFor(t, func() bool { return len(telegram.CallsOf(TELEGRAM_API_GET_UPDATES)) == 2 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	polls := telegram.CallsOf(TELEGRAM_API_GET_UPDATES)
+	if len(polls) != 3 {
+		t.Fatalf("polled %d times, want the last updates confirmed once: %v", len(polls), polls)
+	}
+	if last := polls[2].Values; last.Get("offset") != "6" || last.Get("timeout") != "0" {
+		t.Errorf("last poll offset = %q, timeout = %q, want the updates up to 5 confirmed without waiting", last.Get("offset"), last.Get("timeout"))
+	}
+	if sent := telegram.CallsOf(TELEGRAM_API_SEND_MESSAGE); len(sent) != 1 {
+		t.Errorf("sent %d messages, want the polled update answered", len(sent))
+	}
+}
@@ -0,0 +1,47 @@
+package handler
+
+import "sort"
+
+// SortBy is the order movies are recommended in.
+type SortBy string
+
+// the supported SortBys.
+const (
+	SORT_BY_RELEVANCE SortBy = "relevance"
+	SORT_BY_RATING    SortBy = "rating"
+	SORT_BY_YEAR      SortBy = "year"
+)
+
+// sortBys are the supported SortBys.
+var sortBys = []SortBy{SORT_BY_RELEVANCE, SORT_BY_RATING, SORT_BY_YEAR}
+
+// isSortBy reports whether by is one of the supported SortBys.
+func isSortBy(by SortBy) bool {
+	for _, b := range sortBys {
+		if b == by {
+			return true
+		}
+	}
+	return false
+}
+
+// sortMovies returns a copy of movies sorted by: the highest rating or the latest year first, or the order of the
+// MovieSource for SORT_BY_RELEVANCE. the movies without a rating or a year are sorted last, and ties keep the order of
+// the MovieSource, so the order is deterministic.
+func sortMovies(movies []Movie, by SortBy) []Movie {
+	sorted := make([]Movie, len(movies))
+	copy(sorted, movies)
+
+	switch by {
+	case SORT_BY_RATING:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Rating > sorted[j].Rating
+		})
+	case SORT_BY_YEAR:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Year > sorted[j].Year
+		})
+	}
+
+	return sorted
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSortMovies(t *testing.T) {
+	movies := []Movie{
+		{Title: "Unrated", Year: 2012},
+		{Title: "Inception", Year: 2010, Rating: 8.8},
+		{Title: "Undated", Rating: 7.5},
+		{Title: "Tenet", Year: 2020, Rating: 7.3},
+		{Title: "Memento", Year: 2000, Rating: 8.8},
+		{Title: "Dunkirk", Year: 2020, Rating: 7.8},
+	}
+
+	tests := []struct {
+		by   SortBy
+		want []string
+	}{
+		{SORT_BY_RELEVANCE, []string{"Unrated", "Inception", "Undated", "Tenet", "Memento", "Dunkirk"}},
+		{SORT_BY_RATING, []string{"Inception", "Memento", "Dunkirk", "Undated", "Tenet", "Unrated"}},
+		{SORT_BY_YEAR, []string{"Tenet", "Dunkirk", "Unrated", "Inception", "Memento", "Undated"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.by), func(t *testing.T) {
+			if got := titles(sortMovies(movies, tt.by)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortMovies(%q) = %q, want %q", tt.by, got, tt.want)
+			}
+		})
+	}
+
+	if movies[0].Title != "Unrated" {
+		t.Errorf("sortMovies() sorted the movies in place: %q", titles(movies))
+	}
+}
+
+func TestSortCommand(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.Source = &fakeSource{movies: map[string][]Movie{"dream": {
+		{Title: "Old", Year: 1990, EndYear: 1990, Rating: 9},
+		{Title: "New", Year: 2020, EndYear: 2020, Rating: 6},
+	}}}
+
+	postUpdate(bot, messageUpdate(1, 7, "/sort year dream"))
+	postUpdate(bot, messageUpdate(2, 7, "/sort length dream"))
+	postUpdate(bot, messageUpdate(3, 7, "/sort rating"))
+
+	texts := sentTexts(telegram.Calls())
+	want := []string{
+		"1. New (2020) (6.0)\n2. Old (1990) (9.0)\n",
+		bot.text(context.Background(), UNKNOWN_SORT_TEXT, "length"),
+		bot.text(context.Background(), SORT_USAGE_TEXT),
+	}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+}
+
+func TestSortCommandSearchOptions(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.Source = &fakeSource{movies: map[string][]Movie{"dream": {
+		{Title: "Old", Year: 1990, EndYear: 1990, Rating: 9},
+		{Title: "Bad", Year: 2021, EndYear: 2021, Rating: 4},
+		{Title: "New", Year: 2020, EndYear: 2020, Rating: 6},
+		{Title: "Newer", Year: 2022, EndYear: 2022, Rating: 7},
+	}}}
+	bot.MaxResults = 3
+	bot.Preferences = NewMemoryPreferencesStore()
+	if err := bot.Preferences.Set(8, Preferences{MinRating: 5, SortBy: SORT_BY_RATING, MaxResults: 2}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	postUpdate(bot, messageUpdate(1, 7, "/sort year dream"))
+	postUpdate(bot, messageUpdate(2, 8, "/sort year dream"))
+
+	// the sort of the command wins over the one of the preferences, their rating and number of results still apply.
+	texts := sentTexts(telegram.Calls())
+	want := []string{
+		"1. Newer (2022) (7.0)\n2. Bad (2021) (4.0)\n3. New (2020) (6.0)\n",
+		"1. Newer (2022) (7.0)\n2. New (2020) (6.0)\n",
+	}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+}
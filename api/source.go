@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Movie is a movie found by a MovieSource.
+type Movie struct {
+	Title string
+
+	// Year is the release year, zero if it's unknown. EndYear is the last year of a TV series: it is equal to Year for
+	// a single year and zero if the series is still running.
+	Year    int
+	EndYear int
+
+	// Rating is the rating out of 10, zero if the movie isn't rated yet.
+	Rating float64
+
+	// URL is the page of the movie, and PosterURL its poster image. they are empty if they are unknown.
+	URL       string
+	PosterURL string
+
+	// Genres are the genres of the movie as the source names them, e.g. "Action" or "Sci-Fi". nil if they are unknown.
+	Genres []string
+
+	// Plot is the short summary of the plot, empty if it's unknown.
+	Plot string
+
+	// Kind is the type of the title, e.g. a movie or a TV series. empty if it's unknown.
+	Kind Kind
+
+	// Rank is the position of the title on the Chart it was listed from, from 1. zero if it wasn't listed from one.
+	Rank int
+}
+
+// Kind is the type of a title.
+type Kind string
+
+// the supported Kinds.
+const (
+	KIND_MOVIE    Kind = "movie"
+	KIND_SERIES   Kind = "series"
+	KIND_SHORT    Kind = "short"
+	KIND_TV_MOVIE Kind = "tv-movie"
+	KIND_SPECIAL  Kind = "special"
+	KIND_VIDEO    Kind = "video"
+	KIND_GAME     Kind = "game"
+)
+
+// kinds are the supported Kinds, in the order they are listed to the users.
+var kinds = []Kind{KIND_MOVIE, KIND_SERIES, KIND_SHORT, KIND_TV_MOVIE, KIND_SPECIAL, KIND_VIDEO, KIND_GAME}
+
+// isKind reports whether kind is one of the supported Kinds.
+func isKind(kind Kind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Chart is a list of titles curated by the MovieSource, e.g. the best rated ones.
+type Chart string
+
+// the supported Charts. they are named after their IMDB pages.
+const (
+	CHART_TOP_250    Chart = "top"
+	CHART_MOVIEMETER Chart = "moviemeter"
+	CHART_TOP_TV     Chart = "toptv"
+	CHART_TV_METER   Chart = "tvmeter"
+	CHART_BOTTOM_100 Chart = "bottom"
+)
+
+// charts are the supported Charts, in the order they are listed to the users.
+var charts = []Chart{CHART_TOP_250, CHART_MOVIEMETER, CHART_TOP_TV, CHART_TV_METER, CHART_BOTTOM_100}
+
+// isChart reports whether chart is one of the supported Charts.
+func isChart(chart Chart) bool {
+	for _, c := range charts {
+		if c == chart {
+			return true
+		}
+	}
+	return false
+}
+
+// MovieSource finds the movies recommended to the users. the results are in order of relevance, and empty if nothing
+// matches. implementations must be safe for concurrent use.
+type MovieSource interface {
+	// Search returns the movies matching all the keywords.
+	Search(ctx context.Context, keywords []string) ([]Movie, error)
+
+	// SearchGenre returns the movies of the genre, which is one of genres.
+	SearchGenre(ctx context.Context, genre string) ([]Movie, error)
+
+	// Trending returns the movies which are popular right now, the most popular first.
+	Trending(ctx context.Context) ([]Movie, error)
+
+	// Chart returns the titles of the chart, which is one of charts, in the order of their Rank.
+	Chart(ctx context.Context, chart Chart) ([]Movie, error)
+
+	// SearchByTitle returns the titles satisfying all the params, which are valid.
+	SearchByTitle(ctx context.Context, params TitleSearchParams) ([]Movie, error)
+}
+
+// QueryBudgeter is implemented by the MovieSources which search the keywords in a query of limited length, e.g. in a
+// URL. the keywords which don't fit are left out of the searches, see Bot.trimKeywords.
+type QueryBudgeter interface {
+	// QueryBudget returns the number of characters the query escaped keywords of a Search and their separators can
+	// take.
+	QueryBudget() int
+}
+
+// TitleSearchParams are the criteria of an advanced title search. zero fields don't constrain the search.
+type TitleSearchParams struct {
+	// Genres are the genres the titles have all of, each one of genres.
+	Genres []string
+
+	// MinYear and MaxYear bound the release year of the titles, inclusively.
+	MinYear int
+	MaxYear int
+
+	// MinRating is the lowest rating of the titles, out of 10.
+	MinRating float64
+
+	// SortBy is the order of the titles. empty means SORT_BY_RELEVANCE, which is the popularity.
+	SortBy SortBy
+}
+
+// validate returns an error telling what is wrong with the params, if anything is.
+func (p TitleSearchParams) validate() error {
+	for _, genre := range p.Genres {
+		if !isGenre(genre) {
+			return fmt.Errorf("unknown genre %q", genre)
+		}
+	}
+
+	switch {
+	case p.MinYear < 0 || p.MaxYear < 0 || p.MaxYear != 0 && p.MinYear > p.MaxYear:
+		return fmt.Errorf("invalid year range %d-%d", p.MinYear, p.MaxYear)
+	case p.MinRating < 0 || p.MinRating > 10:
+		return fmt.Errorf("invalid minimum rating %g", p.MinRating)
+	case p.SortBy != "" && !isSortBy(p.SortBy):
+		return fmt.Errorf("unknown sort %q", p.SortBy)
+	}
+
+	return nil
+}
+
+// String returns the params the way /advanced takes them, e.g. "genre=horror year=2000-2010 rating=7". the zero
+// fields are left out.
+func (p TitleSearchParams) String() string {
+	var pairs []string
+	if len(p.Genres) > 0 {
+		pairs = append(pairs, "genre="+strings.Join(p.Genres, ","))
+	}
+	if p.MinYear != 0 || p.MaxYear != 0 {
+		pairs = append(pairs, "year="+yearRangeText(p.MinYear, p.MaxYear))
+	}
+	if p.MinRating > 0 {
+		pairs = append(pairs, "rating="+strconv.FormatFloat(p.MinRating, 'f', -1, 64))
+	}
+	if p.SortBy != "" {
+		pairs = append(pairs, "sort="+string(p.SortBy))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// yearRangeText formats an inclusive range of years the way parseYearRange parses it, leaving the open ends out.
+func yearRangeText(from, to int) string {
+	text := ""
+	if from != 0 {
+		text = strconv.Itoa(from)
+	}
+	if to != from {
+		text += "-"
+		if to != 0 {
+			text += strconv.Itoa(to)
+		}
+	}
+	return text
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrNoSpeechToText is returned by the SpeechToText which can't transcribe anything, see NoSpeechToText.
+var ErrNoSpeechToText = errors.New("speech to text is not supported")
+
+// SpeechToText transcribes the voice messages and the audio files sent to the bot, so they are searched like the
+// keywords of a text message. implementations must be safe for concurrent use.
+type SpeechToText interface {
+	// Transcribe returns the words spoken in the Telegram file with the ID.
+	Transcribe(ctx context.Context, fileID string) (string, error)
+}
+
+// NoSpeechToText is the SpeechToText of the bots without one: it transcribes nothing, failing with ErrNoSpeechToText,
+// so the voice messages are answered as being unsupported.
+type NoSpeechToText struct{}
+
+// Transcribe implements the SpeechToText interface.
+func (NoSpeechToText) Transcribe(ctx context.Context, fileID string) (string, error) {
+	return "", ErrNoSpeechToText
+}
+
+// TranscribeFunc transcribes the words spoken in audio, the content of a voice message or an audio file. it is
+// usually a call to a speech to text provider.
+type TranscribeFunc func(ctx context.Context, audio []byte) (string, error)
+
+// FileTranscriber returns a SpeechToText which downloads the files from Telegram with the token of the bot, up to
+// MAX_VOICE_SIZE bytes, and transcribes their content with transcribe.
+func (b *Bot) FileTranscriber(transcribe TranscribeFunc) SpeechToText {
+	return fileTranscriber{b: b, transcribe: transcribe}
+}
+
+// fileTranscriber is the SpeechToText returned by Bot.FileTranscriber.
+type fileTranscriber struct {
+	b          *Bot
+	transcribe TranscribeFunc
+}
+
+// Transcribe implements the SpeechToText interface.
+func (t fileTranscriber) Transcribe(ctx context.Context, fileID string) (string, error) {
+	audio, err := t.b.downloadFile(ctx, fileID, MAX_VOICE_SIZE)
+	if err != nil {
+		return "", err
+	}
+	return t.transcribe(ctx, audio)
+}
+
+// speechToText returns the SpeechToText of the bot, falling back to NoSpeechToText.
+func (b *Bot) speechToText() SpeechToText {
+	if b.SpeechToText == nil {
+		return NoSpeechToText{}
+	}
+	return b.SpeechToText
+}
+
+// answerVoice transcribes the voice message or the audio file of update with the SpeechToText of the bot, and answers
+// the transcript like a text message. the message is answered as unsupported if the bot has no SpeechToText.
+func (b *Bot) answerVoice(ctx context.Context, update *Update) (string, error) {
+	chatID := update.Message.Chat.ID
+	if b.Limiter != nil && !b.Limiter.Allow(chatID) {
+		b.logger(ctx).Info("chat is rate limited", "update_id", update.UpdateID, "chat_id", chatID)
+		return b.sendMessage(ctx, chatID, b.text(ctx, SLOW_DOWN_TEXT))
+	}
+
+	fileID := update.Message.Voice.FileID
+	if fileID == "" {
+		fileID = update.Message.Audio.FileID
+	}
+
+	transcript, err := b.speechToText().Transcribe(ctx, fileID)
+	switch {
+	case errors.Is(err, ErrNoSpeechToText):
+		return b.sendMessage(ctx, chatID, b.text(ctx, MEDIA_NOT_SUPPORTED_TEXT))
+	case errors.Is(err, ErrFileTooLarge):
+		return b.sendMessage(ctx, chatID, b.text(ctx, VOICE_TOO_LONG_TEXT))
+	case err != nil:
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		b.logger(ctx).Error("error transcribing the voice message", "chat_id", chatID, "file_id", fileID, "error", err)
+		return b.sendMessage(ctx, chatID, b.text(ctx, TRANSCRIPTION_FAILED_TEXT))
+	}
+
+	keywords := getKeywords(transcript)
+	b.logger(ctx).Info("transcribed the voice message", "chat_id", chatID, "keywords", keywords)
+	if len(keywords) == 0 {
+		return b.sendMessage(ctx, chatID, b.text(ctx, TRANSCRIPTION_EMPTY_TEXT))
+	}
+
+	// the transcript is searched as keywords, even if it sounds like a command.
+	return b.sendToClient(ctx, chatID, strings.Join(keywords, ", "))
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// speechFunc is a SpeechToText transcribing with the function itself.
+type speechFunc func(ctx context.Context, fileID string) (string, error)
+
+// Transcribe implements the SpeechToText interface.
+func (f speechFunc) Transcribe(ctx context.Context, fileID string) (string, error) {
+	return f(ctx, fileID)
+}
+
+// voiceUpdate returns the JSON of an update with the voice message of a private chat, as Telegram posts it.
+func voiceUpdate(updateID, chatID int, fileID string) string {
+	return fmt.Sprintf(`{"update_id": %d, "message": {"message_id": %d, "chat": {"id": %d, "type": "private"}, "voice": {"file_id": %q, "duration": 3}}}`,
+		updateID, updateID, chatID, fileID)
+}
+
+func TestVoiceMessages(t *testing.T) {
+	tests := []struct {
+		name       string
+		transcript string
+		err        error
+		want       MessageKey
+	}{
+		{name: "too long", err: fmt.Errorf("%w: %d bytes", ErrFileTooLarge, MAX_VOICE_SIZE+1), want: VOICE_TOO_LONG_TEXT},
+		{name: "failed", err: errors.New("provider is down"), want: TRANSCRIPTION_FAILED_TEXT},
+		{name: "silence", transcript: " ... ", want: TRANSCRIPTION_EMPTY_TEXT},
+		{name: "unsupported", err: ErrNoSpeechToText, want: MEDIA_NOT_SUPPORTED_TEXT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, telegram, imdb := newTestBot(t, fixtures{})
+			bot.SpeechToText = speechFunc(func(ctx context.Context, fileID string) (string, error) {
+				return tt.transcript, tt.err
+			})
+
+			postUpdate(bot, voiceUpdate(1, 7, "v"))
+
+			want := bot.text(context.Background(), tt.want)
+			if sent := sentTexts(telegram.Calls()); len(sent) != 1 || sent[0] != want {
+				t.Errorf("sent %q, want %q", sent, want)
+			}
+			if requests := imdb.Requests(); len(requests) != 0 {
+				t.Errorf("searched %q without a transcript", requests)
+			}
+		})
+	}
+}
+
+func TestVoiceMessageSearchesTranscript(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	source := &fakeSource{movies: map[string][]Movie{"help dream heist": {{Title: "Inception", Year: 2010, EndYear: 2010, Rating: 8.8}}}}
+	bot.Source = source
+
+	transcripts := map[string]string{"v": "/help Dream heist", "a": "zombie, Space!"}
+	bot.SpeechToText = speechFunc(func(ctx context.Context, fileID string) (string, error) {
+		return transcripts[fileID], nil
+	})
+
+	postUpdate(bot, voiceUpdate(1, 7, "v"))
+	postUpdate(bot, `{"update_id": 2, "message": {"message_id": 2, "chat": {"id": 7, "type": "private"}, "audio": {"file_id": "a", "duration": 120}}}`)
+
+	// the transcript is searched even though it starts like a command.
+	want := [][]string{{"help dream heist"}, {"zombie", "space"}}
+	if searches := source.Searches(); !reflect.DeepEqual(searches, want) {
+		t.Errorf("searched %q, want %q", searches, want)
+	}
+	if sent := sentTexts(telegram.Calls()); len(sent) != 2 || sent[0] != "1. Inception (2010) (8.8)\n" {
+		t.Errorf("sent %q, want the movies of the transcript first", sent)
+	}
+}
+
+func TestFileTranscriber(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	telegram.Respond(func(call telegramCall) (int, string) {
+		switch call.Method {
+		case TELEGRAM_API_GET_FILE:
+			return http.StatusOK, `{"ok":true,"result":{"file_id":"v","file_size":4,"file_path":"voice/file_1.oga"}}`
+		case "/file/bot" + TEST_BOT_TOKEN + "/voice/file_1.oga":
+			return http.StatusOK, "OggS"
+		}
+		return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+	})
+
+	var audio []byte
+	stt := bot.FileTranscriber(func(ctx context.Context, content []byte) (string, error) {
+		audio = content
+		return "heist", nil
+	})
+
+	transcript, err := stt.Transcribe(context.Background(), "v")
+	if err != nil || transcript != "heist" {
+		t.Fatalf("Transcribe() = %q, %v, want heist", transcript, err)
+	}
+	if string(audio) != "OggS" {
+		t.Errorf("transcribed %q, want the downloaded file", audio)
+	}
+	if calls := telegram.CallsOf(TELEGRAM_API_GET_FILE); len(calls) != 1 || calls[0].Values.Get("file_id") != "v" {
+		t.Errorf("getFile calls = %v, want one of the file v", calls)
+	}
+}
+
+func TestFileTranscriberTooLarge(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	telegram.Respond(func(call telegramCall) (int, string) {
+		return http.StatusOK, fmt.Sprintf(`{"ok":true,"result":{"file_id":"v","file_size":%d,"file_path":"voice/file_1.oga"}}`, MAX_VOICE_SIZE+1)
+	})
+
+	stt := bot.FileTranscriber(func(ctx context.Context, content []byte) (string, error) {
+		t.Error("transcribed a file larger than MAX_VOICE_SIZE")
+		return "", nil
+	})
+
+	if _, err := stt.Transcribe(context.Background(), "v"); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Transcribe() error = %v, want %v", err, ErrFileTooLarge)
+	}
+	if calls := telegram.Calls(); len(calls) != 1 {
+		t.Errorf("made %d calls, want getFile only: %v", len(calls), calls)
+	}
+}
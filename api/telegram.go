@@ -0,0 +1,377 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errUnparsableEntities is returned by the Telegram API calls whose text Telegram couldn't parse in its parse mode.
+var errUnparsableEntities = errors.New("telegram can't parse the entities of the text")
+
+// errReplyNotFound is returned by the Telegram API calls replying to a message which doesn't exist anymore.
+var errReplyNotFound = errors.New("the message to reply to is not found")
+
+// ErrBotBlocked is returned by the Telegram API calls made to a chat whose user has blocked the bot.
+var ErrBotBlocked = errors.New("the bot was blocked by the user")
+
+// TelegramResponse is the object Telegram answers every Bot API call with.
+type TelegramResponse struct {
+	Ok          bool                `json:"ok"`
+	Description string              `json:"description"`
+	ErrorCode   int                 `json:"error_code"`
+	Result      json.RawMessage     `json:"result"`
+	Parameters  *ResponseParameters `json:"parameters"`
+}
+
+// ResponseParameters describes why a Telegram API call was unsuccessful.
+type ResponseParameters struct {
+	RetryAfter int `json:"retry_after"`
+}
+
+// InlineKeyboardMarkup is a Telegram object describing the buttons shown under a message.
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+// InlineKeyboardButton is a button of an InlineKeyboardMarkup. tapping it sends a CallbackQuery carrying CallbackData.
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+// sendMessage posts a single text message, formatted in the ParseMode of the bot, to the chat and returns the body of
+// the telegram response.
+func (b *Bot) sendMessage(ctx context.Context, chatID int, text string) (string, error) {
+	return b.sendMessageWithMarkup(ctx, chatID, text, nil)
+}
+
+// sendMessageWithMarkup is like sendMessage, and shows the inline keyboard under the message unless markup is nil.
+func (b *Bot) sendMessageWithMarkup(ctx context.Context, chatID int, text string, markup *InlineKeyboardMarkup) (string, error) {
+	sendValues := url.Values{"chat_id": {strconv.Itoa(chatID)}, "text": {text}}
+	if b.ParseMode != PARSE_MODE_NONE {
+		sendValues.Set("parse_mode", string(b.ParseMode))
+	}
+	b.setDeliveryOptions(ctx, chatID, sendValues)
+	if !b.LinkPreviews {
+		sendValues.Set("disable_web_page_preview", "true")
+	}
+
+	if markup != nil {
+		replyMarkup, err := json.Marshal(markup)
+		if err != nil {
+			return "", err
+		}
+		sendValues.Set("reply_markup", string(replyMarkup))
+	}
+
+	return b.sendFormatted(ctx, TELEGRAM_API_SEND_MESSAGE, sendValues, "text")
+}
+
+// editMessage replaces the text of a message the bot sent to the chat, formatted in the ParseMode of the bot, and its
+// inline keyboard, which is removed if markup is nil. it returns the body of the telegram response.
+func (b *Bot) editMessage(ctx context.Context, chatID, messageID int, text string, markup *InlineKeyboardMarkup) (string, error) {
+	editValues := url.Values{"chat_id": {strconv.Itoa(chatID)}, "message_id": {strconv.Itoa(messageID)}, "text": {text}}
+	if b.ParseMode != PARSE_MODE_NONE {
+		editValues.Set("parse_mode", string(b.ParseMode))
+	}
+	if !b.LinkPreviews {
+		editValues.Set("disable_web_page_preview", "true")
+	}
+
+	if markup != nil {
+		replyMarkup, err := json.Marshal(markup)
+		if err != nil {
+			return "", err
+		}
+		editValues.Set("reply_markup", string(replyMarkup))
+	}
+
+	return b.sendFormatted(ctx, TELEGRAM_API_EDIT_MESSAGE_TEXT, editValues, "text")
+}
+
+// sendFormatted calls the Telegram API method sending the formatted text in the field of values, e.g. "text". if
+// Telegram can't parse the formatting, despite the escaping, the text is sent again as plain text, so the user still
+// gets it. the text replying to a message which was deleted meanwhile is sent again without replying to it. every call
+// waits for its turn in the Sends queue of the bot, see queuedCall.
+func (b *Bot) sendFormatted(ctx context.Context, method string, values url.Values, field string) (string, error) {
+	start := time.Now()
+	body, err := b.queuedCall(ctx, method, values)
+	if errors.Is(err, errReplyNotFound) && values.Get("reply_to_message_id") != "" {
+		b.logger(ctx).Info("the message to reply to is deleted, sending the message without replying", "method", method, "response_body", body)
+
+		values.Del("reply_to_message_id")
+		body, err = b.queuedCall(ctx, method, values)
+	}
+	if errors.Is(err, errUnparsableEntities) && values.Get("parse_mode") != "" {
+		b.logger(ctx).Error("telegram couldn't parse the formatted message, sending it as plain text", "method", method, "error", err, "response_body", body)
+
+		mode := ParseMode(values.Get("parse_mode"))
+		values.Del("parse_mode")
+		values.Set(field, plainText(mode, values.Get(field)))
+		body, err = b.queuedCall(ctx, method, values)
+	}
+	b.metrics().TelegramSendDone(time.Since(start), err)
+
+	return body, err
+}
+
+// queuedCall calls the Telegram API method sending a message with values, every attempt waiting for its turn in the
+// Sends queue of the bot, or right away if the bot has none. the retries of a chat Telegram throttles are queued
+// again once their delay is over, instead of holding up the queue.
+func (b *Bot) queuedCall(ctx context.Context, method string, values url.Values) (string, error) {
+	return b.retryCall(ctx, method, values, b.Sends != nil)
+}
+
+// setDeliveryOptions sets the options of the messages the bot sends to the chat to values: they are delivered
+// silently if the bot is Silent, in the forum topic of ctx if there is one, see threadFrom, and quoting the message
+// of ctx they answer if the Quotes of the bot quote it.
+func (b *Bot) setDeliveryOptions(ctx context.Context, chatID int, values url.Values) {
+	if b.Silent {
+		values.Set("disable_notification", "true")
+	}
+	setThread(ctx, chatID, values)
+	if message, ok := quotedFrom(ctx, chatID); ok && b.Quotes.quotes(message.Chat) {
+		values.Set("reply_to_message_id", strconv.Itoa(message.MessageID))
+	}
+}
+
+// setThread sets the forum topic of ctx the chat is answered in to values, if there is one.
+func setThread(ctx context.Context, chatID int, values url.Values) {
+	if threadID := threadFrom(ctx, chatID); threadID != 0 {
+		values.Set("message_thread_id", strconv.Itoa(threadID))
+	}
+}
+
+// sendPhoto sends the image at photoURL to the chat with caption, formatted in the parse mode of the bot. it returns
+// the body of the telegram response.
+func (b *Bot) sendPhoto(ctx context.Context, chatID int, photoURL, caption string) (string, error) {
+	sendValues := url.Values{"chat_id": {strconv.Itoa(chatID)}, "photo": {photoURL}}
+	b.setDeliveryOptions(ctx, chatID, sendValues)
+	if caption != "" {
+		sendValues.Set("caption", caption)
+		if b.ParseMode != PARSE_MODE_NONE {
+			sendValues.Set("parse_mode", string(b.ParseMode))
+		}
+	}
+
+	return b.sendFormatted(ctx, TELEGRAM_API_SEND_PHOTO, sendValues, "caption")
+}
+
+// sendChatAction shows the action, e.g. CHAT_ACTION_TYPING, to the users of the chat until the bot sends a message,
+// or for at most five seconds. it returns the body of the telegram response.
+func (b *Bot) sendChatAction(ctx context.Context, chatID int, action string) (string, error) {
+	values := url.Values{"chat_id": {strconv.Itoa(chatID)}, "action": {action}}
+	setThread(ctx, chatID, values)
+	return b.callAPI(ctx, TELEGRAM_API_SEND_CHAT_ACTION, values)
+}
+
+// answerCallbackQuery tells Telegram the callback query is handled, showing text to the user unless it's empty.
+func (b *Bot) answerCallbackQuery(ctx context.Context, queryID, text string) (string, error) {
+	values := url.Values{"callback_query_id": {queryID}}
+	if text != "" {
+		values.Set("text", text)
+	}
+	return b.callAPI(ctx, TELEGRAM_API_ANSWER_CALLBACK_QUERY, values)
+}
+
+// callAPI posts values to the given Telegram Bot API method and returns the body of the telegram response. 429 and 5xx
+// responses are retried with exponential backoff, honoring the retry_after Telegram asks for. an error carrying the
+// description is returned if Telegram reports ok:false. nothing is posted once ctx is done, nor if ctx previews the
+// answer of an update: the call is recorded instead, as if it succeeded.
+func (b *Bot) callAPI(ctx context.Context, method string, values url.Values) (string, error) {
+	return b.retryCall(ctx, method, values, false)
+}
+
+// retryCall is callAPI, and if queued, every attempt of the call waits for its turn in the Sends queue of the bot. the
+// delays between the attempts are waited out of the queue, so the other chats are sent their messages meanwhile.
+func (b *Bot) retryCall(ctx context.Context, method string, values url.Values, queued bool) (string, error) {
+	if p := previewFrom(ctx); p != nil {
+		p.record(method, values)
+		return PREVIEW_RESPONSE_BODY, nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		var result apiResult
+		if queued {
+			result = b.queuedPost(ctx, method, values)
+		} else {
+			result = b.post(ctx, method, values)
+		}
+		if result.err != nil {
+			return "", result.err
+		}
+		body, telegramResponse := result.body, result.response
+
+		if telegramResponse.unparsable() {
+			return body, fmt.Errorf("%w: telegram %s failed with error code %d: %s", errUnparsableEntities, method, telegramResponse.ErrorCode, telegramResponse.Description)
+		}
+
+		if telegramResponse.replyNotFound() {
+			return body, fmt.Errorf("%w: telegram %s failed with error code %d: %s", errReplyNotFound, method, telegramResponse.ErrorCode, telegramResponse.Description)
+		}
+
+		if telegramResponse.blocked() {
+			b.blocked(ctx, values)
+			return body, fmt.Errorf("%w: telegram %s failed with error code %d: %s", ErrBotBlocked, method, telegramResponse.ErrorCode, telegramResponse.Description)
+		}
+
+		retryable := result.status == http.StatusTooManyRequests || result.status >= 500
+		if !retryable || attempt >= b.maxRetries() {
+			if !telegramResponse.Ok {
+				return body, fmt.Errorf("telegram %s failed with error code %d: %s", method, telegramResponse.ErrorCode, telegramResponse.Description)
+			}
+			return body, nil
+		}
+
+		delay := retryDelay(attempt, b.retryBaseDelay(), telegramResponse.Parameters)
+		b.logger(ctx).Info("retrying telegram call", "method", method, "status", result.status, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return body, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// apiResult is the outcome of a single attempt of a Telegram API call. err is only set if no response was read.
+type apiResult struct {
+	status   int
+	body     string
+	response TelegramResponse
+	err      error
+}
+
+// post posts values to the Telegram Bot API method once, and decodes the telegram response. the responses which
+// aren't JSON are described by their status code.
+func (b *Bot) post(ctx context.Context, method string, values url.Values) apiResult {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, b.apiURL(method), strings.NewReader(values.Encode()))
+	if err != nil {
+		return apiResult{err: b.redact(err)}
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := b.client().Do(request)
+	if err != nil {
+		return apiResult{err: b.redact(err)}
+	}
+
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return apiResult{err: fmt.Errorf("reading telegram response: %w", err)}
+	}
+
+	b.logger(ctx).Info("telegram responded", "method", method, "status", response.StatusCode, "body", string(body))
+
+	result := apiResult{status: response.StatusCode, body: string(body)}
+	if err := json.Unmarshal(body, &result.response); err != nil {
+		b.logger(ctx).Error("could not decode telegram response", "method", method, "error", err)
+		result.response.ErrorCode = response.StatusCode
+		result.response.Description = http.StatusText(response.StatusCode)
+	}
+	return result
+}
+
+// queuedPost is post, once it's the turn of the call in the Sends queue of the bot. the result is passed back over a
+// channel, since the queue returns as soon as ctx is done, while the post may still be running.
+func (b *Bot) queuedPost(ctx context.Context, method string, values url.Values) apiResult {
+	chatID, _ := strconv.Atoi(values.Get("chat_id"))
+	results := make(chan apiResult, 1)
+	_, err := b.Sends.Do(ctx, chatID, func() (string, error) {
+		result := b.post(ctx, method, values)
+		results <- result
+		return result.body, result.err
+	})
+
+	select {
+	case result := <-results:
+		return result
+	default:
+		return apiResult{err: err}
+	}
+}
+
+// blocked reports whether the call failed because the user has blocked the bot.
+func (r TelegramResponse) blocked() bool {
+	return r.ErrorCode == http.StatusForbidden && strings.Contains(r.Description, TELEGRAM_BLOCKED_DESCRIPTION)
+}
+
+// unparsable reports whether the call failed because Telegram couldn't parse the formatting of the text.
+func (r TelegramResponse) unparsable() bool {
+	return r.ErrorCode == http.StatusBadRequest && strings.Contains(r.Description, TELEGRAM_UNPARSABLE_DESCRIPTION)
+}
+
+// replyNotFound reports whether the call failed because the message it replies to doesn't exist.
+func (r TelegramResponse) replyNotFound() bool {
+	return r.ErrorCode == http.StatusBadRequest && strings.Contains(r.Description, TELEGRAM_REPLY_NOT_FOUND_DESCRIPTION)
+}
+
+// blocked tells the OnBlocked callback of the bot the chat of a call, made with values, has blocked the bot.
+func (b *Bot) blocked(ctx context.Context, values url.Values) {
+	chatID, err := strconv.Atoi(values.Get("chat_id"))
+	if err != nil {
+		return
+	}
+
+	b.logger(ctx).Info("the bot was blocked by the user", "chat_id", chatID)
+	if b.OnBlocked != nil {
+		b.OnBlocked(ctx, chatID)
+	}
+}
+
+// redact removes the bot token from the errors of the http package, which carry the URL of the request, so the token
+// never ends up in the logs.
+func (b *Bot) redact(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		redacted := *urlErr
+		redacted.URL = strings.ReplaceAll(urlErr.URL, b.token, "<token>")
+		return &redacted
+	}
+	return err
+}
+
+// maxRetries returns the number of retries of a Telegram API call, falling back to DEFAULT_MAX_RETRIES.
+func (b *Bot) maxRetries() int {
+	switch {
+	case b.MaxRetries < 0:
+		return 0
+	case b.MaxRetries == 0:
+		return DEFAULT_MAX_RETRIES
+	}
+	return b.MaxRetries
+}
+
+// retryBaseDelay returns the delay before the first retry, falling back to DEFAULT_RETRY_BASE_DELAY.
+func (b *Bot) retryBaseDelay() time.Duration {
+	if b.RetryBaseDelay <= 0 {
+		return DEFAULT_RETRY_BASE_DELAY
+	}
+	return b.RetryBaseDelay
+}
+
+// retryDelay returns how long to wait before retrying a failed Telegram API call. if Telegram asked for a retry_after,
+// it is used as is. otherwise the delay is base doubled for every previous attempt, plus up to base of random jitter.
+func retryDelay(attempt int, base time.Duration, parameters *ResponseParameters) time.Duration {
+	if parameters != nil && parameters.RetryAfter > 0 {
+		return time.Duration(parameters.RetryAfter) * time.Second
+	}
+
+	return base<<attempt + time.Duration(rand.Int63n(int64(base)))
+}
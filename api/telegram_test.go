@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCallAPIRetriesTransientFailures(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+
+	var mu sync.Mutex
+	attempts := 0
+	telegram.Respond(func(telegramCall) (int, string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		switch attempts {
+		case 1:
+			return http.StatusInternalServerError, `{"ok":false,"error_code":500,"description":"Internal Server Error"}`
+		case 2:
+			return http.StatusTooManyRequests, `{"ok":false,"error_code":429,"description":"Too Many Requests"}`
+		}
+		return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+	})
+
+	if _, err := bot.sendMessage(context.Background(), 7, "hello"); err != nil {
+		t.Fatalf("sendMessage() error = %v, want the third attempt to succeed", err)
+	}
+	if calls := len(telegram.Calls()); calls != 3 {
+		t.Errorf("made %d attempts, want 3", calls)
+	}
+}
+
+func TestCallAPIGivesUpAfterMaxRetries(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+	bot.MaxRetries = 2
+	telegram.Respond(func(telegramCall) (int, string) {
+		return http.StatusBadGateway, `{"ok":false,"error_code":502,"description":"Bad Gateway"}`
+	})
+
+	if _, err := bot.sendMessage(context.Background(), 7, "hello"); err == nil {
+		t.Fatal("sendMessage() error = nil, want the last failure")
+	}
+	if calls := len(telegram.Calls()); calls != 3 {
+		t.Errorf("made %d attempts, want the first one and 2 retries", calls)
+	}
+}
+
+func TestCallAPIDoesNotRetryClientErrors(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+	telegram.Respond(func(telegramCall) (int, string) {
+		return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+	})
+
+	if _, err := bot.sendMessage(context.Background(), 7, "hello"); err == nil {
+		t.Fatal("sendMessage() error = nil for a 400")
+	}
+	if calls := len(telegram.Calls()); calls != 1 {
+		t.Errorf("made %d attempts, want a 400 not retried", calls)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	const base = 100 * time.Millisecond
+
+	if d := retryDelay(0, base, &ResponseParameters{RetryAfter: 3}); d != 3*time.Second {
+		t.Errorf("retryDelay() = %v, want the retry_after of 3s", d)
+	}
+	for attempt := 0; attempt < 4; attempt++ {
+		min := base << attempt
+		for i := 0; i < 20; i++ {
+			if d := retryDelay(attempt, base, nil); d < min || d >= min+base {
+				t.Fatalf("retryDelay(%d) = %v, want from %v up to %v", attempt, d, min, min+base)
+			}
+		}
+	}
+}
+
+func TestCallAPIResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "ok", status: http.StatusOK, body: `{"ok":true,"result":{"message_id":1}}`},
+		{name: "not ok", status: http.StatusBadRequest, body: `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`, wantErr: "error code 400: Bad Request: chat not found"},
+		{name: "not ok with 200", status: http.StatusOK, body: `{"ok":false,"error_code":400,"description":"Bad Request: message text is empty"}`, wantErr: "message text is empty"},
+		{name: "not json", status: http.StatusNotFound, body: `<html>not found</html>`, wantErr: "error code 404: Not Found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, telegram, _ := newTestBot(t, fixtures{})
+			telegram.Respond(func(telegramCall) (int, string) { return tt.status, tt.body })
+
+			body, err := bot.callAPI(context.Background(), TELEGRAM_API_SEND_MESSAGE, url.Values{"chat_id": {"7"}, "text": {"hi"}})
+			if body != tt.body {
+				t.Errorf("callAPI() body = %q, want %q", body, tt.body)
+			}
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("callAPI() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("callAPI() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEditMessage(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+	bot.ParseMode = PARSE_MODE_HTML
+	ctx := context.Background()
+
+	markup := &InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{{Text: "Show more", CallbackData: "more:dream:2"}}}}
+	if _, err := bot.editMessage(ctx, 7, 10, "<b>page</b>", markup); err != nil {
+		t.Fatalf("editMessage() error = %v", err)
+	}
+	if _, err := bot.editMessage(ctx, 7, 10, "last page", nil); err != nil {
+		t.Fatalf("editMessage() without markup error = %v", err)
+	}
+
+	edited := telegram.CallsOf(TELEGRAM_API_EDIT_MESSAGE_TEXT)
+	if len(edited) != 2 {
+		t.Fatalf("edited %d messages, want 2", len(edited))
+	}
+	first := edited[0].Values
+	if first.Get("chat_id") != "7" || first.Get("message_id") != "10" || first.Get("text") != "<b>page</b>" || first.Get("parse_mode") != string(PARSE_MODE_HTML) {
+		t.Errorf("edited with %v, want the text of message 10 of chat 7 in HTML", first)
+	}
+	if data := callbackData(t, first); len(data) != 1 || data[0] != "more:dream:2" {
+		t.Errorf("edited the buttons to %q, want the Show more button", data)
+	}
+	if markup := edited[1].Values.Get("reply_markup"); markup != "" {
+		t.Errorf("edited the buttons to %q, want them removed", markup)
+	}
+}
+
+func TestSendOptions(t *testing.T) {
+	tests := []struct {
+		linkPreviews, silent       bool
+		wantNoPreview, wantNoNotif string
+	}{
+		{false, false, "true", ""},
+		{true, false, "", ""},
+		{false, true, "true", "true"},
+		{true, true, "", "true"},
+	}
+
+	for _, tt := range tests {
+		bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+		if bot.LinkPreviews || bot.Silent {
+			t.Errorf("LinkPreviews, Silent of the default bot = %t, %t, want the previews disabled and the notifications sent", bot.LinkPreviews, bot.Silent)
+		}
+		bot.LinkPreviews, bot.Silent = tt.linkPreviews, tt.silent
+		ctx := context.Background()
+
+		postUpdate(bot, messageUpdate(1, 7, "dream"))
+		if _, err := bot.sendPhoto(ctx, 7, "https://example.com/poster.jpg", "Inception"); err != nil {
+			t.Fatalf("sendPhoto() error = %v", err)
+		}
+
+		calls := telegram.Calls()
+		if len(calls) != 2 {
+			t.Fatalf("called %v, want the movies and the photo sent", calls)
+		}
+		for _, call := range calls {
+			if got := call.Values.Get("disable_notification"); got != tt.wantNoNotif {
+				t.Errorf("%s of a bot with Silent %t disable_notification = %q, want %q", call.Method, tt.silent, got, tt.wantNoNotif)
+			}
+		}
+		if got := calls[0].Values.Get("disable_web_page_preview"); got != tt.wantNoPreview {
+			t.Errorf("sendMessage of a bot with LinkPreviews %t disable_web_page_preview = %q, want %q", tt.linkPreviews, got, tt.wantNoPreview)
+		}
+	}
+}
+
+func TestBotBlocked(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{KEYWORD_SEARCH_FIXTURE: "search.html"})
+	var mu sync.Mutex
+	var blocked []int
+	bot.OnBlocked = func(ctx context.Context, chatID int) {
+		mu.Lock()
+		defer mu.Unlock()
+		blocked = append(blocked, chatID)
+	}
+	telegram.Respond(func(telegramCall) (int, string) {
+		return http.StatusForbidden, `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`
+	})
+
+	if _, err := bot.sendMessage(context.Background(), 7, "hi"); !errors.Is(err, ErrBotBlocked) {
+		t.Errorf("sendMessage() error = %v, want %v", err, ErrBotBlocked)
+	}
+	if rec := postUpdate(bot, messageUpdate(1, 8, "dream")); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d, since Telegram delivering the update again wouldn't help", rec.Code, http.StatusOK)
+	}
+
+	if want := []int{7, 8}; !reflect.DeepEqual(blocked, want) {
+		t.Errorf("OnBlocked got the chats %v, want %v", blocked, want)
+	}
+	if calls := telegram.Calls(); len(calls) != 2 {
+		t.Errorf("called %d times, want the blocked calls not retried", len(calls))
+	}
+
+	telegram.Respond(func(telegramCall) (int, string) {
+		return http.StatusForbidden, `{"ok":false,"error_code":403,"description":"Forbidden: bot was kicked from the group chat"}`
+	})
+	if _, err := bot.sendMessage(context.Background(), 9, "hi"); err == nil || errors.Is(err, ErrBotBlocked) {
+		t.Errorf("sendMessage() of another 403 error = %v, want an error which isn't %v", err, ErrBotBlocked)
+	}
+	if len(blocked) != 2 {
+		t.Errorf("OnBlocked got the chats %v, want it not called for another 403", blocked)
+	}
+}
+
+func TestSendFormattedFallsBackToPlainText(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.ParseMode = PARSE_MODE_MARKDOWN_V2
+	telegram.Respond(func(call telegramCall) (int, string) {
+		if call.Values.Get("parse_mode") != "" {
+			return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities: Character '.' is reserved and must be escaped with the preceding '\\'"}`
+		}
+		return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+	})
+
+	if _, err := bot.sendMessage(context.Background(), 7, `*Inception* \(2010\)`); err != nil {
+		t.Fatalf("sendMessage() error = %v", err)
+	}
+	if _, err := bot.sendPhoto(context.Background(), 7, "https://example.com/poster.jpg", `*Inception*`); err != nil {
+		t.Fatalf("sendPhoto() error = %v", err)
+	}
+
+	calls := telegram.Calls()
+	if len(calls) != 4 {
+		t.Fatalf("made %d calls, want each send retried once as plain text: %v", len(calls), calls)
+	}
+	if got := calls[1].Values; got.Get("parse_mode") != "" || got.Get("text") != "Inception (2010)" {
+		t.Errorf("sent the message again with %v, want it as plain text", got)
+	}
+	if got := calls[3].Values; got.Get("parse_mode") != "" || got.Get("caption") != "Inception" {
+		t.Errorf("sent the photo again with %v, want its caption as plain text", got)
+	}
+}
+
+func TestSendFormattedOtherErrors(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.ParseMode = PARSE_MODE_HTML
+	telegram.Respond(func(telegramCall) (int, string) {
+		return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+	})
+
+	if _, err := bot.sendMessage(context.Background(), 7, "<b>Inception</b>"); err == nil {
+		t.Error("sendMessage() error = nil, want the chat not found error")
+	}
+	if calls := telegram.Calls(); len(calls) != 1 {
+		t.Errorf("made %d calls, want the message not sent again as plain text", len(calls))
+	}
+}
+
+func TestQueuedCallRetryDoesNotStallOtherChats(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+	bot.Sends = NewSendQueue(100)
+
+	var mu sync.Mutex
+	throttled := false
+	sent := make(map[string]time.Time)
+	telegram.Respond(func(call telegramCall) (int, string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		chatID := call.Values.Get("chat_id")
+		if chatID == "1" && !throttled {
+			throttled = true
+			return http.StatusTooManyRequests, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`
+		}
+		sent[chatID] = time.Now()
+		return http.StatusOK, `{"ok":true,"result":{"message_id":1}}`
+	})
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, chatID := range []int{1, 2} {
+		wg.Add(1)
+		go func(chatID int) {
+			defer wg.Done()
+			if _, err := bot.sendMessage(context.Background(), chatID, "hello"); err != nil {
+				t.Errorf("sendMessage(%d) error = %v", chatID, err)
+			}
+		}(chatID)
+		// chat 1 is queued first, so it's throttled before chat 2 is sent its message.
+		waitFor(t, func() bool { return len(telegram.Calls()) > 0 })
+	}
+	wg.Wait()
+
+	if elapsed := sent["2"].Sub(start); elapsed >= time.Second {
+		t.Errorf("chat 2 was sent its message after %v, it waited for the retry of chat 1", elapsed)
+	}
+	if elapsed := sent["1"].Sub(start); elapsed < time.Second {
+		t.Errorf("chat 1 was sent its message after %v, before the retry_after of 1s", elapsed)
+	}
+}
+
+func TestCallAPICanceledContext(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, fixtures{})
+	bot.Sends = NewSendQueue(DEFAULT_SEND_RATE)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bot.sendMessage(ctx, 1, "hello"); err != context.Canceled {
+		t.Errorf("sendMessage() error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := bot.callAPI(ctx, TELEGRAM_API_SEND_CHAT_ACTION, nil); err != context.Canceled {
+		t.Errorf("callAPI() error = %v, want %v", err, context.Canceled)
+	}
+	if calls := telegram.Calls(); len(calls) != 0 {
+		t.Errorf("made %d calls with a canceled context, want none", len(calls))
+	}
+}
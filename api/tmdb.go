@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// TMDBSource is a MovieSource which finds the movies with the API of The Movie Database.
+type TMDBSource struct {
+	// BaseURL is the URL of the TMDB API, which can be changed e.g. in tests.
+	BaseURL string
+
+	// APIKey is the TMDB API key the requests are authenticated with.
+	APIKey string
+
+	// Client makes the requests to TMDB. nil uses a client shared with the bots.
+	Client *http.Client
+}
+
+// NewTMDBSource returns a TMDBSource for api.themoviedb.org using the given API key.
+func NewTMDBSource(apiKey string) *TMDBSource {
+	return &TMDBSource{
+		BaseURL: TMDB_API_BASE_URL,
+		APIKey:  apiKey,
+	}
+}
+
+// tmdbGenreIDs maps the genres to the ids of the TMDB movie genres. the genres TMDB doesn't have are missing.
+var tmdbGenreIDs = map[string]int{
+	"action": 28, "adventure": 12, "animation": 16, "comedy": 35, "crime": 80, "documentary": 99, "drama": 18,
+	"family": 10751, "fantasy": 14, "history": 36, "horror": 27, "music": 10402, "mystery": 9648, "romance": 10749,
+	"sci-fi": 878, "thriller": 53, "war": 10752, "western": 37,
+}
+
+// tmdbMovie is a movie of the TMDB search and discover responses.
+type tmdbMovie struct {
+	ID          int     `json:"id"`
+	Title       string  `json:"title"`
+	ReleaseDate string  `json:"release_date"`
+	VoteAverage float64 `json:"vote_average"`
+	VoteCount   int     `json:"vote_count"`
+	PosterPath  string  `json:"poster_path"`
+	GenreIDs    []int   `json:"genre_ids"`
+	Overview    string  `json:"overview"`
+}
+
+// movie converts m to a Movie. movies nobody has voted for are unrated. the movie endpoints of TMDB list nothing but
+// movies, the series have endpoints of their own.
+func (m tmdbMovie) movie() Movie {
+	movie := Movie{
+		Title: m.Title,
+		URL:   TMDB_MOVIE_BASE_URL + strconv.Itoa(m.ID),
+		Plot:  m.Overview,
+		Kind:  KIND_MOVIE,
+	}
+
+	if len(m.ReleaseDate) >= 4 {
+		if year, err := strconv.Atoi(m.ReleaseDate[:4]); err == nil {
+			movie.Year, movie.EndYear = year, year
+		}
+	}
+
+	if m.VoteCount > 0 {
+		movie.Rating = m.VoteAverage
+	}
+
+	if m.PosterPath != "" {
+		movie.PosterURL = TMDB_IMAGE_BASE_URL + m.PosterPath
+	}
+
+	for _, id := range m.GenreIDs {
+		if genre, ok := tmdbGenreName(id); ok {
+			movie.Genres = append(movie.Genres, genre)
+		}
+	}
+
+	return movie
+}
+
+// tmdbGenreName returns the name of the TMDB genre id, capitalized like the IMDB genres, e.g. "Sci-Fi". ok is false
+// for the genres missing from tmdbGenreIDs.
+func tmdbGenreName(id int) (name string, ok bool) {
+	for genre, genreID := range tmdbGenreIDs {
+		if genreID == id {
+			parts := strings.Split(genre, "-")
+			for i, part := range parts {
+				parts[i] = strings.ToUpper(part[:1]) + part[1:]
+			}
+			return strings.Join(parts, "-"), true
+		}
+	}
+	return "", false
+}
+
+// tmdbMovies is the response of the TMDB discover endpoint.
+type tmdbMovies struct {
+	Results []tmdbMovie `json:"results"`
+}
+
+// tmdbKeywords is the response of the TMDB keyword search.
+type tmdbKeywords struct {
+	Results []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"results"`
+}
+
+// tmdbError is the body of the TMDB error responses.
+type tmdbError struct {
+	StatusMessage string `json:"status_message"`
+}
+
+// Search implements the MovieSource interface. every keyword is looked up with the TMDB keyword search, and the
+// movies tagged with all of them are discovered, the most popular first.
+func (s *TMDBSource) Search(ctx context.Context, keywords []string) ([]Movie, error) {
+	if len(keywords) == 0 {
+		return nil, fmt.Errorf("%w: no keywords to search", ErrInvalidKeywords)
+	}
+
+	ids := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		id, ok, err := s.keywordID(ctx, keyword)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, nil
+		}
+		ids[i] = strconv.Itoa(id)
+	}
+
+	return s.discover(ctx, url.Values{"with_keywords": {strings.Join(ids, ",")}})
+}
+
+// SearchGenre implements the MovieSource interface. it discovers the most popular movies of the genre.
+func (s *TMDBSource) SearchGenre(ctx context.Context, genre string) ([]Movie, error) {
+	id, ok := tmdbGenreIDs[genre]
+	if !ok {
+		return nil, fmt.Errorf("genre %q is not supported by TMDB", genre)
+	}
+
+	return s.discover(ctx, url.Values{"with_genres": {strconv.Itoa(id)}})
+}
+
+// Trending implements the MovieSource interface. it returns the movies trending on TMDB this week.
+func (s *TMDBSource) Trending(ctx context.Context) ([]Movie, error) {
+	return s.movies(ctx, "/trending/movie/week", url.Values{})
+}
+
+// tmdbChartPaths are the TMDB endpoints listing the charts TMDB has.
+var tmdbChartPaths = map[Chart]string{
+	CHART_TOP_250:    "/movie/top_rated",
+	CHART_MOVIEMETER: "/movie/popular",
+}
+
+// Chart implements the MovieSource interface. TMDB has the best rated and the most popular movies only, ranked in the
+// order TMDB lists them.
+func (s *TMDBSource) Chart(ctx context.Context, chart Chart) ([]Movie, error) {
+	path, ok := tmdbChartPaths[chart]
+	if !ok {
+		return nil, fmt.Errorf("chart %q is not supported by TMDB", chart)
+	}
+
+	movies, err := s.movies(ctx, path, url.Values{})
+	for i := range movies {
+		movies[i].Rank = i + 1
+	}
+	return movies, err
+}
+
+// keywordID returns the id of the TMDB keyword named keyword, or of the first keyword found if none has exactly that
+// name. ok is false if TMDB knows no such keyword.
+func (s *TMDBSource) keywordID(ctx context.Context, keyword string) (id int, ok bool, err error) {
+	var keywords tmdbKeywords
+	if err := s.get(ctx, "/search/keyword", url.Values{"query": {keyword}}, &keywords); err != nil {
+		return 0, false, err
+	}
+
+	if len(keywords.Results) == 0 {
+		return 0, false, nil
+	}
+
+	for _, result := range keywords.Results {
+		if strings.EqualFold(result.Name, keyword) {
+			return result.ID, true, nil
+		}
+	}
+	return keywords.Results[0].ID, true, nil
+}
+
+// discover returns the movies of the TMDB discover endpoint matching values, the most popular first unless values sort
+// them otherwise.
+func (s *TMDBSource) discover(ctx context.Context, values url.Values) ([]Movie, error) {
+	if values.Get("sort_by") == "" {
+		values.Set("sort_by", "popularity.desc")
+	}
+	return s.movies(ctx, "/discover/movie", values)
+}
+
+// tmdbSorts are the values of the sort_by parameter of the TMDB discover endpoint for the SortBys.
+var tmdbSorts = map[SortBy]string{
+	SORT_BY_RELEVANCE: "popularity.desc",
+	SORT_BY_RATING:    "vote_average.desc",
+	SORT_BY_YEAR:      "primary_release_date.desc",
+}
+
+// SearchByTitle implements the MovieSource interface. it discovers the movies satisfying params.
+func (s *TMDBSource) SearchByTitle(ctx context.Context, params TitleSearchParams) ([]Movie, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	if len(params.Genres) > 0 {
+		ids := make([]string, len(params.Genres))
+		for i, genre := range params.Genres {
+			id, ok := tmdbGenreIDs[genre]
+			if !ok {
+				return nil, fmt.Errorf("genre %q is not supported by TMDB", genre)
+			}
+			ids[i] = strconv.Itoa(id)
+		}
+		values.Set("with_genres", strings.Join(ids, ","))
+	}
+	if params.MinYear != 0 {
+		values.Set("primary_release_date.gte", fmt.Sprintf("%04d-01-01", params.MinYear))
+	}
+	if params.MaxYear != 0 {
+		values.Set("primary_release_date.lte", fmt.Sprintf("%04d-12-31", params.MaxYear))
+	}
+	if params.MinRating > 0 {
+		values.Set("vote_average.gte", strconv.FormatFloat(params.MinRating, 'f', 1, 64))
+	}
+	if sort, ok := tmdbSorts[params.SortBy]; ok {
+		values.Set("sort_by", sort)
+	}
+
+	return s.discover(ctx, values)
+}
+
+// movies returns the movies listed by the TMDB endpoint at path, called with the query values.
+func (s *TMDBSource) movies(ctx context.Context, path string, values url.Values) ([]Movie, error) {
+	var response tmdbMovies
+	if err := s.get(ctx, path, values, &response); err != nil {
+		return nil, err
+	}
+
+	movies := make([]Movie, len(response.Results))
+	for i, result := range response.Results {
+		movies[i] = result.movie()
+	}
+	return movies, nil
+}
+
+// get calls the TMDB API at path with the query values and decodes its JSON response into v. the API key is kept out
+// of the returned errors.
+func (s *TMDBSource) get(ctx context.Context, path string, values url.Values, v interface{}) error {
+	values.Set("api_key", s.APIKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+path+"?"+values.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	client := s.Client
+	if client == nil {
+		client = httpClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			redacted := *urlErr
+			redacted.URL = strings.ReplaceAll(urlErr.URL, s.APIKey, "<api_key>")
+			return fmt.Errorf("%w: %v", ErrScrapeFailed, &redacted)
+		}
+		return fmt.Errorf("%w: %v", ErrScrapeFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var tmdbErr tmdbError
+		json.NewDecoder(resp.Body).Decode(&tmdbErr)
+		kind := ErrScrapeFailed
+		if resp.StatusCode == http.StatusTooManyRequests {
+			kind = ErrRateLimited
+		}
+		return fmt.Errorf("%w: tmdb %s failed with status code %d: %s", kind, path, resp.StatusCode, tmdbErr.StatusMessage)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: decoding the tmdb %s response: %v", ErrScrapeFailed, path, err)
+	}
+	return nil
+}
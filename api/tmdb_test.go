@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TMDB_TEST_API_KEY is the API key of the TMDBSource of the tests.
+const TMDB_TEST_API_KEY = "KEY"
+
+// newTMDBServer returns a TMDBSource calling a server which answers with handle the requests made with the API key
+// TMDB_TEST_API_KEY, and refuses the others the way TMDB does.
+func newTMDBServer(t *testing.T, handle http.HandlerFunc) *TMDBSource {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.URL.Query().Get("api_key"); key != TMDB_TEST_API_KEY {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"status_code":7,"status_message":"Invalid API key: You must be granted a valid key."}`))
+			return
+		}
+		handle(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	source := NewTMDBSource(TMDB_TEST_API_KEY)
+	source.BaseURL = server.URL
+	return source
+}
+
+func TestTMDBSourceSearch(t *testing.T) {
+	var discovered string
+	source := newTMDBServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search/keyword":
+			switch r.URL.Query().Get("query") {
+			case "dream":
+				w.Write([]byte(`{"page":1,"results":[{"id":9,"name":"dreams"},{"id":4344,"name":"Dream"}]}`))
+			case "heist":
+				w.Write([]byte(`{"page":1,"results":[{"id":10051,"name":"heist"}]}`))
+			default:
+				w.Write([]byte(`{"page":1,"results":[]}`))
+			}
+		case "/discover/movie":
+			discovered = r.URL.RawQuery
+			w.Write([]byte(`{"page":1,"results":[
+				{"id":27205,"title":"Inception","release_date":"2010-07-15","vote_average":8.4,"vote_count":35000,
+				 "poster_path":"/inception.jpg","genre_ids":[28,878,10770],"overview":"Cobb steals secrets."},
+				{"id":1,"title":"Unreleased","release_date":"","vote_average":0,"vote_count":0}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	movies, err := source.Search(context.Background(), []string{"dream", "heist"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	want := []Movie{
+		{
+			Title:     "Inception",
+			Year:      2010,
+			EndYear:   2010,
+			Rating:    8.4,
+			URL:       TMDB_MOVIE_BASE_URL + "27205",
+			PosterURL: TMDB_IMAGE_BASE_URL + "/inception.jpg",
+			Genres:    []string{"Action", "Sci-Fi"},
+			Plot:      "Cobb steals secrets.",
+			Kind:      KIND_MOVIE,
+		},
+		{Title: "Unreleased", URL: TMDB_MOVIE_BASE_URL + "1", Kind: KIND_MOVIE},
+	}
+	if !reflect.DeepEqual(movies, want) {
+		t.Errorf("Search() = %+v, want %+v", movies, want)
+	}
+	if !strings.Contains(discovered, "with_keywords=4344%2C10051") || !strings.Contains(discovered, "sort_by=popularity.desc") {
+		t.Errorf("discovered %q, want the movies of the keywords named exactly, the most popular first", discovered)
+	}
+
+	movies, err = source.Search(context.Background(), []string{"dream", "unknown"})
+	if err != nil || movies != nil {
+		t.Errorf("Search() of an unknown keyword = %v, %v, want no movies", movies, err)
+	}
+}
+
+func TestTMDBSourceErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		status int
+		want   error
+	}{
+		{"invalid key", "WRONG", 0, ErrScrapeFailed},
+		{"rate limited", TMDB_TEST_API_KEY, http.StatusTooManyRequests, ErrRateLimited},
+		{"server error", TMDB_TEST_API_KEY, http.StatusInternalServerError, ErrScrapeFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTMDBServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"status_message":"try again later"}`))
+			})
+			source.APIKey = tt.key
+
+			_, err := source.Search(context.Background(), []string{"dream"})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Search() error = %v, want %v", err, tt.want)
+			}
+			if err != nil && strings.Contains(err.Error(), tt.key) {
+				t.Errorf("Search() error = %v, want the API key kept out", err)
+			}
+		})
+	}
+
+	if _, err := NewTMDBSource(TMDB_TEST_API_KEY).Search(context.Background(), nil); !errors.Is(err, ErrInvalidKeywords) {
+		t.Errorf("Search() of no keywords error = %v, want %v", err, ErrInvalidKeywords)
+	}
+}
+
+func TestNewHandlerFromConfigTMDB(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Token = TEST_BOT_TOKEN
+	cfg.Source = MOVIE_SOURCE_TMDB
+
+	if _, err := NewHandlerFromConfig(cfg); err == nil {
+		t.Error("NewHandlerFromConfig() without a TMDB API key error = nil")
+	}
+
+	cfg.TMDBAPIKey = TMDB_TEST_API_KEY
+	bot, err := NewHandlerFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewHandlerFromConfig() error = %v", err)
+	}
+	if source, ok := bot.Source.(*TMDBSource); !ok || source.APIKey != TMDB_TEST_API_KEY {
+		t.Errorf("source = %#v, want a TMDBSource with the API key", bot.Source)
+	}
+}
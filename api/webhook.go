@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+)
+
+// secretTokenPattern matches the secret tokens Telegram accepts.
+var secretTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// SetWebhook registers webhookURL as the webhook Telegram posts the updates of the bot to. the URL must be https, as
+// Telegram requires. the SecretToken of the bot, if it has one, is registered too, so Telegram sends it with every
+// update. the description Telegram gives is returned if it refuses the webhook.
+func (b *Bot) SetWebhook(ctx context.Context, webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return errors.New("invalid webhook URL " + webhookURL + ". telegram only posts to https URLs")
+	}
+
+	values := url.Values{"url": {webhookURL}}
+	if b.SecretToken != "" {
+		if !secretTokenPattern.MatchString(b.SecretToken) {
+			return errors.New("invalid secret token. telegram only accepts 1 to 256 letters, digits, _ and -")
+		}
+		values.Set("secret_token", b.SecretToken)
+	}
+
+	_, err = b.callAPI(ctx, TELEGRAM_API_SET_WEBHOOK, values)
+	return err
+}
+
+// DeleteWebhook removes the webhook of the bot, e.g. to switch to polling.
+func (b *Bot) DeleteWebhook(ctx context.Context) error {
+	_, err := b.callAPI(ctx, TELEGRAM_API_DELETE_WEBHOOK, url.Values{})
+	return err
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSetWebhook(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	bot.SecretToken = "s3cr3t_token"
+
+	if err := bot.SetWebhook(context.Background(), "https://example.com/api"); err != nil {
+		t.Fatalf("SetWebhook() error = %v", err)
+	}
+
+	calls := telegram.CallsOf(TELEGRAM_API_SET_WEBHOOK)
+	if len(calls) != 1 || calls[0].Values.Get("url") != "https://example.com/api" || calls[0].Values.Get("secret_token") != "s3cr3t_token" {
+		t.Errorf("called %v, want the webhook registered with the secret token", calls)
+	}
+}
+
+func TestSetWebhookInvalid(t *testing.T) {
+	tests := []struct {
+		name, url, secretToken string
+	}{
+		{"http", "http://example.com/api", ""},
+		{"no host", "https:///api", ""},
+		{"unparsable", "https://exa mple.com/%zz", ""},
+		{"invalid secret token", "https://example.com/api", "not a token!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, telegram, _ := newTestBot(t, nil)
+			bot.SecretToken = tt.secretToken
+
+			if err := bot.SetWebhook(context.Background(), tt.url); err == nil {
+				t.Error("SetWebhook() error = nil")
+			}
+			if calls := telegram.Calls(); len(calls) != 0 {
+				t.Errorf("called %v, want nothing", calls)
+			}
+		})
+	}
+}
+
+func TestWebhookRefused(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+	telegram.Respond(func(telegramCall) (int, string) {
+		return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: bad webhook: An HTTPS URL must be provided for webhook"}`
+	})
+
+	if err := bot.SetWebhook(context.Background(), "https://example.com/api"); err == nil || !strings.Contains(err.Error(), "bad webhook") {
+		t.Errorf("SetWebhook() error = %v, want the description of telegram", err)
+	}
+
+	telegram.Respond(func(telegramCall) (int, string) {
+		return http.StatusOK, `{"ok":false,"description":"Webhook is already deleted"}`
+	})
+	if err := bot.DeleteWebhook(context.Background()); err == nil || !strings.Contains(err.Error(), "already deleted") {
+		t.Errorf("DeleteWebhook() error = %v, want the description of telegram", err)
+	}
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	bot, telegram, _ := newTestBot(t, nil)
+
+	if err := bot.DeleteWebhook(context.Background()); err != nil {
+		t.Fatalf("DeleteWebhook() error = %v", err)
+	}
+	if calls := telegram.CallsOf(TELEGRAM_API_DELETE_WEBHOOK); len(calls) != 1 {
+		t.Errorf("called deleteWebhook %d times, want once", len(calls))
+	}
+}
@@ -0,0 +1,94 @@
+// Command gmtm-cli recommends movies from the terminal, the way the bot does in Telegram. the keywords are given as
+// the arguments, comma delimited:
+//
+//	gmtm-cli -sort rating -limit 5 time travel, dystopia
+//
+// it needs no Telegram token.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	handler "github.com/MehdiEidi/gmtm/api"
+)
+
+// source finds the movies. nil searches IMDB, like handler.SearchMovies does.
+var source handler.MovieSource
+
+// fields are the fields of the movies printed. the terminal has room for more of them than the bot's DEFAULT_FIELDS.
+const fields = handler.FIELD_TITLE | handler.FIELD_YEAR | handler.FIELD_RATING | handler.FIELD_LINK
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run searches the movies as args say, prints them to stdout and returns the exit code of the command. the usage and
+// the errors are printed to stderr.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gmtm-cli", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: gmtm-cli [flags] <keywords>")
+		flags.PrintDefaults()
+	}
+
+	minRating := flags.Float64("min-rating", 0, "drop the movies rated below it")
+	sortBy := flags.String("sort", string(handler.SORT_BY_RELEVANCE), "order of the movies: relevance, rating or year")
+	kind := flags.String("type", "", "only the titles of this type, e.g. movie or series, empty prints them all")
+	limit := flags.Int("limit", 0, "print at most this many movies, 0 prints them all")
+	keepDuplicates := flags.Bool("keep-duplicates", false, "print the movies listed more than once as many times")
+	version := flags.Bool("version", false, "print the version and exit")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *version {
+		fmt.Fprintln(stdout, "gmtm-cli", handler.Version)
+		return 0
+	}
+
+	keywords := handler.ParseKeywords(strings.Join(flags.Args(), " "))
+	if len(keywords) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var kinds []handler.Kind
+	if *kind != "" {
+		kinds = []handler.Kind{handler.Kind(strings.ToLower(*kind))}
+	}
+
+	movies, err := handler.SearchMovies(ctx, keywords, handler.SearchOptions{
+		Source:         source,
+		MinRating:      *minRating,
+		SortBy:         handler.SortBy(*sortBy),
+		MaxResults:     *limit,
+		Kinds:          kinds,
+		KeepDuplicates: *keepDuplicates,
+	})
+	switch {
+	case errors.Is(err, handler.ErrNoResults):
+		fmt.Fprintln(stderr, "no movies found for those keywords")
+		return 0
+	case errors.Is(err, handler.ErrInvalidKeywords):
+		fmt.Fprintln(stderr, "gmtm-cli:", err)
+		return 2
+	case err != nil:
+		fmt.Fprintln(stderr, "gmtm-cli:", err)
+		return 1
+	}
+
+	fmt.Fprint(stdout, handler.FormatMovieFields(movies, handler.PARSE_MODE_NONE, fields))
+	return 0
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	handler "github.com/MehdiEidi/gmtm/api"
+)
+
+// useFixture makes run search a server serving the fixture of the handler package for every search.
+func useFixture(t *testing.T, fixture string) {
+	page, err := os.ReadFile(filepath.Join("..", "..", "api", "testdata", fixture))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	}))
+	t.Cleanup(server.Close)
+
+	scraper := handler.NewScraper()
+	scraper.BaseURL = server.URL
+	scraper.IgnoreRobotsTxt = true
+	scraper.MaxAttempts = 1
+	source = scraper
+	t.Cleanup(func() { source = nil })
+}
+
+func TestRun(t *testing.T) {
+	useFixture(t, "search.html")
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"all", []string{"dream,", "heist"}, []string{"1. Inception (2010) (8.8)", "2. Bad Movie (2015–2018) (4.1)", "3. Unrated"}},
+		{"rated", []string{"-min-rating", "5", "dream"}, []string{"1. Inception (2010) (8.8)"}},
+		{"limited and sorted", []string{"-sort", "year", "-limit", "2", "dream"}, []string{"1. Bad Movie (2015–2018) (4.1)", "2. Inception (2010) (8.8)"}},
+		{"series only", []string{"-type", "Series", "dream"}, []string{"1. Bad Movie (2015–2018) (4.1)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(context.Background(), tt.args, &stdout, &stderr); code != 0 {
+				t.Fatalf("run() = %d, stderr %q, want 0", code, stderr.String())
+			}
+
+			lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("printed %q, want %q", lines, tt.want)
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("printed %q, want it to start with %q", lines[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	useFixture(t, "empty.html")
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{"no keywords", nil, 2, "usage: gmtm-cli"},
+		{"only commas", []string{",,"}, 2, "usage: gmtm-cli"},
+		{"unknown flag", []string{"-colour", "dream"}, 2, "flag provided but not defined"},
+		{"unknown sort", []string{"-sort", "length", "dream"}, 1, `unknown sort "length"`},
+		{"no results", []string{"dream"}, 0, "no movies found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(context.Background(), tt.args, &stdout, &stderr); code != tt.code {
+				t.Errorf("run() = %d, want %d", code, tt.code)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.stderr)
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("stdout = %q, want nothing", stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunVersion(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), []string{"-version"}, &stdout, &stderr); code != 0 || stdout.String() != "gmtm-cli "+handler.Version+"\n" {
+		t.Errorf("run() = %d, stdout %q, want the version", code, stdout.String())
+	}
+}
@@ -2,7 +2,10 @@ module github.com/MehdiEidi/gmtm
 
 go 1.17
 
-require github.com/gocolly/colly v1.2.0
+require (
+	github.com/gocolly/colly v1.2.0
+	golang.org/x/sync v0.1.0
+)
 
 require (
 	github.com/PuerkitoBio/goquery v1.8.0 // indirect